@@ -61,6 +61,20 @@ const (
 	ErrAskNotFound = 40
 	// ErrInvalidSealProof signals that the passed in seal proof was invalid.
 	ErrInvalidSealProof = 41
+	// ErrPoStTooLate signals that the PoSt was submitted after the grace period.
+	ErrPoStTooLate = 42
+	// ErrInvalidFault signals that a declared fault is not a committed sector.
+	ErrInvalidFault = 43
+	// ErrNotInStorageFault signals that the miner cannot be slashed.
+	ErrNotInStorageFault = 44
+	// ErrInsufficientCollateral signals that the collateral does not cover the pledge.
+	ErrInsufficientCollateral = 45
+	// ErrDealsActive signals that deals committed to the miner's sectors have not expired.
+	ErrDealsActive = 46
+	// ErrSectorNotProven indicates a sector is not committed or the miner is late proving it.
+	ErrSectorNotProven = 47
+	// ErrInStorageFault signals that the miner missed its PoSt and can be slashed.
+	ErrInStorageFault = 48
 )
 
 // Errors map error codes to revert errors this actor may return.
@@ -74,6 +88,13 @@ var Errors = map[uint8]error{
 	ErrInvalidPoSt:             errors.NewCodedRevertErrorf(ErrInvalidPoSt, "PoSt proof did not validate"),
 	ErrAskNotFound:             errors.NewCodedRevertErrorf(ErrAskNotFound, "no ask was found"),
 	ErrInvalidSealProof:        errors.NewCodedRevertErrorf(ErrInvalidSealProof, "seal proof was invalid"),
+	ErrPoStTooLate:             errors.NewCodedRevertErrorf(ErrPoStTooLate, "PoSt submitted after the grace period"),
+	ErrInvalidFault:            errors.NewCodedRevertErrorf(ErrInvalidFault, "faulty sector is not committed"),
+	ErrNotInStorageFault:       errors.NewCodedRevertErrorf(ErrNotInStorageFault, "miner is not in storage fault"),
+	ErrInsufficientCollateral:  errors.NewCodedRevertErrorf(ErrInsufficientCollateral, "not enough collateral for pledge"),
+	ErrDealsActive:             errors.NewCodedRevertErrorf(ErrDealsActive, "miner still has deals that have not expired"),
+	ErrSectorNotProven:         errors.NewCodedRevertErrorf(ErrSectorNotProven, "sector is not committed and proven"),
+	ErrInStorageFault:          errors.NewCodedRevertErrorf(ErrInStorageFault, "miner is in storage fault"),
 }
 
 // Actor is the miner actor.
@@ -99,8 +120,18 @@ type Ask struct {
 
 // State is the miner actors storage.
 type State struct {
+	// Owner is the address that controls the miner's funds and may change its
+	// worker and owner.
 	Owner address.Address
 
+	// Worker is the address the miner uses for day to day operation, such as
+	// committing sectors and submitting PoSts. It defaults to the owner.
+	Worker address.Address
+
+	// ProposedOwner is the address the owner proposed to transfer the miner
+	// to. It becomes the owner once it accepts.
+	ProposedOwner address.Address
+
 	// PeerID references the libp2p identity that the miner is operating.
 	PeerID peer.ID
 
@@ -130,7 +161,22 @@ type State struct {
 	ProvingPeriodStart *types.BlockHeight
 	LastPoSt           *types.BlockHeight
 
+	// SlashedAt is the block height at which the miner was last slashed for
+	// failing to submit a PoSt.
+	SlashedAt *types.BlockHeight
+
 	Power *big.Int
+
+	// DealsExpireAt is the block height at which the last of the deals
+	// committed to the miner's sectors expires. It is nil if no deal has been
+	// committed.
+	DealsExpireAt *types.BlockHeight
+}
+
+// isOperator returns true if addr may operate the miner, that is if it is
+// either the owner or the worker.
+func (state *State) isOperator(addr address.Address) bool {
+	return addr == state.Owner || addr == state.Worker
 }
 
 // NewActor returns a new miner actor
@@ -142,6 +188,7 @@ func NewActor() *actor.Actor {
 func NewState(owner address.Address, key []byte, pledge *big.Int, pid peer.ID, collateral *types.AttoFIL) *State {
 	return &State{
 		Owner:             owner,
+		Worker:            owner,
 		PeerID:            pid,
 		PublicKey:         key,
 		PledgeSectors:     pledge,
@@ -197,14 +244,34 @@ var minerExports = exec.Exports{
 		Params: nil,
 		Return: []abi.Type{abi.Address},
 	},
+	"getWorker": &exec.FunctionSignature{
+		Params: nil,
+		Return: []abi.Type{abi.Address},
+	},
+	"changeWorker": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address},
+		Return: []abi.Type{},
+	},
+	"proposeOwner": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address},
+		Return: []abi.Type{},
+	},
+	"acceptOwner": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: []abi.Type{},
+	},
 	"getLastUsedSectorID": &exec.FunctionSignature{
 		Params: nil,
 		Return: []abi.Type{abi.SectorID},
 	},
 	"commitSector": &exec.FunctionSignature{
-		Params: []abi.Type{abi.SectorID, abi.Bytes, abi.Bytes, abi.Bytes, abi.Bytes},
+		Params: []abi.Type{abi.SectorID, abi.Bytes, abi.Bytes, abi.Bytes, abi.Bytes, abi.UintArray},
 		Return: []abi.Type{},
 	},
+	"publishDeals": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Bytes},
+		Return: []abi.Type{abi.UintArray},
+	},
 	"getKey": &exec.FunctionSignature{
 		Params: []abi.Type{},
 		Return: []abi.Type{abi.Bytes},
@@ -225,8 +292,32 @@ var minerExports = exec.Exports{
 		Params: []abi.Type{},
 		Return: []abi.Type{abi.Integer},
 	},
+	"getCollateral": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: []abi.Type{abi.AttoFIL},
+	},
+	"addCollateral": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: []abi.Type{},
+	},
+	"withdrawCollateral": &exec.FunctionSignature{
+		Params: []abi.Type{abi.AttoFIL},
+		Return: []abi.Type{},
+	},
+	"setPledge": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Integer},
+		Return: []abi.Type{},
+	},
+	"exit": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: []abi.Type{},
+	},
 	"submitPoSt": &exec.FunctionSignature{
-		Params: []abi.Type{abi.Bytes},
+		Params: []abi.Type{abi.Bytes, abi.UintArray},
+		Return: []abi.Type{},
+	},
+	"slashStorageFault": &exec.FunctionSignature{
+		Params: []abi.Type{},
 		Return: []abi.Type{},
 	},
 	"getProvingPeriodStart": &exec.FunctionSignature{
@@ -237,6 +328,10 @@ var minerExports = exec.Exports{
 		Params: nil,
 		Return: []abi.Type{abi.CommitmentsMap},
 	},
+	"verifySectorProven": &exec.FunctionSignature{
+		Params: []abi.Type{abi.SectorID},
+		Return: []abi.Type{},
+	},
 }
 
 // Exports returns the miner actors exported functions.
@@ -253,7 +348,7 @@ func (ma *Actor) AddAsk(ctx exec.VMContext, price *types.AttoFIL, expiry *big.In
 
 	var state State
 	out, err := actor.WithState(ctx, &state, func() (interface{}, error) {
-		if ctx.Message().From != state.Owner {
+		if !state.isOperator(ctx.Message().From) {
 			return nil, Errors[ErrCallerUnauthorized]
 		}
 
@@ -385,6 +480,101 @@ func (ma *Actor) GetOwner(ctx exec.VMContext) (address.Address, uint8, error) {
 	return a, 0, nil
 }
 
+// GetWorker returns the miner's worker.
+func (ma *Actor) GetWorker(ctx exec.VMContext) (address.Address, uint8, error) {
+	if err := ctx.Charge(100); err != nil {
+		return address.Address{}, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	out, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		return state.Worker, nil
+	})
+	if err != nil {
+		return address.Address{}, errors.CodeError(err), err
+	}
+
+	a, ok := out.(address.Address)
+	if !ok {
+		return address.Address{}, 1, errors.NewFaultErrorf("expected an Address return value from call, but got %T instead", out)
+	}
+
+	return a, 0, nil
+}
+
+// ChangeWorker replaces the miner's worker. Only the owner may change it.
+func (ma *Actor) ChangeWorker(ctx exec.VMContext, worker address.Address) (uint8, error) {
+	if err := ctx.Charge(100); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if ctx.Message().From != state.Owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		state.Worker = worker
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// ProposeOwner starts the transfer of the miner to a new owner, which
+// completes once the new owner calls AcceptOwner. Proposing another owner
+// replaces any pending proposal.
+func (ma *Actor) ProposeOwner(ctx exec.VMContext, owner address.Address) (uint8, error) {
+	if err := ctx.Charge(100); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if ctx.Message().From != state.Owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		state.ProposedOwner = owner
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// AcceptOwner completes the transfer of the miner to the owner proposed with
+// ProposeOwner. It must be called by the proposed owner.
+func (ma *Actor) AcceptOwner(ctx exec.VMContext) (uint8, error) {
+	if err := ctx.Charge(100); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if state.ProposedOwner.Empty() || ctx.Message().From != state.ProposedOwner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		state.Owner = state.ProposedOwner
+		state.ProposedOwner = address.Address{}
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
 // GetLastUsedSectorID returns the last used sector id.
 func (ma *Actor) GetLastUsedSectorID(ctx exec.VMContext) (uint64, uint8, error) {
 	if err := ctx.Charge(100); err != nil {
@@ -429,8 +619,9 @@ func (ma *Actor) GetSectorCommitments(ctx exec.VMContext) (map[string]types.Comm
 }
 
 // CommitSector adds a commitment to the specified sector. The sector must not
-// already be committed.
-func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR, commRStar, proof []byte) (uint8, error) {
+// already be committed. The published deals with ids dealIDs are recorded as
+// stored in the sector by the storage market.
+func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR, commRStar, proof []byte, dealIDs []uint64) (uint8, error) {
 	if err := ctx.Charge(100); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
@@ -482,7 +673,7 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 	var state State
 	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
 		// verify that the caller is authorized to perform update
-		if ctx.Message().From != state.Owner {
+		if !state.isOperator(ctx.Message().From) {
 			return nil, Errors[ErrCallerUnauthorized]
 		}
 
@@ -513,6 +704,22 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 		if ret != 0 {
 			return nil, Errors[ErrStoragemarketCallFailed]
 		}
+
+		if len(dealIDs) > 0 {
+			rets, ret, err := ctx.Send(address.StorageMarketAddress, "commitDeals", nil, []interface{}{sectorID, dealIDs})
+			if err != nil {
+				return nil, err
+			}
+			if ret != 0 {
+				return nil, Errors[ErrStoragemarketCallFailed]
+			}
+
+			expiry := types.NewBlockHeightFromBytes(rets[0])
+			if state.DealsExpireAt == nil || expiry.GreaterThan(state.DealsExpireAt) {
+				state.DealsExpireAt = expiry
+			}
+		}
+
 		return nil, nil
 	})
 	if err != nil {
@@ -522,6 +729,46 @@ func (ma *Actor) CommitSector(ctx exec.VMContext, sectorID uint64, commD, commR,
 	return 0, nil
 }
 
+// PublishDeals publishes deals the miner agreed to with its clients to the
+// storage market. deals is the cbor encoding of a []storagemarket.Deal. It
+// returns the ids the storage market assigned to the deals.
+func (ma *Actor) PublishDeals(ctx exec.VMContext, deals []byte) ([]uint64, uint8, error) {
+	if err := ctx.Charge(100); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if !state.isOperator(ctx.Message().From) {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	rets, ret, err := ctx.Send(address.StorageMarketAddress, "publishDeals", nil, []interface{}{deals})
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+	if ret != 0 {
+		return nil, ErrStoragemarketCallFailed, Errors[ErrStoragemarketCallFailed]
+	}
+
+	idsVal, err := abi.Deserialize(rets[0], abi.UintArray)
+	if err != nil {
+		return nil, 1, errors.FaultErrorWrap(err, "could not deserialize deal ids")
+	}
+
+	ids, ok := idsVal.Val.([]uint64)
+	if !ok {
+		return nil, 1, errors.NewFaultErrorf("expected []uint64 to be returned, but got %T instead", idsVal.Val)
+	}
+
+	return ids, 0, nil
+}
+
 // GetKey returns the public key for this miner.
 func (ma *Actor) GetKey(ctx exec.VMContext) ([]byte, uint8, error) {
 	if err := ctx.Charge(100); err != nil {
@@ -573,7 +820,7 @@ func (ma *Actor) UpdatePeerID(ctx exec.VMContext, pid peer.ID) (uint8, error) {
 	var storage State
 	_, err := actor.WithState(ctx, &storage, func() (interface{}, error) {
 		// verify that the caller is authorized to perform update
-		if ctx.Message().From != storage.Owner {
+		if !storage.isOperator(ctx.Message().From) {
 			return nil, Errors[ErrCallerUnauthorized]
 		}
 
@@ -632,9 +879,258 @@ func (ma *Actor) GetPower(ctx exec.VMContext) (*big.Int, uint8, error) {
 	return power, 0, nil
 }
 
+// GetCollateral returns the amount of filecoin held as collateral for the miner's pledge.
+func (ma *Actor) GetCollateral(ctx exec.VMContext) (*types.AttoFIL, uint8, error) {
+	if err := ctx.Charge(100); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	ret, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		return state.Collateral, nil
+	})
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	collateral, ok := ret.(*types.AttoFIL)
+	if !ok {
+		return nil, 1, errors.NewFaultErrorf("expected *types.AttoFIL to be returned, but got %T instead", ret)
+	}
+
+	return collateral, 0, nil
+}
+
+// AddCollateral adds the value of the message to the miner's collateral.
+func (ma *Actor) AddCollateral(ctx exec.VMContext) (uint8, error) {
+	if err := ctx.Charge(100); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if !state.isOperator(ctx.Message().From) {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		state.Collateral = state.Collateral.Add(ctx.Message().Value)
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// WithdrawCollateral sends amount of the miner's collateral to its owner. The
+// collateral remaining must still cover the miner's pledge, so collateral
+// backing committed sectors can never be withdrawn.
+func (ma *Actor) WithdrawCollateral(ctx exec.VMContext, amount *types.AttoFIL) (uint8, error) {
+	if err := ctx.Charge(100); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	if !amount.IsPositive() {
+		return 1, errors.NewRevertError("amount must be positive")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if ctx.Message().From != state.Owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		if amount.GreaterThan(state.Collateral) {
+			return nil, Errors[ErrInsufficientCollateral]
+		}
+
+		remaining := state.Collateral.Sub(amount)
+		minCollateral, err := minimumCollateral(ctx, state.PledgeSectors)
+		if err != nil {
+			return nil, err
+		}
+		if remaining.LessThan(minCollateral) {
+			return nil, Errors[ErrInsufficientCollateral]
+		}
+
+		_, ret, err := ctx.Send(state.Owner, "", amount, nil)
+		if err != nil {
+			return nil, err
+		}
+		if ret != 0 {
+			return nil, errors.NewRevertError("failed to send collateral to owner")
+		}
+
+		state.Collateral = remaining
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// SetPledge changes the number of sectors the miner pledges to store. The
+// pledge can not be lower than the storage market's minimum or the number of
+// sectors already committed, and the miner's collateral must cover it.
+func (ma *Actor) SetPledge(ctx exec.VMContext, pledge *big.Int) (uint8, error) {
+	if err := ctx.Charge(100); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if !state.isOperator(ctx.Message().From) {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		if pledge.Cmp(state.Power) < 0 {
+			return nil, Errors[ErrInsufficientPledge]
+		}
+
+		minPledge, err := minimumPledge(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if pledge.Cmp(minPledge) < 0 {
+			return nil, Errors[ErrInsufficientPledge]
+		}
+
+		minCollateral, err := minimumCollateral(ctx, pledge)
+		if err != nil {
+			return nil, err
+		}
+		if state.Collateral.LessThan(minCollateral) {
+			return nil, Errors[ErrInsufficientCollateral]
+		}
+
+		state.PledgeSectors = pledge
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// Exit returns all of the miner's collateral to its owner, drops its pledge,
+// asks and sectors, and deregisters it from the storage market. A miner can
+// only exit once every deal committed to its sectors has expired. A miner that
+// is late submitting its PoSt pays the late fee before exiting, and one past
+// the grace period can not exit, so that it can still be slashed.
+func (ma *Actor) Exit(ctx exec.VMContext) (uint8, error) {
+	if err := ctx.Charge(100); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if ctx.Message().From != state.Owner {
+			return nil, Errors[ErrCallerUnauthorized]
+		}
+
+		if state.DealsExpireAt != nil && ctx.BlockHeight().LessThan(state.DealsExpireAt) {
+			return nil, Errors[ErrDealsActive]
+		}
+
+		if state.Power.Sign() > 0 && state.ProvingPeriodStart != nil {
+			provingPeriodEnd := state.ProvingPeriodStart.Add(ProvingPeriodBlocks)
+			gracePeriodEnd := provingPeriodEnd.Add(GracePeriodBlocks)
+			if ctx.BlockHeight().GreaterThan(gracePeriodEnd) {
+				return nil, Errors[ErrInStorageFault]
+			}
+
+			if ctx.BlockHeight().GreaterThan(provingPeriodEnd) {
+				fee := LatePoStFee(state.Collateral, ctx.BlockHeight().Sub(provingPeriodEnd))
+				if err := burnCollateral(ctx, &state, fee); err != nil {
+					return nil, err
+				}
+			}
+
+			_, ret, err := ctx.Send(address.StorageMarketAddress, "updatePower", nil, []interface{}{big.NewInt(0).Neg(state.Power)})
+			if err != nil {
+				return nil, err
+			}
+			if ret != 0 {
+				return nil, Errors[ErrStoragemarketCallFailed]
+			}
+		}
+
+		_, ret, err := ctx.Send(address.StorageMarketAddress, "removeMiner", nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if ret != 0 {
+			return nil, Errors[ErrStoragemarketCallFailed]
+		}
+
+		if state.Collateral.IsPositive() {
+			_, ret, err := ctx.Send(state.Owner, "", state.Collateral, nil)
+			if err != nil {
+				return nil, err
+			}
+			if ret != 0 {
+				return nil, errors.NewRevertError("failed to send collateral to owner")
+			}
+		}
+
+		state.Collateral = types.NewZeroAttoFIL()
+		state.PledgeSectors = big.NewInt(0)
+		state.Asks = nil
+		state.SectorCommitments = make(map[string]types.Commitments)
+		state.Power = big.NewInt(0)
+		state.ProvingPeriodStart = nil
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// minimumPledge asks the storage market for the minimum number of sectors a
+// miner must pledge.
+func minimumPledge(ctx exec.VMContext) (*big.Int, error) {
+	ret, code, err := ctx.Send(address.StorageMarketAddress, "getMinimumPledge", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if code != 0 {
+		return nil, Errors[ErrStoragemarketCallFailed]
+	}
+
+	return big.NewInt(0).SetBytes(ret[0]), nil
+}
+
+// minimumCollateral asks the storage market for the collateral required to
+// pledge the given number of sectors.
+func minimumCollateral(ctx exec.VMContext, pledge *big.Int) (*types.AttoFIL, error) {
+	ret, code, err := ctx.Send(address.StorageMarketAddress, "getMinimumCollateral", nil, []interface{}{pledge})
+	if err != nil {
+		return nil, err
+	}
+	if code != 0 {
+		return nil, Errors[ErrStoragemarketCallFailed]
+	}
+
+	return types.NewAttoFILFromBytes(ret[0]), nil
+}
+
 // SubmitPoSt is used to submit a coalesced PoST to the chain to convince the chain
-// that you have been actually storing the files you claim to be.
-func (ma *Actor) SubmitPoSt(ctx exec.VMContext, proof []byte) (uint8, error) {
+// that you have been actually storing the files you claim to be. Sectors the
+// miner could not prove are declared in faults; they are removed from the
+// miner's commitments and no longer count towards its power. A PoSt submitted
+// within GracePeriodBlocks after the end of the proving period is accepted, but
+// a fee is charged from the miner's collateral.
+func (ma *Actor) SubmitPoSt(ctx exec.VMContext, proof []byte, faults []uint64) (uint8, error) {
 	if err := ctx.Charge(100); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
@@ -646,10 +1142,27 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, proof []byte) (uint8, error) {
 	var state State
 	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
 		// verify that the caller is authorized to perform update
-		if ctx.Message().From != state.Owner {
+		if !state.isOperator(ctx.Message().From) {
 			return nil, Errors[ErrCallerUnauthorized]
 		}
 
+		if state.ProvingPeriodStart == nil {
+			return nil, errors.NewRevertError("no sectors have been committed")
+		}
+
+		// Check if we submitted it in time
+		provingPeriodEnd := state.ProvingPeriodStart.Add(ProvingPeriodBlocks)
+		gracePeriodEnd := provingPeriodEnd.Add(GracePeriodBlocks)
+		if ctx.BlockHeight().GreaterThan(gracePeriodEnd) {
+			return nil, Errors[ErrPoStTooLate]
+		}
+
+		for _, sectorID := range faults {
+			if _, ok := state.SectorCommitments[strconv.FormatUint(sectorID, 10)]; !ok {
+				return nil, Errors[ErrInvalidFault]
+			}
+		}
+
 		// reach in to actor storage to grab comm-r for each committed sector
 		var commRs []proofs.CommR
 		for _, v := range state.SectorCommitments {
@@ -664,7 +1177,7 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, proof []byte) (uint8, error) {
 		req := proofs.VerifyPoSTRequest{
 			ChallengeSeed: proofs.PoStChallengeSeed{},
 			CommRs:        commRs,
-			Faults:        []uint64{},
+			Faults:        faults,
 			Proof:         postProof,
 		}
 
@@ -676,17 +1189,68 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, proof []byte) (uint8, error) {
 			return nil, Errors[ErrInvalidPoSt]
 		}
 
-		// Check if we submitted it in time
-		provingPeriodEnd := state.ProvingPeriodStart.Add(ProvingPeriodBlocks)
+		if ctx.BlockHeight().GreaterThan(provingPeriodEnd) {
+			fee := LatePoStFee(state.Collateral, ctx.BlockHeight().Sub(provingPeriodEnd))
+			if err := burnCollateral(ctx, &state, fee); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := removeFaultySectors(ctx, &state, faults); err != nil {
+			return nil, err
+		}
+
+		state.ProvingPeriodStart = provingPeriodEnd
+		state.LastPoSt = ctx.BlockHeight()
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
 
-		if ctx.BlockHeight().LessEqual(provingPeriodEnd) {
-			state.ProvingPeriodStart = provingPeriodEnd
-			state.LastPoSt = ctx.BlockHeight()
-		} else {
-			// Not great.
-			// TODO: charge penalty
-			return nil, errors.NewRevertErrorf("submitted PoSt late, need to pay a fee")
+	return 0, nil
+}
+
+// SlashStorageFault is called by the storage market to penalize a miner that
+// has not submitted a PoSt by the end of the grace period. All of the miner's
+// collateral is burnt and its sectors no longer count towards its power.
+func (ma *Actor) SlashStorageFault(ctx exec.VMContext) (uint8, error) {
+	if err := ctx.Charge(100); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	if ctx.Message().From != address.StorageMarketAddress {
+		return ErrCallerUnauthorized, Errors[ErrCallerUnauthorized]
+	}
+
+	var state State
+	_, err := actor.WithState(ctx, &state, func() (interface{}, error) {
+		if state.Power.Sign() == 0 {
+			return nil, Errors[ErrNotInStorageFault]
+		}
+
+		gracePeriodEnd := state.ProvingPeriodStart.Add(ProvingPeriodBlocks).Add(GracePeriodBlocks)
+		if ctx.BlockHeight().LessEqual(gracePeriodEnd) {
+			return nil, Errors[ErrNotInStorageFault]
+		}
+
+		if err := burnCollateral(ctx, &state, state.Collateral); err != nil {
+			return nil, err
+		}
+
+		delta := big.NewInt(0).Neg(state.Power)
+		_, ret, err := ctx.Send(address.StorageMarketAddress, "updatePower", nil, []interface{}{delta})
+		if err != nil {
+			return nil, err
 		}
+		if ret != 0 {
+			return nil, Errors[ErrStoragemarketCallFailed]
+		}
+
+		state.Power = big.NewInt(0)
+		state.SectorCommitments = make(map[string]types.Commitments)
+		state.SlashedAt = ctx.BlockHeight()
 
 		return nil, nil
 	})
@@ -697,6 +1261,67 @@ func (ma *Actor) SubmitPoSt(ctx exec.VMContext, proof []byte) (uint8, error) {
 	return 0, nil
 }
 
+// LatePoStFee calculates the fee charged from a miner's collateral for a PoSt
+// submitted lateBy blocks after the end of its proving period. The fee grows
+// linearly to the whole collateral at the end of the grace period.
+func LatePoStFee(collateral *types.AttoFIL, lateBy *types.BlockHeight) *types.AttoFIL {
+	if lateBy.GreaterEqual(GracePeriodBlocks) {
+		return collateral
+	}
+
+	return collateral.MulBigInt(lateBy.AsBigInt()).DivBigInt(GracePeriodBlocks.AsBigInt())
+}
+
+// burnCollateral removes amount from the miner's collateral and sends it to
+// the network.
+func burnCollateral(ctx exec.VMContext, state *State, amount *types.AttoFIL) error {
+	if amount.GreaterThan(state.Collateral) {
+		amount = state.Collateral
+	}
+	if amount.IsZero() {
+		return nil
+	}
+
+	_, ret, err := ctx.Send(address.NetworkAddress, "", amount, nil)
+	if err != nil {
+		return err
+	}
+	if ret != 0 {
+		return errors.NewRevertError("failed to burn collateral")
+	}
+
+	state.Collateral = state.Collateral.Sub(amount)
+	return nil
+}
+
+// removeFaultySectors drops the given sectors from the miner's commitments and
+// removes their power from the storage market.
+func removeFaultySectors(ctx exec.VMContext, state *State, faults []uint64) error {
+	removed := int64(0)
+	for _, sectorID := range faults {
+		sectorIDstr := strconv.FormatUint(sectorID, 10)
+		if _, ok := state.SectorCommitments[sectorIDstr]; ok {
+			delete(state.SectorCommitments, sectorIDstr)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return nil
+	}
+
+	delta := big.NewInt(-removed)
+	_, ret, err := ctx.Send(address.StorageMarketAddress, "updatePower", nil, []interface{}{delta})
+	if err != nil {
+		return err
+	}
+	if ret != 0 {
+		return Errors[ErrStoragemarketCallFailed]
+	}
+
+	state.Power = state.Power.Add(state.Power, delta)
+	return nil
+}
+
 // GetProvingPeriodStart returns the current ProvingPeriodStart value.
 func (ma *Actor) GetProvingPeriodStart(ctx exec.VMContext) (*types.BlockHeight, uint8, error) {
 	if err := ctx.Charge(100); err != nil {
@@ -715,3 +1340,34 @@ func (ma *Actor) GetProvingPeriodStart(ctx exec.VMContext) (*types.BlockHeight,
 
 	return state.ProvingPeriodStart, 0, nil
 }
+
+// VerifySectorProven succeeds if the sector is committed and the miner is not
+// late submitting the PoSt covering it. It is intended to be used as the
+// condition of payment vouchers that should only be redeemable while the
+// data they pay for is being stored.
+func (ma *Actor) VerifySectorProven(ctx exec.VMContext, sectorID uint64) (uint8, error) {
+	if err := ctx.Charge(100); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	chunk, err := ctx.ReadStorage()
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	var state State
+	if err := actor.UnmarshalStorage(chunk, &state); err != nil {
+		return errors.CodeError(err), err
+	}
+
+	if _, ok := state.SectorCommitments[strconv.FormatUint(sectorID, 10)]; !ok {
+		return ErrSectorNotProven, Errors[ErrSectorNotProven]
+	}
+
+	gracePeriodEnd := state.ProvingPeriodStart.Add(ProvingPeriodBlocks).Add(GracePeriodBlocks)
+	if ctx.BlockHeight().GreaterThan(gracePeriodEnd) {
+		return ErrSectorNotProven, Errors[ErrSectorNotProven]
+	}
+
+	return 0, nil
+}
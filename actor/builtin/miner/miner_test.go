@@ -6,10 +6,12 @@ import (
 	"testing"
 
 	peer "gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	. "github.com/filecoin-project/go-filecoin/actor/builtin/miner"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/core"
@@ -286,7 +288,7 @@ func TestMinerCommitSector(t *testing.T) {
 	commRStar := th.MakeCommitment()
 	commD := th.MakeCommitment()
 
-	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), commD, commR, commRStar, th.MakeRandomBytes(int(proofs.SealBytesLen)))
+	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), commD, commR, commRStar, th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
 	require.NoError(err)
 	require.NoError(res.ExecutionError)
 	require.Equal(uint8(0), res.Receipt.ExitCode)
@@ -299,7 +301,7 @@ func TestMinerCommitSector(t *testing.T) {
 	require.Equal(types.NewBlockHeight(3), types.NewBlockHeightFromBytes(res.Receipt.Return[0]))
 
 	// fail because commR already exists
-	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "commitSector", uint64(1), commD, commR, commRStar, th.MakeRandomBytes(int(proofs.SealBytesLen)))
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "commitSector", uint64(1), commD, commR, commRStar, th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
 	require.NoError(err)
 	require.EqualError(res.ExecutionError, "sector already committed")
 	require.Equal(uint8(0x23), res.Receipt.ExitCode)
@@ -314,20 +316,20 @@ func TestMinerSubmitPoSt(t *testing.T) {
 	minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), origPid)
 
 	// add a sector
-	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)))
+	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
 	require.NoError(err)
 	require.NoError(res.ExecutionError)
 	require.Equal(uint8(0), res.Receipt.ExitCode)
 
 	// add another sector
-	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "commitSector", uint64(2), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)))
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "commitSector", uint64(2), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
 	require.NoError(err)
 	require.NoError(res.ExecutionError)
 	require.Equal(uint8(0), res.Receipt.ExitCode)
 
 	// submit post
 	proof := th.MakeRandomPoSTProofForTest()
-	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 8, "submitPoSt", proof[:])
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 8, "submitPoSt", proof[:], []uint64{})
 	require.NoError(err)
 	require.NoError(res.ExecutionError)
 	require.Equal(uint8(0), res.Receipt.ExitCode)
@@ -338,9 +340,381 @@ func TestMinerSubmitPoSt(t *testing.T) {
 	require.NoError(res.ExecutionError)
 	require.Equal(types.NewBlockHeightFromBytes(res.Receipt.Return[0]), types.NewBlockHeight(20003))
 
-	// fail to submit inside the proving period
+	// submit late, inside the grace period
 	proof = th.MakeRandomPoSTProofForTest()
-	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 40008, "submitPoSt", proof[:])
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 40053, "submitPoSt", proof[:], []uint64{})
 	require.NoError(err)
-	require.EqualError(res.ExecutionError, "submitted PoSt late, need to pay a fee")
+	require.NoError(res.ExecutionError)
+	require.Equal(uint8(0), res.Receipt.ExitCode)
+
+	// half of the grace period has passed, so half of the collateral is burnt
+	minerActor, err := st.GetActor(ctx, minerAddr)
+	require.NoError(err)
+	var mstor State
+	builtin.RequireReadState(t, vms, minerAddr, minerActor, &mstor)
+	require.True(types.NewAttoFILFromFIL(50).Equal(mstor.Collateral))
+	require.True(types.NewAttoFILFromFIL(50).Equal(minerActor.Balance))
+
+	// the next proving period starts where the missed one ended
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 40054, "getProvingPeriodStart")
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+	require.Equal(types.NewBlockHeightFromBytes(res.Receipt.Return[0]), types.NewBlockHeight(40003))
+
+	// fail to submit after the grace period
+	proof = th.MakeRandomPoSTProofForTest()
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 60104, "submitPoSt", proof[:], []uint64{})
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, Errors[ErrPoStTooLate].Error())
+	require.Equal(uint8(ErrPoStTooLate), res.Receipt.ExitCode)
+}
+
+func TestMinerVerifySectorProven(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	st, vms := core.CreateStorages(ctx, t)
+
+	minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+
+	// a committed sector is proven until the miner misses its PoSt deadline
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "verifySectorProven", uint64(1))
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+	require.Equal(uint8(0), res.Receipt.ExitCode)
+
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 20103, "verifySectorProven", uint64(1))
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+
+	// sectors that are not committed are not proven
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "verifySectorProven", uint64(2))
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, Errors[ErrSectorNotProven].Error())
+	require.Equal(uint8(ErrSectorNotProven), res.Receipt.ExitCode)
+
+	// once the grace period is over the sector is no longer proven
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 20104, "verifySectorProven", uint64(1))
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, Errors[ErrSectorNotProven].Error())
+}
+
+func TestMinerSubmitPoStWithFaults(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	st, vms := core.CreateStorages(ctx, t)
+
+	minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+	for sectorID := uint64(1); sectorID <= 2; sectorID++ {
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", sectorID, th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+	}
+
+	// declaring a sector that was never committed fails
+	proof := th.MakeRandomPoSTProofForTest()
+	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 8, "submitPoSt", proof[:], []uint64{3})
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, Errors[ErrInvalidFault].Error())
+
+	// declaring a committed sector faulty removes its power
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 8, "submitPoSt", proof[:], []uint64{2})
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+	require.Equal(uint8(0), res.Receipt.ExitCode)
+
+	result := callQueryMethodSuccess("getPower", ctx, t, st, vms, address.TestAddress, minerAddr)
+	require.Equal(big.NewInt(1), big.NewInt(0).SetBytes(result[0]))
+
+	minerActor, err := st.GetActor(ctx, minerAddr)
+	require.NoError(err)
+	var mstor State
+	builtin.RequireReadState(t, vms, minerAddr, minerActor, &mstor)
+	require.Len(mstor.SectorCommitments, 1)
+	require.Contains(mstor.SectorCommitments, "1")
+}
+
+func TestLatePoStFee(t *testing.T) {
+	assert := assert.New(t)
+	collateral := types.NewAttoFILFromFIL(100)
+
+	assert.True(LatePoStFee(collateral, types.NewBlockHeight(0)).IsZero())
+	assert.True(types.NewAttoFILFromFIL(25).Equal(LatePoStFee(collateral, GracePeriodBlocks.Sub(types.NewBlockHeight(75)))))
+	assert.True(collateral.Equal(LatePoStFee(collateral, GracePeriodBlocks)))
+	assert.True(collateral.Equal(LatePoStFee(collateral, GracePeriodBlocks.Add(types.NewBlockHeight(1)))))
+}
+
+func TestMinerCollateral(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("adds the value of the message to the collateral", func(t *testing.T) {
+		require := require.New(t)
+		st, vms := core.CreateStorages(ctx, t)
+		minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 20, 1, "addCollateral")
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		result := callQueryMethodSuccess("getCollateral", ctx, t, st, vms, address.TestAddress, minerAddr)
+		require.True(types.NewAttoFILFromFIL(120).Equal(types.NewAttoFILFromBytes(result[0])))
+	})
+
+	t.Run("withdraws collateral not backing the pledge", func(t *testing.T) {
+		require := require.New(t)
+		st, vms := core.CreateStorages(ctx, t)
+		minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 1, "withdrawCollateral", types.NewAttoFILFromFIL(90))
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		minerActor, err := st.GetActor(ctx, minerAddr)
+		require.NoError(err)
+		require.True(types.NewAttoFILFromFIL(10).Equal(minerActor.Balance))
+
+		// the pledge of 100 sectors needs more than what is left
+		res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 1, "withdrawCollateral", types.NewAttoFILFromFIL(10))
+		require.NoError(err)
+		require.EqualError(res.ExecutionError, Errors[ErrInsufficientCollateral].Error())
+	})
+
+	t.Run("only the owner can withdraw collateral", func(t *testing.T) {
+		require := require.New(t)
+		st, vms := core.CreateStorages(ctx, t)
+		minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+		msg := types.NewMessage(address.TestAddress2, minerAddr, 0, types.NewZeroAttoFIL(), "withdrawCollateral", actor.MustConvertParams(types.NewAttoFILFromFIL(1)))
+		res, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(1))
+		require.NoError(err)
+		require.EqualError(res.ExecutionError, Errors[ErrCallerUnauthorized].Error())
+	})
+}
+
+func TestMinerSetPledge(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	st, vms := core.CreateStorages(ctx, t)
+	minerAddr := createTestMinerWith(10, 1, assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+	res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 1, "setPledge", big.NewInt(1000))
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+
+	result := callQueryMethodSuccess("getPledge", ctx, t, st, vms, address.TestAddress, minerAddr)
+	require.Equal(big.NewInt(1000), big.NewInt(0).SetBytes(result[0]))
+
+	// the pledge can not drop below the storage market's minimum
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 1, "setPledge", big.NewInt(0).Sub(storagemarket.MinimumPledge, big.NewInt(1)))
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, Errors[ErrInsufficientPledge].Error())
+
+	// 1 FIL of collateral covers at most 1000 sectors
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 1, "setPledge", big.NewInt(1001))
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, Errors[ErrInsufficientCollateral].Error())
+
+	// the pledge can not drop below the committed sectors
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
+	require.NoError(err)
+	require.NoError(res.ExecutionError)
+
+	res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 4, "setPledge", big.NewInt(0))
+	require.NoError(err)
+	require.EqualError(res.ExecutionError, Errors[ErrInsufficientPledge].Error())
+}
+
+func TestMinerExit(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns all collateral to the owner", func(t *testing.T) {
+		require := require.New(t)
+		st, vms := core.CreateStorages(ctx, t)
+		minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 1, "exit")
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		minerActor, err := st.GetActor(ctx, minerAddr)
+		require.NoError(err)
+		require.True(minerActor.Balance.IsZero())
+
+		var mstor State
+		builtin.RequireReadState(t, vms, minerAddr, minerActor, &mstor)
+		require.True(mstor.Collateral.IsZero())
+		require.Equal(0, mstor.PledgeSectors.Sign())
+	})
+
+	t.Run("fails until committed deals expire", func(t *testing.T) {
+		require := require.New(t)
+		st, vms := core.CreateStorages(ctx, t)
+		minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+		signer := types.NewMockSigner(types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed()))
+		terms := storagemarket.DealTerms{
+			PieceRef:   types.SomeCid(),
+			Size:       types.NewBytesAmount(1000),
+			TotalPrice: types.NewAttoFILFromFIL(5),
+			Duration:   10,
+			Miner:      minerAddr,
+			Client:     signer.Addresses[0],
+		}
+		sig, err := storagemarket.SignDealTerms(&terms, signer)
+		require.NoError(err)
+		dealsBytes, err := cbor.DumpObject([]storagemarket.Deal{{Terms: terms, ClientSignature: sig}})
+		require.NoError(err)
+
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 2, "publishDeals", dealsBytes)
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{0})
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		// the deal was published at 2 for 10 blocks
+		res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 11, "exit")
+		require.NoError(err)
+		require.EqualError(res.ExecutionError, Errors[ErrDealsActive].Error())
+
+		res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 12, "exit")
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		result := callQueryMethodSuccess("getPower", ctx, t, st, vms, address.TestAddress, minerAddr)
+		require.Equal(0, big.NewInt(0).SetBytes(result[0]).Sign())
+
+		// the storage market no longer knows the miner
+		res, err = th.CreateAndApplyTestMessage(t, st, vms, address.StorageMarketAddress, 0, 13, "slashStorageFault", minerAddr)
+		require.NoError(err)
+		require.EqualError(res.ExecutionError, storagemarket.Errors[storagemarket.ErrUnknownMiner].Error())
+	})
+
+	t.Run("charges the late PoSt fee and fails after the grace period", func(t *testing.T) {
+		require := require.New(t)
+		st, vms := core.CreateStorages(ctx, t)
+		minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		// the proving period started at 3, so its grace period ends at 20103
+		res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 20104, "exit")
+		require.NoError(err)
+		require.EqualError(res.ExecutionError, Errors[ErrInStorageFault].Error())
+
+		network, err := st.GetActor(ctx, address.NetworkAddress)
+		require.NoError(err)
+		networkBalance := network.Balance
+
+		res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 20053, "exit")
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		// half of the grace period has passed, so half of the collateral is burnt
+		network, err = st.GetActor(ctx, address.NetworkAddress)
+		require.NoError(err)
+		require.True(types.NewAttoFILFromFIL(50).Equal(network.Balance.Sub(networkBalance)))
+
+		minerActor, err := st.GetActor(ctx, minerAddr)
+		require.NoError(err)
+		require.True(minerActor.Balance.IsZero())
+	})
+}
+
+func TestMinerWorker(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("defaults to the owner", func(t *testing.T) {
+		require := require.New(t)
+		st, vms := core.CreateStorages(ctx, t)
+		minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+		result := callQueryMethodSuccess("getWorker", ctx, t, st, vms, address.TestAddress, minerAddr)
+		workerAddr, err := address.NewFromBytes(result[0])
+		require.NoError(err)
+		require.Equal(address.TestAddress, workerAddr)
+	})
+
+	t.Run("worker operates the miner but can not withdraw", func(t *testing.T) {
+		require := require.New(t)
+		st, vms := core.CreateStorages(ctx, t)
+		minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 1, "changeWorker", address.TestAddress2)
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		result := callQueryMethodSuccess("getWorker", ctx, t, st, vms, address.TestAddress, minerAddr)
+		workerAddr, err := address.NewFromBytes(result[0])
+		require.NoError(err)
+		require.Equal(address.TestAddress2, workerAddr)
+
+		res = applyMessageFrom(t, st, vms, address.TestAddress2, minerAddr, 2, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
+		require.NoError(res.ExecutionError)
+
+		res = applyMessageFrom(t, st, vms, address.TestAddress2, minerAddr, 3, "withdrawCollateral", types.NewAttoFILFromFIL(1))
+		require.EqualError(res.ExecutionError, Errors[ErrCallerUnauthorized].Error())
+
+		res = applyMessageFrom(t, st, vms, address.TestAddress2, minerAddr, 3, "changeWorker", address.TestAddress2)
+		require.EqualError(res.ExecutionError, Errors[ErrCallerUnauthorized].Error())
+	})
+}
+
+func TestMinerOwnerTransfer(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("proposed owner becomes the owner once it accepts", func(t *testing.T) {
+		require := require.New(t)
+		st, vms := core.CreateStorages(ctx, t)
+		minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+		res, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 1, "proposeOwner", address.TestAddress2)
+		require.NoError(err)
+		require.NoError(res.ExecutionError)
+
+		result := callQueryMethodSuccess("getOwner", ctx, t, st, vms, address.TestAddress, minerAddr)
+		ownerAddr, err := address.NewFromBytes(result[0])
+		require.NoError(err)
+		require.Equal(address.TestAddress, ownerAddr)
+
+		res = applyMessageFrom(t, st, vms, address.TestAddress2, minerAddr, 2, "acceptOwner")
+		require.NoError(res.ExecutionError)
+
+		result = callQueryMethodSuccess("getOwner", ctx, t, st, vms, address.TestAddress, minerAddr)
+		ownerAddr, err = address.NewFromBytes(result[0])
+		require.NoError(err)
+		require.Equal(address.TestAddress2, ownerAddr)
+
+		// the previous owner remains the worker, but can no longer withdraw
+		res, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "withdrawCollateral", types.NewAttoFILFromFIL(1))
+		require.NoError(err)
+		require.EqualError(res.ExecutionError, Errors[ErrCallerUnauthorized].Error())
+	})
+
+	t.Run("only the proposed owner can accept", func(t *testing.T) {
+		require := require.New(t)
+		st, vms := core.CreateStorages(ctx, t)
+		minerAddr := createTestMiner(assert.New(t), st, vms, address.TestAddress, []byte("my public key"), th.RequireRandomPeerID())
+
+		res := applyMessageFrom(t, st, vms, address.TestAddress2, minerAddr, 1, "acceptOwner")
+		require.EqualError(res.ExecutionError, Errors[ErrCallerUnauthorized].Error())
+
+		res = applyMessageFrom(t, st, vms, address.TestAddress2, minerAddr, 1, "proposeOwner", address.TestAddress2)
+		require.EqualError(res.ExecutionError, Errors[ErrCallerUnauthorized].Error())
+	})
+}
+
+func applyMessageFrom(t *testing.T, st state.Tree, vms vm.StorageMap, from, to address.Address, height uint64, method string, params ...interface{}) *consensus.ApplicationResult {
+	msg := types.NewMessage(from, to, core.MustGetNonce(st, from), types.NewAttoFILFromFIL(0), method, actor.MustConvertParams(params...))
+
+	res, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(height))
+	require.NoError(t, err)
+	return res
 }
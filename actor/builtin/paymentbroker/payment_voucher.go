@@ -1,27 +1,152 @@
 package paymentbroker
 
 import (
+	"bytes"
+	"errors"
+
 	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 	"gx/ipfs/QmekxXDhCxCJRNuzmHreuaT3BsuJcsjcXWNrtV9C8DRHtd/go-multibase"
 
+	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
 func init() {
 	cbor.RegisterCborType(PaymentVoucher{})
+	cbor.RegisterCborType(Condition{})
+	cbor.RegisterCborType(Merge{})
+}
+
+// Condition is an actor method that must succeed for a voucher to be redeemed.
+// Its params are kept abi encoded along with their types so that they survive
+// being passed around in a voucher.
+type Condition struct {
+	To         address.Address `json:"to"`
+	Method     string          `json:"method"`
+	ParamTypes []abi.Type      `json:"param_types"`
+	Params     []byte          `json:"params"`
+}
+
+// NewCondition creates a condition that calls method on the actor at to with
+// the given abi compatible params.
+func NewCondition(to address.Address, method string, params ...interface{}) (*Condition, error) {
+	vals, err := abi.ToValues(params)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := abi.EncodeValues(vals)
+	if err != nil {
+		return nil, err
+	}
+
+	paramTypes := make([]abi.Type, len(vals))
+	for i, v := range vals {
+		paramTypes[i] = v.Type
+	}
+
+	return &Condition{
+		To:         to,
+		Method:     method,
+		ParamTypes: paramTypes,
+		Params:     encoded,
+	}, nil
+}
+
+// Values decodes the condition's params into the values the method is called with.
+func (c *Condition) Values() ([]interface{}, error) {
+	vals, err := abi.DecodeValues(c.Params, c.ParamTypes)
+	if err != nil {
+		return nil, err
+	}
+	return abi.FromValues(vals), nil
+}
+
+// Equals returns true if both conditions call the same method with the same params.
+func (c *Condition) Equals(other *Condition) bool {
+	if c == nil || other == nil {
+		return c == other
+	}
+
+	if c.To != other.To || c.Method != other.Method || !bytes.Equal(c.Params, other.Params) {
+		return false
+	}
+
+	if len(c.ParamTypes) != len(other.ParamTypes) {
+		return false
+	}
+	for i, t := range c.ParamTypes {
+		if t != other.ParamTypes[i] {
+			return false
+		}
+	}
+
+	return true
 }
 
 // PaymentVoucher is a voucher for a payment channel that can be transferred off-chain but guarantees a future payment.
+// If it has a Condition, the voucher can only be redeemed while the condition succeeds.
+// Amount is the total paid on Lane, including what was redeemed on the lanes
+// the voucher merges. A voucher supersedes the vouchers of its lane with a
+// lower Nonce.
 type PaymentVoucher struct {
 	Channel   types.ChannelID   `json:"channel"`
 	Payer     address.Address   `json:"payer"`
 	Target    address.Address   `json:"target"`
 	Amount    types.AttoFIL     `json:"amount"`
 	ValidAt   types.BlockHeight `json:"valid_at"`
+	Lane      uint64            `json:"lane"`
+	Nonce     uint64            `json:"nonce"`
+	Merges    []Merge           `json:"merges"`
+	Condition *Condition        `json:"condition"`
 	Signature types.Signature   `json:"signature"`
 }
 
+// Merge names a lane whose redeemed amount a voucher takes over. Nonce
+// supersedes the merged lane's vouchers, so it must be higher than theirs.
+type Merge struct {
+	Lane  uint64 `json:"lane"`
+	Nonce uint64 `json:"nonce"`
+}
+
+// RedeemParams returns the params of the payment broker's redeem and close
+// methods that settle the given vouchers. They must all be for one channel.
+func RedeemParams(vouchers ...*PaymentVoucher) ([]interface{}, error) {
+	if len(vouchers) == 0 {
+		return nil, errors.New("no vouchers to redeem")
+	}
+
+	payer, chid := vouchers[0].Payer, &vouchers[0].Channel
+	for _, voucher := range vouchers[1:] {
+		if voucher.Payer != payer || !voucher.Channel.Equal(chid) {
+			return nil, errors.New("vouchers must be for the same payment channel")
+		}
+	}
+
+	vouchersBytes, err := cbor.DumpObject(vouchers)
+	if err != nil {
+		return nil, err
+	}
+
+	return []interface{}{payer, chid, vouchersBytes}, nil
+}
+
+// DecodeRedeemParams decodes base58, Cbor-encoded vouchers and returns the
+// params of the payment broker's redeem and close methods that settle them.
+func DecodeRedeemParams(vouchersRaw ...string) ([]interface{}, error) {
+	vouchers := make([]*PaymentVoucher, len(vouchersRaw))
+	for i, voucherRaw := range vouchersRaw {
+		voucher, err := DecodeVoucher(voucherRaw)
+		if err != nil {
+			return nil, err
+		}
+		vouchers[i] = voucher
+	}
+
+	return RedeemParams(vouchers...)
+}
+
 // DecodeVoucher creates a *PaymentVoucher from a base58, Cbor-encoded one
 func DecodeVoucher(voucherRaw string) (*PaymentVoucher, error) {
 	_, cborVoucher, err := multibase.Decode(voucherRaw)
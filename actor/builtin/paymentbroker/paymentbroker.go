@@ -2,6 +2,7 @@ package paymentbroker
 
 import (
 	"context"
+	"strconv"
 
 	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
@@ -38,6 +39,18 @@ const (
 	ErrInvalidSignature = 42
 	//ErrTooEarly indicates that the block height is too low to satisfy a voucher
 	ErrTooEarly = 43
+	// ErrInvalidCondition indicates the voucher's condition could not be decoded.
+	ErrInvalidCondition = 44
+	// ErrConditionFailed indicates the voucher's condition did not succeed.
+	ErrConditionFailed = 45
+	// ErrInvalidVoucher indicates a voucher is malformed or not for the channel being redeemed.
+	ErrInvalidVoucher = 46
+	// ErrSupersededVoucher indicates a voucher's nonce is lower than its lane's.
+	ErrSupersededVoucher = 47
+	// ErrInvalidMerge indicates a voucher merges its own lane.
+	ErrInvalidMerge = 48
+	// ErrNoVouchers indicates an attempt to redeem or close a channel without vouchers.
+	ErrNoVouchers = 49
 )
 
 // Errors map error codes to revert errors this actor may return.
@@ -53,18 +66,62 @@ var Errors = map[uint8]error{
 	ErrExpired:                  errors.NewCodedRevertError(ErrExpired, "block height has exceeded channel's end of life"),
 	ErrAlreadyWithdrawn:         errors.NewCodedRevertError(ErrAlreadyWithdrawn, "update amount has already been redeemed"),
 	ErrInvalidSignature:         errors.NewCodedRevertErrorf(ErrInvalidSignature, "signature failed to validate"),
+	ErrInvalidCondition:         errors.NewCodedRevertErrorf(ErrInvalidCondition, "voucher condition is malformed"),
+	ErrConditionFailed:          errors.NewCodedRevertErrorf(ErrConditionFailed, "voucher condition was not met"),
+	ErrInvalidVoucher:           errors.NewCodedRevertErrorf(ErrInvalidVoucher, "voucher is invalid for this channel"),
+	ErrSupersededVoucher:        errors.NewCodedRevertErrorf(ErrSupersededVoucher, "voucher is superseded by a higher nonce"),
+	ErrInvalidMerge:             errors.NewCodedRevertErrorf(ErrInvalidMerge, "voucher may not merge its own lane"),
+	ErrNoVouchers:               errors.NewCodedRevertErrorf(ErrNoVouchers, "no vouchers to redeem"),
 }
 
 func init() {
 	cbor.RegisterCborType(PaymentChannel{})
+	cbor.RegisterCborType(Lane{})
 }
 
 // PaymentChannel records the intent to pay funds to a target account.
+// AmountRedeemed is the total redeemed over all of the channel's lanes.
 type PaymentChannel struct {
 	Target         address.Address    `json:"target"`
 	Amount         *types.AttoFIL     `json:"amount"`
 	AmountRedeemed *types.AttoFIL     `json:"amount_redeemed"`
 	Eol            *types.BlockHeight `json:"eol"`
+
+	// Lanes maps the stringified lane number to the lanes vouchers have been
+	// redeemed on, so that one channel can pay for several deals.
+	Lanes map[string]*Lane `json:"lanes"`
+}
+
+// Lane tracks the vouchers redeemed on one lane of a payment channel.
+type Lane struct {
+	AmountRedeemed *types.AttoFIL `json:"amount_redeemed"`
+	Nonce          uint64         `json:"nonce"`
+}
+
+// lane returns the channel's lane with the given number, creating it if no
+// voucher has been redeemed on it yet.
+func (channel *PaymentChannel) lane(id uint64) *Lane {
+	if channel.Lanes == nil {
+		channel.Lanes = make(map[string]*Lane)
+	}
+
+	key := strconv.FormatUint(id, 10)
+	lane, ok := channel.Lanes[key]
+	if !ok {
+		lane = &Lane{AmountRedeemed: types.NewZeroAttoFIL()}
+		channel.Lanes[key] = lane
+	}
+	return lane
+}
+
+// LaneRedeemed returns the amount redeemed so far on the channel's lane with
+// the given number.
+func (channel *PaymentChannel) LaneRedeemed(id uint64) *types.AttoFIL {
+	lane, ok := channel.Lanes[strconv.FormatUint(id, 10)]
+	if !ok {
+		return types.NewZeroAttoFIL()
+	}
+	return lane.AmountRedeemed
 }
 
 // Actor provides a mechanism for off chain payments.
@@ -87,8 +144,12 @@ func (pb *Actor) Exports() exec.Exports {
 var _ exec.ExecutableActor = (*Actor)(nil)
 
 var paymentBrokerExports = exec.Exports{
+	"addFunds": &exec.FunctionSignature{
+		Params: []abi.Type{abi.ChannelID},
+		Return: nil,
+	},
 	"close": &exec.FunctionSignature{
-		Params: []abi.Type{abi.Address, abi.ChannelID, abi.AttoFIL, abi.BlockHeight, abi.Bytes},
+		Params: []abi.Type{abi.Address, abi.ChannelID, abi.Bytes},
 		Return: nil,
 	},
 	"createChannel": &exec.FunctionSignature{
@@ -108,7 +169,7 @@ var paymentBrokerExports = exec.Exports{
 		Return: nil,
 	},
 	"redeem": &exec.FunctionSignature{
-		Params: []abi.Type{abi.Address, abi.ChannelID, abi.AttoFIL, abi.BlockHeight, abi.Bytes},
+		Params: []abi.Type{abi.Address, abi.ChannelID, abi.Bytes},
 		Return: nil,
 	},
 	"voucher": &exec.FunctionSignature{
@@ -173,28 +234,39 @@ func (pb *Actor) CreateChannel(vmctx exec.VMContext, target address.Address, eol
 // Redeem is called by the target account to withdraw funds with authorization from the payer.
 // This method is exactly like Close except it doesn't close the channel.
 // This is useful when you want to checkpoint the value in a payment, but continue to use the
-// channel afterwards. The amt represents the total funds authorized so far, so that subsequent
-// calls to Update will only transfer the difference between the given amt and the greatest
-// amt taken so far. A series of channel transactions might look like this:
+// channel afterwards. The amount of a voucher represents the total funds authorized so far on
+// its lane, so that subsequent calls to Redeem will only transfer the difference between the
+// given amount and the greatest amount taken so far from that lane. A series of channel
+// transactions on one lane might look like this:
 //                                Payer: 2000, Target: 0, Channel: 0
 // payer createChannel(1000)   -> Payer: 1000, Target: 0, Channel: 1000
 // target Redeem(100)          -> Payer: 1000, Target: 100, Channel: 900
 // target Redeem(200)          -> Payer: 1000, Target: 200, Channel: 800
 // target Close(500)           -> Payer: 1500, Target: 500, Channel: 0
 //
-func (pb *Actor) Redeem(vmctx exec.VMContext, payer address.Address, chid *types.ChannelID, amt *types.AttoFIL, validAt *types.BlockHeight, sig []byte) (uint8, error) {
+// Vouchers are passed cbor encoded, at most one per lane, and are settled
+// atomically. If a voucher carries a condition, the condition is called first
+// and the voucher is only paid if it succeeds.
+func (pb *Actor) Redeem(vmctx exec.VMContext, payer address.Address, chid *types.ChannelID, vouchersBytes []byte) (uint8, error) {
 	if err := vmctx.Charge(100); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
-	if !VerifyVoucherSignature(payer, chid, amt, validAt, sig) {
-		return errors.CodeError(Errors[ErrInvalidSignature]), Errors[ErrInvalidSignature]
+	vouchers, err := decodeVouchers(payer, chid, vouchersBytes)
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	for _, voucher := range vouchers {
+		if err := checkCondition(vmctx, voucher.Condition); err != nil {
+			return errors.CodeError(err), err
+		}
 	}
 
 	ctx := context.Background()
 	storage := vmctx.Storage()
 
-	err := withPayerChannels(ctx, storage, payer, func(byChannelID exec.Lookup) error {
+	err = withPayerChannels(ctx, storage, payer, func(byChannelID exec.Lookup) error {
 		var channel *PaymentChannel
 
 		chInt, err := byChannelID.Find(ctx, chid.KeyString())
@@ -210,8 +282,8 @@ func (pb *Actor) Redeem(vmctx exec.VMContext, payer address.Address, chid *types
 			return errors.NewFaultError("Expected PaymentChannel from channels lookup")
 		}
 
-		// validate the amount can be sent to the target and send payment to that address.
-		err = updateChannel(vmctx, vmctx.Message().From, channel, amt, validAt)
+		// validate the vouchers can be paid to the target and send payment to that address.
+		err = updateChannel(vmctx, vmctx.Message().From, channel, vouchers)
 		if err != nil {
 			return err
 		}
@@ -230,21 +302,28 @@ func (pb *Actor) Redeem(vmctx exec.VMContext, payer address.Address, chid *types
 	return 0, nil
 }
 
-// Close first executes the logic performed in the the Update method, then returns all
+// Close first executes the logic performed in the the Redeem method, then returns all
 // funds remaining in the channel to the payer account and deletes the channel.
-func (pb *Actor) Close(vmctx exec.VMContext, payer address.Address, chid *types.ChannelID, amt *types.AttoFIL, validAt *types.BlockHeight, sig []byte) (uint8, error) {
+func (pb *Actor) Close(vmctx exec.VMContext, payer address.Address, chid *types.ChannelID, vouchersBytes []byte) (uint8, error) {
 	if err := vmctx.Charge(100); err != nil {
 		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
 	}
 
-	if !VerifyVoucherSignature(payer, chid, amt, validAt, sig) {
-		return errors.CodeError(Errors[ErrInvalidSignature]), Errors[ErrInvalidSignature]
+	vouchers, err := decodeVouchers(payer, chid, vouchersBytes)
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	for _, voucher := range vouchers {
+		if err := checkCondition(vmctx, voucher.Condition); err != nil {
+			return errors.CodeError(err), err
+		}
 	}
 
 	ctx := context.Background()
 	storage := vmctx.Storage()
 
-	err := withPayerChannels(ctx, storage, payer, func(byChannelID exec.Lookup) error {
+	err = withPayerChannels(ctx, storage, payer, func(byChannelID exec.Lookup) error {
 		chInt, err := byChannelID.Find(ctx, chid.KeyString())
 		if err != nil {
 			if err == hamt.ErrNotFound {
@@ -258,8 +337,8 @@ func (pb *Actor) Close(vmctx exec.VMContext, payer address.Address, chid *types.
 			return errors.NewFaultError("Expected PaymentChannel from channels lookup")
 		}
 
-		// validate the amount can be sent to the target and send payment to that address.
-		err = updateChannel(vmctx, vmctx.Message().From, channel, amt, validAt)
+		// validate the vouchers can be paid to the target and send payment to that address.
+		err = updateChannel(vmctx, vmctx.Message().From, channel, vouchers)
 		if err != nil {
 			return err
 		}
@@ -334,6 +413,53 @@ func (pb *Actor) Extend(vmctx exec.VMContext, chid *types.ChannelID, eol *types.
 	return 0, nil
 }
 
+// AddFunds can be used by the owner of a channel to add more funds to it
+// without changing the Channel's lifespan.
+func (pb *Actor) AddFunds(vmctx exec.VMContext, chid *types.ChannelID) (uint8, error) {
+	if err := vmctx.Charge(100); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	ctx := context.Background()
+	storage := vmctx.Storage()
+	payerAddress := vmctx.Message().From
+
+	err := withPayerChannels(ctx, storage, payerAddress, func(byChannelID exec.Lookup) error {
+		chInt, err := byChannelID.Find(ctx, chid.KeyString())
+		if err != nil {
+			if err == hamt.ErrNotFound {
+				return Errors[ErrUnknownChannel]
+			}
+			return errors.FaultErrorWrapf(err, "Could not retrieve payment channel with ID: %s", chid)
+		}
+
+		channel, ok := chInt.(*PaymentChannel)
+		if !ok {
+			return errors.NewFaultError("Expected PaymentChannel from channels lookup")
+		}
+
+		// funds added to an expired channel could only be reclaimed
+		if vmctx.BlockHeight().GreaterEqual(channel.Eol) {
+			return Errors[ErrExpired]
+		}
+
+		// increment the value
+		channel.Amount = channel.Amount.Add(vmctx.Message().Value)
+
+		return byChannelID.Set(ctx, chid.KeyString(), channel)
+	})
+
+	if err != nil {
+		// ensure error is properly wrapped
+		if !errors.IsFault(err) && !errors.ShouldRevert(err) {
+			return 1, errors.FaultErrorWrap(err, "Error adding funds to channel")
+		}
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
 // Reclaim is used by the owner of a channel to reclaim unspent funds in timed
 // out payment Channels they own.
 func (pb *Actor) Reclaim(vmctx exec.VMContext, chid *types.ChannelID) (uint8, error) {
@@ -487,36 +613,133 @@ func (pb *Actor) Ls(vmctx exec.VMContext, payer address.Address) ([]byte, uint8,
 	return channelsBytes, 0, nil
 }
 
-func updateChannel(ctx exec.VMContext, target address.Address, channel *PaymentChannel, amt *types.AttoFIL, validAt *types.BlockHeight) error {
+func updateChannel(ctx exec.VMContext, target address.Address, channel *PaymentChannel, vouchers []*PaymentVoucher) error {
 	if target != channel.Target {
 		return Errors[ErrWrongTarget]
 	}
 
-	if ctx.BlockHeight().LessThan(validAt) {
-		return Errors[ErrTooEarly]
+	for _, voucher := range vouchers {
+		if ctx.BlockHeight().LessThan(&voucher.ValidAt) {
+			return Errors[ErrTooEarly]
+		}
 	}
 
 	if ctx.BlockHeight().GreaterEqual(channel.Eol) {
 		return Errors[ErrExpired]
 	}
 
-	if amt.GreaterThan(channel.Amount) {
-		return Errors[ErrInsufficientChannelFunds]
+	updateAmount := types.NewZeroAttoFIL()
+	for _, voucher := range vouchers {
+		amt, err := updateLane(channel, voucher)
+		if err != nil {
+			return err
+		}
+		updateAmount = updateAmount.Add(amt)
 	}
 
-	if amt.LessEqual(channel.AmountRedeemed) {
-		return Errors[ErrAlreadyWithdrawn]
+	amountRedeemed := channel.AmountRedeemed.Add(updateAmount)
+	if amountRedeemed.GreaterThan(channel.Amount) {
+		return Errors[ErrInsufficientChannelFunds]
 	}
 
 	// transfer funds to sender
-	updateAmount := amt.Sub(channel.AmountRedeemed)
-	_, _, err := ctx.Send(ctx.Message().From, "", updateAmount, nil)
-	if err != nil {
-		return err
+	if updateAmount.GreaterThan(types.ZeroAttoFIL) {
+		_, _, err := ctx.Send(ctx.Message().From, "", updateAmount, nil)
+		if err != nil {
+			return err
+		}
 	}
 
 	// update amount redeemed from this channel
-	channel.AmountRedeemed = amt
+	channel.AmountRedeemed = amountRedeemed
+
+	return nil
+}
+
+// updateLane records the voucher as redeemed on its lane, merging the lanes it
+// names into it, and returns the amount it pays.
+func updateLane(channel *PaymentChannel, voucher *PaymentVoucher) (*types.AttoFIL, error) {
+	if voucher.Amount.GreaterThan(channel.Amount) {
+		return nil, Errors[ErrInsufficientChannelFunds]
+	}
+
+	lane := channel.lane(voucher.Lane)
+	if voucher.Nonce < lane.Nonce {
+		return nil, Errors[ErrSupersededVoucher]
+	}
+
+	paid := lane.AmountRedeemed
+	for _, merge := range voucher.Merges {
+		if merge.Lane == voucher.Lane {
+			return nil, Errors[ErrInvalidMerge]
+		}
+
+		merged := channel.lane(merge.Lane)
+		if merge.Nonce <= merged.Nonce {
+			return nil, Errors[ErrSupersededVoucher]
+		}
+
+		paid = paid.Add(merged.AmountRedeemed)
+		merged.AmountRedeemed = types.NewZeroAttoFIL()
+		merged.Nonce = merge.Nonce
+	}
+
+	if voucher.Amount.LessEqual(paid) {
+		return nil, Errors[ErrAlreadyWithdrawn]
+	}
+
+	amount := voucher.Amount
+	lane.AmountRedeemed = &amount
+	lane.Nonce = voucher.Nonce
+
+	return amount.Sub(paid), nil
+}
+
+// decodeVouchers decodes the vouchers passed to redeem or close and checks
+// that they are signed by payer for channel chid, with at most one per lane.
+func decodeVouchers(payer address.Address, chid *types.ChannelID, data []byte) ([]*PaymentVoucher, error) {
+	var vouchers []*PaymentVoucher
+	if err := cbor.DecodeInto(data, &vouchers); err != nil {
+		return nil, Errors[ErrInvalidVoucher]
+	}
+	if len(vouchers) == 0 {
+		return nil, Errors[ErrNoVouchers]
+	}
+
+	lanes := make(map[uint64]bool)
+	for _, voucher := range vouchers {
+		if voucher.Payer != payer || !voucher.Channel.Equal(chid) || lanes[voucher.Lane] {
+			return nil, Errors[ErrInvalidVoucher]
+		}
+		lanes[voucher.Lane] = true
+
+		if !VerifyVoucherSignature(voucher) {
+			return nil, Errors[ErrInvalidSignature]
+		}
+	}
+
+	return vouchers, nil
+}
+
+// checkCondition calls the voucher's condition, if any, and returns an error
+// unless it succeeds.
+func checkCondition(vmctx exec.VMContext, condition *Condition) error {
+	if condition == nil {
+		return nil
+	}
+
+	params, err := condition.Values()
+	if err != nil {
+		return Errors[ErrInvalidCondition]
+	}
+
+	_, ret, err := vmctx.Send(condition.To, condition.Method, nil, params)
+	if errors.IsFault(err) {
+		return err
+	}
+	if err != nil || ret != 0 {
+		return Errors[ErrConditionFailed]
+	}
 
 	return nil
 }
@@ -542,29 +765,29 @@ func reclaim(ctx context.Context, vmctx exec.VMContext, byChannelID exec.Lookup,
 	return nil
 }
 
-// Separator is the separator used when concatenating channel and amount in a
-// voucher signature.
-const separator = 0x0
-
-// SignVoucher creates the signature for the given combination of
-// channel, amount, validAt (earliest block height for redeem) and from address.
-// It does so by signing the following bytes: (channelID | 0x0 | amount | 0x0 | validAt)
-func SignVoucher(channelID *types.ChannelID, amount *types.AttoFIL, validAt *types.BlockHeight, addr address.Address, signer types.Signer) (types.Signature, error) {
-	data := createVoucherSignatureData(channelID, amount, validAt)
-	return signer.SignBytes(data, addr)
+// SignVoucher creates the payer's signature of the voucher. It signs the cbor
+// encoding of the voucher without its signature.
+func SignVoucher(voucher *PaymentVoucher, signer types.Signer) (types.Signature, error) {
+	data, err := createVoucherSignatureData(voucher)
+	if err != nil {
+		return nil, err
+	}
+	return signer.SignBytes(data, voucher.Payer)
 }
 
-// VerifyVoucherSignature returns whether the voucher's signature is valid
-func VerifyVoucherSignature(payer address.Address, chid *types.ChannelID, amt *types.AttoFIL, validAt *types.BlockHeight, sig []byte) bool {
-	data := createVoucherSignatureData(chid, amt, validAt)
-	return types.IsValidSignature(data, payer, sig)
+// VerifyVoucherSignature returns whether the voucher is signed by its payer.
+func VerifyVoucherSignature(voucher *PaymentVoucher) bool {
+	data, err := createVoucherSignatureData(voucher)
+	if err != nil {
+		return false
+	}
+	return types.IsValidSignature(data, voucher.Payer, voucher.Signature)
 }
 
-func createVoucherSignatureData(channelID *types.ChannelID, amount *types.AttoFIL, validAt *types.BlockHeight) []byte {
-	data := append(channelID.Bytes(), separator)
-	data = append(data, amount.Bytes()...)
-	data = append(data, separator)
-	return append(data, validAt.Bytes()...)
+func createVoucherSignatureData(voucher *PaymentVoucher) ([]byte, error) {
+	unsigned := *voucher
+	unsigned.Signature = nil
+	return cbor.DumpObject(unsigned)
 }
 
 func withPayerChannels(ctx context.Context, storage exec.Storage, payer address.Address, f func(exec.Lookup) error) error {
@@ -273,16 +273,12 @@ func TestPaymentBrokerCloseInvalidSig(t *testing.T) {
 	require := require.New(t)
 	sys := setup(t)
 
-	amt := types.NewAttoFILFromFIL(100)
-	signature, err := sys.Signature(amt, sys.defaultValidAt)
-	require.NoError(err)
+	voucher := sys.Voucher(types.NewAttoFILFromFIL(100), sys.defaultValidAt, 0, 0)
 	// make the signature invalid
-	signature[0] = 0
-	signature[1] = 1
+	voucher.Signature[0] = 0
+	voucher.Signature[1] = 1
 
-	pdata := core.MustConvertParams(sys.payer, sys.channelID, amt, sys.defaultValidAt, ([]byte)(signature))
-	msg := types.NewMessage(sys.target, address.PaymentBrokerAddress, 0, types.NewAttoFILFromFIL(0), "close", pdata)
-	res, err := sys.ApplyMessage(msg, 0)
+	res, err := sys.applyVouchersMessage(sys.target, 0, "close", 0, voucher)
 	require.EqualError(res.ExecutionError, Errors[ErrInvalidSignature].Error())
 	require.NoError(err)
 }
@@ -291,20 +287,208 @@ func TestPaymentBrokerRedeemInvalidSig(t *testing.T) {
 	require := require.New(t)
 	sys := setup(t)
 
-	amt := types.NewAttoFILFromFIL(100)
-	signature, err := sys.Signature(amt, sys.defaultValidAt)
-	require.NoError(err)
+	voucher := sys.Voucher(types.NewAttoFILFromFIL(100), sys.defaultValidAt, 0, 0)
 	// make the signature invalid
-	signature[0] = 0
-	signature[1] = 1
+	voucher.Signature[0] = 0
+	voucher.Signature[1] = 1
 
-	pdata := core.MustConvertParams(sys.payer, sys.channelID, amt, sys.defaultValidAt, ([]byte)(signature))
-	msg := types.NewMessage(sys.target, address.PaymentBrokerAddress, 0, types.NewAttoFILFromFIL(0), "redeem", pdata)
-	res, err := sys.ApplyMessage(msg, 0)
+	res, err := sys.applyVouchersMessage(sys.target, 0, "redeem", 0, voucher)
 	require.EqualError(res.ExecutionError, Errors[ErrInvalidSignature].Error())
 	require.NoError(err)
 }
 
+func TestPaymentBrokerConditionalVouchers(t *testing.T) {
+	t.Run("redeem pays when the condition succeeds", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		sys := setup(t)
+
+		condition, err := NewCondition(address.StorageMarketAddress, "getTotalStorage")
+		require.NoError(err)
+
+		target := state.MustGetActor(sys.st, sys.target)
+		targetBalance := target.Balance
+
+		result, err := sys.applyConditionalMessage("redeem", 100, condition, condition)
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+		assert.Equal(uint8(0), result.Receipt.ExitCode)
+
+		target = state.MustGetActor(sys.st, sys.target)
+		assert.Equal(targetBalance.Add(types.NewAttoFILFromFIL(100)), target.Balance)
+	})
+
+	t.Run("redeem fails when the condition fails", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		sys := setup(t)
+
+		// no deal stores this piece, so the storage market rejects the condition
+		condition, err := NewCondition(address.StorageMarketAddress, "verifyPieceStored", sys.target, types.SomeCid().Bytes())
+		require.NoError(err)
+
+		result, err := sys.applyConditionalMessage("redeem", 100, condition, condition)
+		require.NoError(err)
+		assert.Equal(uint8(ErrConditionFailed), result.Receipt.ExitCode)
+		assert.EqualError(result.ExecutionError, Errors[ErrConditionFailed].Error())
+	})
+
+	t.Run("close fails when the condition fails", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		sys := setup(t)
+
+		condition, err := NewCondition(address.StorageMarketAddress, "noSuchMethod")
+		require.NoError(err)
+
+		result, err := sys.applyConditionalMessage("close", 100, condition, condition)
+		require.NoError(err)
+		assert.Equal(uint8(ErrConditionFailed), result.Receipt.ExitCode)
+	})
+
+	t.Run("the condition is covered by the voucher signature", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		sys := setup(t)
+
+		condition, err := NewCondition(address.StorageMarketAddress, "getTotalStorage")
+		require.NoError(err)
+
+		// dropping the condition of a conditional voucher invalidates its signature
+		result, err := sys.applyConditionalMessage("redeem", 100, condition, nil)
+		require.NoError(err)
+		assert.EqualError(result.ExecutionError, Errors[ErrInvalidSignature].Error())
+
+		// and so does adding a condition to an unconditional one
+		result, err = sys.applyConditionalMessage("redeem", 100, nil, condition)
+		require.NoError(err)
+		assert.EqualError(result.ExecutionError, Errors[ErrInvalidSignature].Error())
+	})
+}
+
+func TestConditionRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addr := address.NewForTestGetter()()
+	condition, err := NewCondition(address.StorageMarketAddress, "verifyPieceStored", addr, []byte("piece"))
+	require.NoError(err)
+
+	voucher := &PaymentVoucher{Condition: condition}
+	encoded, err := voucher.Encode()
+	require.NoError(err)
+
+	decoded, err := DecodeVoucher(encoded)
+	require.NoError(err)
+	assert.True(condition.Equals(decoded.Condition))
+
+	values, err := decoded.Condition.Values()
+	require.NoError(err)
+	assert.Equal([]interface{}{addr, []byte("piece")}, values)
+}
+
+func TestPaymentBrokerLanes(t *testing.T) {
+	t.Run("redeems vouchers on separate lanes together", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		sys := setup(t)
+
+		result, err := sys.applyVouchersMessage(sys.target, 0, "redeem", 0,
+			sys.Voucher(types.NewAttoFILFromFIL(100), sys.defaultValidAt, 0, 0),
+			sys.Voucher(types.NewAttoFILFromFIL(200), sys.defaultValidAt, 1, 0),
+		)
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+
+		payee := state.MustGetActor(sys.st, sys.target)
+		assert.Equal(types.NewAttoFILFromFIL(300), payee.Balance)
+
+		channel := sys.retrieveChannel(state.MustGetActor(sys.st, address.PaymentBrokerAddress))
+		assert.Equal(types.NewAttoFILFromFIL(300), channel.AmountRedeemed)
+		assert.Equal(types.NewAttoFILFromFIL(100), channel.Lanes["0"].AmountRedeemed)
+		assert.Equal(types.NewAttoFILFromFIL(200), channel.Lanes["1"].AmountRedeemed)
+	})
+
+	t.Run("rejects redeeming and closing without vouchers", func(t *testing.T) {
+		require := require.New(t)
+		sys := setup(t)
+
+		vouchersBytes, err := cbor.DumpObject([]*PaymentVoucher{})
+		require.NoError(err)
+
+		for _, method := range []string{"redeem", "close"} {
+			pdata := core.MustConvertParams(sys.payer, sys.channelID, vouchersBytes)
+			msg := types.NewMessage(sys.target, address.PaymentBrokerAddress, 0, types.NewAttoFILFromFIL(0), method, pdata)
+
+			result, err := sys.ApplyMessage(msg, 0)
+			require.NoError(err)
+			require.EqualError(result.ExecutionError, Errors[ErrNoVouchers].Error())
+		}
+	})
+
+	t.Run("rejects two vouchers for the same lane", func(t *testing.T) {
+		require := require.New(t)
+		sys := setup(t)
+
+		result, err := sys.applyVouchersMessage(sys.target, 0, "redeem", 0,
+			sys.Voucher(types.NewAttoFILFromFIL(100), sys.defaultValidAt, 0, 0),
+			sys.Voucher(types.NewAttoFILFromFIL(200), sys.defaultValidAt, 0, 1),
+		)
+		require.NoError(err)
+		require.EqualError(result.ExecutionError, Errors[ErrInvalidVoucher].Error())
+	})
+
+	t.Run("rejects vouchers superseded by a higher nonce", func(t *testing.T) {
+		require := require.New(t)
+		sys := setup(t)
+
+		result, err := sys.applyVouchersMessage(sys.target, 0, "redeem", 0, sys.Voucher(types.NewAttoFILFromFIL(100), sys.defaultValidAt, 0, 2))
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+
+		result, err = sys.applyVouchersMessage(sys.target, 1, "redeem", 0, sys.Voucher(types.NewAttoFILFromFIL(200), sys.defaultValidAt, 0, 1))
+		require.NoError(err)
+		require.EqualError(result.ExecutionError, Errors[ErrSupersededVoucher].Error())
+	})
+
+	t.Run("merging a lane credits its redeemed amount", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		sys := setup(t)
+
+		result, err := sys.applyVouchersMessage(sys.target, 0, "redeem", 0, sys.Voucher(types.NewAttoFILFromFIL(100), sys.defaultValidAt, 1, 0))
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+
+		// lane 0 takes over lane 1, so only the difference is paid
+		result, err = sys.applyVouchersMessage(sys.target, 1, "redeem", 0, sys.Voucher(types.NewAttoFILFromFIL(300), sys.defaultValidAt, 0, 0, Merge{Lane: 1, Nonce: 1}))
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+
+		payee := state.MustGetActor(sys.st, sys.target)
+		assert.Equal(types.NewAttoFILFromFIL(300), payee.Balance)
+
+		channel := sys.retrieveChannel(state.MustGetActor(sys.st, address.PaymentBrokerAddress))
+		assert.Equal(types.NewAttoFILFromFIL(300), channel.AmountRedeemed)
+		assert.Equal(types.NewZeroAttoFIL(), channel.Lanes["1"].AmountRedeemed)
+		assert.Equal(uint64(1), channel.Lanes["1"].Nonce)
+
+		// the merged lane's old vouchers can no longer be redeemed
+		result, err = sys.applyVouchersMessage(sys.target, 2, "redeem", 0, sys.Voucher(types.NewAttoFILFromFIL(200), sys.defaultValidAt, 1, 0))
+		require.NoError(err)
+		require.EqualError(result.ExecutionError, Errors[ErrSupersededVoucher].Error())
+	})
+
+	t.Run("rejects vouchers merging their own lane", func(t *testing.T) {
+		require := require.New(t)
+		sys := setup(t)
+
+		result, err := sys.applyVouchersMessage(sys.target, 0, "redeem", 0, sys.Voucher(types.NewAttoFILFromFIL(100), sys.defaultValidAt, 0, 0, Merge{Lane: 0, Nonce: 1}))
+		require.NoError(err)
+		require.EqualError(result.ExecutionError, Errors[ErrInvalidMerge].Error())
+	})
+}
+
 func TestPaymentBrokerReclaim(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -381,6 +565,59 @@ func TestPaymentBrokerExtend(t *testing.T) {
 	assert.Equal(types.NewBlockHeight(20), channel.Eol)
 }
 
+func TestPaymentBrokerAddFunds(t *testing.T) {
+	t.Run("adds funds without changing the eol", func(t *testing.T) {
+		require := require.New(t)
+		assert := assert.New(t)
+		sys := setup(t)
+
+		pdata := core.MustConvertParams(sys.channelID)
+		msg := types.NewMessage(sys.payer, address.PaymentBrokerAddress, 1, types.NewAttoFILFromFIL(500), "addFunds", pdata)
+
+		result, err := sys.ApplyMessage(msg, 9)
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+		assert.Equal(uint8(0), result.Receipt.ExitCode)
+
+		// the added funds can be redeemed before the original eol
+		result, err = sys.ApplyRedeemMessageWithBlockHeight(sys.target, 1400, 0, 9)
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+
+		paymentBroker := state.MustGetActor(sys.st, address.PaymentBrokerAddress)
+		assert.Equal(types.NewAttoFILFromFIL(100), paymentBroker.Balance) // 1000 + 500 - 1400
+
+		channel := sys.retrieveChannel(paymentBroker)
+		assert.Equal(types.NewAttoFILFromFIL(1500), channel.Amount)
+		assert.Equal(types.NewAttoFILFromFIL(1400), channel.AmountRedeemed)
+		assert.Equal(types.NewBlockHeight(10), channel.Eol)
+	})
+
+	t.Run("fails with non existent channel", func(t *testing.T) {
+		require := require.New(t)
+		sys := setup(t)
+
+		pdata := core.MustConvertParams(types.NewChannelID(383))
+		msg := types.NewMessage(sys.payer, address.PaymentBrokerAddress, 1, types.NewAttoFILFromFIL(500), "addFunds", pdata)
+
+		result, err := sys.ApplyMessage(msg, 9)
+		require.NoError(err)
+		require.EqualError(result.ExecutionError, Errors[ErrUnknownChannel].Error())
+	})
+
+	t.Run("fails after the eol", func(t *testing.T) {
+		require := require.New(t)
+		sys := setup(t)
+
+		pdata := core.MustConvertParams(sys.channelID)
+		msg := types.NewMessage(sys.payer, address.PaymentBrokerAddress, 1, types.NewAttoFILFromFIL(500), "addFunds", pdata)
+
+		result, err := sys.ApplyMessage(msg, 10)
+		require.NoError(err)
+		require.EqualError(result.ExecutionError, Errors[ErrExpired].Error())
+	})
+}
+
 func TestPaymentBrokerExtendFailsWithNonExistentChannel(t *testing.T) {
 	require := require.New(t)
 	assert := assert.New(t)
@@ -615,12 +852,25 @@ func setup(t *testing.T) system {
 	}
 }
 
-func (sys *system) Signature(amt *types.AttoFIL, validAt *types.BlockHeight) ([]byte, error) {
-	sig, err := SignVoucher(sys.channelID, amt, validAt, sys.payer, mockSigner)
-	if err != nil {
-		return nil, err
+func (sys *system) Voucher(amt *types.AttoFIL, validAt *types.BlockHeight, lane, nonce uint64, merges ...Merge) *PaymentVoucher {
+	sys.t.Helper()
+
+	voucher := &PaymentVoucher{
+		Channel: *sys.channelID,
+		Payer:   sys.payer,
+		Target:  sys.target,
+		Amount:  *amt,
+		ValidAt: *validAt,
+		Lane:    lane,
+		Nonce:   nonce,
+		Merges:  merges,
 	}
-	return ([]byte)(sig), nil
+
+	signature, err := SignVoucher(voucher, mockSigner)
+	require.NoError(sys.t, err)
+	voucher.Signature = signature
+
+	return voucher
 }
 
 func (sys *system) CallQueryMethod(method string, height uint64, params ...interface{}) ([][]byte, uint8, error) {
@@ -683,18 +933,44 @@ func (sys *system) retrieveChannel(paymentBroker *actor.Actor) *PaymentChannel {
 func (sys *system) applySignatureMessage(target address.Address, amtInt uint64, validAt *types.BlockHeight, nonce uint64, method string, height uint64) (*consensus.ApplicationResult, error) {
 	sys.t.Helper()
 
-	require := require.New(sys.t)
+	voucher := sys.Voucher(types.NewAttoFILFromFIL(amtInt), validAt, 0, 0)
 
-	amt := types.NewAttoFILFromFIL(amtInt)
-	signature, err := sys.Signature(amt, validAt)
-	require.NoError(err)
+	return sys.applyVouchersMessage(target, nonce, method, height, voucher)
+}
 
-	pdata := core.MustConvertParams(sys.payer, sys.channelID, amt, validAt, signature)
+func (sys *system) applyVouchersMessage(target address.Address, nonce uint64, method string, height uint64, vouchers ...*PaymentVoucher) (*consensus.ApplicationResult, error) {
+	sys.t.Helper()
+
+	params, err := RedeemParams(vouchers...)
+	require.NoError(sys.t, err)
+
+	pdata := core.MustConvertParams(params...)
 	msg := types.NewMessage(target, address.PaymentBrokerAddress, nonce, types.NewAttoFILFromFIL(0), method, pdata)
 
 	return sys.ApplyMessage(msg, height)
 }
 
+func (sys *system) applyConditionalMessage(method string, amtInt uint64, signed, condition *Condition) (*consensus.ApplicationResult, error) {
+	sys.t.Helper()
+
+	require := require.New(sys.t)
+
+	voucher := &PaymentVoucher{
+		Channel:   *sys.channelID,
+		Payer:     sys.payer,
+		Target:    sys.target,
+		Amount:    *types.NewAttoFILFromFIL(amtInt),
+		ValidAt:   *sys.defaultValidAt,
+		Condition: signed,
+	}
+	signature, err := SignVoucher(voucher, mockSigner)
+	require.NoError(err)
+	voucher.Signature = signature
+	voucher.Condition = condition
+
+	return sys.applyVouchersMessage(sys.target, 0, method, 0, voucher)
+}
+
 func (sys *system) ApplyMessage(msg *types.Message, height uint64) (*consensus.ApplicationResult, error) {
 	return th.ApplyTestMessage(sys.st, sys.vms, msg, types.NewBlockHeight(height))
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"strconv"
 
 	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
@@ -32,6 +33,18 @@ const (
 	ErrUnknownMiner = 34
 	// ErrInsufficientCollateral indicates the collateral is too low.
 	ErrInsufficientCollateral = 43
+	// ErrSlashingFailed indicates the miner could not be slashed.
+	ErrSlashingFailed = 44
+	// ErrInvalidDeal indicates a published deal is malformed or belongs to another miner.
+	ErrInvalidDeal = 45
+	// ErrInvalidDealSignature indicates a published deal was not signed by its client.
+	ErrInvalidDealSignature = 46
+	// ErrUnknownDeal indicates a deal has not been published.
+	ErrUnknownDeal = 47
+	// ErrDealCommitted indicates a deal has already been committed to a sector.
+	ErrDealCommitted = 48
+	// ErrPieceNotStored indicates no committed deal stores a piece in a proven sector.
+	ErrPieceNotStored = 49
 )
 
 // Errors map error codes to revert errors this actor may return.
@@ -39,10 +52,18 @@ var Errors = map[uint8]error{
 	ErrPledgeTooLow:           errors.NewCodedRevertErrorf(ErrPledgeTooLow, "pledge must be at least %s sectors", MinimumPledge),
 	ErrUnknownMiner:           errors.NewCodedRevertErrorf(ErrUnknownMiner, "unknown miner"),
 	ErrInsufficientCollateral: errors.NewCodedRevertErrorf(ErrInsufficientCollateral, "collateral must be more than %s FIL per sector", MinimumCollateralPerSector),
+	ErrSlashingFailed:         errors.NewCodedRevertErrorf(ErrSlashingFailed, "miner could not be slashed"),
+	ErrInvalidDeal:            errors.NewCodedRevertErrorf(ErrInvalidDeal, "invalid deal"),
+	ErrInvalidDealSignature:   errors.NewCodedRevertErrorf(ErrInvalidDealSignature, "deal is not signed by its client"),
+	ErrUnknownDeal:            errors.NewCodedRevertErrorf(ErrUnknownDeal, "unknown deal"),
+	ErrDealCommitted:          errors.NewCodedRevertErrorf(ErrDealCommitted, "deal is already committed to a sector"),
+	ErrPieceNotStored:         errors.NewCodedRevertErrorf(ErrPieceNotStored, "piece is not stored in a proven sector"),
 }
 
 func init() {
 	cbor.RegisterCborType(State{})
+	cbor.RegisterCborType(DealTerms{})
+	cbor.RegisterCborType(Deal{})
 	cbor.RegisterCborType(struct{}{})
 }
 
@@ -57,6 +78,71 @@ type State struct {
 	// TotalCommitedStorage is the number of sectors that are currently committed
 	// in the whole network.
 	TotalCommittedStorage *big.Int
+
+	// Deals maps deal ids to the deals published by miners.
+	Deals cid.Cid `refmt:",omitempty"`
+
+	// NextDealID is the id the next published deal will get.
+	NextDealID uint64
+
+	// PublishedTerms maps the cids of the terms of published deals to their
+	// ids, so that the same deal is never published twice.
+	PublishedTerms cid.Cid `refmt:",omitempty"`
+
+	// PieceSectors maps a miner and a piece to the ids of the sectors the miner
+	// committed deals for the piece to. See pieceSectorsKey.
+	PieceSectors cid.Cid `refmt:",omitempty"`
+}
+
+// DealTerms are the terms of a storage deal. The client signs them when
+// proposing the deal to a miner.
+type DealTerms struct {
+	// PieceRef is the cid of the piece stored in the deal
+	PieceRef cid.Cid
+
+	// Size is the number of bytes of the piece
+	Size *types.BytesAmount
+
+	// TotalPrice is the price the client pays for the whole deal
+	TotalPrice *types.AttoFIL
+
+	// Duration is the number of blocks the piece is stored for
+	Duration uint64
+
+	// Miner is the address of the miner storing the piece
+	Miner address.Address
+
+	// Client is the address of the client paying for the deal
+	Client address.Address
+
+	// Nonce is picked by the client so that the terms of its deals differ even
+	// if it stores the same piece with the same miner more than once
+	Nonce uint64
+}
+
+// Cid returns the cid of the terms, which identifies a deal.
+func (t *DealTerms) Cid() (cid.Cid, error) {
+	obj, err := cbor.WrapObject(t, types.DefaultHashFunction, -1)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return obj.Cid(), nil
+}
+
+// Deal is a storage deal a miner has published to the storage market.
+type Deal struct {
+	Terms DealTerms
+
+	// ClientSignature is the client's signature over Terms
+	ClientSignature types.Signature
+
+	// PublishedAt is the block height at which the miner published the deal
+	PublishedAt *types.BlockHeight
+
+	// Committed is true once the miner committed the sector with id SectorID
+	// that contains the piece.
+	Committed bool
+	SectorID  uint64
 }
 
 // NewActor returns a new storage market actor.
@@ -102,6 +188,38 @@ var storageMarketExports = exec.Exports{
 		Params: []abi.Type{},
 		Return: []abi.Type{abi.Integer},
 	},
+	"slashStorageFault": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address},
+		Return: nil,
+	},
+	"getMinimumCollateral": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Integer},
+		Return: []abi.Type{abi.AttoFIL},
+	},
+	"getMinimumPledge": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: []abi.Type{abi.Integer},
+	},
+	"removeMiner": &exec.FunctionSignature{
+		Params: []abi.Type{},
+		Return: nil,
+	},
+	"publishDeals": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Bytes},
+		Return: []abi.Type{abi.UintArray},
+	},
+	"commitDeals": &exec.FunctionSignature{
+		Params: []abi.Type{abi.SectorID, abi.UintArray},
+		Return: []abi.Type{abi.BlockHeight},
+	},
+	"getDeal": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Integer},
+		Return: []abi.Type{abi.Bytes},
+	},
+	"verifyPieceStored": &exec.FunctionSignature{
+		Params: []abi.Type{abi.Address, abi.Bytes},
+		Return: nil,
+	},
 }
 
 // CreateMiner creates a new miner with the a pledge of the given amount of sectors. The
@@ -169,20 +287,8 @@ func (sma *Actor) UpdatePower(vmctx exec.VMContext, delta *big.Int) (uint8, erro
 
 	var state State
 	_, err := actor.WithState(vmctx, &state, func() (interface{}, error) {
-		miner := vmctx.Message().From
-		ctx := context.Background()
-
-		miners, err := actor.LoadLookup(ctx, vmctx.Storage(), state.Miners)
-		if err != nil {
-			return nil, errors.FaultErrorWrapf(err, "could not load lookup for miner with CID: %s", state.Miners)
-		}
-
-		_, err = miners.Find(ctx, miner.String())
-		if err != nil {
-			if err == hamt.ErrNotFound {
-				return nil, Errors[ErrUnknownMiner]
-			}
-			return nil, errors.FaultErrorWrapf(err, "could not load lookup for miner with address: %s", miner)
+		if err := findMiner(context.Background(), vmctx, &state, vmctx.Message().From); err != nil {
+			return nil, err
 		}
 
 		state.TotalCommittedStorage = state.TotalCommittedStorage.Add(state.TotalCommittedStorage, delta)
@@ -196,6 +302,35 @@ func (sma *Actor) UpdatePower(vmctx exec.VMContext, delta *big.Int) (uint8, erro
 	return 0, nil
 }
 
+// SlashStorageFault may be called by anyone to slash a miner that has not
+// submitted a PoSt by the end of its grace period. The miner's collateral is
+// burnt and its power is removed from the network through UpdatePower.
+func (sma *Actor) SlashStorageFault(vmctx exec.VMContext, minerAddr address.Address) (uint8, error) {
+	if err := vmctx.Charge(100); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(vmctx, &state, func() (interface{}, error) {
+		return nil, findMiner(context.Background(), vmctx, &state, minerAddr)
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	// The miner updates the total storage through UpdatePower, so this call
+	// must not be made while the storage market's state is held.
+	_, ret, err := vmctx.Send(minerAddr, "slashStorageFault", nil, nil)
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+	if ret != 0 {
+		return ErrSlashingFailed, Errors[ErrSlashingFailed]
+	}
+
+	return 0, nil
+}
+
 // GetTotalStorage returns the total amount of proven storage in the system.
 func (sma *Actor) GetTotalStorage(vmctx exec.VMContext) (*big.Int, uint8, error) {
 	if err := vmctx.Charge(100); err != nil {
@@ -218,6 +353,394 @@ func (sma *Actor) GetTotalStorage(vmctx exec.VMContext) (*big.Int, uint8, error)
 	return count, 0, nil
 }
 
+// GetMinimumCollateral returns the minimum amount of collateral a miner must
+// hold to pledge the given number of sectors.
+func (sma *Actor) GetMinimumCollateral(vmctx exec.VMContext, sectors *big.Int) (*types.AttoFIL, uint8, error) {
+	if err := vmctx.Charge(100); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	return MinimumCollateral(sectors), 0, nil
+}
+
+// GetMinimumPledge returns the minimum number of sectors a miner must pledge.
+func (sma *Actor) GetMinimumPledge(vmctx exec.VMContext) (*big.Int, uint8, error) {
+	if err := vmctx.Charge(100); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	return MinimumPledge, 0, nil
+}
+
+// RemoveMiner deregisters the calling miner when it exits. The miner must have
+// removed its power through UpdatePower beforehand.
+func (sma *Actor) RemoveMiner(vmctx exec.VMContext) (uint8, error) {
+	if err := vmctx.Charge(100); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	_, err := actor.WithState(vmctx, &state, func() (interface{}, error) {
+		ctx := context.Background()
+		minerAddr := vmctx.Message().From
+
+		if err := findMiner(ctx, vmctx, &state, minerAddr); err != nil {
+			return nil, err
+		}
+
+		miners, err := actor.WithLookup(ctx, vmctx.Storage(), state.Miners, func(lookup exec.Lookup) error {
+			return lookup.Delete(ctx, minerAddr.String())
+		})
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not remove miner with address: %s", minerAddr)
+		}
+		state.Miners = miners
+
+		return nil, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	return 0, nil
+}
+
+// PublishDeals records deals the calling miner agreed to with its clients. The
+// deals are passed as the cbor encoding of a []Deal, and must all be for the
+// calling miner and signed by their clients. It returns the ids of the deals in
+// the order they were given. A deal whose terms have already been published
+// keeps its id and is not recorded again.
+func (sma *Actor) PublishDeals(vmctx exec.VMContext, dealsBytes []byte) ([]uint64, uint8, error) {
+	if err := vmctx.Charge(100); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var deals []Deal
+	if err := cbor.DecodeInto(dealsBytes, &deals); err != nil {
+		return nil, ErrInvalidDeal, Errors[ErrInvalidDeal]
+	}
+
+	var state State
+	ret, err := actor.WithState(vmctx, &state, func() (interface{}, error) {
+		ctx := context.Background()
+		minerAddr := vmctx.Message().From
+
+		if err := findMiner(ctx, vmctx, &state, minerAddr); err != nil {
+			return nil, err
+		}
+
+		lookup, err := actor.LoadTypedLookup(ctx, vmctx.Storage(), state.Deals, &Deal{})
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not load lookup for deals with CID: %s", state.Deals)
+		}
+
+		published, err := actor.LoadTypedLookup(ctx, vmctx.Storage(), state.PublishedTerms, uint64(0))
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not load lookup for published terms with CID: %s", state.PublishedTerms)
+		}
+
+		ids := make([]uint64, len(deals))
+		for i, deal := range deals {
+			if deal.Terms.Miner != minerAddr || deal.Terms.Size == nil || deal.Terms.TotalPrice == nil {
+				return nil, Errors[ErrInvalidDeal]
+			}
+			if !VerifyDealSignature(&deal.Terms, deal.ClientSignature) {
+				return nil, Errors[ErrInvalidDealSignature]
+			}
+
+			termsCid, err := deal.Terms.Cid()
+			if err != nil {
+				return nil, errors.FaultErrorWrap(err, "could not compute cid of deal terms")
+			}
+
+			id, err := published.Find(ctx, termsCid.String())
+			if err == nil {
+				ids[i] = id.(uint64)
+				continue
+			}
+			if err != hamt.ErrNotFound {
+				return nil, errors.FaultErrorWrapf(err, "could not find published terms with CID: %s", termsCid)
+			}
+
+			deal.PublishedAt = vmctx.BlockHeight()
+			deal.Committed = false
+			deal.SectorID = 0
+
+			ids[i] = state.NextDealID
+			state.NextDealID++
+
+			if err := lookup.Set(ctx, strconv.FormatUint(ids[i], 10), deal); err != nil {
+				return nil, errors.FaultErrorWrapf(err, "could not set deal with id: %d", ids[i])
+			}
+			if err := published.Set(ctx, termsCid.String(), ids[i]); err != nil {
+				return nil, errors.FaultErrorWrapf(err, "could not set published terms with CID: %s", termsCid)
+			}
+		}
+
+		state.Deals, err = lookup.Commit(ctx)
+		if err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not commit deals lookup")
+		}
+
+		state.PublishedTerms, err = published.Commit(ctx)
+		if err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not commit published terms lookup")
+		}
+
+		return ids, nil
+	})
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	ids, ok := ret.([]uint64)
+	if !ok {
+		return nil, 1, errors.NewFaultErrorf("expected []uint64 to be returned, but got %T instead", ret)
+	}
+
+	return ids, 0, nil
+}
+
+// CommitDeals records that the deals with the given ids are stored in the
+// calling miner's sector with the given id. It is called by the miner when it
+// commits the sector, and returns the block height at which the last of the
+// deals expires.
+func (sma *Actor) CommitDeals(vmctx exec.VMContext, sectorID uint64, dealIDs []uint64) (*types.BlockHeight, uint8, error) {
+	if err := vmctx.Charge(100); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	ret, err := actor.WithState(vmctx, &state, func() (interface{}, error) {
+		ctx := context.Background()
+		minerAddr := vmctx.Message().From
+
+		if err := findMiner(ctx, vmctx, &state, minerAddr); err != nil {
+			return nil, err
+		}
+
+		lookup, err := actor.LoadTypedLookup(ctx, vmctx.Storage(), state.Deals, &Deal{})
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not load lookup for deals with CID: %s", state.Deals)
+		}
+
+		pieceSectors, err := actor.LoadTypedLookup(ctx, vmctx.Storage(), state.PieceSectors, []uint64{})
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not load lookup for piece sectors with CID: %s", state.PieceSectors)
+		}
+
+		expiry := types.NewBlockHeight(0)
+		for _, id := range dealIDs {
+			key := strconv.FormatUint(id, 10)
+
+			dealInt, err := lookup.Find(ctx, key)
+			if err != nil {
+				if err == hamt.ErrNotFound {
+					return nil, Errors[ErrUnknownDeal]
+				}
+				return nil, errors.FaultErrorWrapf(err, "could not find deal with id: %d", id)
+			}
+
+			deal, ok := dealInt.(*Deal)
+			if !ok {
+				return nil, errors.NewFaultErrorf("expected *Deal, but got %T instead", dealInt)
+			}
+
+			if deal.Terms.Miner != minerAddr {
+				return nil, Errors[ErrInvalidDeal]
+			}
+			if deal.Committed {
+				return nil, Errors[ErrDealCommitted]
+			}
+
+			deal.Committed = true
+			deal.SectorID = sectorID
+
+			if err := lookup.Set(ctx, key, deal); err != nil {
+				return nil, errors.FaultErrorWrapf(err, "could not set deal with id: %d", id)
+			}
+
+			sectorsKey := pieceSectorsKey(minerAddr, deal.Terms.PieceRef)
+			sectorIDs, err := findPieceSectors(ctx, pieceSectors, sectorsKey)
+			if err != nil {
+				return nil, err
+			}
+			if err := pieceSectors.Set(ctx, sectorsKey, append(sectorIDs, sectorID)); err != nil {
+				return nil, errors.FaultErrorWrapf(err, "could not set piece sectors with key: %s", sectorsKey)
+			}
+
+			if end := deal.PublishedAt.Add(types.NewBlockHeight(deal.Terms.Duration)); end.GreaterThan(expiry) {
+				expiry = end
+			}
+		}
+
+		state.Deals, err = lookup.Commit(ctx)
+		if err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not commit deals lookup")
+		}
+
+		state.PieceSectors, err = pieceSectors.Commit(ctx)
+		if err != nil {
+			return nil, errors.FaultErrorWrap(err, "could not commit piece sectors lookup")
+		}
+
+		return expiry, nil
+	})
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	expiry, ok := ret.(*types.BlockHeight)
+	if !ok {
+		return nil, 1, errors.NewFaultErrorf("expected *types.BlockHeight to be returned, but got %T instead", ret)
+	}
+
+	return expiry, 0, nil
+}
+
+// GetDeal returns the cbor encoding of the deal with the given id.
+func (sma *Actor) GetDeal(vmctx exec.VMContext, dealID *big.Int) ([]byte, uint8, error) {
+	if err := vmctx.Charge(100); err != nil {
+		return nil, exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	var state State
+	ret, err := actor.WithState(vmctx, &state, func() (interface{}, error) {
+		ctx := context.Background()
+
+		lookup, err := actor.LoadTypedLookup(ctx, vmctx.Storage(), state.Deals, &Deal{})
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not load lookup for deals with CID: %s", state.Deals)
+		}
+
+		deal, err := lookup.Find(ctx, dealID.String())
+		if err != nil {
+			if err == hamt.ErrNotFound {
+				return nil, Errors[ErrUnknownDeal]
+			}
+			return nil, errors.FaultErrorWrapf(err, "could not find deal with id: %s", dealID)
+		}
+
+		return deal, nil
+	})
+	if err != nil {
+		return nil, errors.CodeError(err), err
+	}
+
+	out, err := cbor.DumpObject(ret)
+	if err != nil {
+		return nil, 1, errors.FaultErrorWrap(err, "failed to marshal deal")
+	}
+
+	return out, 0, nil
+}
+
+// VerifyPieceStored succeeds if the miner has committed a deal for the piece
+// with the given cid to a sector it is still proving. Clients use it as the
+// condition of the payment vouchers of their storage deals.
+func (sma *Actor) VerifyPieceStored(vmctx exec.VMContext, minerAddr address.Address, pieceRefBytes []byte) (uint8, error) {
+	if err := vmctx.Charge(100); err != nil {
+		return exec.ErrInsufficientGas, errors.RevertErrorWrap(err, "Insufficient gas")
+	}
+
+	pieceRef, err := cid.Cast(pieceRefBytes)
+	if err != nil {
+		return ErrInvalidDeal, Errors[ErrInvalidDeal]
+	}
+
+	var state State
+	ret, err := actor.WithState(vmctx, &state, func() (interface{}, error) {
+		ctx := context.Background()
+
+		pieceSectors, err := actor.LoadTypedLookup(ctx, vmctx.Storage(), state.PieceSectors, []uint64{})
+		if err != nil {
+			return nil, errors.FaultErrorWrapf(err, "could not load lookup for piece sectors with CID: %s", state.PieceSectors)
+		}
+
+		sectorIDs, err := findPieceSectors(ctx, pieceSectors, pieceSectorsKey(minerAddr, pieceRef))
+		if err != nil {
+			return nil, err
+		}
+
+		return sectorIDs, nil
+	})
+	if err != nil {
+		return errors.CodeError(err), err
+	}
+
+	sectorIDs, ok := ret.([]uint64)
+	if !ok {
+		return 1, errors.NewFaultErrorf("expected []uint64, but got %T instead", ret)
+	}
+
+	for _, sectorID := range sectorIDs {
+		_, code, err := vmctx.Send(minerAddr, "verifySectorProven", nil, []interface{}{sectorID})
+		if errors.IsFault(err) {
+			return errors.CodeError(err), err
+		}
+		if err == nil && code == 0 {
+			return 0, nil
+		}
+	}
+
+	return ErrPieceNotStored, Errors[ErrPieceNotStored]
+}
+
+// pieceSectorsKey is the key of the sectors of a miner storing a piece in the
+// PieceSectors lookup.
+func pieceSectorsKey(minerAddr address.Address, pieceRef cid.Cid) string {
+	return minerAddr.String() + "/" + pieceRef.String()
+}
+
+// findPieceSectors returns the sector ids stored under key in the
+// PieceSectors lookup, which are none if the key is not found.
+func findPieceSectors(ctx context.Context, pieceSectors exec.Lookup, key string) ([]uint64, error) {
+	sectorIDs, err := pieceSectors.Find(ctx, key)
+	if err == hamt.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.FaultErrorWrapf(err, "could not find piece sectors with key: %s", key)
+	}
+	return sectorIDs.([]uint64), nil
+}
+
+// findMiner returns an error if minerAddr is not a miner created by the storage market.
+func findMiner(ctx context.Context, vmctx exec.VMContext, state *State, minerAddr address.Address) error {
+	miners, err := actor.LoadLookup(ctx, vmctx.Storage(), state.Miners)
+	if err != nil {
+		return errors.FaultErrorWrapf(err, "could not load lookup for miner with CID: %s", state.Miners)
+	}
+
+	_, err = miners.Find(ctx, minerAddr.String())
+	if err != nil {
+		if err == hamt.ErrNotFound {
+			return Errors[ErrUnknownMiner]
+		}
+		return errors.FaultErrorWrapf(err, "could not load lookup for miner with address: %s", minerAddr)
+	}
+
+	return nil
+}
+
+// SignDealTerms signs the terms of a deal with the key of its client.
+func SignDealTerms(terms *DealTerms, signer types.Signer) (types.Signature, error) {
+	data, err := cbor.DumpObject(terms)
+	if err != nil {
+		return nil, err
+	}
+	return signer.SignBytes(data, terms.Client)
+}
+
+// VerifyDealSignature returns whether sig is the signature of the deal's client over its terms.
+func VerifyDealSignature(terms *DealTerms, sig types.Signature) bool {
+	data, err := cbor.DumpObject(terms)
+	if err != nil {
+		return false
+	}
+	return types.IsValidSignature(data, terms.Client, sig)
+}
+
 // MinimumCollateral returns the minimum required amount of collateral for a given pledge
 func MinimumCollateral(sectors *big.Int) *types.AttoFIL {
 	return MinimumCollateralPerSector.MulBigInt(sectors)
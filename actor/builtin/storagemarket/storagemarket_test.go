@@ -13,10 +13,14 @@ import (
 	. "github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/state"
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 )
 
 func TestStorageMarketCreateMiner(t *testing.T) {
@@ -139,6 +143,249 @@ func TestStorageMarkeCreateMinerErrorsOnInvalidKey(t *testing.T) {
 	assert.Contains(result.ExecutionError.Error(), miner.Errors[miner.ErrPublicKeyTooBig].Error())
 }
 
+func TestStorageMarketSlashStorageFault(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	st, vms := core.CreateStorages(ctx, t)
+
+	pdata := actor.MustConvertParams(big.NewInt(10), []byte{}, th.RequireRandomPeerID())
+	msg := types.NewMessage(address.TestAddress, address.StorageMarketAddress, 0, types.NewAttoFILFromFIL(100), "createMiner", pdata)
+	result, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(0))
+	require.NoError(err)
+	require.NoError(result.ExecutionError)
+
+	minerAddr, err := address.NewFromBytes(result.Receipt.Return[0])
+	require.NoError(err)
+
+	result, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{})
+	require.NoError(err)
+	require.NoError(result.ExecutionError)
+
+	// a miner cannot be slashed before the end of its grace period
+	gracePeriodEnd := types.NewBlockHeight(3).Add(miner.ProvingPeriodBlocks).Add(miner.GracePeriodBlocks)
+	msg = types.NewMessage(address.TestAddress2, address.StorageMarketAddress, 0, types.NewAttoFILFromFIL(0), "slashStorageFault", actor.MustConvertParams(minerAddr))
+	result, err = th.ApplyTestMessage(st, vms, msg, gracePeriodEnd)
+	require.NoError(err)
+	require.NotNil(result.ExecutionError)
+	assert.Contains(result.ExecutionError.Error(), miner.Errors[miner.ErrNotInStorageFault].Error())
+
+	// anyone can slash a miner once its grace period is over
+	msg = types.NewMessage(address.TestAddress2, address.StorageMarketAddress, 0, types.NewAttoFILFromFIL(0), "slashStorageFault", actor.MustConvertParams(minerAddr))
+	result, err = th.ApplyTestMessage(st, vms, msg, gracePeriodEnd.Add(types.NewBlockHeight(1)))
+	require.NoError(err)
+	require.NoError(result.ExecutionError)
+	require.Equal(uint8(0), result.Receipt.ExitCode)
+
+	minerActor, err := st.GetActor(ctx, minerAddr)
+	require.NoError(err)
+
+	var mstor miner.State
+	builtin.RequireReadState(t, vms, minerAddr, minerActor, &mstor)
+	assert.True(mstor.Collateral.IsZero())
+	assert.True(minerActor.Balance.IsZero())
+	assert.Equal(0, mstor.Power.Sign())
+
+	var smstor State
+	storageMkt, err := st.GetActor(ctx, address.StorageMarketAddress)
+	require.NoError(err)
+	builtin.RequireReadState(t, vms, address.StorageMarketAddress, storageMkt, &smstor)
+	assert.Equal(0, smstor.TotalCommittedStorage.Sign())
+}
+
+func TestStorageMarketSlashStorageFaultUnknownMiner(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	st, vms := core.CreateStorages(ctx, t)
+
+	msg := types.NewMessage(address.TestAddress, address.StorageMarketAddress, 0, types.NewAttoFILFromFIL(0), "slashStorageFault", actor.MustConvertParams(address.TestAddress2))
+	result, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(0))
+	require.NoError(err)
+	require.NotNil(result.ExecutionError)
+	assert.Contains(result.ExecutionError.Error(), Errors[ErrUnknownMiner].Error())
+}
+
+func TestStorageMarketPublishAndCommitDeals(t *testing.T) {
+	ctx := context.Background()
+
+	signer := types.NewMockSigner(types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed()))
+	clientAddr := signer.Addresses[0]
+
+	createMinerAndDeal := func(t *testing.T) (state.Tree, vm.StorageMap, address.Address, Deal) {
+		st, vms := core.CreateStorages(ctx, t)
+
+		pdata := actor.MustConvertParams(big.NewInt(10), []byte{}, th.RequireRandomPeerID())
+		msg := types.NewMessage(address.TestAddress, address.StorageMarketAddress, 0, types.NewAttoFILFromFIL(100), "createMiner", pdata)
+		result, err := th.ApplyTestMessage(st, vms, msg, types.NewBlockHeight(0))
+		require.NoError(t, err)
+		require.NoError(t, result.ExecutionError)
+
+		minerAddr, err := address.NewFromBytes(result.Receipt.Return[0])
+		require.NoError(t, err)
+
+		terms := DealTerms{
+			PieceRef:   types.SomeCid(),
+			Size:       types.NewBytesAmount(1000),
+			TotalPrice: types.NewAttoFILFromFIL(5),
+			Duration:   10000,
+			Miner:      minerAddr,
+			Client:     clientAddr,
+		}
+		sig, err := SignDealTerms(&terms, signer)
+		require.NoError(t, err)
+
+		return st, vms, minerAddr, Deal{Terms: terms, ClientSignature: sig}
+	}
+
+	t.Run("records published deals and the sector they are committed to", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		st, vms, minerAddr, deal := createMinerAndDeal(t)
+
+		dealsBytes, err := cbor.DumpObject([]Deal{deal, deal})
+		require.NoError(err)
+
+		result, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 2, "publishDeals", dealsBytes)
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+
+		// the same deal is only recorded once
+		var ids []uint64
+		require.NoError(cbor.DecodeInto(result.Receipt.Return[0], &ids))
+		assert.Equal([]uint64{0, 0}, ids)
+
+		other := deal
+		other.Terms.Duration++
+		other.ClientSignature, err = SignDealTerms(&other.Terms, signer)
+		require.NoError(err)
+		dealsBytes, err = cbor.DumpObject([]Deal{deal, other})
+		require.NoError(err)
+
+		result, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 2, "publishDeals", dealsBytes)
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+		require.NoError(cbor.DecodeInto(result.Receipt.Return[0], &ids))
+		assert.Equal([]uint64{0, 1}, ids)
+
+		// the same piece stored again under a new nonce is a separate deal
+		again := deal
+		again.Terms.Nonce++
+		again.ClientSignature, err = SignDealTerms(&again.Terms, signer)
+		require.NoError(err)
+		dealsBytes, err = cbor.DumpObject([]Deal{again})
+		require.NoError(err)
+
+		result, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 2, "publishDeals", dealsBytes)
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+		require.NoError(cbor.DecodeInto(result.Receipt.Return[0], &ids))
+		assert.Equal([]uint64{2}, ids)
+
+		result, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(7), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{1})
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+
+		result, err = th.CreateAndApplyTestMessage(t, st, vms, address.StorageMarketAddress, 0, 4, "getDeal", big.NewInt(1))
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+
+		var recorded Deal
+		require.NoError(cbor.DecodeInto(result.Receipt.Return[0], &recorded))
+		assert.Equal(deal.Terms.PieceRef, recorded.Terms.PieceRef)
+		assert.Equal(minerAddr, recorded.Terms.Miner)
+		assert.Equal(types.NewBlockHeight(2), recorded.PublishedAt)
+		assert.True(recorded.Committed)
+		assert.Equal(uint64(7), recorded.SectorID)
+
+		// a deal can only be committed once
+		result, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 5, "commitSector", uint64(8), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{1})
+		require.NoError(err)
+		require.NotNil(result.ExecutionError)
+		assert.Contains(result.ExecutionError.Error(), Errors[ErrDealCommitted].Error())
+	})
+
+	t.Run("verifies pieces stored in proven sectors", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		st, vms, minerAddr, deal := createMinerAndDeal(t)
+		pieceRef := deal.Terms.PieceRef.Bytes()
+
+		dealsBytes, err := cbor.DumpObject([]Deal{deal})
+		require.NoError(err)
+
+		result, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 2, "publishDeals", dealsBytes)
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+
+		// published but not yet committed
+		result, err = th.CreateAndApplyTestMessage(t, st, vms, address.StorageMarketAddress, 0, 3, "verifyPieceStored", minerAddr, pieceRef)
+		require.NoError(err)
+		assert.EqualError(result.ExecutionError, Errors[ErrPieceNotStored].Error())
+
+		result, err = th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 3, "commitSector", uint64(1), th.MakeCommitment(), th.MakeCommitment(), th.MakeCommitment(), th.MakeRandomBytes(int(proofs.SealBytesLen)), []uint64{0})
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+
+		result, err = th.CreateAndApplyTestMessage(t, st, vms, address.StorageMarketAddress, 0, 4, "verifyPieceStored", minerAddr, pieceRef)
+		require.NoError(err)
+		require.NoError(result.ExecutionError)
+		assert.Equal(uint8(0), result.Receipt.ExitCode)
+
+		// another miner does not store the piece
+		result, err = th.CreateAndApplyTestMessage(t, st, vms, address.StorageMarketAddress, 0, 4, "verifyPieceStored", address.TestAddress2, pieceRef)
+		require.NoError(err)
+		assert.EqualError(result.ExecutionError, Errors[ErrPieceNotStored].Error())
+
+		// the miner has missed its PoSt deadline
+		late := miner.ProvingPeriodBlocks.Add(miner.GracePeriodBlocks).Add(types.NewBlockHeight(4))
+		result, err = th.CreateAndApplyTestMessage(t, st, vms, address.StorageMarketAddress, 0, late.AsBigInt().Uint64(), "verifyPieceStored", minerAddr, pieceRef)
+		require.NoError(err)
+		assert.EqualError(result.ExecutionError, Errors[ErrPieceNotStored].Error())
+	})
+
+	t.Run("rejects deals not signed by their client", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		st, vms, minerAddr, deal := createMinerAndDeal(t)
+		deal.Terms.TotalPrice = types.NewAttoFILFromFIL(1)
+
+		dealsBytes, err := cbor.DumpObject([]Deal{deal})
+		require.NoError(err)
+
+		result, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 2, "publishDeals", dealsBytes)
+		require.NoError(err)
+		require.NotNil(result.ExecutionError)
+		assert.Contains(result.ExecutionError.Error(), Errors[ErrInvalidDealSignature].Error())
+	})
+
+	t.Run("rejects deals for another miner", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		st, vms, minerAddr, deal := createMinerAndDeal(t)
+		deal.Terms.Miner = address.TestAddress2
+		sig, err := SignDealTerms(&deal.Terms, signer)
+		require.NoError(err)
+		deal.ClientSignature = sig
+
+		dealsBytes, err := cbor.DumpObject([]Deal{deal})
+		require.NoError(err)
+
+		result, err := th.CreateAndApplyTestMessage(t, st, vms, minerAddr, 0, 2, "publishDeals", dealsBytes)
+		require.NoError(err)
+		require.NotNil(result.ExecutionError)
+		assert.Contains(result.ExecutionError.Error(), Errors[ErrInvalidDeal].Error())
+	})
+}
+
 func TestMinimumCollateral(t *testing.T) {
 	assert := assert.New(t)
 	numSectors := big.NewInt(25000)
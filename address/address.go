@@ -96,13 +96,23 @@ func NewTestnet(hash []byte) Address {
 
 // New constructs a new address for the given nework.
 func New(network Network, hash []byte) Address {
+	return NewWithProtocol(network, Version, hash)
+}
+
+// NewWithProtocol constructs a new address for the given network of a key of
+// the given protocol.
+func NewWithProtocol(network Network, protocol Protocol, hash []byte) Address {
 	var addr [Length]byte
 	addr[0] = network
-	addr[1] = Version
+	addr[1] = protocol
 	copy(addr[2:], hash)
 	return addr
 }
 
+func validProtocol(protocol Protocol) bool {
+	return protocol == SECP256K1 || protocol == BLS
+}
+
 // NewFromString tries to parse a given string into a filecoin address.
 func NewFromString(s string) (Address, error) {
 	networkString, version, hash, err := decode(s)
@@ -115,11 +125,11 @@ func NewFromString(s string) (Address, error) {
 		return Address{}, err
 	}
 
-	if version != Version {
+	if !validProtocol(version) {
 		return Address{}, ErrUnknownVersion
 	}
 
-	return New(network, hash), nil
+	return NewWithProtocol(network, version, hash), nil
 }
 
 // NewFromBytes tries to create an address from the given bytes.
@@ -134,11 +144,11 @@ func NewFromBytes(raw []byte) (Address, error) {
 	}
 
 	version := raw[1]
-	if version != Version {
+	if !validProtocol(version) {
 		return Address{}, ErrUnknownVersion
 	}
 
-	return New(network, raw[2:]), nil
+	return NewWithProtocol(network, version, raw[2:]), nil
 }
 
 // ParseError checks if the given address parses as a valid filecoin address.
@@ -152,7 +162,7 @@ func ParseError(addr string) error {
 		return errors.Wrap(err, "invalid network")
 	}
 
-	if version != Version {
+	if !validProtocol(version) {
 		return fmt.Errorf("invalid version: version=%d", version)
 	}
 
@@ -178,6 +188,12 @@ func (a Address) Version() byte {
 	return a[1]
 }
 
+// Protocol returns the protocol of the address, the type of key it is
+// derived from.
+func (a Address) Protocol() Protocol {
+	return a[1]
+}
+
 // Hash returns the hash part of the address.
 func (a Address) Hash() []byte {
 	return a[2:]
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
 )
 
 var hashes = make([][]byte, 5)
@@ -69,6 +70,26 @@ func TestValidAddresses(t *testing.T) {
 	}
 }
 
+func TestBLSAddress(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	a := NewWithProtocol(Mainnet, BLS, hashes[0])
+	assert.Equal(BLS, a.Protocol())
+	assert.Equal(hashes[0], a.Hash())
+	assert.NotEqual(NewMainnet(hashes[0]), a)
+	assert.Equal(SECP256K1, NewMainnet(hashes[0]).Protocol())
+
+	fromString, err := NewFromString(a.String())
+	require.NoError(err)
+	assert.Equal(a, fromString)
+	assert.NoError(ParseError(a.String()))
+
+	fromBytes, err := NewFromBytes(a.Bytes())
+	require.NoError(err)
+	assert.Equal(a, fromBytes)
+}
+
 func TestInvalidAddressCreation(t *testing.T) {
 	testCases := []struct {
 		input                    string
@@ -113,10 +134,10 @@ func TestInvalidAddressCreation(t *testing.T) {
 		assert.Equal(ErrUnknownNetwork, err)
 	})
 
-	t.Run(fmt.Sprintf("NewFromBytes supports only AddressVersion %d", Version), func(t *testing.T) {
+	t.Run("NewFromBytes supports only known protocols", func(t *testing.T) {
 		assert := assert.New(t)
 
-		_, err := NewFromBytes([]byte{Testnet, Version + 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+		_, err := NewFromBytes([]byte{Testnet, BLS + 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
 		assert.Error(err)
 		assert.Equal(ErrUnknownVersion, err)
 	})
@@ -10,8 +10,21 @@ const HashLength = 20
 // Length is the lengh of a full address in bytes.
 const Length = 1 + 1 + HashLength
 
-// Version is the current version of the address format.
-const Version byte = 0
+// Protocol identifies the type of key an address is derived from. It is
+// stored in the version byte of the address.
+type Protocol = byte
+
+const (
+	// SECP256K1 is the protocol of addresses of secp256k1 keys. Actor
+	// addresses use it as well.
+	SECP256K1 Protocol = iota
+	// BLS is the protocol of addresses of BLS keys.
+	BLS
+)
+
+// Version is the version of the address format used for addresses that are
+// not derived from a BLS key.
+const Version byte = SECP256K1
 
 // Base32Charset is the character set used for base32 encoding in addresses.
 const Base32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
@@ -42,6 +55,9 @@ var (
 	StorageMarketAddress Address
 	// PaymentBrokerAddress is the hard-coded address of the filecoin storage market
 	PaymentBrokerAddress Address
+	// BurnAddress is an address without a key, so funds sent to it can never
+	// be spent
+	BurnAddress Address
 )
 
 func init() {
@@ -59,4 +75,7 @@ func init() {
 
 	p := Hash([]byte("payments"))
 	PaymentBrokerAddress = NewMainnet(p)
+
+	b := Hash([]byte("burn"))
+	BurnAddress = NewMainnet(b)
 }
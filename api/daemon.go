@@ -20,6 +20,8 @@ type Daemon interface {
 type DaemonInitConfig struct {
 	// GenesisFile, path to a file containing archive of genesis block DAG data
 	GenesisFile string
+	// ImportSnapshot, path to a chain snapshot file to initialize the chain from instead of the genesis block
+	ImportSnapshot string
 	// RepoDir, path to the repo of the node on disk.
 	RepoDir string
 	// PeerKeyFile is the path to a file containing a libp2p peer id key
@@ -47,6 +49,13 @@ func GenesisFile(p string) DaemonInitOpt {
 	}
 }
 
+// ImportSnapshot defines a chain snapshot file to initialize the chain from on daemon init.
+func ImportSnapshot(p string) DaemonInitOpt {
+	return func(dc *DaemonInitConfig) {
+		dc.ImportSnapshot = p
+	}
+}
+
 // RepoDir defines the location on disk of the repo.
 func RepoDir(p string) DaemonInitOpt {
 	return func(dc *DaemonInitConfig) {
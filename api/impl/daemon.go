@@ -107,6 +107,10 @@ func (nd *nodeDaemon) Init(ctx context.Context, opts ...api.DaemonInitOpt) error
 		}
 	}
 
+	if cfg.GenesisFile != "" && cfg.ImportSnapshot != "" {
+		return fmt.Errorf(`cannot use both "--genesisfile" and "--import-snapshot" options`)
+	}
+
 	if cfg.DevnetTest && cfg.DevnetNightly {
 		return fmt.Errorf(`cannot use both "--devnet-test" and "--devnet-nightly" options`)
 	}
@@ -161,6 +165,13 @@ func (nd *nodeDaemon) Init(ctx context.Context, opts ...api.DaemonInitOpt) error
 
 			return &blk, nil
 		}
+	case cfg.ImportSnapshot != "":
+		root, err := loadCar(rep, cfg.ImportSnapshot)
+		if err != nil {
+			return err
+		}
+
+		initopts = append(initopts, node.SnapshotOpt(root))
 	}
 
 	// TODO: don't create the repo if this fails
@@ -178,11 +189,17 @@ func loadPeerKey(fname string) (crypto.PrivKey, error) {
 
 // LoadGenesis gets the genesis block from either a local car file or an HTTP(S) URL.
 func LoadGenesis(rep repo.Repo, sourceName string) (cid.Cid, error) {
+	return loadCar(rep, sourceName)
+}
+
+// loadCar loads a car file with a single root from either a local file or an
+// HTTP(S) URL into the repo's datastore and returns its root.
+func loadCar(rep repo.Repo, sourceName string) (cid.Cid, error) {
 	var source io.ReadCloser
 
 	sourceURL, err := url.Parse(sourceName)
 	if err != nil {
-		return cid.Undef, fmt.Errorf("invalid filepath or URL for genesis file: %s", sourceURL)
+		return cid.Undef, fmt.Errorf("invalid filepath or URL for car file: %s", sourceURL)
 	}
 	if sourceURL.Scheme == "http" || sourceURL.Scheme == "https" {
 		// NOTE: This code is temporary. It allows downloading a genesis block via HTTP(S) to be able to join a
@@ -193,7 +210,7 @@ func LoadGenesis(rep repo.Repo, sourceName string) (cid.Cid, error) {
 		}
 		source = response.Body
 	} else if sourceURL.Scheme != "" {
-		return cid.Undef, fmt.Errorf("unsupported protocol for genesis file: %s", sourceURL.Scheme)
+		return cid.Undef, fmt.Errorf("unsupported protocol for car file: %s", sourceURL.Scheme)
 	} else {
 		file, err := os.Open(sourceName)
 		if err != nil {
@@ -65,7 +65,7 @@ func (np *nodePaych) Ls(ctx context.Context, fromAddr, payerAddr address.Address
 	return channels, nil
 }
 
-func (np *nodePaych) Voucher(ctx context.Context, fromAddr address.Address, channel *types.ChannelID, amount *types.AttoFIL, validAt *types.BlockHeight) (string, error) {
+func (np *nodePaych) Voucher(ctx context.Context, fromAddr address.Address, channel *types.ChannelID, amount *types.AttoFIL, validAt *types.BlockHeight, lane, nonce uint64) (string, error) {
 	nd := np.api.node
 
 	if err := setDefaultFromAddr(&fromAddr, nd); err != nil {
@@ -88,7 +88,10 @@ func (np *nodePaych) Voucher(ctx context.Context, fromAddr address.Address, chan
 		return "", err
 	}
 
-	sig, err := paymentbroker.SignVoucher(channel, amount, validAt, fromAddr, nd.Wallet)
+	voucher.Lane = lane
+	voucher.Nonce = nonce
+
+	sig, err := paymentbroker.SignVoucher(&voucher, nd.Wallet)
 	if err != nil {
 		return "", err
 	}
@@ -97,8 +100,8 @@ func (np *nodePaych) Voucher(ctx context.Context, fromAddr address.Address, chan
 	return voucher.Encode()
 }
 
-func (np *nodePaych) Redeem(ctx context.Context, fromAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, voucherRaw string) (cid.Cid, error) {
-	voucher, err := paymentbroker.DecodeVoucher(voucherRaw)
+func (np *nodePaych) Redeem(ctx context.Context, fromAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, vouchersRaw ...string) (cid.Cid, error) {
+	params, err := paymentbroker.DecodeRedeemParams(vouchersRaw...)
 	if err != nil {
 		return cid.Undef, err
 	}
@@ -111,7 +114,7 @@ func (np *nodePaych) Redeem(ctx context.Context, fromAddr address.Address, gasPr
 		gasPrice,
 		gasLimit,
 		"redeem",
-		voucher.Payer, &voucher.Channel, &voucher.Amount, &voucher.ValidAt, []byte(voucher.Signature),
+		params...,
 	)
 }
 
@@ -128,8 +131,8 @@ func (np *nodePaych) Reclaim(ctx context.Context, fromAddr address.Address, gasP
 	)
 }
 
-func (np *nodePaych) Close(ctx context.Context, fromAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, voucherRaw string) (cid.Cid, error) {
-	voucher, err := paymentbroker.DecodeVoucher(voucherRaw)
+func (np *nodePaych) Close(ctx context.Context, fromAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, vouchersRaw ...string) (cid.Cid, error) {
+	params, err := paymentbroker.DecodeRedeemParams(vouchersRaw...)
 	if err != nil {
 		return cid.Undef, err
 	}
@@ -142,7 +145,7 @@ func (np *nodePaych) Close(ctx context.Context, fromAddr address.Address, gasPri
 		gasPrice,
 		gasLimit,
 		"close",
-		voucher.Payer, &voucher.Channel, &voucher.Amount, &voucher.ValidAt, []byte(voucher.Signature),
+		params...,
 	)
 }
 
@@ -158,3 +161,16 @@ func (np *nodePaych) Extend(ctx context.Context, fromAddr address.Address, gasPr
 		channel, eol,
 	)
 }
+
+func (np *nodePaych) AddFunds(ctx context.Context, fromAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, channel *types.ChannelID, amount *types.AttoFIL) (cid.Cid, error) {
+	return np.porcelainAPI.MessageSendWithDefaultAddress(
+		ctx,
+		fromAddr,
+		address.PaymentBrokerAddress,
+		amount,
+		gasPrice,
+		gasLimit,
+		"addFunds",
+		channel,
+	)
+}
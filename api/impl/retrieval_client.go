@@ -7,6 +7,7 @@ import (
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 type nodeRetrievalClient struct {
@@ -17,11 +18,11 @@ func newNodeRetrievalClient(api *nodeAPI) *nodeRetrievalClient {
 	return &nodeRetrievalClient{api: api}
 }
 
-func (nrc *nodeRetrievalClient) RetrievePiece(ctx context.Context, pieceCID cid.Cid, minerAddr address.Address) (io.ReadCloser, error) {
+func (nrc *nodeRetrievalClient) RetrievePiece(ctx context.Context, pieceCID cid.Cid, minerAddr address.Address, offset, length uint64, maxPrice *types.AttoFIL) (io.ReadCloser, error) {
 	minerPeerID, err := nrc.api.node.Lookup().GetPeerIDByMinerAddress(ctx, minerAddr)
 	if err != nil {
 		return nil, err
 	}
 
-	return nrc.api.node.RetrievalClient.RetrievePiece(ctx, minerPeerID, pieceCID)
+	return nrc.api.node.RetrievalClient.RetrievePiece(ctx, minerPeerID, pieceCID, offset, length, maxPrice)
 }
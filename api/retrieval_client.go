@@ -7,9 +7,10 @@ import (
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 // RetrievalClient is the interface that defines methods to manage retrieval client operations.
 type RetrievalClient interface {
-	RetrievePiece(ctx context.Context, pieceCID cid.Cid, minerAddr address.Address) (io.ReadCloser, error)
+	RetrievePiece(ctx context.Context, pieceCID cid.Cid, minerAddr address.Address, offset, length uint64, maxPrice *types.AttoFIL) (io.ReadCloser, error)
 }
@@ -255,6 +255,7 @@ func build() {
 	buildGengen()
 	buildFaucet()
 	buildGenesisFileServer()
+	buildRemoteSigner()
 	generateGenesis()
 }
 
@@ -263,6 +264,7 @@ func forcebuild() {
 	buildGengen()
 	buildFaucet()
 	buildGenesisFileServer()
+	buildRemoteSigner()
 	generateGenesis()
 }
 
@@ -319,6 +321,12 @@ func buildGenesisFileServer() {
 	runCmd(cmd([]string{"go", "build", "-o", "./tools/genesis-file-server/genesis-file-server", "./tools/genesis-file-server/"}...))
 }
 
+func buildRemoteSigner() {
+	log.Println("Building remote signer...")
+
+	runCmd(cmd([]string{"go", "build", "-o", "./tools/remote-signer/remote-signer", "./tools/remote-signer/"}...))
+}
+
 func install() {
 	log.Println("Installing...")
 
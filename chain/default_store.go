@@ -26,6 +26,14 @@ var logStore = logging.Logger("chain.store")
 
 var headKey = datastore.NewKey("/chain/heaviestTipSet")
 
+// snapshotBaseKey is the key the cids of the oldest tipset of an imported
+// chain snapshot are stored at.
+var snapshotBaseKey = datastore.NewKey("/chain/snapshotBase")
+
+// stateHorizonKey is the key the height below which the garbage collector
+// deleted the state of the tipsets of the head chain is stored at.
+var stateHorizonKey = datastore.NewKey("/chain/stateHorizon")
+
 // DefaultStore is a generic implementation of the Store interface.
 // It works(tm) for now.
 type DefaultStore struct {
@@ -36,6 +44,8 @@ type DefaultStore struct {
 	// simplify checking the security guarantee that only tipsets of a
 	// validated chain are stored in the filecoin node's DefaultStore.
 	privateStore *hamt.CborIpldStore
+	// blockstore is the blockstore backing the privateStore.
+	blockstore bstore.Blockstore
 	// stateStore is the on disk storage used for loading states.  It can be
 	// shared with the rest of the filecoin node.
 	stateStore *hamt.CborIpldStore
@@ -48,7 +58,16 @@ type DefaultStore struct {
 	genesis cid.Cid
 	// head is the tipset at the head of the best known chain.
 	head types.TipSet
-	// Protects head and genesisCid.
+	// snapshotBase is the oldest tipset of the chain snapshot the store was
+	// initialized from, if any. The store trusts it and its state without
+	// knowing its ancestors, so walks through the chain end there instead
+	// of at the genesis block.
+	snapshotBase types.SortedCidSet
+	// stateHorizon is the height below which the garbage collector deleted
+	// the state of the tipsets, which the tipIndex tracks with an undefined
+	// state root.
+	stateHorizon uint64
+	// Protects head, genesisCid, snapshotBase and stateHorizon.
 	mu sync.RWMutex
 
 	// headEvents is a pubsub channel that publishes an event every time the head changes.
@@ -74,6 +93,7 @@ func NewDefaultStore(ds repo.Datastore, stateStore *hamt.CborIpldStore, genesisC
 	priv := hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
 	return &DefaultStore{
 		privateStore: &priv,
+		blockstore:   bs,
 		stateStore:   stateStore,
 		headEvents:   pubsub.New(128),
 		ds:           ds,
@@ -97,11 +117,27 @@ func NewDefaultStore(ds repo.Datastore, stateStore *hamt.CborIpldStore, genesisC
 // head does not link back to the expected genesis block, or the Store's
 // datastore does not store a link in the chain.  In case of error the caller
 // should not consider the chain useable and propagate the error.
+//
+// If the store was initialized from a chain snapshot, Load stops at the oldest
+// tipset of the snapshot, which it trusts in place of the genesis block.
 func (store *DefaultStore) Load(ctx context.Context) error {
 	tipCids, err := store.loadHead()
 	if err != nil {
 		return err
 	}
+	snapshotBase, err := store.loadSnapshotBase()
+	if err != nil {
+		return err
+	}
+	stateHorizon, err := store.loadStateHorizon()
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	store.snapshotBase = snapshotBase
+	store.stateHorizon = stateHorizon
+	store.mu.Unlock()
+
 	headTs := types.TipSet{}
 	// traverse starting from head to begin loading the chain
 	var startHeight types.Uint64
@@ -129,6 +165,11 @@ func (store *DefaultStore) Load(ctx context.Context) error {
 		if err != nil {
 			return false, err
 		}
+		genesii = ts
+		if uint64(tips[0].Height) < stateHorizon {
+			// the state of the tipset was garbage collected
+			return true, store.tipIndex.Put(&TipSetAndState{TipSet: ts})
+		}
 		stateRoot, err := store.loadStateRoot(ts)
 		if err != nil {
 			return false, err
@@ -142,12 +183,15 @@ func (store *DefaultStore) Load(ctx context.Context) error {
 		}
 		// TODO: we should probably warm up the block cache with the
 		// most recent tipsets traversed here.
-		genesii = ts
 		return true, nil
 	})
 	if err != nil {
 		return err
 	}
+	if store.isSnapshotBase(genesii.ToSlice()) {
+		logStore.Infof("finished loading %d tipsets from %s down to snapshot %s", startHeight, headTs.String(), genesii.String())
+		return store.SetHead(ctx, headTs)
+	}
 	// Check genesis here.
 	if len(genesii) != 1 {
 		return errors.Errorf("genesis tip set must be a single block, got %d blocks", len(genesii))
@@ -180,6 +224,102 @@ func (store *DefaultStore) loadHead() (types.SortedCidSet, error) {
 	return cids, nil
 }
 
+// loadSnapshotBase loads the cids of the oldest tipset of the chain snapshot
+// the store was initialized from. It returns an empty set if the store was
+// initialized from the genesis block.
+func (store *DefaultStore) loadSnapshotBase() (types.SortedCidSet, error) {
+	var cids types.SortedCidSet
+	bb, err := store.ds.Get(snapshotBaseKey)
+	if err == datastore.ErrNotFound {
+		return cids, nil
+	} else if err != nil {
+		return cids, errors.Wrap(err, "failed to read snapshotBaseKey")
+	}
+
+	if err := json.Unmarshal(bb, &cids); err != nil {
+		return cids, errors.Wrap(err, "failed to cast snapshot base cids")
+	}
+	return cids, nil
+}
+
+// setSnapshotBase marks ts as the oldest tipset of the chain snapshot the
+// store is initialized from.
+func (store *DefaultStore) setSnapshotBase(ts types.TipSet) error {
+	cids := ts.ToSortedCidSet()
+	val, err := json.Marshal(cids)
+	if err != nil {
+		return err
+	}
+	if err := store.ds.Put(snapshotBaseKey, val); err != nil {
+		return errors.Wrap(err, "failed to write snapshot base to datastore")
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.snapshotBase = cids
+	return nil
+}
+
+// isSnapshotBase returns true if tips are the blocks of the oldest tipset of
+// the chain snapshot the store was initialized from.
+func (store *DefaultStore) isSnapshotBase(tips []*types.Block) bool {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	if store.snapshotBase.Len() != len(tips) {
+		return false
+	}
+	for _, blk := range tips {
+		if !store.snapshotBase.Has(blk.Cid()) {
+			return false
+		}
+	}
+	return true
+}
+
+// loadStateHorizon loads the height below which the garbage collector
+// deleted the state of the tipsets. It returns 0 if it never did.
+func (store *DefaultStore) loadStateHorizon() (uint64, error) {
+	bb, err := store.ds.Get(stateHorizonKey)
+	if err == datastore.ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Wrap(err, "failed to read stateHorizonKey")
+	}
+
+	var h uint64
+	if err := json.Unmarshal(bb, &h); err != nil {
+		return 0, errors.Wrap(err, "failed to cast state horizon")
+	}
+	return h, nil
+}
+
+// collectState marks the state of the tipsets below height h as deleted by
+// the garbage collector, persisting h so that Load does not look for it.
+// The tipsets stay in the tipIndex, with an undefined state root.
+func (store *DefaultStore) collectState(h uint64, tsass []*TipSetAndState) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if h > store.stateHorizon {
+		val, err := json.Marshal(h)
+		if err != nil {
+			return err
+		}
+		if err := store.ds.Put(stateHorizonKey, val); err != nil {
+			return errors.Wrap(err, "failed to write state horizon to datastore")
+		}
+		store.stateHorizon = h
+	}
+
+	for _, tsas := range tsass {
+		if err := store.tipIndex.Put(&TipSetAndState{TipSet: tsas.TipSet}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (store *DefaultStore) loadStateRoot(ts types.TipSet) (cid.Cid, error) {
 	h, err := ts.Height()
 	if err != nil {
@@ -365,6 +505,24 @@ func (store *DefaultStore) writeTipSetAndState(tsas *TipSetAndState) error {
 	return store.ds.Put(key, val)
 }
 
+// removeTipSetAndState removes a tipset and its state root from the tipindex
+// and the datastore. It does not delete the blocks of the tipset.
+func (store *DefaultStore) removeTipSetAndState(tsas *TipSetAndState) error {
+	if err := store.tipIndex.Remove(tsas.TipSet.String()); err != nil {
+		return err
+	}
+
+	h, err := tsas.TipSet.Height()
+	if err != nil {
+		return err
+	}
+	key := datastore.NewKey(makeKey(tsas.TipSet.String(), h))
+	if err := store.ds.Delete(key); err != nil && err != datastore.ErrNotFound {
+		return errors.Wrapf(err, "failed to delete state root of tipset %s", tsas.TipSet.String())
+	}
+	return nil
+}
+
 // Head returns the current head.
 func (store *DefaultStore) Head() types.TipSet {
 	store.mu.RLock()
@@ -389,6 +547,7 @@ func (store *DefaultStore) LatestState(ctx context.Context) (state.Tree, error)
 // BlockHistory returns a channel of block pointers (or errors), starting with the input tipset
 // followed by each subsequent parent and ending with the genesis block, after which the channel
 // is closed. If an error is encountered while fetching a block, the error is sent, and the channel is closed.
+// If the store was initialized from a chain snapshot, the history ends with the oldest tipset of the snapshot.
 func (store *DefaultStore) BlockHistory(ctx context.Context, start types.TipSet) <-chan interface{} {
 	ctx = logStore.Start(ctx, "BlockHistory")
 	out := make(chan interface{})
@@ -420,6 +579,8 @@ func (store *DefaultStore) BlockHistory(ctx context.Context, start types.TipSet)
 }
 
 // walkChain walks backward through the chain, starting at tips, invoking cb() at each height.
+// It stops after the genesis block or the oldest tipset of the chain snapshot the store was
+// initialized from.
 func (store *DefaultStore) walkChain(ctx context.Context, tips []*types.Block, cb func(tips []*types.Block) (cont bool, err error)) error {
 	for {
 		cont, err := cb(tips)
@@ -433,6 +594,9 @@ func (store *DefaultStore) walkChain(ctx context.Context, tips []*types.Block, c
 		if ids.Empty() {
 			break
 		}
+		if store.isSnapshotBase(tips) {
+			break
+		}
 
 		tips = tips[:0]
 		for it := ids.Iter(); !it.Complete(); it.Next() {
@@ -19,6 +19,9 @@ import (
 // The amount of time the syncer will wait while fetching the blocks of a
 // tipset over the network.
 var blkWaitTime = time.Second // TODO set this parameter in an informed way too
+
+// The number of tipsets the syncer asks its TipSetFetcher for at once.
+var fetchTipSetsLength = 100
 var (
 	// ErrChainHasBadTipSet is returned when the syncer traverses a chain with a cached bad tipset.
 	ErrChainHasBadTipSet = errors.New("input chain contains a cached bad tipset")
@@ -61,12 +64,19 @@ type DefaultSyncer struct {
 	badTipSets *badTipSetCache
 	consensus  consensus.Protocol
 	chainStore Store
+	// fetcher fetches runs of tipsets from peers in bulk. It may be nil, in
+	// which case blocks are only fetched with cstOnline.
+	fetcher TipSetFetcher
+	// fetched holds the blocks the fetcher returned while collecting a chain,
+	// by cid.
+	fetched map[cid.Cid]*types.Block
 }
 
 var _ Syncer = (*DefaultSyncer)(nil)
 
-// NewDefaultSyncer constructs a DefaultSyncer ready for use.
-func NewDefaultSyncer(online, offline *hamt.CborIpldStore, c consensus.Protocol, s Store) Syncer {
+// NewDefaultSyncer constructs a DefaultSyncer ready for use. The fetcher
+// may be nil.
+func NewDefaultSyncer(online, offline *hamt.CborIpldStore, c consensus.Protocol, s Store, fetcher TipSetFetcher) *DefaultSyncer {
 	return &DefaultSyncer{
 		cstOnline:  online,
 		cstOffline: offline,
@@ -75,36 +85,45 @@ func NewDefaultSyncer(online, offline *hamt.CborIpldStore, c consensus.Protocol,
 		},
 		consensus:  c,
 		chainStore: s,
+		fetcher:    fetcher,
+		fetched:    make(map[cid.Cid]*types.Block),
 	}
 }
 
 // getBlksMaybeFromNet resolves cids of blocks.  It gets blocks from local
 // storage if they are available there, and otherwise resolves blocks over
-// the network.  This function will timeout if blocks are unavailable.
+// the network.  Blocks missing locally are first fetched from peers together
+// with the run of their ancestors with the syncer's TipSetFetcher, and then
+// resolved one by one with cstOnline.  This function will timeout if blocks
+// are unavailable.
 // This method is all or nothing, it will error if any of the blocks cannot be
 // resolved.
 // WARNING -- this will take one second to error out if blocks are not found.
 // TODO the timeout factor blkWaitTime and maybe the whole timeout mechanism
 // could use some actual thought, this was just a simple first pass.
 func (syncer *DefaultSyncer) getBlksMaybeFromNet(ctx context.Context, blkCids []cid.Cid) ([]*types.Block, error) {
+	if syncer.fetcher != nil {
+		for _, blkCid := range blkCids {
+			if _, ok := syncer.getBlkLocally(ctx, blkCid); !ok {
+				syncer.fetchTipSets(ctx, blkCids)
+				break
+			}
+		}
+	}
+
 	var blks []*types.Block
 	ctx, cancel := context.WithTimeout(ctx, blkWaitTime)
 	defer cancel()
 	for _, blkCid := range blkCids {
-		// try the chain store
-		blk, err := syncer.chainStore.GetBlock(ctx, blkCid)
-		if err == nil {
-			blks = append(blks, blk)
-			continue
-		}
-		// try the node's local offline storage
-		err = syncer.cstOffline.Get(ctx, blkCid, &blk)
-		if err == nil {
+		// try the chain store, the node's local offline storage and the
+		// blocks fetched from peers
+		blk, ok := syncer.getBlkLocally(ctx, blkCid)
+		if ok {
 			blks = append(blks, blk)
 			continue
 		}
 		// try the network
-		if err = syncer.cstOnline.Get(ctx, blkCid, &blk); err != nil {
+		if err := syncer.cstOnline.Get(ctx, blkCid, &blk); err != nil {
 			return nil, err
 		}
 		blks = append(blks, blk)
@@ -112,6 +131,39 @@ func (syncer *DefaultSyncer) getBlksMaybeFromNet(ctx context.Context, blkCids []
 	return blks, nil
 }
 
+// getBlkLocally resolves the cid of a block from the chain store, the node's
+// local offline storage or the blocks fetched from peers.
+func (syncer *DefaultSyncer) getBlkLocally(ctx context.Context, blkCid cid.Cid) (*types.Block, bool) {
+	blk, err := syncer.chainStore.GetBlock(ctx, blkCid)
+	if err == nil {
+		return blk, true
+	}
+	err = syncer.cstOffline.Get(ctx, blkCid, &blk)
+	if err == nil {
+		return blk, true
+	}
+	blk, ok := syncer.fetched[blkCid]
+	return blk, ok
+}
+
+// fetchTipSets fetches the tipset made of the blocks with cids blkCids and
+// the run of its ancestors from peers, and keeps their blocks for
+// getBlksMaybeFromNet.  The blocks are only used when their cids are asked
+// for, so peers cannot substitute blocks.  Failures are logged and leave the
+// syncer to resolve the blocks with cstOnline.
+func (syncer *DefaultSyncer) fetchTipSets(ctx context.Context, blkCids []cid.Cid) {
+	tipsets, err := syncer.fetcher.FetchTipSets(ctx, blkCids, fetchTipSetsLength)
+	if err != nil {
+		logSyncer.Infof("failed to fetch tipsets from peers, falling back to bitswap: %s", err)
+		return
+	}
+	for _, blks := range tipsets {
+		for _, blk := range blks {
+			syncer.fetched[blk.Cid()] = blk
+		}
+	}
+}
+
 // collectChain resolves the cids of the head tipset and its ancestors to blocks
 // until it resolves blocks contained in the Store. collectChain may resolve cids
 // from the Store, the node's local offline cborstore, or the syncer's online
@@ -178,6 +230,10 @@ func (syncer *DefaultSyncer) tipSetState(ctx context.Context, tsKey string) (sta
 	if err != nil {
 		return nil, err
 	}
+	if !tsas.TipSetStateRoot.Defined() {
+		// a fork off a tipset this old can no longer be validated
+		return nil, errors.Wrapf(ErrStateCollected, "cannot load state of tipset %s", tsKey)
+	}
 	st, err := state.LoadStateTree(ctx, syncer.cstOffline, tsas.TipSetStateRoot, builtin.Actors)
 	if err != nil {
 		return nil, err
@@ -329,6 +385,11 @@ func (syncer *DefaultSyncer) HandleNewBlocks(ctx context.Context, blkCids []cid.
 
 	syncer.mu.Lock()
 	defer syncer.mu.Unlock()
+	// Forget the blocks fetched from peers once the chain is synced, they
+	// are in the store if they were valid.
+	defer func() {
+		syncer.fetched = make(map[cid.Cid]*types.Block)
+	}()
 	// If the store already has all these blocks the syncer is finished.
 	if syncer.chainStore.HasAllBlocks(ctx, blkCids) {
 		return nil
@@ -2,6 +2,7 @@ package chain_test
 
 import (
 	"context"
+	"errors"
 	"github.com/filecoin-project/go-filecoin/chain"
 	"testing"
 
@@ -203,7 +204,7 @@ func initSyncTest(require *require.Assertions, con consensus.Protocol, genFunc f
 	chainDS := r.ChainDatastore()
 	chainStore := chain.NewDefaultStore(chainDS, cst, calcGenBlk.Cid())
 
-	syncer := chain.NewDefaultSyncer(cst, cst, con, chainStore) // note we use same cst for on and offline for tests
+	syncer := chain.NewDefaultSyncer(cst, cst, con, chainStore, nil) // note we use same cst for on and offline for tests
 
 	// Initialize stores to contain genesis block and state
 	calcGenTS := testhelpers.RequireNewTipSet(require, calcGenBlk)
@@ -412,6 +413,65 @@ func TestSyncChainHead(t *testing.T) {
 	assertHead(assert, chainStore, link4)
 }
 
+type fakeTipSetFetcher struct {
+	tipsets [][]*types.Block
+	err     error
+	calls   int
+}
+
+func (f *fakeTipSetFetcher) FetchTipSets(ctx context.Context, start []cid.Cid, count int) ([][]*types.Block, error) {
+	f.calls++
+	return f.tipsets, f.err
+}
+
+// Syncer syncs a whole chain given only the head cids by fetching its tipsets
+// in bulk.
+func TestSyncChainHeadWithFetcher(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	_, chainStore, cst, con := initSyncTestWithPowerTable(require, &testhelpers.TestView{})
+	ctx := context.Background()
+
+	fetcher := &fakeTipSetFetcher{
+		tipsets: [][]*types.Block{link4.ToSlice(), link3.ToSlice(), link2.ToSlice(), link1.ToSlice()},
+	}
+	syncer := chain.NewDefaultSyncer(cst, cst, con, chainStore, fetcher)
+
+	err := syncer.HandleNewBlocks(ctx, link4.ToSortedCidSet().ToSlice())
+	assert.NoError(err)
+	assert.Equal(1, fetcher.calls)
+	assertTsAdded(assert, chainStore, link4)
+	assertTsAdded(assert, chainStore, link3)
+	assertTsAdded(assert, chainStore, link2)
+	assertTsAdded(assert, chainStore, link1)
+	assertHead(assert, chainStore, link4)
+}
+
+// Syncer falls back to resolving blocks one by one if fetching tipsets in
+// bulk fails or returns other blocks.
+func TestSyncChainHeadFetcherFallback(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	for _, fetcher := range []*fakeTipSetFetcher{
+		{err: errors.New("no peers")},
+		{tipsets: [][]*types.Block{{link3blk1}}},
+	} {
+		_, chainStore, cst, con := initSyncTestWithPowerTable(require, &testhelpers.TestView{})
+		syncer := chain.NewDefaultSyncer(cst, cst, con, chainStore, fetcher)
+
+		_ = requirePutBlocks(require, cst, link1.ToSlice()...)
+		cids2 := requirePutBlocks(require, cst, link2.ToSlice()...)
+
+		err := syncer.HandleNewBlocks(ctx, cids2)
+		assert.NoError(err)
+		assertTsAdded(assert, chainStore, link2)
+		assertTsAdded(assert, chainStore, link1)
+		assertHead(assert, chainStore, link2)
+	}
+}
+
 // Syncer determines the heavier fork.
 func TestSyncIgnoreLightFork(t *testing.T) {
 	assert := assert.New(t)
@@ -809,7 +869,7 @@ func TestTipSetWeightDeep(t *testing.T) {
 	// Now sync the chainStore with consensus using a MarketView.
 	verifier = proofs.NewFakeVerifier(true, nil)
 	con = consensus.NewExpected(cst, bs, testhelpers.NewTestProcessor(), &consensus.MarketView{}, calcGenBlk.Cid(), verifier)
-	syncer := chain.NewDefaultSyncer(cst, cst, con, chainStore)
+	syncer := chain.NewDefaultSyncer(cst, cst, con, chainStore, nil)
 	baseTS := chainStore.Head() // this is the last block of the bootstrapping chain creating miners
 	require.Equal(1, len(baseTS))
 	bootstrapStateRoot := baseTS.ToSlice()[0].StateRoot
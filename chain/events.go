@@ -0,0 +1,463 @@
+package chain
+
+import (
+	"context"
+	"sync"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
+	"gx/ipfs/QmdbxjQWogRCHRaxhhGnYdT1oQJzL9GdqSKzCdqWr85AP2/pubsub"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+var logEvents = logging.Logger("chain.events")
+
+// HeadChangeTopic is the topic Events publishes head changes on.
+const HeadChangeTopic = "head-change"
+
+// HeadChange is a change of the head of the chain.
+type HeadChange struct {
+	// Revert are the tipsets the new head no longer descends from, newest
+	// first.
+	Revert []types.TipSet
+	// Apply are the tipsets the new head descends from that the old head
+	// did not, oldest first. The last one is the new head.
+	Apply []types.TipSet
+}
+
+// CollectHeadChange walks back from the old and the new head to their common
+// ancestor and returns the tipsets it passed on the way. If old is empty the
+// change applies just the new head.
+func CollectHeadChange(ctx context.Context, chainReader ReadStore, old, new types.TipSet) (*HeadChange, error) {
+	change := &HeadChange{}
+	if len(old) == 0 {
+		change.Apply = []types.TipSet{new}
+		return change, nil
+	}
+
+	var apply []types.TipSet
+	for !old.Equals(new) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		oldHeight, err := old.Height()
+		if err != nil {
+			return nil, err
+		}
+		newHeight, err := new.Height()
+		if err != nil {
+			return nil, err
+		}
+
+		if oldHeight >= newHeight {
+			change.Revert = append(change.Revert, old)
+			if old, err = parentTipSet(ctx, chainReader, old); err != nil {
+				return nil, err
+			}
+		}
+		if newHeight >= oldHeight {
+			apply = append(apply, new)
+			if new, err = parentTipSet(ctx, chainReader, new); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i := len(apply) - 1; i >= 0; i-- {
+		change.Apply = append(change.Apply, apply[i])
+	}
+	return change, nil
+}
+
+func parentTipSet(ctx context.Context, chainReader ReadStore, ts types.TipSet) (types.TipSet, error) {
+	parents, err := ts.Parents()
+	if err != nil {
+		return nil, err
+	}
+	if parents.Empty() {
+		return nil, errors.New("tipsets have no common ancestor")
+	}
+	tsas, err := chainReader.GetTipSetAndState(ctx, parents.String())
+	if err != nil {
+		return nil, err
+	}
+	return tsas.TipSet, nil
+}
+
+// HeightHandler is called when the chain reaches a height.
+type HeightHandler func(ctx context.Context, ts types.TipSet) error
+
+// MessageHandler is called when a message is included in the chain.
+type MessageHandler func(ctx context.Context, msg *types.SignedMessage, ts types.TipSet) error
+
+// RevertHandler is called when a reorg reverts the tipset a HeightHandler or
+// MessageHandler was called with.
+type RevertHandler func(ctx context.Context, ts types.TipSet) error
+
+// MessageFinder returns the tipset in the chain that included the message
+// with the given cid, or an empty tipset if the chain does not include it.
+type MessageFinder func(ctx context.Context, msgCid cid.Cid) (types.TipSet, error)
+
+// heightWatch is a HeightHandler waiting for a height.
+type heightWatch struct {
+	ctx        context.Context
+	height     uint64
+	confidence uint64
+	handler    HeightHandler
+	revert     RevertHandler
+
+	// target is the first tipset at or above height on the chain, empty
+	// until the chain reaches height.
+	target       types.TipSet
+	targetHeight uint64
+	called       bool
+}
+
+// msgWatch is a MessageHandler waiting for a message.
+type msgWatch struct {
+	ctx        context.Context
+	msgCid     cid.Cid
+	confidence uint64
+	handler    MessageHandler
+	revert     RevertHandler
+
+	// included is the tipset that included the message, empty until the
+	// chain includes it.
+	included       types.TipSet
+	includedHeight uint64
+	msg            *types.SignedMessage
+	called         bool
+}
+
+// Events turns the heads the store publishes into a stream of head changes
+// that say which tipsets a reorg reverted and which it applied, and calls
+// handlers when the chain reaches a height or includes a message, and again
+// on reorgs. Handlers wait for the given confidence, the number of heights
+// the chain has to grow past the tipset they are called with, and are called
+// at most once per tipset. If a reorg reverts that tipset their revert handler
+// is called and they are called again once the new chain satisfies them.
+// Handlers are called one at a time in the order of the changes to the chain.
+type Events struct {
+	chainReader ReadStore
+	findMessage MessageFinder
+	headChanges *pubsub.PubSub
+
+	mu      sync.Mutex
+	head    types.TipSet
+	heights []*heightWatch
+	msgs    []*msgWatch
+}
+
+// NewEvents returns a new Events for the chain tracked by chainReader.
+// findMessage finds the messages that are already in the chain when a handler
+// is registered for them, if it is nil only messages included later are
+// found.
+func NewEvents(chainReader ReadStore, findMessage MessageFinder) *Events {
+	return &Events{
+		chainReader: chainReader,
+		findMessage: findMessage,
+		headChanges: pubsub.New(128),
+	}
+}
+
+// HeadChanges returns a pubsub interface that publishes a HeadChange on
+// HeadChangeTopic after each change of the head, once the handlers for it
+// were called.
+func (e *Events) HeadChanges() *pubsub.PubSub {
+	return e.headChanges
+}
+
+// Start follows the head of the chain until ctx is done.
+func (e *Events) Start(ctx context.Context) {
+	headCh := e.chainReader.HeadEvents().Sub(NewHeadTopic)
+
+	e.mu.Lock()
+	e.head = e.chainReader.Head()
+	e.mu.Unlock()
+
+	go func() {
+		defer e.chainReader.HeadEvents().Unsub(headCh, NewHeadTopic)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case raw, ok := <-headCh:
+				if !ok {
+					return
+				}
+				head, ok := raw.(types.TipSet)
+				if !ok || len(head) == 0 {
+					continue
+				}
+				if err := e.headChanged(ctx, head); err != nil {
+					logEvents.Errorf("failed to process new head %s: %s", head.String(), err)
+				}
+			}
+		}
+	}()
+}
+
+// ChainAt calls handler with the first tipset at or above height once the
+// chain is confidence heights past it, and revert if a reorg reverts that
+// tipset. The handlers stay registered until ctx is done.
+func (e *Events) ChainAt(ctx context.Context, height, confidence uint64, handler HeightHandler, revert RevertHandler) error {
+	w := &heightWatch{
+		ctx:        ctx,
+		height:     height,
+		confidence: confidence,
+		handler:    handler,
+		revert:     revert,
+	}
+
+	e.mu.Lock()
+	head := e.head
+	headHeight, err := heightOf(head)
+	if err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	if len(head) > 0 && headHeight >= height {
+		// find the first tipset at or above height in the current chain
+		ts := head
+		for {
+			h, err := ts.Height()
+			if err != nil {
+				e.mu.Unlock()
+				return err
+			}
+			if h < height {
+				break
+			}
+			w.target, w.targetHeight = ts, h
+			if ts, err = parentTipSet(ctx, e.chainReader, ts); err != nil {
+				break
+			}
+		}
+	}
+	call := e.checkHeight(headHeight, w)
+	e.heights = append(e.heights, w)
+	e.mu.Unlock()
+
+	runCalls([]func(){call})
+	return nil
+}
+
+// Called calls handler with the message with the given cid and the tipset
+// that included it once the chain is confidence heights past that tipset, and
+// revert if a reorg reverts that tipset. The handlers stay registered until
+// ctx is done.
+func (e *Events) Called(ctx context.Context, msgCid cid.Cid, confidence uint64, handler MessageHandler, revert RevertHandler) error {
+	w := &msgWatch{
+		ctx:        ctx,
+		msgCid:     msgCid,
+		confidence: confidence,
+		handler:    handler,
+		revert:     revert,
+	}
+
+	var included types.TipSet
+	if e.findMessage != nil {
+		var err error
+		if included, err = e.findMessage(ctx, msgCid); err != nil {
+			return errors.Wrap(err, "failed to find message")
+		}
+	}
+
+	e.mu.Lock()
+	headHeight, err := heightOf(e.head)
+	if err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	if len(included) > 0 {
+		h, err := included.Height()
+		if err != nil {
+			e.mu.Unlock()
+			return err
+		}
+		// the message may have been found in a tipset that has not been
+		// applied yet, applying it will find the message again
+		if h <= headHeight {
+			w.msg = findMessageIn(included, msgCid)
+			w.included, w.includedHeight = included, h
+		}
+	}
+	call := e.checkMsg(headHeight, w)
+	e.msgs = append(e.msgs, w)
+	e.mu.Unlock()
+
+	runCalls([]func(){call})
+	return nil
+}
+
+// headChanged reverts and applies the tipsets between the current head and
+// the new head and calls the handlers that are due.
+func (e *Events) headChanged(ctx context.Context, newHead types.TipSet) error {
+	e.mu.Lock()
+	change, err := CollectHeadChange(ctx, e.chainReader, e.head, newHead)
+	if err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	e.dropDone()
+
+	var calls []func()
+	for _, ts := range change.Revert {
+		calls = append(calls, e.revert(ts)...)
+	}
+	for _, ts := range change.Apply {
+		if err := e.apply(ts); err != nil {
+			e.mu.Unlock()
+			return err
+		}
+	}
+	e.head = newHead
+	headHeight, err := heightOf(newHead)
+	if err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	for _, w := range e.heights {
+		calls = append(calls, e.checkHeight(headHeight, w))
+	}
+	for _, w := range e.msgs {
+		calls = append(calls, e.checkMsg(headHeight, w))
+	}
+	e.mu.Unlock()
+
+	runCalls(calls)
+	e.headChanges.Pub(change, HeadChangeTopic)
+	return nil
+}
+
+// revert resets the watches satisfied by a reverted tipset and returns the
+// calls of the revert handlers of the ones that were called.
+func (e *Events) revert(ts types.TipSet) []func() {
+	var calls []func()
+	for _, w := range e.heights {
+		if len(w.target) == 0 || !w.target.Equals(ts) {
+			continue
+		}
+		if w.called && w.revert != nil {
+			w := w
+			calls = append(calls, func() { logHandlerErr(w.revert(w.ctx, ts)) })
+		}
+		w.target, w.targetHeight, w.called = nil, 0, false
+	}
+	for _, w := range e.msgs {
+		if len(w.included) == 0 || !w.included.Equals(ts) {
+			continue
+		}
+		if w.called && w.revert != nil {
+			w := w
+			calls = append(calls, func() { logHandlerErr(w.revert(w.ctx, ts)) })
+		}
+		w.included, w.includedHeight, w.msg, w.called = nil, 0, nil, false
+	}
+	return calls
+}
+
+// apply records the watches an applied tipset satisfies.
+func (e *Events) apply(ts types.TipSet) error {
+	h, err := ts.Height()
+	if err != nil {
+		return err
+	}
+	for _, w := range e.heights {
+		if len(w.target) == 0 && h >= w.height {
+			w.target, w.targetHeight = ts, h
+		}
+	}
+	for _, w := range e.msgs {
+		if len(w.included) > 0 {
+			continue
+		}
+		if msg := findMessageIn(ts, w.msgCid); msg != nil {
+			w.included, w.includedHeight, w.msg = ts, h, msg
+		}
+	}
+	return nil
+}
+
+// checkHeight returns the call of the handler of w if the chain is
+// confidence heights past its target at headHeight, and marks it called. It
+// returns nil otherwise.
+func (e *Events) checkHeight(headHeight uint64, w *heightWatch) func() {
+	if w.called || len(w.target) == 0 || headHeight < w.targetHeight+w.confidence {
+		return nil
+	}
+	w.called = true
+	ts := w.target
+	return func() { logHandlerErr(w.handler(w.ctx, ts)) }
+}
+
+// checkMsg returns the call of the handler of w if the chain is confidence
+// heights past the tipset that included its message at headHeight, and marks
+// it called. It returns nil otherwise.
+func (e *Events) checkMsg(headHeight uint64, w *msgWatch) func() {
+	if w.called || len(w.included) == 0 || headHeight < w.includedHeight+w.confidence {
+		return nil
+	}
+	w.called = true
+	msg, ts := w.msg, w.included
+	return func() { logHandlerErr(w.handler(w.ctx, msg, ts)) }
+}
+
+// dropDone removes the watches whose context is done.
+func (e *Events) dropDone() {
+	heights := e.heights[:0]
+	for _, w := range e.heights {
+		if w.ctx.Err() == nil {
+			heights = append(heights, w)
+		}
+	}
+	e.heights = heights
+
+	msgs := e.msgs[:0]
+	for _, w := range e.msgs {
+		if w.ctx.Err() == nil {
+			msgs = append(msgs, w)
+		}
+	}
+	e.msgs = msgs
+}
+
+// runCalls runs the non-nil calls in order.
+func runCalls(calls []func()) {
+	for _, call := range calls {
+		if call != nil {
+			call()
+		}
+	}
+}
+
+func logHandlerErr(err error) {
+	if err != nil {
+		logEvents.Warningf("chain event handler failed: %s", err)
+	}
+}
+
+// heightOf returns the height of ts, or 0 if it is empty.
+func heightOf(ts types.TipSet) (uint64, error) {
+	if len(ts) == 0 {
+		return 0, nil
+	}
+	return ts.Height()
+}
+
+// findMessageIn returns the message with the given cid from the blocks of ts,
+// or nil if none of them includes it.
+func findMessageIn(ts types.TipSet, msgCid cid.Cid) *types.SignedMessage {
+	for _, blk := range ts {
+		for _, msg := range blk.Messages {
+			c, err := msg.Cid()
+			if err == nil && c.Equals(msgCid) {
+				return msg
+			}
+		}
+	}
+	return nil
+}
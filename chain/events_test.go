@@ -0,0 +1,211 @@
+package chain_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+var newEventsTestMessage = types.NewSignedMessageForTestGetter(types.NewMockSigner(types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed())))
+
+func newEventsTestStore(ctx context.Context, require *require.Assertions) *chain.DefaultStore {
+	r, bs, cst := newSnapshotTestRepo()
+	chainStore, err := chain.Init(ctx, r, bs, cst, consensus.InitGenesis)
+	require.NoError(err)
+	return chainStore
+}
+
+// requireExtend puts a single block tipset with the given messages on top of
+// parent into the store. Blocks with the same parent differ by nonce.
+func requireExtend(ctx context.Context, require *require.Assertions, chainStore *chain.DefaultStore, parent types.TipSet, nonce uint64, msgs ...*types.SignedMessage) types.TipSet {
+	stateRoot := parent.ToSlice()[0].StateRoot
+	blk := chain.RequireMkFakeChild(require, chain.FakeChildParams{Parent: parent, GenesisCid: chainStore.GenesisCid(), StateRoot: stateRoot, Nonce: nonce})
+	blk.Messages = msgs
+	ts := testhelpers.RequireNewTipSet(require, blk)
+	chain.RequirePutTsas(ctx, require, chainStore, &chain.TipSetAndState{TipSet: ts, TipSetStateRoot: stateRoot})
+	return ts
+}
+
+// requireSetHead sets the head of the store and waits for events to process
+// it.
+func requireSetHead(ctx context.Context, require *require.Assertions, chainStore *chain.DefaultStore, changes chan interface{}, ts types.TipSet) *chain.HeadChange {
+	require.NoError(chainStore.SetHead(ctx, ts))
+	select {
+	case raw := <-changes:
+		return raw.(*chain.HeadChange)
+	case <-time.After(5 * time.Second):
+		require.Fail("timed out waiting for head change")
+		return nil
+	}
+}
+
+func requireMsgCid(require *require.Assertions, msg *types.SignedMessage) cid.Cid {
+	c, err := msg.Cid()
+	require.NoError(err)
+	return c
+}
+
+func TestCollectHeadChange(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	chainStore := newEventsTestStore(ctx, require)
+	genesis := chainStore.Head()
+	a1 := requireExtend(ctx, require, chainStore, genesis, 0)
+	a2 := requireExtend(ctx, require, chainStore, a1, 0)
+	b1 := requireExtend(ctx, require, chainStore, genesis, 1)
+	b2 := requireExtend(ctx, require, chainStore, b1, 0)
+	b3 := requireExtend(ctx, require, chainStore, b2, 0)
+
+	change, err := chain.CollectHeadChange(ctx, chainStore, a2, b3)
+	require.NoError(err)
+	assert.Equal([]types.TipSet{a2, a1}, change.Revert)
+	assert.Equal([]types.TipSet{b1, b2, b3}, change.Apply)
+
+	change, err = chain.CollectHeadChange(ctx, chainStore, a1, a2)
+	require.NoError(err)
+	assert.Empty(change.Revert)
+	assert.Equal([]types.TipSet{a2}, change.Apply)
+}
+
+func TestEvents(t *testing.T) {
+	t.Parallel()
+
+	t.Run("calls height handlers with confidence and again after reorgs", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		chainStore := newEventsTestStore(ctx, require)
+		events := chain.NewEvents(chainStore, nil)
+		changes := events.HeadChanges().Sub(chain.HeadChangeTopic)
+		events.Start(ctx)
+
+		var applied, reverted []types.TipSet
+		err := events.ChainAt(ctx, 2, 1, func(ctx context.Context, ts types.TipSet) error {
+			applied = append(applied, ts)
+			return nil
+		}, func(ctx context.Context, ts types.TipSet) error {
+			reverted = append(reverted, ts)
+			return nil
+		})
+		require.NoError(err)
+
+		a1 := requireExtend(ctx, require, chainStore, chainStore.Head(), 0)
+		a2 := requireExtend(ctx, require, chainStore, a1, 0)
+		a3 := requireExtend(ctx, require, chainStore, a2, 0)
+		requireSetHead(ctx, require, chainStore, changes, a1)
+		requireSetHead(ctx, require, chainStore, changes, a2)
+		assert.Empty(applied)
+		requireSetHead(ctx, require, chainStore, changes, a3)
+		assert.Equal([]types.TipSet{a2}, applied)
+
+		// reorg onto a fork off a1
+		b2 := requireExtend(ctx, require, chainStore, a1, 1)
+		b3 := requireExtend(ctx, require, chainStore, b2, 0)
+		b4 := requireExtend(ctx, require, chainStore, b3, 0)
+		change := requireSetHead(ctx, require, chainStore, changes, b4)
+		assert.Equal([]types.TipSet{a3, a2}, change.Revert)
+		assert.Equal([]types.TipSet{b2, b3, b4}, change.Apply)
+		assert.Equal([]types.TipSet{a2}, reverted)
+		assert.Equal([]types.TipSet{a2, b2}, applied)
+	})
+
+	t.Run("calls message handlers and again after reorgs", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		chainStore := newEventsTestStore(ctx, require)
+		genesis := chainStore.Head()
+		events := chain.NewEvents(chainStore, nil)
+		changes := events.HeadChanges().Sub(chain.HeadChangeTopic)
+		events.Start(ctx)
+
+		msg := newEventsTestMessage()
+		var applied, reverted []types.TipSet
+		err := events.Called(ctx, requireMsgCid(require, msg), 0, func(ctx context.Context, m *types.SignedMessage, ts types.TipSet) error {
+			assert.True(types.SmsgCidsEqual(msg, m))
+			applied = append(applied, ts)
+			return nil
+		}, func(ctx context.Context, ts types.TipSet) error {
+			reverted = append(reverted, ts)
+			return nil
+		})
+		require.NoError(err)
+
+		a1 := requireExtend(ctx, require, chainStore, genesis, 0, msg)
+		requireSetHead(ctx, require, chainStore, changes, a1)
+		assert.Equal([]types.TipSet{a1}, applied)
+
+		// a fork without the message reverts it
+		b1 := requireExtend(ctx, require, chainStore, genesis, 1)
+		b2 := requireExtend(ctx, require, chainStore, b1, 0)
+		requireSetHead(ctx, require, chainStore, changes, b2)
+		assert.Equal([]types.TipSet{a1}, reverted)
+		assert.Equal([]types.TipSet{a1}, applied)
+
+		// until it includes the message too
+		b3 := requireExtend(ctx, require, chainStore, b2, 0, msg)
+		requireSetHead(ctx, require, chainStore, changes, b3)
+		assert.Equal([]types.TipSet{a1, b3}, applied)
+	})
+
+	t.Run("calls handlers that are already satisfied when registered", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		chainStore := newEventsTestStore(ctx, require)
+		msg := newEventsTestMessage()
+		a1 := requireExtend(ctx, require, chainStore, chainStore.Head(), 0, msg)
+		a2 := requireExtend(ctx, require, chainStore, a1, 0)
+		require.NoError(chainStore.SetHead(ctx, a2))
+
+		events := chain.NewEvents(chainStore, func(ctx context.Context, c cid.Cid) (types.TipSet, error) {
+			if c.Equals(requireMsgCid(require, msg)) {
+				return a1, nil
+			}
+			return nil, nil
+		})
+		events.Start(ctx)
+
+		var heights []types.TipSet
+		err := events.ChainAt(ctx, 1, 1, func(ctx context.Context, ts types.TipSet) error {
+			heights = append(heights, ts)
+			return nil
+		}, nil)
+		require.NoError(err)
+		assert.Equal([]types.TipSet{a1}, heights)
+
+		var msgs []types.TipSet
+		err = events.Called(ctx, requireMsgCid(require, msg), 1, func(ctx context.Context, m *types.SignedMessage, ts types.TipSet) error {
+			msgs = append(msgs, ts)
+			return nil
+		}, nil)
+		require.NoError(err)
+		assert.Equal([]types.TipSet{a1}, msgs)
+
+		// not deep enough yet
+		err = events.Called(ctx, requireMsgCid(require, msg), 2, func(ctx context.Context, m *types.SignedMessage, ts types.TipSet) error {
+			assert.Fail("called too early")
+			return nil
+		}, nil)
+		require.NoError(err)
+	})
+}
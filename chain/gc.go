@@ -0,0 +1,245 @@
+package chain
+
+import (
+	"context"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
+
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+var logGC = logging.Logger("chain.gc")
+
+// tipSetStateKeyPrefix is the prefix of the datastore keys the DefaultStore
+// stores the state roots of tipsets at, which it makes with makeKey.
+var tipSetStateKeyPrefix = datastore.NewKey(makeKeyPrefix).String()
+
+// ErrStateCollected is returned when the state of a tipset is needed that the
+// garbage collector deleted. The tipsets of the head chain stay in the store
+// without their state, with an undefined state root.
+var ErrStateCollected = errors.New("the state of the tipset was garbage collected")
+
+// GCResult reports what a garbage collection deleted.
+type GCResult struct {
+	// TipSets is the number of tipsets of losing forks removed from the
+	// chain store.
+	TipSets int
+	// Blocks is the number of blocks of losing forks deleted.
+	Blocks int
+	// StateNodes is the number of state tree and actor storage nodes
+	// deleted.
+	StateNodes int
+}
+
+// GarbageCollector deletes the parts of the chain and of the state the node
+// no longer needs. It keeps the state of the tipsets of the most recent
+// heights, including those of forks off the head chain that may still win,
+// and every block of the head chain, which the store needs to load the chain
+// and peers need to sync it. It deletes the state of older tipsets and the
+// blocks and tipsets of forks that branched off before the most recent
+// heights.
+type GarbageCollector struct {
+	store  *DefaultStore
+	syncer *DefaultSyncer
+	ds     repo.Datastore
+	bs     bstore.Blockstore
+}
+
+// NewGarbageCollector creates a new GarbageCollector for the state in ds and
+// the chain in store. It stops syncer while collecting, so that it does not
+// delete the state of tipsets the syncer is about to add to the store.
+func NewGarbageCollector(store *DefaultStore, syncer *DefaultSyncer, ds repo.Datastore) *GarbageCollector {
+	return &GarbageCollector{
+		store:  store,
+		syncer: syncer,
+		ds:     ds,
+		bs:     bstore.NewBlockstore(ds),
+	}
+}
+
+// Collect marks the state of the tipsets of the retention most recent heights
+// of the chain, and the blocks of the head chain and of the forks among them,
+// as live and deletes everything else. The blockstore the state lives in also
+// holds data the node imported for storage deals, Collect only deletes cbor
+// nodes, which that data never is.
+func (gc *GarbageCollector) Collect(ctx context.Context, retention uint64) (*GCResult, error) {
+	if retention == 0 {
+		return nil, errors.New("retention must be at least 1")
+	}
+
+	gc.syncer.mu.Lock()
+	defer gc.syncer.mu.Unlock()
+
+	head := gc.store.Head()
+	if head == nil {
+		return nil, errors.New("Unset head")
+	}
+	headHeight, err := head.Height()
+	if err != nil {
+		return nil, err
+	}
+	var minHeight uint64
+	if headHeight+1 > retention {
+		minHeight = headHeight + 1 - retention
+	}
+
+	// mark the tipsets of the head chain, these are never removed
+	headChain := make(map[string]bool)
+	err = gc.store.walkChain(ctx, head.ToSlice(), func(tips []*types.Block) (bool, error) {
+		ts, err := types.NewTipSet(tips...)
+		if err != nil {
+			return false, err
+		}
+		headChain[ts.String()] = true
+		return true, nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk head chain")
+	}
+
+	// mark the blocks and state of the tipsets to keep
+	var dead, collected []*TipSetAndState
+	liveBlocks := cid.NewSet()
+	liveBlocks.Add(gc.store.GenesisCid())
+	liveKeys := make(map[string]bool)
+	liveState := cid.NewSet()
+	for _, tsas := range gc.store.tipIndex.All() {
+		h, err := tsas.TipSet.Height()
+		if err != nil {
+			return nil, err
+		}
+		if h < minHeight && !headChain[tsas.TipSet.String()] {
+			dead = append(dead, tsas)
+			continue
+		}
+
+		for _, blk := range tsas.TipSet {
+			liveBlocks.Add(blk.Cid())
+		}
+		liveKeys[datastore.NewKey(makeKey(tsas.TipSet.String(), h)).String()] = true
+		if !tsas.TipSetStateRoot.Defined() {
+			// a previous collection deleted its state
+			continue
+		}
+		if h < minHeight {
+			collected = append(collected, tsas)
+			continue
+		}
+		err = walkDAG(ctx, gc.bs, tsas.TipSetStateRoot, liveState, func(blocks.Block) error { return nil })
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to mark state of tipset %s", tsas.TipSet.String())
+		}
+	}
+	// blocks fetched from the network end up in the state blockstore too,
+	// keep the live ones there so they can still be served to peers
+	liveBlocks.ForEach(func(c cid.Cid) error { // nolint: errcheck
+		liveState.Add(c)
+		return nil
+	})
+
+	// sweep, forgetting the state of the old tipsets of the head chain first
+	// so no one looks for it once it is gone
+	if err := gc.store.collectState(minHeight, collected); err != nil {
+		return nil, errors.Wrap(err, "failed to mark state as collected")
+	}
+	res := &GCResult{}
+	for _, tsas := range dead {
+		if err := gc.store.removeTipSetAndState(tsas); err != nil {
+			return nil, err
+		}
+		res.TipSets++
+	}
+	// the store only indexes the tipsets added since the node started, the
+	// state roots of forks from before stay behind in the datastore
+	n, err := sweepStateRootKeys(gc.store.ds, liveKeys)
+	res.TipSets += n
+	if err != nil {
+		return res, err
+	}
+	res.Blocks, err = sweepBlocks(ctx, gc.store.blockstore, liveBlocks, func(cid.Cid) bool { return true })
+	if err != nil {
+		return res, err
+	}
+	res.StateNodes, err = sweepBlocks(ctx, gc.bs, liveState, func(c cid.Cid) bool { return c.Type() == cid.DagCBOR })
+	if err != nil {
+		return res, err
+	}
+
+	compact(gc.store.ds)
+	compact(gc.ds)
+
+	logGC.Infof("collected %d tipsets, %d blocks and %d state nodes below height %d", res.TipSets, res.Blocks, res.StateNodes, minHeight)
+	return res, nil
+}
+
+// sweepStateRootKeys deletes the state roots of tipsets from ds whose keys
+// are not in live.
+func sweepStateRootKeys(ds repo.Datastore, live map[string]bool) (int, error) {
+	res, err := ds.Query(query.Query{Prefix: tipSetStateKeyPrefix, KeysOnly: true})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to query tipset state roots")
+	}
+	defer res.Close() // nolint: errcheck
+
+	var dead []datastore.Key
+	for entry := range res.Next() {
+		if entry.Error != nil {
+			return 0, errors.Wrap(entry.Error, "failed to read tipset state roots")
+		}
+		if !live[entry.Key] {
+			dead = append(dead, datastore.NewKey(entry.Key))
+		}
+	}
+
+	for i, key := range dead {
+		if err := ds.Delete(key); err != nil {
+			return i, errors.Wrapf(err, "failed to delete tipset state root %s", key)
+		}
+	}
+	return len(dead), nil
+}
+
+// sweepBlocks deletes the blocks in bs that are not in live and that
+// collectable returns true for.
+func sweepBlocks(ctx context.Context, bs bstore.Blockstore, live *cid.Set, collectable func(cid.Cid) bool) (int, error) {
+	keys, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list blocks")
+	}
+
+	var dead []cid.Cid
+	for c := range keys {
+		if !live.Has(c) && collectable(c) {
+			dead = append(dead, c)
+		}
+	}
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	for i, c := range dead {
+		if err := bs.DeleteBlock(c); err != nil {
+			return i, errors.Wrapf(err, "failed to delete block %s", c.String())
+		}
+	}
+	return len(dead), nil
+}
+
+// compact asks ds to reclaim the space of the entries deleted from it, if it
+// supports that, as badger does.
+func compact(ds repo.Datastore) {
+	gcds, ok := ds.(interface{ CollectGarbage() error })
+	if !ok {
+		return
+	}
+	if err := gcds.CollectGarbage(); err != nil {
+		logGC.Warningf("failed to compact datastore: %s", err)
+	}
+}
@@ -0,0 +1,144 @@
+package chain_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	offline "gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestGarbageCollector(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("keeps recent state and the head chain and removes old state and forks", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		r, chainStore, bs, tipsets, addrs := setupSnapshotTest(ctx, require, 4)
+		cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+
+		// a fork off the head chain at height 2 with a state of its own
+		forkParentState, err := chainStore.GetTipSetAndState(ctx, tipsets[1].String())
+		require.NoError(err)
+		st, err := state.LoadStateTree(ctx, cst, forkParentState.TipSetStateRoot, builtin.Actors)
+		require.NoError(err)
+		require.NoError(st.SetActor(ctx, address.NewForTestGetter()(), actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(100))))
+		forkRoot, err := st.Flush(ctx)
+		require.NoError(err)
+		forkBlk := chain.RequireMkFakeChild(require, chain.FakeChildParams{Parent: tipsets[1], GenesisCid: chainStore.GenesisCid(), StateRoot: forkRoot, Nonce: 1})
+		fork := testhelpers.RequireNewTipSet(require, forkBlk)
+		chain.RequirePutTsas(ctx, require, chainStore, &chain.TipSetAndState{TipSet: fork, TipSetStateRoot: forkRoot})
+
+		// data that is not part of the chain or the state
+		clientData := blocks.NewBlock([]byte("client data"))
+		require.NoError(bs.Put(clientData))
+
+		syncer := chain.NewDefaultSyncer(cst, cst, nil, chainStore, nil)
+		gc := chain.NewGarbageCollector(chainStore, syncer, r.Datastore())
+		res, err := gc.Collect(ctx, 2)
+		require.NoError(err)
+		assert.Equal(1, res.TipSets)
+		assert.Equal(1, res.Blocks)
+		assert.True(res.StateNodes > 0)
+
+		// the fork is gone
+		_, err = chainStore.GetTipSetAndState(ctx, fork.String())
+		assert.Error(err)
+		assert.False(chainStore.HasBlock(ctx, forkBlk.Cid()))
+		has, err := bs.Has(forkRoot)
+		require.NoError(err)
+		assert.False(has)
+
+		// the state of the recent tipsets is intact
+		for _, ts := range tipsets[3:] {
+			tsas, err := chainStore.GetTipSetAndState(ctx, ts.String())
+			require.NoError(err)
+			st, err := state.LoadStateTree(ctx, cst, tsas.TipSetStateRoot, builtin.Actors)
+			require.NoError(err)
+			_, err = st.GetActor(ctx, addrs[0])
+			assert.NoError(err)
+		}
+
+		// the old tipsets of the head chain keep their blocks but lose their state
+		for _, ts := range tipsets[:3] {
+			assert.True(chainStore.HasAllBlocks(ctx, ts.ToSortedCidSet().ToSlice()))
+			tsas, err := chainStore.GetTipSetAndState(ctx, ts.String())
+			require.NoError(err)
+			assert.False(tsas.TipSetStateRoot.Defined())
+		}
+		err = chain.ExportSnapshot(ctx, chainStore, bs, 5, &bytes.Buffer{})
+		assert.Equal(chain.ErrStateCollected, errors.Cause(err))
+		require.NoError(chain.ExportSnapshot(ctx, chainStore, bs, 2, &bytes.Buffer{}))
+
+		has, err = bs.Has(clientData.Cid())
+		require.NoError(err)
+		assert.True(has)
+
+		// the chain still loads from the repo
+		reloaded := chain.NewDefaultStore(r.ChainDatastore(), hamt.NewCborStore(), chainStore.GenesisCid())
+		require.NoError(reloaded.Load(ctx))
+		assert.Equal(tipsets[4], reloaded.Head())
+		assert.Equal(5, len(requireHistory(ctx, require, reloaded)))
+		_, err = reloaded.GetTipSetAndState(ctx, fork.String())
+		assert.Error(err)
+		tsas, err := reloaded.GetTipSetAndState(ctx, tipsets[2].String())
+		require.NoError(err)
+		assert.False(tsas.TipSetStateRoot.Defined())
+		tsas, err = reloaded.GetTipSetAndState(ctx, tipsets[3].String())
+		require.NoError(err)
+		assert.True(tsas.TipSetStateRoot.Defined())
+	})
+
+	t.Run("keeps everything if the retention covers the whole chain", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		r, chainStore, bs, tipsets, _ := setupSnapshotTest(ctx, require, 2)
+		cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+
+		syncer := chain.NewDefaultSyncer(cst, cst, nil, chainStore, nil)
+		gc := chain.NewGarbageCollector(chainStore, syncer, r.Datastore())
+		res, err := gc.Collect(ctx, 10)
+		require.NoError(err)
+		assert.Equal(0, res.TipSets)
+		assert.Equal(0, res.Blocks)
+
+		for _, ts := range tipsets {
+			tsas, err := chainStore.GetTipSetAndState(ctx, ts.String())
+			require.NoError(err)
+			has, err := bs.Has(tsas.TipSetStateRoot)
+			require.NoError(err)
+			assert.True(has)
+		}
+	})
+
+	t.Run("rejects a retention of zero", func(t *testing.T) {
+		require := require.New(t)
+
+		r, chainStore, bs, _, _ := setupSnapshotTest(ctx, require, 1)
+		cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+
+		syncer := chain.NewDefaultSyncer(cst, cst, nil, chainStore, nil)
+		gc := chain.NewGarbageCollector(chainStore, syncer, r.Datastore())
+		_, err := gc.Collect(ctx, 0)
+		require.Error(err)
+	})
+}
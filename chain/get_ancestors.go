@@ -32,6 +32,9 @@ import (
 // the length of provingPeriodAncestors may vary (more null blocks -> shorter length).  The
 // length of slice extraRandomnessAncestors is a constant (at least once the
 // chain is longer than lookback tipsets).
+//
+// If the chain was initialized from a snapshot, the ancestors end at the oldest
+// tipset of the snapshot.
 func GetRecentAncestors(ctx context.Context, base types.TipSet, chainReader ReadStore, childBH, ancestorRoundsNeeded *types.BlockHeight, lookback uint) ([]types.TipSet, error) {
 	if lookback == 0 {
 		return nil, errors.New("lookback must be greater than 0")
@@ -64,7 +67,9 @@ func GetRecentAncestors(ctx context.Context, base types.TipSet, chainReader Read
 	// be reused.
 	tsas, err := chainReader.GetTipSetAndState(ctx, firstExtraRandomnessAncestorsCids.String())
 	if err != nil {
-		return nil, err
+		// the store does not know the parents of the oldest tipset of the
+		// chain snapshot it was initialized from, so the history ends there
+		return provingPeriodAncestors, nil
 	}
 	historyCh = chainReader.BlockHistory(ctx, tsas.TipSet)
 	extraRandomnessAncestors, err := CollectAtMostNTipSets(ctx, historyCh, lookback)
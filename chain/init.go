@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 
 	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 
@@ -39,14 +40,21 @@ func Init(ctx context.Context, r repo.Repo, bs bstore.Blockstore, cst *hamt.Cbor
 	if err = chainStore.SetHead(ctx, genTipSet); err != nil {
 		return nil, errors.Wrap(err, "failed to persist genesis block in chain store")
 	}
-	// Persist the genesis cid to the repo.
-	val, err := json.Marshal(genesis.Cid())
+	if err = writeGenesisCid(r, genesis.Cid()); err != nil {
+		return nil, err
+	}
+
+	return chainStore, nil
+}
+
+// writeGenesisCid persists the genesis cid to the repo.
+func writeGenesisCid(r repo.Repo, c cid.Cid) error {
+	val, err := json.Marshal(c)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to marshal genesis cid")
+		return errors.Wrap(err, "failed to marshal genesis cid")
 	}
 	if err = r.Datastore().Put(GenesisKey, val); err != nil {
-		return nil, errors.Wrap(err, "failed to persist genesis cid")
+		return errors.Wrap(err, "failed to persist genesis cid")
 	}
-
-	return chainStore, nil
+	return nil
 }
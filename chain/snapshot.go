@@ -0,0 +1,295 @@
+package chain
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	blocks "gx/ipfs/QmWoXtvgC8inqFkAATB7cp2Dax7XBi9VDvSg9RCCZufmRk/go-block-format"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func init() {
+	cbor.RegisterCborType(Snapshot{})
+	cbor.RegisterCborType(SnapshotTipSet{})
+	cbor.RegisterCborType(carHeader{})
+}
+
+// Snapshot describes the part of a chain in a snapshot. It is the root of the
+// CAR file ExportSnapshot writes, the same format genesis files use, which
+// holds the blocks of the tipsets in the snapshot, the genesis block and the
+// state trees of the tipsets.
+type Snapshot struct {
+	// Genesis is the cid of the genesis block of the chain.
+	Genesis cid.Cid
+	// TipSets are the tipsets of the snapshot, from the head of the chain
+	// back to the oldest tipset.
+	TipSets []SnapshotTipSet
+}
+
+// SnapshotTipSet is a tipset in a Snapshot.
+type SnapshotTipSet struct {
+	// Blocks are the cids of the blocks of the tipset.
+	Blocks []cid.Cid
+	// StateRoot is the root of the state tree after applying the messages of
+	// the tipset.
+	StateRoot cid.Cid
+}
+
+// ExportSnapshot writes a snapshot of the chain tracked by chainReader to w as
+// a CAR file. The snapshot holds the depth tipsets from the head of the chain
+// back and the full state tree of the oldest of them. The state trees of the
+// newer tipsets share most of their nodes with it, so the snapshot holds only
+// the nodes they add, which lets a node started from the snapshot serve the
+// state of each tipset without replaying their messages.
+func ExportSnapshot(ctx context.Context, chainReader ReadStore, bs bstore.Blockstore, depth int, w io.Writer) error {
+	if depth < 1 {
+		return errors.New("snapshot depth must be at least 1")
+	}
+
+	tipsets, err := CollectAtMostNTipSets(ctx, chainReader.BlockHistory(ctx, chainReader.Head()), uint(depth))
+	if err != nil {
+		return errors.Wrap(err, "failed to walk chain")
+	}
+	if len(tipsets) == 0 {
+		return errors.New("chain has no head")
+	}
+
+	snapshot := Snapshot{Genesis: chainReader.GenesisCid()}
+	for _, ts := range tipsets {
+		tsas, err := chainReader.GetTipSetAndState(ctx, ts.String())
+		if err != nil {
+			return errors.Wrapf(err, "failed to load state of tipset %s", ts.String())
+		}
+		if !tsas.TipSetStateRoot.Defined() {
+			return errors.Wrapf(ErrStateCollected, "cannot export tipset %s, use a smaller depth", ts.String())
+		}
+		snapshot.TipSets = append(snapshot.TipSets, SnapshotTipSet{
+			Blocks:    ts.ToSortedCidSet().ToSlice(),
+			StateRoot: tsas.TipSetStateRoot,
+		})
+	}
+
+	genesis, err := chainReader.GetBlock(ctx, snapshot.Genesis)
+	if err != nil {
+		return errors.Wrap(err, "failed to load genesis block")
+	}
+
+	snapshotNode, err := cbor.WrapObject(snapshot, types.DefaultHashFunction, -1)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode snapshot")
+	}
+
+	cw := newCarWriter(w)
+	if err := cw.writeHeader(snapshotNode.Cid()); err != nil {
+		return err
+	}
+	if err := cw.writeBlock(snapshotNode.Cid(), snapshotNode.RawData()); err != nil {
+		return err
+	}
+	genesisNode := genesis.ToNode()
+	if err := cw.writeBlock(genesisNode.Cid(), genesisNode.RawData()); err != nil {
+		return err
+	}
+	for _, ts := range tipsets {
+		for _, blk := range ts.ToSlice() {
+			nd := blk.ToNode()
+			if err := cw.writeBlock(nd.Cid(), nd.RawData()); err != nil {
+				return err
+			}
+		}
+	}
+
+	// write the oldest state tree first, the newer ones only add the nodes
+	// it does not already have
+	written := cid.NewSet()
+	for i := len(snapshot.TipSets) - 1; i >= 0; i-- {
+		err := walkDAG(ctx, bs, snapshot.TipSets[i].StateRoot, written, func(blk blocks.Block) error {
+			return cw.writeBlock(blk.Cid(), blk.RawData())
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to export state of tipset %d", i)
+		}
+	}
+
+	return cw.flush()
+}
+
+// walkDAG calls visit with each node of the DAG rooted at root, skipping the
+// ones in seen and adding the ones it visits. Actor code cids link to raw
+// objects that are built into the node rather than stored, those are skipped
+// when missing.
+func walkDAG(ctx context.Context, bs bstore.Blockstore, root cid.Cid, seen *cid.Set, visit func(blocks.Block) error) error {
+	todo := []cid.Cid{root}
+	for len(todo) > 0 {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		c := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		if !seen.Visit(c) {
+			continue
+		}
+
+		blk, err := bs.Get(c)
+		if err == bstore.ErrNotFound && c.Type() == cid.Raw {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to load node %s", c.String())
+		}
+		if err := visit(blk); err != nil {
+			return err
+		}
+
+		if c.Type() != cid.DagCBOR {
+			continue
+		}
+		nd, err := cbor.DecodeBlock(blk)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decode node %s", c.String())
+		}
+		for _, link := range nd.Links() {
+			todo = append(todo, link.Cid)
+		}
+	}
+	return nil
+}
+
+// InitFromSnapshot initializes a DefaultStore in the given repo from a chain
+// snapshot written by ExportSnapshot. The CAR file must already be loaded into
+// bs, root is its root. The store trusts the oldest tipset of the snapshot and
+// its state in place of the genesis block, so the node syncs from there
+// instead of replaying the chain from genesis.
+func InitFromSnapshot(ctx context.Context, r repo.Repo, bs bstore.Blockstore, cst *hamt.CborIpldStore, root cid.Cid) (*DefaultStore, error) {
+	var snapshot Snapshot
+	if err := cst.Get(ctx, root, &snapshot); err != nil {
+		return nil, errors.Wrap(err, "failed to load snapshot")
+	}
+	if len(snapshot.TipSets) == 0 {
+		return nil, errors.New("snapshot has no tipsets")
+	}
+
+	var genesis types.Block
+	if err := cst.Get(ctx, snapshot.Genesis, &genesis); err != nil {
+		return nil, errors.Wrap(err, "failed to load genesis block from snapshot")
+	}
+
+	tsass := make([]*TipSetAndState, len(snapshot.TipSets))
+	for i, sts := range snapshot.TipSets {
+		var blks []*types.Block
+		for _, c := range sts.Blocks {
+			var blk types.Block
+			if err := cst.Get(ctx, c, &blk); err != nil {
+				return nil, errors.Wrapf(err, "failed to load block %s from snapshot", c.String())
+			}
+			blks = append(blks, &blk)
+		}
+		ts, err := types.NewTipSet(blks...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid tipset %d in snapshot", i)
+		}
+		if i > 0 {
+			parents, err := tsass[i-1].TipSet.Parents()
+			if err != nil {
+				return nil, err
+			}
+			if !parents.Equals(ts.ToSortedCidSet()) {
+				return nil, errors.Errorf("tipset %d in snapshot is not the parent of tipset %d", i, i-1)
+			}
+		}
+		has, err := bs.Has(sts.StateRoot)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			return nil, errors.Errorf("state of tipset %d is missing from snapshot", i)
+		}
+		tsass[i] = &TipSetAndState{
+			TipSet:          ts,
+			TipSetStateRoot: sts.StateRoot,
+		}
+	}
+
+	chainStore := NewDefaultStore(r.ChainDatastore(), cst, snapshot.Genesis)
+	if err := chainStore.putBlk(ctx, &genesis); err != nil {
+		return nil, errors.Wrap(err, "failed to put genesis block in chain store")
+	}
+	for i := len(tsass) - 1; i >= 0; i-- {
+		if err := chainStore.PutTipSetAndState(ctx, tsass[i]); err != nil {
+			return nil, errors.Wrap(err, "failed to put snapshot tipset in chain store")
+		}
+	}
+	if err := chainStore.setSnapshotBase(tsass[len(tsass)-1].TipSet); err != nil {
+		return nil, err
+	}
+	if err := chainStore.SetHead(ctx, tsass[0].TipSet); err != nil {
+		return nil, errors.Wrap(err, "failed to persist snapshot head in chain store")
+	}
+	if err := writeGenesisCid(r, snapshot.Genesis); err != nil {
+		return nil, err
+	}
+
+	return chainStore, nil
+}
+
+// carHeader is the header of a CAR file.
+type carHeader struct {
+	Roots   []cid.Cid `refmt:"roots"`
+	Version uint64    `refmt:"version"`
+}
+
+// carWriter writes a CAR file a block at a time. Unlike car.WriteCar it does
+// not follow the links of the blocks it writes, which would pull the whole
+// chain back to genesis into the file.
+type carWriter struct {
+	w *bufio.Writer
+}
+
+func newCarWriter(w io.Writer) *carWriter {
+	return &carWriter{w: bufio.NewWriter(w)}
+}
+
+func (cw *carWriter) writeHeader(roots ...cid.Cid) error {
+	data, err := cbor.DumpObject(&carHeader{Roots: roots, Version: 1})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode car header")
+	}
+	return cw.writeSection(data)
+}
+
+func (cw *carWriter) writeBlock(c cid.Cid, data []byte) error {
+	return cw.writeSection(c.Bytes(), data)
+}
+
+// writeSection writes the parts prefixed by their total length.
+func (cw *carWriter) writeSection(parts ...[]byte) error {
+	size := 0
+	for _, part := range parts {
+		size += len(part)
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(size))
+	if _, err := cw.w.Write(buf[:n]); err != nil {
+		return errors.Wrap(err, "failed to write car")
+	}
+	for _, part := range parts {
+		if _, err := cw.w.Write(part); err != nil {
+			return errors.Wrap(err, "failed to write car")
+		}
+	}
+	return nil
+}
+
+func (cw *carWriter) flush() error {
+	return errors.Wrap(cw.w.Flush(), "failed to write car")
+}
@@ -0,0 +1,156 @@
+package chain_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	offline "gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
+	car "gx/ipfs/QmUGpiTCKct5s1F7jaAnY9KJmoo7Qm1R2uhSjq5iHDSUMn/go-car"
+	bserv "gx/ipfs/QmZsGVGCqMCNzHLNMB6q4F6yyvomqf1VxwhJwSfgo1NGaF/go-blockservice"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func newSnapshotTestRepo() (repo.Repo, bstore.Blockstore, *hamt.CborIpldStore) {
+	r := repo.NewInMemoryRepo()
+	bs := bstore.NewBlockstore(r.Datastore())
+	cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
+	return r, bs, cst
+}
+
+// setupSnapshotTest creates a chain of the genesis block and numBlocks single
+// block tipsets, each with a state of its own holding a new actor. It returns
+// the repo, the store and the tipsets of the chain, from genesis to head.
+func setupSnapshotTest(ctx context.Context, require *require.Assertions, numBlocks int) (repo.Repo, *chain.DefaultStore, bstore.Blockstore, []types.TipSet, []address.Address) {
+	r, bs, cst := newSnapshotTestRepo()
+	chainStore, err := chain.Init(ctx, r, bs, cst, consensus.InitGenesis)
+	require.NoError(err)
+
+	addrGetter := address.NewForTestGetter()
+	tipsets := []types.TipSet{chainStore.Head()}
+	var addrs []address.Address
+	for i := 0; i < numBlocks; i++ {
+		parent := tipsets[len(tipsets)-1]
+		parentState, err := chainStore.GetTipSetAndState(ctx, parent.String())
+		require.NoError(err)
+
+		st, err := state.LoadStateTree(ctx, cst, parentState.TipSetStateRoot, builtin.Actors)
+		require.NoError(err)
+		addr := addrGetter()
+		require.NoError(st.SetActor(ctx, addr, actor.NewActor(types.AccountActorCodeCid, types.NewAttoFILFromFIL(uint64(i+1)))))
+		root, err := st.Flush(ctx)
+		require.NoError(err)
+
+		blk := chain.RequireMkFakeChild(require, chain.FakeChildParams{Parent: parent, GenesisCid: chainStore.GenesisCid(), StateRoot: root})
+		ts := testhelpers.RequireNewTipSet(require, blk)
+		chain.RequirePutTsas(ctx, require, chainStore, &chain.TipSetAndState{TipSet: ts, TipSetStateRoot: root})
+		require.NoError(chainStore.SetHead(ctx, ts))
+
+		tipsets = append(tipsets, ts)
+		addrs = append(addrs, addr)
+	}
+	return r, chainStore, bs, tipsets, addrs
+}
+
+// requireImportSnapshot loads a snapshot into a new repo and initializes a
+// store from it.
+func requireImportSnapshot(ctx context.Context, require *require.Assertions, snapshot []byte) (repo.Repo, *chain.DefaultStore) {
+	r, bs, cst := newSnapshotTestRepo()
+	header, err := car.LoadCar(bs, bytes.NewReader(snapshot))
+	require.NoError(err)
+	require.Len(header.Roots, 1)
+
+	chainStore, err := chain.InitFromSnapshot(ctx, r, bs, cst, header.Roots[0])
+	require.NoError(err)
+	return r, chainStore
+}
+
+func requireHistory(ctx context.Context, require *require.Assertions, chainStore chain.ReadStore) []types.TipSet {
+	history, err := chain.CollectAtMostNTipSets(ctx, chainStore.BlockHistory(ctx, chainStore.Head()), 100)
+	require.NoError(err)
+	return history
+}
+
+func TestSnapshotExportImport(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("imports the exported tipsets and their state", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		_, exporter, bs, tipsets, addrs := setupSnapshotTest(ctx, require, 4)
+		var buf bytes.Buffer
+		require.NoError(chain.ExportSnapshot(ctx, exporter, bs, 3, &buf))
+
+		r, chainStore := requireImportSnapshot(ctx, require, buf.Bytes())
+		assert.Equal(tipsets[4], chainStore.Head())
+		assert.Equal(exporter.GenesisCid(), chainStore.GenesisCid())
+
+		// the history ends at the oldest tipset of the snapshot
+		assert.Equal([]types.TipSet{tipsets[4], tipsets[3], tipsets[2]}, requireHistory(ctx, require, chainStore))
+
+		// the state of the head holds all actors
+		st, err := chainStore.LatestState(ctx)
+		require.NoError(err)
+		for _, addr := range addrs {
+			_, err := st.GetActor(ctx, addr)
+			assert.NoError(err)
+		}
+
+		// the chain loads from the repo after a restart
+		reloaded := chain.NewDefaultStore(r.ChainDatastore(), hamt.NewCborStore(), exporter.GenesisCid())
+		require.NoError(reloaded.Load(ctx))
+		assert.Equal(tipsets[4], reloaded.Head())
+		assert.Equal(3, len(requireHistory(ctx, require, reloaded)))
+	})
+
+	t.Run("exports the whole chain if it is shorter than the depth", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		_, exporter, bs, tipsets, _ := setupSnapshotTest(ctx, require, 2)
+		var buf bytes.Buffer
+		require.NoError(chain.ExportSnapshot(ctx, exporter, bs, 10, &buf))
+
+		_, chainStore := requireImportSnapshot(ctx, require, buf.Bytes())
+		assert.Equal([]types.TipSet{tipsets[2], tipsets[1], tipsets[0]}, requireHistory(ctx, require, chainStore))
+	})
+
+	t.Run("recent ancestors end at the oldest tipset of the snapshot", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		_, exporter, bs, tipsets, _ := setupSnapshotTest(ctx, require, 4)
+		var buf bytes.Buffer
+		require.NoError(chain.ExportSnapshot(ctx, exporter, bs, 2, &buf))
+
+		_, chainStore := requireImportSnapshot(ctx, require, buf.Bytes())
+		ancestors, err := chain.GetRecentAncestors(ctx, chainStore.Head(), chainStore, types.NewBlockHeight(5), types.NewBlockHeight(100), 3)
+		require.NoError(err)
+		assert.Equal([]types.TipSet{tipsets[4], tipsets[3]}, ancestors)
+	})
+
+	t.Run("rejects a depth of zero", func(t *testing.T) {
+		require := require.New(t)
+
+		_, exporter, bs, _, _ := setupSnapshotTest(ctx, require, 1)
+		var buf bytes.Buffer
+		require.Error(chain.ExportSnapshot(ctx, exporter, bs, 0, &buf))
+	})
+}
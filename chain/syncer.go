@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 // Syncer handles new blocks, either from the network or the local node's
@@ -20,3 +22,14 @@ import (
 type Syncer interface {
 	HandleNewBlocks(ctx context.Context, blkCids []cid.Cid) error
 }
+
+// TipSetFetcher fetches runs of tipsets from the network in bulk. The Syncer
+// uses it to resolve unknown chains faster than resolving their blocks one at
+// a time.
+type TipSetFetcher interface {
+	// FetchTipSets fetches a run of up to count tipsets, starting with the
+	// tipset made of the blocks with cids start and continuing with its
+	// ancestors. It returns the blocks of each tipset in the run. The blocks
+	// come from untrusted peers and must be validated by the caller.
+	FetchTipSets(ctx context.Context, start []cid.Cid, count int) ([][]*types.Block, error)
+}
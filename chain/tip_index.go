@@ -95,6 +95,45 @@ func (ti *TipIndex) Has(tsKey string) bool {
 	return ok
 }
 
+// Remove removes the tipset given by the input ID, and its state, from both
+// of TipIndex's internal indexes. Removing a tipset that is not in the
+// TipIndex is a nop.
+func (ti *TipIndex) Remove(tsKey string) error {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	tsas, ok := ti.tsasByID[tsKey]
+	if !ok {
+		return nil
+	}
+	delete(ti.tsasByID, tsKey)
+
+	pSet, err := tsas.TipSet.Parents()
+	if err != nil {
+		return err
+	}
+	h, err := tsas.TipSet.Height()
+	if err != nil {
+		return err
+	}
+	key := makeKey(pSet.String(), h)
+	delete(ti.tsasByParentsAndHeight[key], tsKey)
+	if len(ti.tsasByParentsAndHeight[key]) == 0 {
+		delete(ti.tsasByParentsAndHeight, key)
+	}
+	return nil
+}
+
+// All returns all tipsets and states stored in the TipIndex.
+func (ti *TipIndex) All() []*TipSetAndState {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ret := make([]*TipSetAndState, 0, len(ti.tsasByID))
+	for _, tsas := range ti.tsasByID {
+		ret = append(ret, tsas)
+	}
+	return ret
+}
+
 // GetByParentsAndHeight returns the all tipsets and states stored in the TipIndex
 // such that the parent ID of these tipsets equals the input.
 func (ti *TipIndex) GetByParentsAndHeight(pKey string, h uint64) ([]*TipSetAndState, error) {
@@ -123,7 +162,10 @@ func (ti *TipIndex) HasByParentsAndHeight(pKey string, h uint64) bool {
 	return ok
 }
 
+// makeKeyPrefix is the prefix of the strings makeKey returns.
+const makeKeyPrefix = "p-"
+
 // makeKey returns a unique string for every parent set key and height input
 func makeKey(pKey string, h uint64) string {
-	return fmt.Sprintf("p-%s h-%d", pKey, h)
+	return fmt.Sprintf("%s%s h-%d", makeKeyPrefix, pKey, h)
 }
@@ -3,12 +3,15 @@ package commands
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/wallet"
 )
 
 var walletCmd = &cmds.Command{
@@ -20,6 +23,14 @@ var walletCmd = &cmds.Command{
 		"balance": balanceCmd,
 		"import":  walletImportCmd,
 		"export":  walletExportCmd,
+
+		"encrypt":           walletEncryptCmd,
+		"unlock":            walletUnlockCmd,
+		"lock":              walletLockCmd,
+		"change-passphrase": walletChangePassphraseCmd,
+
+		"mnemonic": walletMnemonicCmd,
+		"restore":  walletRestoreCmd,
 	},
 }
 
@@ -44,8 +55,11 @@ type AddressLsResult struct {
 }
 
 var addrsNewCmd = &cmds.Command{
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("type", "Type of the key of the address (secp256k1 or bls)").WithDefault(wallet.SECP256K1),
+	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
-		addr, err := GetAPI(env).Address().Addrs().New(req.Context)
+		addr, err := GetPorcelainAPI(env).WalletNewAddressWithCurve(req.Options["type"].(string))
 		if err != nil {
 			return err
 		}
@@ -214,3 +228,147 @@ var walletExportCmd = &cmds.Command{
 		}),
 	},
 }
+
+var walletEncryptCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Encrypt the keys in the wallet with a passphrase",
+		ShortDescription: `
+Encrypts the private keys stored in the repo with a key derived from the
+passphrase and locks the wallet. Keys can not be used to sign or be exported
+until the wallet is unlocked with 'wallet unlock'. There is no way to recover
+the keys if the passphrase is lost.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("passphrase", true, false, "Passphrase to encrypt the keys with").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		if err := GetPorcelainAPI(env).WalletEncrypt(req.Arguments[0]); err != nil {
+			return err
+		}
+		return re.Emit("Wallet encrypted and locked")
+	},
+	Encoders: stringEncoderMap,
+}
+
+var walletUnlockCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Unlock an encrypted wallet",
+		ShortDescription: `
+Makes the keys of an encrypted wallet usable until the timeout has passed,
+after which the wallet locks itself again. A timeout of 0 keeps the wallet
+unlocked until 'wallet lock' is run.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("passphrase", true, false, "Passphrase of the wallet").EnableStdin(),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("timeout", "How long to keep the wallet unlocked (e.g. 10m)").WithDefault("5m"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		timeout, err := time.ParseDuration(req.Options["timeout"].(string))
+		if err != nil {
+			return errors.Wrap(err, "invalid timeout")
+		}
+		if timeout < 0 {
+			return errors.New("timeout must not be negative")
+		}
+
+		if err := GetPorcelainAPI(env).WalletUnlock(req.Arguments[0], timeout); err != nil {
+			return err
+		}
+		if timeout == 0 {
+			return re.Emit("Wallet unlocked")
+		}
+		return re.Emit(fmt.Sprintf("Wallet unlocked for %s", timeout))
+	},
+	Encoders: stringEncoderMap,
+}
+
+var walletLockCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Lock an encrypted wallet",
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		if err := GetPorcelainAPI(env).WalletLock(); err != nil {
+			return err
+		}
+		return re.Emit("Wallet locked")
+	},
+	Encoders: stringEncoderMap,
+}
+
+var walletChangePassphraseCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Change the passphrase of an encrypted wallet",
+		ShortDescription: `
+Takes the current passphrase of the wallet followed by the new one. When they
+are not given as arguments they are read from stdin, one per line, so they do
+not end up in the shell history.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("passphrases", true, true, "Current passphrase of the wallet followed by the new one").EnableStdin(),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		if len(req.Arguments) != 2 {
+			return errors.New("expected the current and the new passphrase")
+		}
+
+		if err := GetPorcelainAPI(env).WalletChangePassphrase(req.Arguments[0], req.Arguments[1]); err != nil {
+			return err
+		}
+		return re.Emit("Passphrase changed")
+	},
+	Encoders: stringEncoderMap,
+}
+
+var walletMnemonicCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Generate a mnemonic to derive new addresses from",
+		ShortDescription: `
+Generates a BIP-39 mnemonic and prints it. From then on 'address new' derives
+secp256k1 addresses from its seed, so writing down the mnemonic is enough to
+restore them with 'wallet restore'. Addresses created before, and BLS
+addresses, are not covered by the mnemonic.
+`,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		mnemonic, err := GetPorcelainAPI(env).WalletNewMnemonic()
+		if err != nil {
+			return err
+		}
+		return re.Emit(mnemonic)
+	},
+	Encoders: stringEncoderMap,
+}
+
+var walletRestoreCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Restore the addresses of a mnemonic",
+		ShortDescription: `
+Derives addresses from the seed of the mnemonic and imports those that have an
+actor in the state of the head of the chain, stopping after 20 consecutive
+unused addresses. The node should be synced first. New addresses are derived
+after the last restored one.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("mnemonic", "Mnemonic generated by 'wallet mnemonic'"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		mnemonic, ok := req.Options["mnemonic"].(string)
+		if !ok || mnemonic == "" {
+			return errors.New("--mnemonic is required")
+		}
+
+		api := GetPorcelainAPI(env)
+		before := len(api.WalletAddresses())
+		if err := api.WalletRestore(req.Context, mnemonic); err != nil {
+			return err
+		}
+		return re.Emit(fmt.Sprintf("Restored %d addresses", len(api.WalletAddresses())-before))
+	},
+	Encoders: stringEncoderMap,
+}
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	th "github.com/filecoin-project/go-filecoin/testhelpers"
 
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
 )
 
 func TestAddrsNewAndList(t *testing.T) {
@@ -30,6 +32,23 @@ func TestAddrsNewAndList(t *testing.T) {
 	}
 }
 
+func TestAddrsNewBLS(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	require := require.New(t)
+
+	d := th.NewDaemon(t).Start()
+	defer d.ShutdownSuccess()
+
+	out := d.RunSuccess("wallet", "addrs", "new", "--type=bls").ReadStdoutTrimNewlines()
+	addr, err := address.NewFromString(out)
+	require.NoError(err)
+	assert.Equal(address.BLS, addr.Protocol())
+	assert.Contains(d.RunSuccess("wallet", "addrs", "ls").ReadStdout(), out)
+
+	d.RunFail("unknown key type", "wallet", "addrs", "new", "--type=rsa")
+}
+
 func TestWalletBalance(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -115,3 +134,68 @@ func TestWalletLoadFromFile(t *testing.T) {
 	wb := d.RunSuccess("wallet", "balance", fixtures.TestAddresses[0]).ReadStdoutTrimNewlines()
 	assert.Contains(wb, "10000")
 }
+
+func TestWalletEncryption(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := th.NewDaemon(t).Start()
+	defer d.ShutdownSuccess()
+	addr := d.CreateWalletAddr()
+
+	d.RunFail("wallet is not encrypted", "wallet", "lock")
+	d.RunSuccess("wallet", "encrypt", "hunter2")
+
+	t.Log("[failure] keys can not be used while the wallet is locked")
+	d.RunFail("wallet is locked", "wallet", "export", addr)
+	d.RunFail("wallet is locked", "wallet", "addrs", "new")
+
+	t.Log("[failure] wrong passphrase")
+	d.RunFail("incorrect passphrase", "wallet", "unlock", "hunter3")
+
+	t.Log("[success] unlocked wallets export keys")
+	d.RunSuccess("wallet", "unlock", "hunter2", "--timeout=1m")
+	export := d.RunSuccess("wallet", "export", addr).ReadStdout()
+	assert.Contains(export, addr)
+
+	d.RunSuccess("wallet", "lock")
+	d.RunFail("wallet is locked", "wallet", "export", addr)
+
+	t.Log("[success] change passphrase")
+	d.RunSuccess("wallet", "change-passphrase", "hunter2", "correct horse")
+	d.RunFail("incorrect passphrase", "wallet", "unlock", "hunter2")
+	d.RunSuccess("wallet", "unlock", "correct horse", "--timeout=0")
+	d.RunSuccess("wallet", "export", addr)
+
+	t.Log("[success] change passphrase read from stdin")
+	out := d.RunWithStdin(strings.NewReader("correct horse\nbattery staple\n"), "wallet", "change-passphrase").ReadStdout()
+	assert.Contains(out, "Passphrase changed")
+	d.RunSuccess("wallet", "lock")
+	d.RunFail("incorrect passphrase", "wallet", "unlock", "correct horse")
+	d.RunSuccess("wallet", "unlock", "battery staple")
+}
+
+func TestWalletMnemonicRestore(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d1 := th.NewDaemon(t).Start()
+	defer d1.ShutdownSuccess()
+	d2 := th.NewDaemon(t).Start()
+	defer d2.ShutdownSuccess()
+
+	mnemonic := d1.RunSuccess("wallet", "mnemonic").ReadStdoutTrimNewlines()
+	d1.RunFail("wallet already has a seed", "wallet", "mnemonic")
+	first := d1.CreateWalletAddr()
+	second := d1.CreateWalletAddr()
+	assert.NotEqual(first, second)
+
+	t.Log("[failure] invalid mnemonic")
+	d2.RunFail("invalid mnemonic", "wallet", "restore", "--mnemonic=abandon abandon abandon")
+
+	t.Log("[success] addresses without activity are not imported but derived again")
+	out := d2.RunSuccess("wallet", "restore", "--mnemonic="+mnemonic).ReadStdout()
+	assert.Contains(out, "Restored 0 addresses")
+	assert.Equal(first, d2.CreateWalletAddr())
+	assert.Equal(second, d2.CreateWalletAddr())
+}
@@ -11,6 +11,7 @@ import (
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 
+	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -19,8 +20,9 @@ var chainCmd = &cmds.Command{
 		Tagline: "Inspect the filecoin blockchain",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"head": chainHeadCmd,
-		"ls":   chainLsCmd,
+		"export": chainExportCmd,
+		"head":   chainHeadCmd,
+		"ls":     chainLsCmd,
 	},
 }
 
@@ -43,6 +45,36 @@ var chainHeadCmd = &cmds.Command{
 	Type: []cid.Cid{},
 }
 
+var chainExportCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Export a snapshot of the blockchain",
+		ShortDescription: `
+Writes a CAR file with the most recent tipsets of the chain, from head back to
+the given depth, and their state to stdout. A new node initialized from the
+snapshot with go-filecoin init --import-snapshot trusts the oldest tipset in
+it and syncs from there instead of from the genesis block. By default the
+snapshot is deep enough for the node to check every proof of space-time that
+is still live.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.UintOption("depth", "number of tipsets to export"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		depth := int(consensus.AncestorRoundsNeeded.AsBigInt().Uint64()) + consensus.LookBackParameter
+		if d, ok := req.Options["depth"].(uint); ok {
+			depth = int(d)
+		}
+
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(GetPorcelainAPI(env).ChainExport(req.Context, depth, pw)) // nolint: errcheck
+		}()
+
+		return re.Emit(pr)
+	},
+}
+
 var chainLsCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline:          "List blocks in the blockchain",
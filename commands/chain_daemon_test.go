@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
@@ -110,4 +113,32 @@ func TestChainDaemon(t *testing.T) {
 		assert.Contains(chainLsResult, "1")
 		assert.Contains(chainLsResult, "0")
 	})
+
+	t.Run("chain export writes a snapshot a new node can be initialized from", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+		require := require.New(t)
+
+		d1 := th.NewDaemon(t, th.WithMiner(fixtures.TestMiners[0])).Start()
+		defer d1.ShutdownSuccess()
+
+		d1.RunSuccess("mining", "once")
+		head := d1.RunSuccess("mining", "once", "--enc", "text").ReadStdoutTrimNewlines()
+
+		snapshot := d1.RunSuccess("chain", "export", "--depth=2").ReadStdout()
+		f, err := ioutil.TempFile("", "snapshot")
+		require.NoError(err)
+		defer os.Remove(f.Name()) // nolint: errcheck
+		_, err = f.WriteString(snapshot)
+		require.NoError(err)
+		require.NoError(f.Close())
+
+		d2 := th.NewDaemon(t, th.ImportSnapshot(f.Name())).Start()
+		defer d2.ShutdownSuccess()
+
+		// the chain of the new node ends at the oldest tipset of the snapshot
+		chainLs := strings.Split(d2.RunSuccess("chain", "ls").ReadStdoutTrimNewlines(), "\n")
+		require.Len(chainLs, 2)
+		assert.Equal(head, chainLs[0])
+	})
 }
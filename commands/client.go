@@ -14,6 +14,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/api"
 	"github.com/filecoin-project/go-filecoin/protocol/storage"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 var clientCmd = &cmds.Command{
@@ -111,6 +112,10 @@ Duration should be specified with the number of blocks for which to store the
 data. New blocks are generated about every 30 seconds, so the time given should
 be represented as a count of 30 second intervals. For example, 1 minute would
 be 2, 1 hour would be 120, and 1 day would be 2880.
+
+The deal is paid from a new payment channel unless --channel names an existing
+channel of the default address, which must hold enough funds for the deal. Each
+deal paid from the same channel needs its own --lane.
 `,
 	},
 	Arguments: []cmdkit.Argument{
@@ -121,6 +126,8 @@ be 2, 1 hour would be 120, and 1 day would be 2880.
 	},
 	Options: []cmdkit.Option{
 		cmdkit.BoolOption("allow-duplicates", "Allows duplicate proposals to be created. Unless this flag is set, you will not be able to make more than one deal per piece per miner. This protection exists to prevent erroneous duplicate deals."),
+		cmdkit.StringOption("channel", "ID of an existing payment channel to pay the deal from"),
+		cmdkit.Uint64Option("lane", "Lane of the payment channel the deal pays on").WithDefault(uint64(0)),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		allowDuplicates, _ := req.Options["allow-duplicates"].(bool)
@@ -145,7 +152,16 @@ be 2, 1 hour would be 120, and 1 day would be 2880.
 			return err
 		}
 
-		resp, err := GetAPI(env).Client().ProposeStorageDeal(req.Context, data, miner, askid, duration, allowDuplicates)
+		var channel *types.ChannelID
+		if channelOption, ok := req.Options["channel"].(string); ok {
+			channel, ok = types.NewChannelIDFromString(channelOption, 10)
+			if !ok {
+				return fmt.Errorf("invalid channel id")
+			}
+		}
+		lane, _ := req.Options["lane"].(uint64)
+
+		resp, err := GetAPI(env).Client().ProposeStorageDeal(req.Context, data, miner, askid, duration, allowDuplicates, channel, lane)
 		if err != nil {
 			return err
 		}
@@ -18,6 +18,7 @@ var initCmd = &cmds.Command{
 	},
 	Options: []cmdkit.Option{
 		cmdkit.StringOption(GenesisFile, "path of file or HTTP(S) URL containing archive of genesis block DAG data"),
+		cmdkit.StringOption(ImportSnapshot, "path of file or HTTP(S) URL containing a chain snapshot written by chain export to initialize the chain from instead of the genesis block"),
 		cmdkit.StringOption(PeerKeyFile, "path of file containing key to use for new node's libp2p identity"),
 		cmdkit.StringOption(WithMiner, "when set, creates a custom genesis block with a pre generated miner account, requires running the daemon using dev mode (--dev)"),
 		cmdkit.StringOption(DefaultAddress, "when set, sets the daemons's default address to the provided address"),
@@ -33,6 +34,7 @@ var initCmd = &cmds.Command{
 		}
 
 		genesisFile, _ := req.Options[GenesisFile].(string)
+		importSnapshot, _ := req.Options[ImportSnapshot].(string)
 		peerKeyFile, _ := req.Options[PeerKeyFile].(string)
 		autoSealIntervalSeconds, _ := req.Options[AutoSealIntervalSeconds].(uint)
 		devnetTest, _ := req.Options[DevnetTest].(bool)
@@ -61,6 +63,7 @@ var initCmd = &cmds.Command{
 			req.Context,
 			api.RepoDir(repoDir),
 			api.GenesisFile(genesisFile),
+			api.ImportSnapshot(importSnapshot),
 			api.PeerKeyFile(peerKeyFile),
 			api.WithMiner(withMiner),
 			api.DevnetTest(devnetTest),
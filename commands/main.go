@@ -68,6 +68,9 @@ const (
 	// GenesisFile is the path of file containing archive of genesis block DAG data
 	GenesisFile = "genesisfile"
 
+	// ImportSnapshot is the path of a chain snapshot file to initialize the chain from
+	ImportSnapshot = "import-snapshot"
+
 	// DevnetTest populates config bootstrap addrs with the dns multiaddrs of the test devnet and other test devnet specific bootstrap parameters
 	DevnetTest = "devnet-test"
 
@@ -123,6 +126,7 @@ MESSAGE COMMANDS
 
 TOOL COMMANDS
   go-filecoin log                    - Interact with the daemon event log output.
+  go-filecoin repo                   - Manage the repo
   go-filecoin version                - Show go-filecoin version information
 `,
 	},
@@ -164,6 +168,7 @@ var rootSubcmdsDaemon = map[string]*cmds.Command{
 	"mpool":            mpoolCmd,
 	"paych":            paymentChannelCmd,
 	"ping":             pingCmd,
+	"repo":             repoCmd,
 	"retrieval-client": retrievalClientCmd,
 	"show":             showCmd,
 	"swarm":            swarmCmd,
@@ -347,3 +352,31 @@ func parseGasOptions(req *cmds.Request) (types.AttoFIL, types.GasUnits, bool, er
 
 	return *price, types.NewGasUnits(gasLimitInt), preview, nil
 }
+
+// parseOptionalGasOptions is like parseGasOptions, for commands that do not
+// require the price and limit options. It returns nil for those not given.
+func parseOptionalGasOptions(req *cmds.Request) (*types.AttoFIL, *types.GasUnits, bool, error) {
+	var price *types.AttoFIL
+	if priceOption := req.Options["price"]; priceOption != nil {
+		var ok bool
+		price, ok = types.NewAttoFILFromFILString(priceOption.(string))
+		if !ok {
+			return nil, nil, false, errors.New("invalid gas price (specify FIL as a decimal number)")
+		}
+	}
+
+	var limit *types.GasUnits
+	if limitOption := req.Options["limit"]; limitOption != nil {
+		gasLimitInt, ok := limitOption.(uint64)
+		if !ok {
+			msg := fmt.Sprintf("invalid gas limit: %s", limitOption)
+			return nil, nil, false, errors.New(msg)
+		}
+		gasLimit := types.NewGasUnits(gasLimitInt)
+		limit = &gasLimit
+	}
+
+	preview, _ := req.Options["preview"].(bool)
+
+	return price, limit, preview, nil
+}
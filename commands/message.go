@@ -14,7 +14,9 @@ import (
 	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/plumbing/mthdsig"
+	"github.com/filecoin-project/go-filecoin/porcelain"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -24,8 +26,10 @@ var msgCmd = &cmds.Command{
 		Tagline: "Manage messages",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"send": msgSendCmd,
-		"wait": msgWaitCmd,
+		"resend": msgResendCmd,
+		"send":   msgSendCmd,
+		"status": msgStatusCmd,
+		"wait":   msgWaitCmd,
 	},
 }
 
@@ -38,6 +42,11 @@ type msgSendResult struct {
 var msgSendCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Send a message", // This feels too generic...
+		ShortDescription: `
+Sends a message to an actor. If no gas price is given the message pays the
+median gas price of messages in recent blocks, and if no gas limit is given
+it is estimated by previewing the message.
+`,
 	},
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("target", true, false, "Address of the actor to send the message to"),
@@ -61,6 +70,7 @@ var msgSendCmd = &cmds.Command{
 		if !ok {
 			val = 0
 		}
+		value := types.NewAttoFILFromFIL(uint64(val))
 
 		o := req.Options["from"]
 		var fromAddr address.Address
@@ -72,7 +82,7 @@ var msgSendCmd = &cmds.Command{
 			}
 		}
 
-		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		optGasPrice, optGasLimit, preview, err := parseOptionalGasOptions(req)
 		if err != nil {
 			return err
 		}
@@ -99,11 +109,43 @@ var msgSendCmd = &cmds.Command{
 			})
 		}
 
+		// the gas estimate depends on the sender, so resolve the default one first
+		if fromAddr == (address.Address{}) {
+			fromAddr, err = GetPorcelainAPI(env).GetAndMaybeSetDefaultSenderAddress()
+			if err != nil {
+				return err
+			}
+			if fromAddr == (address.Address{}) {
+				return porcelain.ErrNoDefaultFromAddress
+			}
+		}
+
+		// suggest a gas price and estimate the gas limit if they are not given
+		var gasPrice types.AttoFIL
+		if optGasPrice != nil {
+			gasPrice = *optGasPrice
+		} else {
+			gasPrice, err = GetPorcelainAPI(env).GasPriceSuggest(req.Context)
+			if err != nil {
+				return errors.Wrap(err, "failed to suggest gas price")
+			}
+		}
+
+		var gasLimit types.GasUnits
+		if optGasLimit != nil {
+			gasLimit = *optGasLimit
+		} else {
+			gasLimit, err = GetPorcelainAPI(env).MessageEstimateGas(req.Context, fromAddr, target, value, method)
+			if err != nil {
+				return errors.Wrap(err, "failed to estimate gas limit")
+			}
+		}
+
 		c, err := GetPorcelainAPI(env).MessageSendWithDefaultAddress(
 			req.Context,
 			fromAddr,
 			target,
-			types.NewAttoFILFromFIL(uint64(val)),
+			value,
 			gasPrice,
 			gasLimit,
 			method,
@@ -220,6 +262,156 @@ var msgWaitCmd = &cmds.Command{
 	},
 }
 
+// MessageStatusResult is the result of a message status call. Nonces is set
+// for an address, Message for a message cid.
+type MessageStatusResult struct {
+	Nonces  *msg.NonceStatus         `json:",omitempty"`
+	Message *porcelain.MessageStatus `json:",omitempty"`
+}
+
+var msgStatusCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show where a message is, or the nonces of the messages sent from an address",
+		ShortDescription: `
+Given a message cid, shows the tipset that included the message, its height,
+the receipt of the message and the state root after the tipset, or whether
+the message is waiting in the message pool.
+
+Given an address, shows the nonce of the next message from the address the
+chain accepts, the nonce the next message sent from it gets, and the nonces of
+its messages in the message pool. Gaps are nonces without a message in the
+message pool; the messages after a gap are stuck until it is filled, either
+with 'message resend' or by the next message sent from the address, which
+restores the journaled messages of the gaps or else takes the first gap's
+nonce.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid-or-address", true, false, "Cid of the message or address to show the nonces of"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		if msgCid, err := cid.Parse(req.Arguments[0]); err == nil {
+			status, err := GetPorcelainAPI(env).MessageStatus(req.Context, msgCid)
+			if err != nil {
+				return err
+			}
+			return re.Emit(&MessageStatusResult{Message: status})
+		}
+
+		addr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid message cid or address")
+		}
+
+		status, err := GetPorcelainAPI(env).MessageNonceStatus(req.Context, addr)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&MessageStatusResult{Nonces: status})
+	},
+	Type: MessageStatusResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *MessageStatusResult) error {
+			if status := res.Nonces; status != nil {
+				fmt.Fprintf(w, "Chain nonce: %d\n", status.ChainNonce) // nolint: errcheck
+				fmt.Fprintf(w, "Next nonce:  %d\n", status.NextNonce)  // nolint: errcheck
+				fmt.Fprintf(w, "Pending:     %v\n", status.Pending)    // nolint: errcheck
+				fmt.Fprintf(w, "Gaps:        %v\n", status.Gaps)       // nolint: errcheck
+				return nil
+			}
+
+			status := res.Message
+			if status.Location == nil {
+				if status.Pending {
+					fmt.Fprintln(w, "Pending in message pool") // nolint: errcheck
+				} else {
+					fmt.Fprintln(w, "Not found") // nolint: errcheck
+				}
+				return nil
+			}
+			fmt.Fprintf(w, "TipSet:     %s\n", status.Location.TipSet.String())    // nolint: errcheck
+			fmt.Fprintf(w, "Height:     %d\n", status.Location.Height)             // nolint: errcheck
+			fmt.Fprintf(w, "Block:      %s\n", status.Location.Block.String())     // nolint: errcheck
+			fmt.Fprintf(w, "State root: %s\n", status.Location.StateRoot.String()) // nolint: errcheck
+			if rcpt := status.Location.Receipt; rcpt != nil {
+				fmt.Fprintf(w, "Exit code:  %d\n", rcpt.ExitCode)   // nolint: errcheck
+				fmt.Fprintf(w, "Gas cost:   %s\n", rcpt.GasAttoFIL) // nolint: errcheck
+			} else {
+				fmt.Fprintln(w, "Not applied, conflicts with another message of the tipset") // nolint: errcheck
+			}
+			return nil
+		}),
+	},
+}
+
+var msgResendCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Fill nonce gaps and rebroadcast the pending messages from an address",
+		ShortDescription: `
+Fills every gap in the nonces of the messages sent from the address with the
+original message if it is still valid, and otherwise with an empty message
+from the address to the burn address, and broadcasts the pending messages from the
+address again. If no gas price or limit is given for the empty messages, the
+suggested gas price and an estimated limit are used.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("address", true, false, "Address to resend the messages of"),
+	},
+	Options: []cmdkit.Option{
+		priceOption,
+		limitOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		addr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid address")
+		}
+
+		optGasPrice, optGasLimit, _, err := parseOptionalGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		var gasPrice types.AttoFIL
+		if optGasPrice != nil {
+			gasPrice = *optGasPrice
+		} else {
+			gasPrice, err = GetPorcelainAPI(env).GasPriceSuggest(req.Context)
+			if err != nil {
+				return errors.Wrap(err, "failed to suggest gas price")
+			}
+		}
+
+		var gasLimit types.GasUnits
+		if optGasLimit != nil {
+			gasLimit = *optGasLimit
+		} else {
+			gasLimit, err = GetPorcelainAPI(env).MessageEstimateGas(req.Context, addr, address.BurnAddress, nil, "")
+			if err != nil {
+				return errors.Wrap(err, "failed to estimate gas limit")
+			}
+		}
+
+		cids, err := GetPorcelainAPI(env).MessageResend(req.Context, addr, gasPrice, gasLimit)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(cids)
+	},
+	Type: []cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, cids *[]cid.Cid) error {
+			for _, c := range *cids {
+				fmt.Fprintln(w, c.String()) // nolint: errcheck
+			}
+			return nil
+		}),
+	},
+}
+
 func appendJSON(val interface{}, out []byte) ([]byte, error) {
 	m, err := json.MarshalIndent(val, "", "\t")
 	if err != nil {
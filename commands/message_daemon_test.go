@@ -51,6 +51,12 @@ func TestMessageSend(t *testing.T) {
 		"--price", "0", "--limit", "300",
 		"--value=10", fixtures.TestAddresses[1],
 	)
+
+	t.Log("[success] with estimated gas price and limit")
+	d.RunSuccess("message", "send",
+		"--from", fixtures.TestAddresses[0],
+		"--value=10", fixtures.TestAddresses[1],
+	)
 }
 
 func TestMessageWait(t *testing.T) {
@@ -95,6 +101,28 @@ func TestMessageWait(t *testing.T) {
 
 		wg.Wait()
 	})
+
+	t.Run("status shows where a message is", func(t *testing.T) {
+		assert := assert.New(t)
+
+		msgcid := d.RunSuccess(
+			"message", "send",
+			"--from", fixtures.TestAddresses[0],
+			"--price", "0", "--limit", "300",
+			"--value=10",
+			fixtures.TestAddresses[1],
+		).ReadStdoutTrimNewlines()
+
+		out := d.RunSuccess("message", "status", msgcid).ReadStdout()
+		assert.Contains(out, "Pending in message pool")
+
+		d.RunSuccess("mining once")
+		d.RunSuccess("message", "wait", msgcid)
+
+		out = d.RunSuccess("message", "status", msgcid).ReadStdout()
+		assert.Contains(out, "Height:")
+		assert.Contains(out, "Exit code:  0")
+	})
 }
 
 func TestMessageSendBlockGasLimit(t *testing.T) {
@@ -142,3 +170,34 @@ func TestMessageSendBlockGasLimit(t *testing.T) {
 		assert.NotEmpty(t, result.Messages, "msg under the block gas limit passes validation and is run in the block")
 	})
 }
+
+func TestMessageStatusAndResend(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := th.NewDaemon(t, th.KeyFile(fixtures.KeyFilePaths()[0])).Start()
+	defer d.ShutdownSuccess()
+
+	msgCid := d.RunSuccess("message", "send",
+		"--from", fixtures.TestAddresses[0],
+		"--price", "0", "--limit", "300",
+		"--value=10", fixtures.TestAddresses[1],
+	).ReadStdoutTrimNewlines()
+
+	out := d.RunSuccess("message", "status", fixtures.TestAddresses[0]).ReadStdout()
+	assert.Contains(out, "Gaps:        []")
+
+	// removing the message leaves a gap in the nonces of the address
+	d.RunSuccess("mpool", "rm", msgCid)
+	out = d.RunSuccess("message", "status", fixtures.TestAddresses[0]).ReadStdout()
+	assert.NotContains(out, "Gaps:        []")
+
+	filler := d.RunSuccess("message", "resend", fixtures.TestAddresses[0],
+		"--price", "0", "--limit", "300",
+	).ReadStdoutTrimNewlines()
+	assert.NotEqual(msgCid, filler)
+	assert.Equal(filler, d.RunSuccess("mpool", "ls").ReadStdoutTrimNewlines())
+
+	out = d.RunSuccess("message", "status", fixtures.TestAddresses[0]).ReadStdout()
+	assert.Contains(out, "Gaps:        []")
+}
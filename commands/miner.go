@@ -24,11 +24,14 @@ var minerCmd = &cmds.Command{
 	Subcommands: map[string]*cmds.Command{
 		"create":        minerCreateCmd,
 		"add-ask":       minerAddAskCmd,
+		"collateral":    minerCollateralCmd,
+		"exit":          minerExitCmd,
 		"owner":         minerOwnerCmd,
 		"pledge":        minerPledgeCmd,
 		"power":         minerPowerCmd,
 		"set-price":     minerSetPriceCmd,
 		"update-peerid": minerUpdatePeerIDCmd,
+		"worker":        minerWorkerCmd,
 	},
 }
 
@@ -37,6 +40,9 @@ var minerPledgeCmd = &cmds.Command{
 		Tagline:          "View number of pledged sectors for <miner>",
 		ShortDescription: `Shows the number of pledged sectors for the given miner address`,
 	},
+	Subcommands: map[string]*cmds.Command{
+		"set": minerPledgeSetCmd,
+	},
 	Arguments: []cmdkit.Argument{
 		cmdkit.StringArg("miner", true, false, "The miner address"),
 	},
@@ -58,6 +64,234 @@ var minerPledgeCmd = &cmds.Command{
 	},
 }
 
+// minerMessageResult is the type returned by commands sending a single message to a miner.
+type minerMessageResult struct {
+	Cid     cid.Cid
+	GasUsed types.GasUnits
+	Preview bool
+}
+
+var minerMessageResultEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *minerMessageResult) error {
+		if res.Preview {
+			output := strconv.FormatUint(uint64(res.GasUsed), 10)
+			_, err := w.Write([]byte(output))
+			return err
+		}
+		return PrintString(w, res.Cid)
+	}),
+}
+
+// minerMessageOptions are the options of commands sending a single message to a miner.
+var minerMessageOptions = []cmdkit.Option{
+	cmdkit.StringOption("from", "Address to send from"),
+	cmdkit.StringOption("miner", "The address of the miner, defaults to the miner of this node"),
+	priceOption,
+	limitOption,
+	previewOption,
+}
+
+// parseMinerMessageOptions parses the from and miner addresses of minerMessageOptions.
+func parseMinerMessageOptions(req *cmds.Request) (fromAddr address.Address, minerAddr address.Address, err error) {
+	fromAddr, err = optionalAddr(req.Options["from"])
+	if err != nil {
+		return address.Address{}, address.Address{}, err
+	}
+
+	if req.Options["miner"] != nil {
+		minerAddr, err = address.NewFromString(req.Options["miner"].(string))
+		if err != nil {
+			return address.Address{}, address.Address{}, errors.Wrap(err, "miner must be an address")
+		}
+	}
+
+	return fromAddr, minerAddr, nil
+}
+
+var minerPledgeSetCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Change the number of sectors pledged by a miner",
+		ShortDescription: `Issues a new message to the network to change the miner's pledge and waits for it
+to be mined. The pledge can not be lower than the storage market's minimum of 10
+sectors or the number of committed sectors, and the miner's collateral must be at
+least 0.001 FIL per pledged sector.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("pledge", true, false, "The new size of the pledge (in sectors)"),
+	},
+	Options: minerMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		fromAddr, minerAddr, err := parseMinerMessageOptions(req)
+		if err != nil {
+			return err
+		}
+
+		pledge, err := strconv.ParseUint(req.Arguments[0], 10, 64)
+		if err != nil {
+			return ErrInvalidPledge
+		}
+
+		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		if preview {
+			usedGas, err := GetPorcelainAPI(env).MinerPreviewSetPledge(req.Context, fromAddr, minerAddr, pledge)
+			if err != nil {
+				return err
+			}
+			return re.Emit(&minerMessageResult{GasUsed: usedGas, Preview: true})
+		}
+
+		c, err := GetPorcelainAPI(env).MinerSetPledge(req.Context, fromAddr, minerAddr, gasPrice, gasLimit, pledge)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&minerMessageResult{Cid: c, GasUsed: types.NewGasUnits(0)})
+	},
+	Type:     &minerMessageResult{},
+	Encoders: minerMessageResultEncoders,
+}
+
+var minerCollateralCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Manage the collateral of a miner",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add":      minerCollateralAddCmd,
+		"withdraw": minerCollateralWithdrawCmd,
+	},
+}
+
+var minerCollateralAddCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline:          "Add <amount> FIL to the collateral of a miner",
+		ShortDescription: `Issues a new message to the network sending collateral to the miner and waits for it to be mined.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("amount", true, false, "The amount of collateral in FIL to add"),
+	},
+	Options: minerMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		fromAddr, minerAddr, err := parseMinerMessageOptions(req)
+		if err != nil {
+			return err
+		}
+
+		amount, ok := types.NewAttoFILFromFILString(req.Arguments[0])
+		if !ok {
+			return ErrInvalidCollateral
+		}
+
+		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		if preview {
+			usedGas, err := GetPorcelainAPI(env).MinerPreviewAddCollateral(req.Context, fromAddr, minerAddr)
+			if err != nil {
+				return err
+			}
+			return re.Emit(&minerMessageResult{GasUsed: usedGas, Preview: true})
+		}
+
+		c, err := GetPorcelainAPI(env).MinerAddCollateral(req.Context, fromAddr, minerAddr, gasPrice, gasLimit, amount)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&minerMessageResult{Cid: c, GasUsed: types.NewGasUnits(0)})
+	},
+	Type:     &minerMessageResult{},
+	Encoders: minerMessageResultEncoders,
+}
+
+var minerCollateralWithdrawCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Withdraw <amount> FIL of collateral from a miner to its owner",
+		ShortDescription: `Issues a new message to the network withdrawing collateral and waits for it to be
+mined. Only collateral that is not needed to cover the miner's pledge can be withdrawn.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("amount", true, false, "The amount of collateral in FIL to withdraw"),
+	},
+	Options: minerMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		fromAddr, minerAddr, err := parseMinerMessageOptions(req)
+		if err != nil {
+			return err
+		}
+
+		amount, ok := types.NewAttoFILFromFILString(req.Arguments[0])
+		if !ok {
+			return ErrInvalidCollateral
+		}
+
+		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		if preview {
+			usedGas, err := GetPorcelainAPI(env).MinerPreviewWithdrawCollateral(req.Context, fromAddr, minerAddr, amount)
+			if err != nil {
+				return err
+			}
+			return re.Emit(&minerMessageResult{GasUsed: usedGas, Preview: true})
+		}
+
+		c, err := GetPorcelainAPI(env).MinerWithdrawCollateral(req.Context, fromAddr, minerAddr, gasPrice, gasLimit, amount)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&minerMessageResult{Cid: c, GasUsed: types.NewGasUnits(0)})
+	},
+	Type:     &minerMessageResult{},
+	Encoders: minerMessageResultEncoders,
+}
+
+var minerExitCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Return all collateral of a miner to its owner",
+		ShortDescription: `Issues a new message to the network returning the miner's collateral, dropping
+its pledge and sectors and removing it from the storage market, and waits for it to
+be mined. A miner can only exit once every deal committed to its sectors has expired.`,
+	},
+	Options: minerMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		fromAddr, minerAddr, err := parseMinerMessageOptions(req)
+		if err != nil {
+			return err
+		}
+
+		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		if preview {
+			usedGas, err := GetPorcelainAPI(env).MinerPreviewExit(req.Context, fromAddr, minerAddr)
+			if err != nil {
+				return err
+			}
+			return re.Emit(&minerMessageResult{GasUsed: usedGas, Preview: true})
+		}
+
+		c, err := GetPorcelainAPI(env).MinerExit(req.Context, fromAddr, minerAddr, gasPrice, gasLimit)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&minerMessageResult{Cid: c, GasUsed: types.NewGasUnits(0)})
+	},
+	Type:     &minerMessageResult{},
+	Encoders: minerMessageResultEncoders,
+}
+
 // MinerCreateResult is the type returned when creating a miner.
 type MinerCreateResult struct {
 	Address address.Address
@@ -445,6 +679,10 @@ var minerOwnerCmd = &cmds.Command{
 		Tagline:          "Show the actor address of <miner>",
 		ShortDescription: `Given <miner> miner address, output the address of the actor that owns the miner.`,
 	},
+	Subcommands: map[string]*cmds.Command{
+		"accept":   minerOwnerAcceptCmd,
+		"transfer": minerOwnerTransferCmd,
+	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		minerAddr, err := optionalAddr(req.Arguments[0])
 		if err != nil {
@@ -468,6 +706,168 @@ var minerOwnerCmd = &cmds.Command{
 	},
 }
 
+var minerOwnerTransferCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Propose to transfer a miner to <new-owner>",
+		ShortDescription: `Issues a new message to the network proposing <new-owner> as the owner of the
+miner and waits for it to be mined. The transfer completes once the new owner
+accepts it with 'miner owner accept'. The message must be sent by the current owner.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("new-owner", true, false, "The address of the proposed owner"),
+	},
+	Options: minerMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		fromAddr, minerAddr, err := parseMinerMessageOptions(req)
+		if err != nil {
+			return err
+		}
+
+		ownerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "new owner must be an address")
+		}
+
+		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		if preview {
+			usedGas, err := GetPorcelainAPI(env).MinerPreviewProposeOwner(req.Context, fromAddr, minerAddr, ownerAddr)
+			if err != nil {
+				return err
+			}
+			return re.Emit(&minerMessageResult{GasUsed: usedGas, Preview: true})
+		}
+
+		c, err := GetPorcelainAPI(env).MinerProposeOwner(req.Context, fromAddr, minerAddr, gasPrice, gasLimit, ownerAddr)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&minerMessageResult{Cid: c, GasUsed: types.NewGasUnits(0)})
+	},
+	Type:     &minerMessageResult{},
+	Encoders: minerMessageResultEncoders,
+}
+
+var minerOwnerAcceptCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Accept the proposed transfer of a miner",
+		ShortDescription: `Issues a new message to the network making the sender the owner of the miner and
+waits for it to be mined. The sender must have been proposed as the new owner
+with 'miner owner transfer'.`,
+	},
+	Options: minerMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		fromAddr, minerAddr, err := parseMinerMessageOptions(req)
+		if err != nil {
+			return err
+		}
+
+		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		if preview {
+			usedGas, err := GetPorcelainAPI(env).MinerPreviewAcceptOwner(req.Context, fromAddr, minerAddr)
+			if err != nil {
+				return err
+			}
+			return re.Emit(&minerMessageResult{GasUsed: usedGas, Preview: true})
+		}
+
+		c, err := GetPorcelainAPI(env).MinerAcceptOwner(req.Context, fromAddr, minerAddr, gasPrice, gasLimit)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&minerMessageResult{Cid: c, GasUsed: types.NewGasUnits(0)})
+	},
+	Type:     &minerMessageResult{},
+	Encoders: minerMessageResultEncoders,
+}
+
+var minerWorkerCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Show the worker address of <miner>",
+		ShortDescription: `Given <miner> miner address, output the address that commits sectors and
+submits PoSts on behalf of the miner.`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"set": minerWorkerSetCmd,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		minerAddr, err := optionalAddr(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		workerAddr, err := GetPorcelainAPI(env).MinerGetWorkerAddress(req.Context, minerAddr)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&workerAddr)
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("miner", true, false, "The address of the miner"),
+	},
+	Type: address.Address{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, a *address.Address) error {
+			return PrintString(w, a)
+		}),
+	},
+}
+
+var minerWorkerSetCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Make <worker> the worker of a miner",
+		ShortDescription: `Issues a new message to the network replacing the miner's worker and waits for it
+to be mined. The worker may commit sectors, submit PoSts, add asks and update the
+peer id of the miner. The message must be sent by the owner.`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("worker", true, false, "The address of the new worker"),
+	},
+	Options: minerMessageOptions,
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		fromAddr, minerAddr, err := parseMinerMessageOptions(req)
+		if err != nil {
+			return err
+		}
+
+		workerAddr, err := address.NewFromString(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "worker must be an address")
+		}
+
+		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		if preview {
+			usedGas, err := GetPorcelainAPI(env).MinerPreviewChangeWorker(req.Context, fromAddr, minerAddr, workerAddr)
+			if err != nil {
+				return err
+			}
+			return re.Emit(&minerMessageResult{GasUsed: usedGas, Preview: true})
+		}
+
+		c, err := GetPorcelainAPI(env).MinerChangeWorker(req.Context, fromAddr, minerAddr, gasPrice, gasLimit, workerAddr)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&minerMessageResult{Cid: c, GasUsed: types.NewGasUnits(0)})
+	},
+	Type:     &minerMessageResult{},
+	Encoders: minerMessageResultEncoders,
+}
+
 var minerPowerCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Get the power of a miner versus the total storage market power",
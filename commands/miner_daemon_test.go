@@ -36,12 +36,15 @@ func TestMinerHelp(t *testing.T) {
 
 		expected := []string{
 			"miner add-ask <miner> <price> <expiry>  - DEPRECATED: Use set-price",
+			"miner collateral                        - Manage the collateral of a miner",
 			"miner create <pledge> <collateral>      - Create a new file miner with <pledge> sectors and <collateral> FIL",
+			"miner exit                              - Return all collateral of a miner to its owner",
 			"miner owner <miner>                     - Show the actor address of <miner>",
 			"miner pledge <miner>                    - View number of pledged sectors for <miner>",
 			"miner power <miner>                     - Get the power of a miner versus the total storage market power",
 			"miner set-price <storageprice> <expiry> - Set the minimum price for storage",
 			"miner update-peerid <address> <peerid>  - Change the libp2p identity that a miner is operating",
+			"miner worker <miner>                    - Show the worker address of <miner>",
 		}
 
 		result := runHelpSuccess(t, "miner", "--help")
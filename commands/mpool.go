@@ -9,6 +9,7 @@ import (
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 
+	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -17,8 +18,9 @@ var mpoolCmd = &cmds.Command{
 		Tagline: "Manage the message pool",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"ls": mpoolLsCmd,
-		"rm": mpoolRemoveCmd,
+		"ls":      mpoolLsCmd,
+		"replace": mpoolReplaceCmd,
+		"rm":      mpoolRemoveCmd,
 	},
 }
 
@@ -28,16 +30,39 @@ var mpoolLsCmd = &cmds.Command{
 	},
 	Options: []cmdkit.Option{
 		cmdkit.UintOption("wait-for-count", "Block until this number of messages are in the pool").WithDefault(0),
+		cmdkit.StringOption("from", "Only show messages sent from this address"),
+		cmdkit.Uint64Option("nonce", "Only show messages with this nonce"),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		messageCount, _ := req.Options["wait-for-count"].(uint)
 
+		var fromAddr address.Address
+		if o := req.Options["from"]; o != nil {
+			var err error
+			fromAddr, err = address.NewFromString(o.(string))
+			if err != nil {
+				return errors.Wrap(err, "invalid from address")
+			}
+		}
+		nonce, filterNonce := req.Options["nonce"].(uint64)
+
 		pending, err := GetAPI(env).Mpool().View(req.Context, messageCount)
 		if err != nil {
 			return err
 		}
 
-		return re.Emit(pending)
+		filtered := []*types.SignedMessage{}
+		for _, msg := range pending {
+			if !fromAddr.Empty() && msg.From != fromAddr {
+				continue
+			}
+			if filterNonce && uint64(msg.Nonce) != nonce {
+				continue
+			}
+			filtered = append(filtered, msg)
+		}
+
+		return re.Emit(filtered)
 	},
 	Type: []*types.SignedMessage{},
 	Encoders: cmds.EncoderMap{
@@ -54,6 +79,50 @@ var mpoolLsCmd = &cmds.Command{
 	},
 }
 
+var mpoolReplaceCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Replace a pending message with one paying a higher gas price",
+		ShortDescription: `
+Replaces a message in the message pool that was sent from an address in the
+wallet with a copy of it with the given gas price and limit, and broadcasts the
+copy. The gas price must be at least mpool.replaceByFeeBumpPercent percent
+higher than the gas price of the pending message.
+`,
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("cid", true, false, "The CID of the message to replace"),
+	},
+	Options: []cmdkit.Option{
+		priceOption,
+		limitOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		msgCid, err := cid.Parse(req.Arguments[0])
+		if err != nil {
+			return errors.Wrap(err, "invalid message cid")
+		}
+
+		gasPrice, gasLimit, _, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		c, err := GetPorcelainAPI(env).MessageReplace(req.Context, msgCid, gasPrice, gasLimit)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(c)
+	},
+	Type: cid.Cid{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, c cid.Cid) error {
+			fmt.Fprintln(w, c.String()) // nolint: errcheck
+			return nil
+		}),
+	},
+}
+
 var mpoolRemoveCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
 		Tagline: "Delete a message from the message pool",
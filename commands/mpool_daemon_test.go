@@ -79,6 +79,36 @@ func TestMpoolLs(t *testing.T) {
 
 		assert.True(complete)
 	})
+
+	t.Run("filter by sender and nonce", func(t *testing.T) {
+		t.Parallel()
+		d := th.NewDaemon(t, th.KeyFile(fixtures.KeyFilePaths()[0]), th.KeyFile(fixtures.KeyFilePaths()[1])).Start()
+		defer d.ShutdownSuccess()
+
+		first := d.RunSuccess("message", "send",
+			"--from", fixtures.TestAddresses[0],
+			"--price", "0", "--limit", "300",
+			"--value=10", fixtures.TestAddresses[2],
+		).ReadStdoutTrimNewlines()
+		second := d.RunSuccess("message", "send",
+			"--from", fixtures.TestAddresses[0],
+			"--price", "0", "--limit", "300",
+			"--value=10", fixtures.TestAddresses[2],
+		).ReadStdoutTrimNewlines()
+		other := d.RunSuccess("message", "send",
+			"--from", fixtures.TestAddresses[1],
+			"--price", "0", "--limit", "300",
+			"--value=10", fixtures.TestAddresses[2],
+		).ReadStdoutTrimNewlines()
+
+		out := d.RunSuccess("mpool", "ls", "--from", fixtures.TestAddresses[0]).ReadStdoutTrimNewlines()
+		assert.Contains(out, first)
+		assert.Contains(out, second)
+		assert.NotContains(out, other)
+
+		out = d.RunSuccess("mpool", "ls", "--from", fixtures.TestAddresses[0], "--nonce", "1").ReadStdoutTrimNewlines()
+		assert.Equal(second, out)
+	})
 }
 
 func TestMpoolRm(t *testing.T) {
@@ -102,3 +132,28 @@ func TestMpoolRm(t *testing.T) {
 		assert.Equal("", out)
 	})
 }
+
+func TestMpoolReplace(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	t.Run("replace a message with a higher gas price", func(t *testing.T) {
+		t.Parallel()
+		d := th.NewDaemon(t, th.KeyFile(fixtures.KeyFilePaths()[0])).Start()
+		defer d.ShutdownSuccess()
+
+		msgCid := d.RunSuccess("message", "send",
+			"--from", fixtures.TestAddresses[0],
+			"--price", "0.0001", "--limit", "300",
+			"--value=10", fixtures.TestAddresses[2],
+		).ReadStdoutTrimNewlines()
+
+		d.RunFail("same nonce", "mpool", "replace", msgCid, "--price", "0.000105", "--limit", "300")
+
+		replacement := d.RunSuccess("mpool", "replace", msgCid, "--price", "0.0002", "--limit", "300").ReadStdoutTrimNewlines()
+		assert.NotEqual(msgCid, replacement)
+
+		out := d.RunSuccess("mpool", "ls").ReadStdoutTrimNewlines()
+		assert.Equal(replacement, out)
+	})
+}
@@ -7,9 +7,7 @@ import (
 
 	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
-	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
-	"gx/ipfs/QmekxXDhCxCJRNuzmHreuaT3BsuJcsjcXWNrtV9C8DRHtd/go-multibase"
 
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
 	"github.com/filecoin-project/go-filecoin/address"
@@ -21,13 +19,14 @@ var paymentChannelCmd = &cmds.Command{
 		Tagline: "Payment channel operations",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"close":   closeCmd,
-		"create":  createChannelCmd,
-		"extend":  extendCmd,
-		"ls":      lsCmd,
-		"reclaim": reclaimCmd,
-		"redeem":  redeemCmd,
-		"voucher": voucherCmd,
+		"add-funds": addFundsCmd,
+		"close":     closeCmd,
+		"create":    createChannelCmd,
+		"extend":    extendCmd,
+		"ls":        lsCmd,
+		"reclaim":   reclaimCmd,
+		"redeem":    redeemCmd,
+		"voucher":   voucherCmd,
 	},
 }
 
@@ -181,6 +180,8 @@ var voucherCmd = &cmds.Command{
 	Options: []cmdkit.Option{
 		cmdkit.StringOption("from", "Address for which to retrieve channels"),
 		cmdkit.StringOption("validat", "Smallest block height at which target can redeem"),
+		cmdkit.Uint64Option("lane", "Lane of the channel the voucher pays on").WithDefault(uint64(0)),
+		cmdkit.Uint64Option("nonce", "Nonce of the voucher, superseding vouchers of its lane with a lower nonce").WithDefault(uint64(0)),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		fromAddr, err := optionalAddr(req.Options["from"])
@@ -203,7 +204,10 @@ var voucherCmd = &cmds.Command{
 			return ErrInvalidAmount
 		}
 
-		voucher, err := GetAPI(env).Paych().Voucher(req.Context, fromAddr, channel, amount, validAt)
+		lane, _ := req.Options["lane"].(uint64)
+		nonce, _ := req.Options["nonce"].(uint64)
+
+		voucher, err := GetAPI(env).Paych().Voucher(req.Context, fromAddr, channel, amount, validAt, lane, nonce)
 		if err != nil {
 			return err
 		}
@@ -226,10 +230,12 @@ type redeemResult struct {
 
 var redeemCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
-		Tagline: "Redeem a payment voucher against a payment channel",
+		Tagline: "Redeem payment vouchers against a payment channel",
+		ShortDescription: `Redeem one or more vouchers of a payment channel, at most one per lane,
+in a single message.`,
 	},
 	Arguments: []cmdkit.Argument{
-		cmdkit.StringArg("voucher", true, false, "Base58 encoded signed voucher"),
+		cmdkit.StringArg("voucher", true, true, "Base58 encoded signed vouchers"),
 	},
 	Options: []cmdkit.Option{
 		cmdkit.StringOption("from", "Address of the channel target"),
@@ -249,13 +255,7 @@ var redeemCmd = &cmds.Command{
 		}
 
 		if preview {
-			_, cborVoucher, err := multibase.Decode(req.Arguments[0])
-			if err != nil {
-				return err
-			}
-
-			var voucher paymentbroker.PaymentVoucher
-			err = cbor.DecodeInto(cborVoucher, &voucher)
+			params, err := paymentbroker.DecodeRedeemParams(req.Arguments...)
 			if err != nil {
 				return err
 			}
@@ -265,7 +265,7 @@ var redeemCmd = &cmds.Command{
 				fromAddr,
 				address.PaymentBrokerAddress,
 				"redeem",
-				voucher.Payer, &voucher.Channel, &voucher.Amount, &voucher.ValidAt, []byte(voucher.Signature),
+				params...,
 			)
 			if err != nil {
 				return err
@@ -277,7 +277,7 @@ var redeemCmd = &cmds.Command{
 			})
 		}
 
-		c, err := GetAPI(env).Paych().Redeem(req.Context, fromAddr, gasPrice, gasLimit, req.Arguments[0])
+		c, err := GetAPI(env).Paych().Redeem(req.Context, fromAddr, gasPrice, gasLimit, req.Arguments...)
 		if err != nil {
 			return err
 		}
@@ -386,10 +386,12 @@ type closeResult struct {
 
 var closeCmd = &cmds.Command{
 	Helptext: cmdkit.HelpText{
-		Tagline: "Redeem a payment voucher and close the payment channel",
+		Tagline: "Redeem payment vouchers and close the payment channel",
+		ShortDescription: `Redeem one or more vouchers of a payment channel, at most one per lane,
+then return the remaining funds to the payer.`,
 	},
 	Arguments: []cmdkit.Argument{
-		cmdkit.StringArg("voucher", true, false, "Base58 encoded signed voucher"),
+		cmdkit.StringArg("voucher", true, true, "Base58 encoded signed vouchers"),
 	},
 	Options: []cmdkit.Option{
 		cmdkit.StringOption("from", "Address of the channel target"),
@@ -409,13 +411,7 @@ var closeCmd = &cmds.Command{
 		}
 
 		if preview {
-			_, cborVoucher, err := multibase.Decode(req.Arguments[0])
-			if err != nil {
-				return err
-			}
-
-			var voucher paymentbroker.PaymentVoucher
-			err = cbor.DecodeInto(cborVoucher, &voucher)
+			params, err := paymentbroker.DecodeRedeemParams(req.Arguments...)
 			if err != nil {
 				return err
 			}
@@ -425,7 +421,7 @@ var closeCmd = &cmds.Command{
 				fromAddr,
 				address.PaymentBrokerAddress,
 				"close",
-				voucher.Payer, &voucher.Channel, &voucher.Amount, &voucher.ValidAt, []byte(voucher.Signature),
+				params...,
 			)
 			if err != nil {
 				return err
@@ -437,7 +433,7 @@ var closeCmd = &cmds.Command{
 			})
 		}
 
-		c, err := GetAPI(env).Paych().Close(req.Context, fromAddr, gasPrice, gasLimit, req.Arguments[0])
+		c, err := GetAPI(env).Paych().Close(req.Context, fromAddr, gasPrice, gasLimit, req.Arguments...)
 		if err != nil {
 			return err
 		}
@@ -549,3 +545,86 @@ var extendCmd = &cmds.Command{
 		}),
 	},
 }
+
+type addFundsResult struct {
+	Cid     cid.Cid
+	GasUsed types.GasUnits
+	Preview bool
+}
+
+var addFundsCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Add funds to a given channel without changing its lifetime",
+	},
+	Arguments: []cmdkit.Argument{
+		cmdkit.StringArg("channel", true, false, "Id of channel to add funds to"),
+		cmdkit.StringArg("amount", true, false, "Amount in FIL to add to the channel"),
+	},
+	Options: []cmdkit.Option{
+		cmdkit.StringOption("from", "Address of the channel creator"),
+		priceOption,
+		limitOption,
+		previewOption,
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		fromAddr, err := optionalAddr(req.Options["from"])
+		if err != nil {
+			return err
+		}
+
+		channel, ok := types.NewChannelIDFromString(req.Arguments[0], 10)
+		if !ok {
+			return fmt.Errorf("invalid channel id")
+		}
+
+		amount, ok := types.NewAttoFILFromFILString(req.Arguments[1])
+		if !ok {
+			return ErrInvalidAmount
+		}
+
+		gasPrice, gasLimit, preview, err := parseGasOptions(req)
+		if err != nil {
+			return err
+		}
+
+		if preview {
+			usedGas, err := GetPorcelainAPI(env).MessagePreview(
+				req.Context,
+				fromAddr,
+				address.PaymentBrokerAddress,
+				"addFunds",
+				channel,
+			)
+			if err != nil {
+				return err
+			}
+			return re.Emit(&addFundsResult{
+				Cid:     cid.Cid{},
+				GasUsed: usedGas,
+				Preview: true,
+			})
+		}
+
+		c, err := GetAPI(env).Paych().AddFunds(req.Context, fromAddr, gasPrice, gasLimit, channel, amount)
+		if err != nil {
+			return err
+		}
+
+		return re.Emit(&addFundsResult{
+			Cid:     c,
+			GasUsed: types.NewGasUnits(0),
+			Preview: false,
+		})
+	},
+	Type: &addFundsResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *addFundsResult) error {
+			if res.Preview {
+				output := strconv.FormatUint(uint64(res.GasUsed), 10)
+				_, err := w.Write([]byte(output))
+				return err
+			}
+			return PrintString(w, res.Cid)
+		}),
+	},
+}
@@ -336,6 +336,30 @@ func TestPaymentChannelExtendSuccess(t *testing.T) {
 	})
 }
 
+func TestPaymentChannelAddFundsSuccess(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	payer, err := address.NewFromString(fixtures.TestAddresses[0])
+	require.NoError(err)
+	target, err := address.NewFromString(fixtures.TestAddresses[1])
+	require.NoError(err)
+
+	eol := types.NewBlockHeight(5)
+	amt := types.NewAttoFILFromFIL(2000)
+
+	daemonTestWithPaymentChannel(t, &payer, &target, amt, eol, func(d *th.TestDaemon, channelID *types.ChannelID) {
+		assert := assert.New(t)
+
+		addedAmt := types.NewAttoFILFromFIL(1500)
+
+		mustAddFunds(t, d, channelID, addedAmt, &payer)
+
+		lsStr := listChannelsAsStrs(d, &payer)[0]
+		assert.Equal(fmt.Sprintf("%v: target: %s, amt: %s, amt redeemed: 0, eol: %s", channelID.String(), target.String(), addedAmt.Add(amt), eol), lsStr)
+	})
+}
+
 func daemonTestWithPaymentChannel(t *testing.T, payerAddress *address.Address, targetAddress *address.Address, fundsToLock *types.AttoFIL, eol *types.BlockHeight, f func(*th.TestDaemon, *types.ChannelID)) {
 	assert := assert.New(t)
 
@@ -436,6 +460,36 @@ func mustExtendChannel(t *testing.T, d *th.TestDaemon, channelID *types.ChannelI
 	wg.Wait()
 }
 
+func mustAddFunds(t *testing.T, d *th.TestDaemon, channelID *types.ChannelID, amount *types.AttoFIL, payerAddress *address.Address) {
+	require := require.New(t)
+
+	args := []string{"paych", "add-funds"}
+	args = append(args, "--from", payerAddress.String(), "--price", "0", "--limit", "300")
+	args = append(args, channelID.String(), amount.String())
+
+	addFundsCmd := d.RunSuccess(args...)
+	messageCid, err := cid.Parse(strings.Trim(addFundsCmd.ReadStdout(), "\n"))
+	require.NoError(err)
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		_ = d.RunSuccess("message", "wait",
+			"--return=false",
+			"--message=false",
+			"--receipt=false",
+			messageCid.String(),
+		)
+
+		wg.Done()
+	}()
+
+	d.RunSuccess("mining once")
+
+	wg.Wait()
+}
+
 func mustRedeemVoucher(t *testing.T, d *th.TestDaemon, voucher string, targetAddress *address.Address) {
 	require := require.New(t)
 
@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"gx/ipfs/QmQtQrtNioesAWtrx8csBvfY37gTe94d6wQ3VikZUjxD39/go-ipfs-cmds"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+)
+
+var repoCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Manage the repo",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"gc": repoGCCmd,
+	},
+}
+
+var repoGCCmd = &cmds.Command{
+	Helptext: cmdkit.HelpText{
+		Tagline: "Delete old state and forks from the repo",
+		ShortDescription: `
+Keeps the state of the tipsets of the most recent chain heights, including
+those of forks off the head chain, and every block of the head chain. Deletes
+the state of older tipsets and the tipsets and blocks of forks that branched
+off before the most recent heights. The number of heights to keep defaults to
+datastore.gcRetention in the config. Mining and validating blocks look back at
+the state of recent tipsets, keeping fewer heights than they look back breaks
+them.
+`,
+	},
+	Options: []cmdkit.Option{
+		cmdkit.Uint64Option("retention", "number of most recent chain heights to keep the state of"),
+	},
+	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+		retention, ok := req.Options["retention"].(uint64)
+		if !ok {
+			r, err := GetPorcelainAPI(env).ConfigGet("datastore.gcRetention")
+			if err != nil {
+				return err
+			}
+			retention, ok = r.(uint64)
+			if !ok {
+				return errors.New("datastore.gcRetention is not a number")
+			}
+		}
+
+		res, err := GetPorcelainAPI(env).RepoGC(req.Context, retention)
+		if err != nil {
+			return err
+		}
+		return re.Emit(res)
+	},
+	Type: chain.GCResult{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, res *chain.GCResult) error {
+			_, err := fmt.Fprintf(w, "removed %d tipsets, %d blocks and %d state nodes\n", res.TipSets, res.Blocks, res.StateNodes)
+			return err
+		}),
+	},
+}
@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/go-filecoin/fixtures"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+)
+
+func TestRepoGC(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := th.NewDaemon(t, th.WithMiner(fixtures.TestMiners[0])).Start()
+	defer d.ShutdownSuccess()
+
+	for i := 0; i < 6; i++ {
+		d.RunSuccess("mining", "once")
+	}
+
+	// keep enough state for mining to look back at the power table
+	out := d.RunSuccess("repo", "gc", "--retention=4").ReadStdoutTrimNewlines()
+	assert.Contains(out, "state nodes")
+
+	// the whole chain is still there and the node keeps mining on it
+	d.RunSuccess("mining", "once")
+	chain := d.RunSuccess("chain", "ls").ReadStdoutTrimNewlines()
+	assert.Equal(8, len(strings.Split(chain, "\n")))
+
+	d.RunFail("retention must be at least 1", "repo", "gc", "--retention=0")
+}
@@ -6,6 +6,7 @@ import (
 	"gx/ipfs/Qmde5VP1qUkyQXKCfmEUA7bP64V2HAptbJ7phuPp7jXWwg/go-ipfs-cmdkit"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 var retrievalClientCmd = &cmds.Command{
@@ -25,6 +26,11 @@ var clientRetrievePieceCmd = &cmds.Command{
 		cmdkit.StringArg("miner", true, false, "Retrieval miner actor address"),
 		cmdkit.StringArg("cid", true, false, "Content identifier of piece to read"),
 	},
+	Options: []cmdkit.Option{
+		cmdkit.Uint64Option("offset", "Offset in bytes of the first byte of the piece to read").WithDefault(uint64(0)),
+		cmdkit.Uint64Option("length", "Number of bytes of the piece to read. If not set, the rest of the piece is read").WithDefault(uint64(0)),
+		cmdkit.StringOption("max-price", "Maximum total price in FIL to pay the miner for the piece. If not set, the piece is requested for free"),
+	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		minerAddr, err := address.NewFromString(req.Arguments[0])
 		if err != nil {
@@ -36,7 +42,19 @@ var clientRetrievePieceCmd = &cmds.Command{
 			return err
 		}
 
-		readCloser, err := GetAPI(env).RetrievalClient().RetrievePiece(req.Context, pieceCID, minerAddr)
+		maxPrice := types.NewZeroAttoFIL()
+		if req.Options["max-price"] != nil {
+			var ok bool
+			maxPrice, ok = types.NewAttoFILFromFILString(req.Options["max-price"].(string))
+			if !ok {
+				return ErrInvalidPrice
+			}
+		}
+
+		offset, _ := req.Options["offset"].(uint64)
+		length, _ := req.Options["length"].(uint64)
+
+		readCloser, err := GetAPI(env).RetrievalClient().RetrievePiece(req.Context, pieceCID, minerAddr, offset, length, maxPrice)
 		if err != nil {
 			return err
 		}
@@ -17,13 +17,14 @@ import (
 
 // Config is an in memory representation of the filecoin configuration file
 type Config struct {
-	API       *APIConfig       `json:"api"`
-	Bootstrap *BootstrapConfig `json:"bootstrap"`
-	Datastore *DatastoreConfig `json:"datastore"`
-	Swarm     *SwarmConfig     `json:"swarm"`
-	Mining    *MiningConfig    `json:"mining"`
-	Wallet    *WalletConfig    `json:"wallet"`
-	Heartbeat *HeartbeatConfig `json:"heartbeat"`
+	API       *APIConfig         `json:"api"`
+	Bootstrap *BootstrapConfig   `json:"bootstrap"`
+	Datastore *DatastoreConfig   `json:"datastore"`
+	Swarm     *SwarmConfig       `json:"swarm"`
+	Mining    *MiningConfig      `json:"mining"`
+	Mpool     *MessagePoolConfig `json:"mpool"`
+	Wallet    *WalletConfig      `json:"wallet"`
+	Heartbeat *HeartbeatConfig   `json:"heartbeat"`
 }
 
 // APIConfig holds all configuration options related to the api.
@@ -52,6 +53,13 @@ func newDefaultAPIConfig() *APIConfig {
 type DatastoreConfig struct {
 	Type string `json:"type"`
 	Path string `json:"path"`
+	// GCPeriod is how often the node collects garbage in the repo in the
+	// background. Golang duration units are accepted. Background garbage
+	// collection is disabled if it is empty.
+	GCPeriod string `json:"gcPeriod"`
+	// GCRetention is the number of most recent chain heights garbage
+	// collection keeps the state of.
+	GCRetention uint64 `json:"gcRetention"`
 }
 
 // Validators hold the list of validation functions for each configuration
@@ -65,8 +73,10 @@ var Validators = map[string]func(string, string) error{
 
 func newDefaultDatastoreConfig() *DatastoreConfig {
 	return &DatastoreConfig{
-		Type: "badgerds",
-		Path: "badger",
+		Type:        "badgerds",
+		Path:        "badger",
+		GCPeriod:    "",
+		GCRetention: 1000,
 	}
 }
 
@@ -104,6 +114,13 @@ type MiningConfig struct {
 	BlockSignerAddress      address.Address `json:"blockSignerAddress"`
 	AutoSealIntervalSeconds uint            `json:"autoSealIntervalSeconds"`
 	StoragePrice            *types.AttoFIL  `json:"storagePrice"`
+	RetrievalPrice          *types.AttoFIL  `json:"retrievalPrice"`
+	// RedeemBlocksBeforeEol is how many blocks before a payment channel's
+	// end of life the miner redeems the best vouchers it holds for it.
+	RedeemBlocksBeforeEol uint64 `json:"redeemBlocksBeforeEol"`
+	// RedeemThreshold is the unredeemed amount at which the miner redeems a
+	// channel's vouchers early. Zero disables early redemption.
+	RedeemThreshold *types.AttoFIL `json:"redeemThreshold"`
 }
 
 func newDefaultMiningConfig() *MiningConfig {
@@ -111,12 +128,47 @@ func newDefaultMiningConfig() *MiningConfig {
 		MinerAddress:            address.Address{},
 		AutoSealIntervalSeconds: 120,
 		StoragePrice:            types.NewZeroAttoFIL(),
+		RetrievalPrice:          types.NewZeroAttoFIL(),
+		RedeemBlocksBeforeEol:   50,
+		RedeemThreshold:         types.NewZeroAttoFIL(),
+	}
+}
+
+// MessagePoolConfig holds all configuration options related to the message pool.
+type MessagePoolConfig struct {
+	// MaxPoolSize is the number of pending messages at which the pool starts
+	// evicting its lowest priced messages to admit better paying ones.
+	MaxPoolSize int `json:"maxPoolSize"`
+	// MaxSenderMessages is the largest number of pending messages the pool
+	// holds from a single sender.
+	MaxSenderMessages int `json:"maxSenderMessages"`
+	// ReplaceByFeeBumpPercent is how much higher, in percent, the gas price of
+	// a message must be to replace a pending message with the same nonce.
+	ReplaceByFeeBumpPercent uint64 `json:"replaceByFeeBumpPercent"`
+	// MessageExpiration is the number of blocks of chain growth after which a
+	// pending message that has not been included in a block is dropped.
+	MessageExpiration uint64 `json:"messageExpiration"`
+}
+
+func newDefaultMessagePoolConfig() *MessagePoolConfig {
+	return &MessagePoolConfig{
+		MaxPoolSize:             10000,
+		MaxSenderMessages:       100,
+		ReplaceByFeeBumpPercent: 10,
+		MessageExpiration:       100,
 	}
 }
 
 // WalletConfig holds all configuration options related to the wallet.
 type WalletConfig struct {
 	DefaultAddress address.Address `json:"defaultAddress,omitempty"`
+	// RemoteSigner is the endpoint of a signer holding additional keys,
+	// either an http:// URL or a unix:// socket path. No remote signer is
+	// used if it is empty.
+	RemoteSigner string `json:"remoteSigner,omitempty"`
+	// RemoteSignerToken authenticates the node to the remote signer, which
+	// requires it when serving over http://.
+	RemoteSignerToken string `json:"remoteSignerToken,omitempty"`
 }
 
 func newDefaultWalletConfig() *WalletConfig {
@@ -157,6 +209,7 @@ func NewDefaultConfig() *Config {
 		Datastore: newDefaultDatastoreConfig(),
 		Swarm:     newDefaultSwarmConfig(),
 		Mining:    newDefaultMiningConfig(),
+		Mpool:     newDefaultMessagePoolConfig(),
 		Wallet:    newDefaultWalletConfig(),
 		Heartbeat: newDefaultHeartbeatConfig(),
 	}
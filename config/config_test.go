@@ -58,7 +58,9 @@ func TestWriteFile(t *testing.T) {
 	},
 	"datastore": {
 		"type": "badgerds",
-		"path": "badger"
+		"path": "badger",
+		"gcPeriod": "",
+		"gcRetention": 1000
 	},
 	"swarm": {
 		"address": "/ip4/0.0.0.0/tcp/6000"
@@ -67,7 +69,16 @@ func TestWriteFile(t *testing.T) {
 		"minerAddress": "",
 		"blockSignerAddress": "",
 		"autoSealIntervalSeconds": 120,
-		"storagePrice": "0"
+		"storagePrice": "0",
+		"retrievalPrice": "0",
+		"redeemBlocksBeforeEol": 50,
+		"redeemThreshold": "0"
+	},
+	"mpool": {
+		"maxPoolSize": 10000,
+		"maxSenderMessages": 100,
+		"replaceByFeeBumpPercent": 10,
+		"messageExpiration": 100
 	},
 	"wallet": {
 		"defaultAddress": ""
@@ -134,6 +134,10 @@ func (c *Expected) validateBlockStructure(ctx context.Context, b *types.Block) e
 		return fmt.Errorf("block has nil StateRoot")
 	}
 
+	if !types.VerifyBLSAggregate(b.Messages, b.BLSAggregateSig) {
+		return fmt.Errorf("block has invalid BLS aggregate signature")
+	}
+
 	return nil
 }
 
@@ -60,6 +60,33 @@ func TestExpected_NewValidTipSet(t *testing.T) {
 		assert.NotNil(tipSet)
 	})
 
+	t.Run("NewValidTipSet checks the BLS aggregate signature of blocks", func(t *testing.T) {
+		genesisBlock, err := consensus.InitGenesis(cistore, bstore)
+		require.NoError(err)
+
+		exp := consensus.NewExpected(cistore, bstore, consensus.NewDefaultProcessor(), ptv, genesisBlock.Cid(), verifier)
+
+		pTipSet, err := exp.NewValidTipSet(ctx, []*types.Block{genesisBlock})
+		require.NoError(err)
+
+		blsSigner := types.NewMockSigner(types.MustGenerateBLSKeyInfo(1))
+		msgs, aggregate, err := types.AggregateBLSSignatures(types.NewSignedMsgs(2, blsSigner))
+		require.NoError(err)
+
+		blocks := makeSomeBlocks(pTipSet)[:1]
+		blocks[0].Messages = msgs
+		blocks[0].BLSAggregateSig = aggregate
+		tipSet, err := exp.NewValidTipSet(ctx, blocks)
+		assert.NoError(err)
+		assert.NotNil(tipSet)
+
+		blocks = makeSomeBlocks(pTipSet)[:1]
+		blocks[0].Messages = msgs
+		tipSet, err = exp.NewValidTipSet(ctx, blocks)
+		assert.Error(err)
+		assert.Nil(tipSet)
+	})
+
 	t.Run("NewValidTipSet returns nil + error when invalid blocks", func(t *testing.T) {
 
 		parentBlock := types.NewBlockForTest(nil, 0)
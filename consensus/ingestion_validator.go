@@ -0,0 +1,108 @@
+package consensus
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// MaxMessageSize is the size in bytes of the largest message admitted to the
+// message pool or propagated to peers.
+const MaxMessageSize = 32 * 1024
+
+// MaxNonceGap is how far the nonce of a message may be ahead of its sender's
+// nonce in the head state for the message to be admitted to the message pool.
+const MaxNonceGap = 100
+
+// IngestionValidator validates messages before they are admitted to the
+// message pool or propagated to peers, against the state at the head of the
+// chain. Messages in the pool may queue behind other pending messages from the
+// same sender, so rather than requiring the message to be the next one its
+// sender can apply it accepts nonces up to MaxNonceGap ahead of the sender's,
+// requires the sender to cover the messages it has queued along with the new
+// one, and checks everything else with a SignedMessageValidator.
+type IngestionValidator struct {
+	validator   SignedMessageValidator
+	latestState func(ctx context.Context) (state.Tree, error)
+	pendingFrom func(addr address.Address) []*types.SignedMessage
+}
+
+// NewIngestionValidator creates a new IngestionValidator that validates
+// messages with validator against the state returned by latestState, and
+// the pending messages of their sender returned by pendingFrom.
+func NewIngestionValidator(validator SignedMessageValidator, latestState func(ctx context.Context) (state.Tree, error), pendingFrom func(addr address.Address) []*types.SignedMessage) *IngestionValidator {
+	return &IngestionValidator{
+		validator:   validator,
+		latestState: latestState,
+		pendingFrom: pendingFrom,
+	}
+}
+
+// Validate returns an error if the message is too big, if its sender does not
+// exist, if its nonce was already used or is too far ahead, if its sender
+// cannot cover the value plus GasPrice*GasLimit of its pending messages and
+// this one, or if it fails the SignedMessageValidator.
+func (iv *IngestionValidator) Validate(ctx context.Context, msg *types.SignedMessage) error {
+	data, err := msg.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal message")
+	}
+	if len(data) > MaxMessageSize {
+		return fmt.Errorf("message size %d exceeds maximum of %d bytes", len(data), MaxMessageSize)
+	}
+
+	st, err := iv.latestState(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to load head state")
+	}
+
+	fromActor, err := st.GetActor(ctx, msg.From)
+	if err != nil {
+		if state.IsActorNotFoundError(err) {
+			return fmt.Errorf("sender %s not found", msg.From)
+		}
+		return errors.Wrapf(err, "failed to load sender %s", msg.From)
+	}
+
+	if msg.Nonce < fromActor.Nonce {
+		return fmt.Errorf("nonce %d is stale, sender %s is at nonce %d", msg.Nonce, msg.From, fromActor.Nonce)
+	}
+	if uint64(msg.Nonce) > uint64(fromActor.Nonce)+MaxNonceGap {
+		return fmt.Errorf("nonce %d is more than %d ahead of sender %s at nonce %d", msg.Nonce, MaxNonceGap, msg.From, fromActor.Nonce)
+	}
+
+	// the sender must be able to pay for everything it queued, not just this
+	// message, as the messages are applied one after another
+	total := messageCost(msg)
+	for _, pending := range iv.pendingFrom(msg.From) {
+		// a pending message with the same nonce would be replaced
+		if pending.Nonce < fromActor.Nonce || pending.Nonce == msg.Nonce {
+			continue
+		}
+		total = total.Add(messageCost(pending))
+	}
+	if total.GreaterThan(fromActor.Balance) {
+		return fmt.Errorf("balance insufficient to cover the value and gas of the pending messages of sender %s: %s needed, balance is %s", msg.From, total.String(), fromActor.Balance.String())
+	}
+
+	// validate the message at its own nonce, as it may be queued behind others
+	atNonce := *fromActor
+	atNonce.Nonce = msg.Nonce
+	return iv.validator.Validate(ctx, msg, &atNonce)
+}
+
+// messageCost returns the most a message can take from its sender's balance:
+// its value plus GasPrice*GasLimit.
+func messageCost(msg *types.SignedMessage) *types.AttoFIL {
+	cost := msg.GasPrice.MulBigInt(big.NewInt(int64(msg.GasLimit)))
+	if msg.Value != nil {
+		cost = cost.Add(msg.Value)
+	}
+	return cost
+}
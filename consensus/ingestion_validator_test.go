@@ -0,0 +1,127 @@
+package consensus_test
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	. "github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/state"
+	th "github.com/filecoin-project/go-filecoin/testhelpers"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestIngestionValidator(t *testing.T) {
+	ctx := context.Background()
+	ki := types.MustGenerateKeyInfo(2, types.GenerateKeyInfoSeed())
+	mockSigner := types.NewMockSigner(ki)
+	sender := mockSigner.Addresses[0]
+	unknown := mockSigner.Addresses[1]
+	target := address.NewForTestGetter()()
+
+	setupWithPending := func(require *require.Assertions, pending ...*types.SignedMessage) *IngestionValidator {
+		senderActor := th.RequireNewAccountActor(require, types.NewAttoFILFromFIL(1000))
+		senderActor.Nonce = 5
+		_, st := requireMakeStateTree(require, hamt.NewCborStore(), map[address.Address]*actor.Actor{
+			sender: senderActor,
+		})
+
+		latestState := func(ctx context.Context) (state.Tree, error) {
+			return st, nil
+		}
+		pendingFrom := func(addr address.Address) []*types.SignedMessage {
+			var msgs []*types.SignedMessage
+			for _, msg := range pending {
+				if msg.From == addr {
+					msgs = append(msgs, msg)
+				}
+			}
+			return msgs
+		}
+		return NewIngestionValidator(NewDefaultMessageValidator(), latestState, pendingFrom)
+	}
+	setup := func(require *require.Assertions) *IngestionValidator {
+		return setupWithPending(require)
+	}
+
+	signedMessage := func(require *require.Assertions, from address.Address, nonce uint64, value uint64, gasPrice uint64, gasLimit uint64, params []byte) *types.SignedMessage {
+		msg := types.NewMessage(from, target, nonce, types.NewAttoFILFromFIL(value), "", params)
+		smsg, err := types.NewSignedMessage(*msg, mockSigner, *types.NewAttoFILFromFIL(gasPrice), types.NewGasUnits(gasLimit))
+		require.NoError(err)
+		return smsg
+	}
+
+	t.Run("accepts the next message of the sender and messages queued behind it", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		validator := setup(require)
+
+		assert.NoError(validator.Validate(ctx, signedMessage(require, sender, 5, 10, 1, 100, nil)))
+		assert.NoError(validator.Validate(ctx, signedMessage(require, sender, 5+MaxNonceGap, 10, 1, 100, nil)))
+	})
+
+	t.Run("rejects stale nonces", func(t *testing.T) {
+		require := require.New(t)
+		validator := setup(require)
+
+		err := validator.Validate(ctx, signedMessage(require, sender, 4, 10, 1, 100, nil))
+		require.Error(err)
+		assert.Contains(t, err.Error(), "stale")
+	})
+
+	t.Run("rejects nonces too far ahead", func(t *testing.T) {
+		require := require.New(t)
+		validator := setup(require)
+
+		err := validator.Validate(ctx, signedMessage(require, sender, 6+MaxNonceGap, 10, 1, 100, nil))
+		require.Error(err)
+		assert.Contains(t, err.Error(), "ahead")
+	})
+
+	t.Run("rejects messages whose sender cannot cover value and gas", func(t *testing.T) {
+		require := require.New(t)
+		validator := setup(require)
+
+		err := validator.Validate(ctx, signedMessage(require, sender, 5, 900, 1, 101, nil))
+		require.Error(err)
+		assert.Contains(t, err.Error(), "balance insufficient")
+	})
+
+	t.Run("rejects messages whose sender cannot also cover its pending messages", func(t *testing.T) {
+		require := require.New(t)
+		validator := setupWithPending(require,
+			signedMessage(require, sender, 5, 400, 1, 100, nil),
+			signedMessage(require, sender, 6, 300, 1, 100, nil),
+		)
+
+		err := validator.Validate(ctx, signedMessage(require, sender, 7, 100, 1, 1, nil))
+		require.Error(err)
+		assert.Contains(t, err.Error(), "balance insufficient")
+
+		// replacing a pending message only counts the replacement
+		assert.NoError(t, validator.Validate(ctx, signedMessage(require, sender, 6, 100, 2, 100, nil)))
+	})
+
+	t.Run("rejects messages from unknown senders", func(t *testing.T) {
+		require := require.New(t)
+		validator := setup(require)
+
+		err := validator.Validate(ctx, signedMessage(require, unknown, 0, 0, 0, 0, nil))
+		require.Error(err)
+		assert.Contains(t, err.Error(), "not found")
+	})
+
+	t.Run("rejects messages that are too big", func(t *testing.T) {
+		require := require.New(t)
+		validator := setup(require)
+
+		err := validator.Validate(ctx, signedMessage(require, sender, 5, 10, 1, 100, make([]byte, MaxMessageSize)))
+		require.Error(err)
+		assert.Contains(t, err.Error(), "exceeds maximum")
+	})
+}
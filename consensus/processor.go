@@ -373,21 +373,35 @@ func CallQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, to a
 }
 
 // PreviewQueryMethod estimates the amount of gas that will be used by a method
-// call. It accepts all the same arguments as CallQueryMethod.
-func PreviewQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, to address.Address, method string, params []byte, from address.Address, optBh *types.BlockHeight) (types.GasUnits, error) {
-	toActor, err := st.GetActor(ctx, to)
+// call. It accepts all the same arguments as CallQueryMethod, and optionally
+// the value the message transfers from the from actor to the to actor, which
+// is created if it does not exist yet as when the message is applied.
+func PreviewQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, to address.Address, optValue *types.AttoFIL, method string, params []byte, from address.Address, optBh *types.BlockHeight) (types.GasUnits, error) {
+	// not committing or flushing storage structures guarantees changes won't make it to stored state tree or datastore
+	cachedSt := state.NewCachedStateTree(st)
+
+	var fromActor, toActor *actor.Actor
+	var err error
+	if optValue != nil {
+		fromActor, err = cachedSt.GetActor(ctx, from)
+		if err != nil {
+			return types.NewGasUnits(0), errors.ApplyErrorPermanentWrapf(err, "failed to get From actor")
+		}
+		toActor, err = cachedSt.GetOrCreateActor(ctx, to, func() (*actor.Actor, error) {
+			return &actor.Actor{}, nil
+		})
+	} else {
+		toActor, err = st.GetActor(ctx, to)
+	}
 	if err != nil {
 		return types.NewGasUnits(0), errors.ApplyErrorPermanentWrapf(err, "failed to get To actor")
 	}
 
-	// not committing or flushing storage structures guarantees changes won't make it to stored state tree or datastore
-	cachedSt := state.NewCachedStateTree(st)
-
 	msg := &types.Message{
 		From:   from,
 		To:     to,
 		Nonce:  0,
-		Value:  nil,
+		Value:  optValue,
 		Method: method,
 		Params: params,
 	}
@@ -397,6 +411,7 @@ func PreviewQueryMethod(ctx context.Context, st state.Tree, vms vm.StorageMap, t
 	gasTracker.MsgGasLimit = types.BlockGasLimit
 
 	vmCtxParams := vm.NewContextParams{
+		From:        fromActor,
 		To:          toActor,
 		Message:     msg,
 		State:       cachedSt,
@@ -560,7 +575,9 @@ var _ SignedMessageValidator = (*DefaultMessageValidator)(nil)
 
 // Validate validates that the given message is ready to be processed.
 func (nmv *DefaultMessageValidator) Validate(ctx context.Context, msg *types.SignedMessage, fromActor *actor.Actor) error {
-	if !msg.VerifySignature() {
+	// The signatures of messages aggregated into a block are verified with
+	// the block structure.
+	if !msg.IsAggregated() && !msg.VerifySignature() {
 		return errInvalidSignature
 	}
 
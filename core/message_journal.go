@@ -0,0 +1,120 @@
+package core
+
+import (
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+const messageJournalPrefix = "mpool"
+
+// MessageJournal persists the messages this node originates so they are not
+// lost when the node restarts before they make it into the chain. The message
+// pool itself only lives in memory; the node reloads the journaled messages
+// into it on start.
+type MessageJournal struct {
+	ds repo.Datastore
+}
+
+// NewMessageJournal creates a new MessageJournal storing messages in ds.
+func NewMessageJournal(ds repo.Datastore) *MessageJournal {
+	return &MessageJournal{ds: ds}
+}
+
+// Record persists a message.
+func (j *MessageJournal) Record(msg *types.SignedMessage) error {
+	c, err := msg.Cid()
+	if err != nil {
+		return errors.Wrap(err, "failed to create CID")
+	}
+
+	data, err := msg.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal message")
+	}
+
+	if err := j.ds.Put(messageJournalKey(c), data); err != nil {
+		return errors.Wrapf(err, "failed to journal message %s", c.String())
+	}
+	return nil
+}
+
+// Remove deletes a message from the journal. Removing a message that is not
+// in the journal is a nop.
+func (j *MessageJournal) Remove(c cid.Cid) error {
+	err := j.ds.Delete(messageJournalKey(c))
+	if err != nil && err != datastore.ErrNotFound {
+		return errors.Wrapf(err, "failed to remove message %s from journal", c.String())
+	}
+	return nil
+}
+
+// RemoveIncluded removes the journaled messages that made it into the chain,
+// given the messages of a tipset the head of the chain gained. Messages are
+// matched by sender and nonce rather than cid, so a journaled message is also
+// removed when the chain included another message with its nonce, which it
+// can then no longer be.
+func (j *MessageJournal) RemoveIncluded(included []*types.SignedMessage) error {
+	if len(included) == 0 {
+		return nil
+	}
+
+	type senderNonce struct {
+		from  address.Address
+		nonce types.Uint64
+	}
+	nonces := make(map[senderNonce]bool, len(included))
+	for _, msg := range included {
+		nonces[senderNonce{msg.From, msg.Nonce}] = true
+	}
+
+	msgs, err := j.Messages()
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		if !nonces[senderNonce{msg.From, msg.Nonce}] {
+			continue
+		}
+		c, err := msg.Cid()
+		if err != nil {
+			return errors.Wrap(err, "failed to create CID")
+		}
+		if err := j.Remove(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Messages returns all journaled messages.
+func (j *MessageJournal) Messages() ([]*types.SignedMessage, error) {
+	res, err := j.ds.Query(query.Query{Prefix: "/" + messageJournalPrefix})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query message journal")
+	}
+	defer res.Close() // nolint: errcheck
+
+	var msgs []*types.SignedMessage
+	for entry := range res.Next() {
+		if entry.Error != nil {
+			return nil, errors.Wrap(entry.Error, "failed to read message journal")
+		}
+
+		var msg types.SignedMessage
+		if err := msg.Unmarshal(entry.Value); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal journaled message %s", entry.Key)
+		}
+		msgs = append(msgs, &msg)
+	}
+	return msgs, nil
+}
+
+func messageJournalKey(c cid.Cid) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{messageJournalPrefix, c.String()})
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestMessageJournal(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r := repo.NewInMemoryRepo()
+	journal := NewMessageJournal(r.Datastore())
+
+	msgs, err := journal.Messages()
+	require.NoError(err)
+	assert.Len(msgs, 0)
+
+	msg1 := newSignedMessage()
+	msg2 := newSignedMessage()
+	require.NoError(journal.Record(msg1))
+	require.NoError(journal.Record(msg2))
+
+	// a journal on the same datastore sees the same messages
+	msgs, err = NewMessageJournal(r.Datastore()).Messages()
+	require.NoError(err)
+	require.Len(msgs, 2)
+	assert.True(types.SmsgCidsEqual(msg1, msgs[0]) || types.SmsgCidsEqual(msg1, msgs[1]))
+	assert.True(types.SmsgCidsEqual(msg2, msgs[0]) || types.SmsgCidsEqual(msg2, msgs[1]))
+
+	c1, err := msg1.Cid()
+	require.NoError(err)
+	require.NoError(journal.Remove(c1))
+	require.NoError(journal.Remove(c1))
+
+	msgs, err = journal.Messages()
+	require.NoError(err)
+	require.Len(msgs, 1)
+	assert.True(types.SmsgCidsEqual(msg2, msgs[0]))
+}
+
+func TestMessageJournalRemoveIncluded(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	journal := NewMessageJournal(repo.NewInMemoryRepo().Datastore())
+
+	msg1 := newSignedMessage()
+	msg2 := newSignedMessage()
+	msg3 := newSignedMessage()
+	require.NoError(journal.Record(msg1))
+	require.NoError(journal.Record(msg2))
+	require.NoError(journal.Record(msg3))
+
+	// another message with the nonce of msg2, e.g. one that replaced it
+	replacement := msg2.Message
+	replacement.Method = "replacement"
+	replacementSmsg, err := types.NewSignedMessage(replacement, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+	require.NoError(err)
+
+	require.NoError(journal.RemoveIncluded(nil))
+	require.NoError(journal.RemoveIncluded([]*types.SignedMessage{msg1, replacementSmsg, newSignedMessage()}))
+
+	msgs, err := journal.Messages()
+	require.NoError(err)
+	require.Len(msgs, 1)
+	assert.True(types.SmsgCidsEqual(msg3, msgs[0]))
+}
@@ -2,34 +2,71 @@ package core
 
 import (
 	"context"
+	"math/big"
 	"sort"
 	"sync"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/types"
 	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
 )
 
+var log = logging.Logger("core")
+
+// PoolValidator validates messages before they are admitted to the pool.
+type PoolValidator interface {
+	// Validate returns an error if the message should not be admitted to the pool.
+	Validate(ctx context.Context, msg *types.SignedMessage) error
+}
+
 // MessagePool keeps an unordered, de-duplicated set of Messages and supports removal by CID.
 // By 'de-duplicated' we mean that insertion of a message by cid that already
 // exists is a nop. We use a MessagePool to store all messages received by this node
 // via network or directly created via user command that have yet to be included
 // in a block. Messages are removed as they are processed.
 //
+// The pool holds at most one message per sender and nonce. A pending message
+// is replaced by a message with the same sender and nonce only if the new
+// message pays a gas price at least ReplaceByFeeBumpPercent higher. Once the
+// pool is full it evicts its lowest priced messages to admit better paying
+// ones, and messages that are not included in a block for MessageExpiration
+// blocks are dropped.
+//
+// Blocks hold the messages of BLS senders without their signatures, which are
+// aggregated into the block. The pool therefore keeps the signed BLS messages
+// it removes when they are included in the chain for MessageExpiration blocks,
+// so it can add them back if the chain including them is abandoned.
+//
 // MessagePool is safe for concurrent access.
 type MessagePool struct {
 	lk sync.RWMutex
 
-	pending map[cid.Cid]*types.SignedMessage // all pending messages
+	cfg       *config.MessagePoolConfig
+	validator PoolValidator
+
+	// height of the chain head the pool was last updated to
+	height uint64
+
+	pending         map[cid.Cid]*timedMessage              // all pending messages
+	addressNonceMap map[address.Address]map[uint64]cid.Cid // pending messages by sender and nonce
+	included        map[cid.Cid]*timedMessage              // signed BLS messages included in the chain
 }
 
-// Add adds a message to the pool.
-func (pool *MessagePool) Add(msg *types.SignedMessage) (cid.Cid, error) {
-	pool.lk.Lock()
-	defer pool.lk.Unlock()
+// timedMessage is a pending message along with the height of the chain head
+// when it was admitted to the pool.
+type timedMessage struct {
+	message *types.SignedMessage
+	addedAt uint64
+}
 
+// Add adds a message to the pool, if it passes the pool's validator. If the
+// pool holds a message with the same sender and nonce it is replaced, provided
+// the new message pays enough more gas.
+func (pool *MessagePool) Add(ctx context.Context, msg *types.SignedMessage) (cid.Cid, error) {
 	c, err := msg.Cid()
 	if err != nil {
 		return cid.Undef, errors.Wrap(err, "failed to create CID")
@@ -40,34 +77,209 @@ func (pool *MessagePool) Add(msg *types.SignedMessage) (cid.Cid, error) {
 		return cid.Undef, errors.Errorf("failed to add message %s to pool: sig invalid", c.String())
 	}
 
-	pool.pending[c] = msg
+	if err := pool.validator.Validate(ctx, msg); err != nil {
+		return cid.Undef, errors.Wrapf(err, "failed to add message %s to pool", c.String())
+	}
+
+	pool.lk.Lock()
+	defer pool.lk.Unlock()
+
+	if _, ok := pool.pending[c]; ok {
+		return c, nil
+	}
+
+	nonces := pool.addressNonceMap[msg.From]
+	if existingCid, ok := nonces[uint64(msg.Nonce)]; ok {
+		existing := pool.pending[existingCid].message
+		if !pool.replaces(msg, existing) {
+			return cid.Undef, errors.Errorf("failed to add message %s to pool: gas price %s is not %d%% above gas price %s of pending message %s with the same nonce",
+				c.String(), msg.GasPrice.String(), pool.cfg.ReplaceByFeeBumpPercent, existing.GasPrice.String(), existingCid.String())
+		}
+		pool.remove(existingCid)
+	} else {
+		if len(nonces) >= pool.cfg.MaxSenderMessages {
+			return cid.Undef, errors.Errorf("failed to add message %s to pool: sender %s has %d pending messages", c.String(), msg.From, len(nonces))
+		}
+		if len(pool.pending) >= pool.cfg.MaxPoolSize && !pool.evictCheaperThan(msg) {
+			return cid.Undef, errors.Errorf("failed to add message %s to pool: pool is full and gas price %s is too low", c.String(), msg.GasPrice.String())
+		}
+	}
+
+	pool.pending[c] = &timedMessage{message: msg, addedAt: pool.height}
+	if pool.addressNonceMap[msg.From] == nil {
+		pool.addressNonceMap[msg.From] = make(map[uint64]cid.Cid)
+	}
+	pool.addressNonceMap[msg.From][uint64(msg.Nonce)] = c
 	return c, nil
 }
 
+// replaces returns true if msg pays a high enough gas price to replace existing.
+func (pool *MessagePool) replaces(msg, existing *types.SignedMessage) bool {
+	if !msg.GasPrice.GreaterThan(&existing.GasPrice) {
+		return false
+	}
+	bumped := existing.GasPrice.MulBigInt(big.NewInt(int64(100 + pool.cfg.ReplaceByFeeBumpPercent)))
+	return msg.GasPrice.MulBigInt(big.NewInt(100)).GreaterEqual(bumped)
+}
+
+// evictCheaperThan makes room for msg by evicting the lowest priced of the
+// messages with the highest nonce of each sender, so no sender is left with a
+// nonce gap. It returns false, evicting nothing, if msg does not pay more than
+// that message.
+func (pool *MessagePool) evictCheaperThan(msg *types.SignedMessage) bool {
+	var cheapest *timedMessage
+	var cheapestCid cid.Cid
+	for _, nonces := range pool.addressNonceMap {
+		var last cid.Cid
+		var lastNonce uint64
+		for nonce, c := range nonces {
+			if !last.Defined() || nonce > lastNonce {
+				last, lastNonce = c, nonce
+			}
+		}
+		tm := pool.pending[last]
+		if cheapest == nil || tm.message.GasPrice.LessThan(&cheapest.message.GasPrice) {
+			cheapest, cheapestCid = tm, last
+		}
+	}
+
+	if cheapest == nil || !msg.GasPrice.GreaterThan(&cheapest.message.GasPrice) {
+		return false
+	}
+	log.Debugf("evicting message %s from full message pool", cheapestCid.String())
+	pool.remove(cheapestCid)
+	return true
+}
+
 // Pending returns all pending messages.
 func (pool *MessagePool) Pending() []*types.SignedMessage {
 	pool.lk.Lock()
 	defer pool.lk.Unlock()
 	out := make([]*types.SignedMessage, 0, len(pool.pending))
-	for _, msg := range pool.pending {
-		out = append(out, msg)
+	for _, tm := range pool.pending {
+		out = append(out, tm.message)
 	}
 
 	return out
 }
 
+// PendingFrom returns the pending messages sent from addr.
+func (pool *MessagePool) PendingFrom(addr address.Address) []*types.SignedMessage {
+	pool.lk.RLock()
+	defer pool.lk.RUnlock()
+
+	nonces := pool.addressNonceMap[addr]
+	out := make([]*types.SignedMessage, 0, len(nonces))
+	for _, c := range nonces {
+		out = append(out, pool.pending[c].message)
+	}
+	return out
+}
+
+// Get returns the pending message with the given CID, if there is one.
+func (pool *MessagePool) Get(c cid.Cid) (*types.SignedMessage, bool) {
+	pool.lk.RLock()
+	defer pool.lk.RUnlock()
+
+	tm, ok := pool.pending[c]
+	if !ok {
+		return nil, false
+	}
+	return tm.message, true
+}
+
 // Remove removes the message by CID from the pending pool.
 func (pool *MessagePool) Remove(c cid.Cid) {
 	pool.lk.Lock()
 	defer pool.lk.Unlock()
 
+	pool.remove(c)
+}
+
+// remove removes the message by CID. The pool lock must be held.
+func (pool *MessagePool) remove(c cid.Cid) {
+	tm, ok := pool.pending[c]
+	if !ok {
+		return
+	}
 	delete(pool.pending, c)
+
+	nonces := pool.addressNonceMap[tm.message.From]
+	delete(nonces, uint64(tm.message.Nonce))
+	if len(nonces) == 0 {
+		delete(pool.addressNonceMap, tm.message.From)
+	}
+}
+
+// removeIncluded removes the message by CID from the pending pool because it
+// was included in the chain. A BLS-signed message is kept along with its
+// signature in case the chain is abandoned.
+func (pool *MessagePool) removeIncluded(c cid.Cid) {
+	pool.lk.Lock()
+	defer pool.lk.Unlock()
+
+	tm, ok := pool.pending[c]
+	if !ok {
+		return
+	}
+	if tm.message.From.Protocol() == address.BLS && !tm.message.IsAggregated() {
+		pool.included[c] = &timedMessage{message: tm.message, addedAt: pool.height}
+	}
+	pool.remove(c)
+}
+
+// SignedIncluded returns the signed message for a message taken from a block
+// of an abandoned chain. The signature of an aggregated message is restored if
+// the pool saw the message before it was included, otherwise false is returned.
+func (pool *MessagePool) SignedIncluded(msg *types.SignedMessage) (*types.SignedMessage, bool) {
+	if !msg.IsAggregated() {
+		return msg, true
+	}
+	c, err := msg.Cid()
+	if err != nil {
+		return nil, false
+	}
+
+	pool.lk.RLock()
+	defer pool.lk.RUnlock()
+
+	tm, ok := pool.included[c]
+	if !ok {
+		return nil, false
+	}
+	return tm.message, true
 }
 
-// NewMessagePool constructs a new MessagePool.
-func NewMessagePool() *MessagePool {
+// setHeight records the height of the new chain head and drops the messages
+// that have been pending, or included in the chain, for MessageExpiration
+// blocks or more.
+func (pool *MessagePool) setHeight(height uint64) {
+	pool.lk.Lock()
+	defer pool.lk.Unlock()
+
+	pool.height = height
+	for c, tm := range pool.pending {
+		if height >= tm.addedAt+pool.cfg.MessageExpiration {
+			log.Debugf("dropping expired message %s from message pool", c.String())
+			pool.remove(c)
+		}
+	}
+	for c, tm := range pool.included {
+		if height >= tm.addedAt+pool.cfg.MessageExpiration {
+			delete(pool.included, c)
+		}
+	}
+}
+
+// NewMessagePool constructs a new MessagePool that admits the messages
+// accepted by validator.
+func NewMessagePool(cfg *config.MessagePoolConfig, validator PoolValidator) *MessagePool {
 	return &MessagePool{
-		pending: make(map[cid.Cid]*types.SignedMessage),
+		cfg:             cfg,
+		validator:       validator,
+		pending:         make(map[cid.Cid]*timedMessage),
+		addressNonceMap: make(map[address.Address]map[uint64]cid.Cid),
+		included:        make(map[cid.Cid]*timedMessage),
 	}
 }
 
@@ -199,11 +411,17 @@ func UpdateMessagePool(ctx context.Context, pool *MessagePool, store *hamt.CborI
 		}
 	}
 
-	// Now actually update the pool.
+	// Now actually update the pool. Messages that can no longer be applied
+	// on the new chain are dropped, as are messages that have expired.
+	pool.setHeight(newHeight)
 	for _, m := range addToPool {
-		_, err := pool.Add(m)
-		if err != nil {
-			return err
+		m, ok := pool.SignedIncluded(m)
+		if !ok {
+			log.Debugf("dropping aggregated message from abandoned chain: signature is unknown")
+			continue
+		}
+		if _, err := pool.Add(ctx, m); err != nil {
+			log.Debugf("dropping message from abandoned chain: %s", err)
 		}
 	}
 	// m.Cid() can error, so collect all the Cids before
@@ -216,7 +434,7 @@ func UpdateMessagePool(ctx context.Context, pool *MessagePool, store *hamt.CborI
 		removeCids[i] = cid
 	}
 	for _, cid := range removeCids {
-		pool.Remove(cid)
+		pool.removeIncluded(cid)
 	}
 
 	return nil
@@ -12,6 +12,7 @@ import (
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -22,8 +23,9 @@ var newSignedMessage = types.NewSignedMessageForTestGetter(mockSigner)
 
 func TestMessagePoolAddRemove(t *testing.T) {
 	assert := assert.New(t)
+	ctx := context.Background()
 
-	pool := NewMessagePool()
+	pool := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 	msg1 := newSignedMessage()
 	msg2 := newSignedMessage()
 
@@ -33,10 +35,10 @@ func TestMessagePoolAddRemove(t *testing.T) {
 	assert.NoError(err)
 
 	assert.Len(pool.Pending(), 0)
-	_, err = pool.Add(msg1)
+	_, err = pool.Add(ctx, msg1)
 	assert.NoError(err)
 	assert.Len(pool.Pending(), 1)
-	_, err = pool.Add(msg2)
+	_, err = pool.Add(ctx, msg2)
 	assert.NoError(err)
 	assert.Len(pool.Pending(), 2)
 
@@ -48,46 +50,65 @@ func TestMessagePoolAddRemove(t *testing.T) {
 
 func TestMessagePoolAddBadSignature(t *testing.T) {
 	assert := assert.New(t)
+	ctx := context.Background()
 
-	pool := NewMessagePool()
+	pool := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 	smsg := newSignedMessage()
 	smsg.Message.Nonce = types.Uint64(uint64(smsg.Message.Nonce) + uint64(1)) // invalidate message
 
-	c, err := pool.Add(smsg)
+	c, err := pool.Add(ctx, smsg)
 	assert.False(c.Defined())
 	assert.Error(err)
 }
 
+func TestMessagePoolAddRejectedByValidator(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	validator := NewMockMessagePoolValidator()
+	validator.Valid = false
+	pool := NewMessagePool(config.NewDefaultConfig().Mpool, validator)
+
+	c, err := pool.Add(ctx, newSignedMessage())
+	assert.False(c.Defined())
+	assert.Error(err)
+	assert.Len(pool.Pending(), 0)
+}
+
 func TestMessagePoolDedup(t *testing.T) {
 	assert := assert.New(t)
+	ctx := context.Background()
 
-	pool := NewMessagePool()
+	pool := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 	msg1 := newSignedMessage()
 
 	assert.Len(pool.Pending(), 0)
-	_, err := pool.Add(msg1)
+	_, err := pool.Add(ctx, msg1)
 	assert.NoError(err)
 	assert.Len(pool.Pending(), 1)
 
-	_, err = pool.Add(msg1)
+	_, err = pool.Add(ctx, msg1)
 	assert.NoError(err)
 	assert.Len(pool.Pending(), 1)
 }
 
 func TestMessagePoolAsync(t *testing.T) {
 	assert := assert.New(t)
+	ctx := context.Background()
 
 	count := 400
 	msgs := types.NewSignedMsgs(count, mockSigner)
 
-	pool := NewMessagePool()
+	cfg := config.NewDefaultConfig().Mpool
+	cfg.MaxSenderMessages = count
+	pool := NewMessagePool(cfg, NewMockMessagePoolValidator())
 	var wg sync.WaitGroup
 
 	for i := 0; i < 4; i++ {
 		wg.Add(1)
 		go func(i int) {
 			for j := 0; j < count/4; j++ {
-				_, err := pool.Add(msgs[j+(count/4)*i])
+				_, err := pool.Add(ctx, msgs[j+(count/4)*i])
 				assert.NoError(err)
 			}
 			wg.Done()
@@ -98,6 +119,128 @@ func TestMessagePoolAsync(t *testing.T) {
 	assert.Len(pool.Pending(), count)
 }
 
+func newPricedMessage(require *require.Assertions, from address.Address, nonce uint64, gasPrice int64) *types.SignedMessage {
+	msg := types.NewMessage(from, address.NewForTestGetter()(), nonce, types.NewAttoFILFromFIL(0), "", nil)
+	smsg, err := types.NewSignedMessage(*msg, mockSigner, types.NewGasPrice(gasPrice), types.NewGasUnits(0))
+	require.NoError(err)
+	return smsg
+}
+
+func TestMessagePoolReplaceByFee(t *testing.T) {
+	ctx := context.Background()
+	sender := mockSigner.Addresses[0]
+
+	t.Run("replaces a message paying enough more gas", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		pool := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
+
+		MustAdd(pool, newPricedMessage(require, sender, 0, 100))
+		replacement := newPricedMessage(require, sender, 0, 110)
+		_, err := pool.Add(ctx, replacement)
+		require.NoError(err)
+
+		assertPoolEquals(assert, pool, replacement)
+	})
+
+	t.Run("rejects a replacement below the bump", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		pool := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
+
+		original := newPricedMessage(require, sender, 0, 100)
+		MustAdd(pool, original)
+		_, err := pool.Add(ctx, newPricedMessage(require, sender, 0, 109))
+		require.Error(err)
+		assert.Contains(err.Error(), "same nonce")
+
+		assertPoolEquals(assert, pool, original)
+	})
+
+	t.Run("replaces a zero priced message with any positive price", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		pool := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
+
+		MustAdd(pool, newPricedMessage(require, sender, 0, 0))
+		_, err := pool.Add(ctx, newPricedMessage(require, sender, 0, 0))
+		assert.Error(err)
+
+		replacement := newPricedMessage(require, sender, 0, 1)
+		_, err = pool.Add(ctx, replacement)
+		require.NoError(err)
+		assertPoolEquals(assert, pool, replacement)
+	})
+}
+
+func TestMessagePoolLimits(t *testing.T) {
+	ctx := context.Background()
+	alice, bob, carol := mockSigner.Addresses[0], mockSigner.Addresses[1], mockSigner.Addresses[2]
+
+	t.Run("caps pending messages per sender", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		cfg := config.NewDefaultConfig().Mpool
+		cfg.MaxSenderMessages = 2
+		pool := NewMessagePool(cfg, NewMockMessagePoolValidator())
+
+		MustAdd(pool, newPricedMessage(require, alice, 0, 1), newPricedMessage(require, alice, 1, 1))
+		_, err := pool.Add(ctx, newPricedMessage(require, alice, 2, 1))
+		require.Error(err)
+		assert.Contains(err.Error(), "pending messages")
+
+		_, err = pool.Add(ctx, newPricedMessage(require, bob, 0, 1))
+		assert.NoError(err)
+	})
+
+	t.Run("evicts the lowest priced last message of a sender when full", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		cfg := config.NewDefaultConfig().Mpool
+		cfg.MaxPoolSize = 3
+		pool := NewMessagePool(cfg, NewMockMessagePoolValidator())
+
+		a0 := newPricedMessage(require, alice, 0, 1)
+		a1 := newPricedMessage(require, alice, 1, 5)
+		b0 := newPricedMessage(require, bob, 0, 2)
+		MustAdd(pool, a0, a1, b0)
+
+		// a0 is the cheapest message, but a1 depends on it
+		c0 := newPricedMessage(require, carol, 0, 3)
+		_, err := pool.Add(ctx, c0)
+		require.NoError(err)
+		assertPoolEquals(assert, pool, a0, a1, c0)
+
+		_, err = pool.Add(ctx, newPricedMessage(require, bob, 0, 3))
+		require.Error(err)
+		assert.Contains(err.Error(), "pool is full")
+		assertPoolEquals(assert, pool, a0, a1, c0)
+	})
+}
+
+func TestMessagePoolExpiry(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+	store := hamt.NewCborStore()
+
+	cfg := config.NewDefaultConfig().Mpool
+	cfg.MessageExpiration = 2
+	pool := NewMessagePool(cfg, NewMockMessagePoolValidator())
+
+	chain := NewChainWithMessages(store, types.TipSet{}, [][]*types.SignedMessage{}, [][]*types.SignedMessage{})
+
+	m0 := newPricedMessage(require, mockSigner.Addresses[0], 0, 0)
+	MustAdd(pool, m0)
+	require.NoError(UpdateMessagePool(ctx, pool, store, chain[0], chain[0]))
+	assertPoolEquals(assert, pool, m0)
+
+	m1 := newPricedMessage(require, mockSigner.Addresses[1], 0, 0)
+	MustAdd(pool, m1)
+	require.NoError(UpdateMessagePool(ctx, pool, store, chain[0], chain[1]))
+	assertPoolEquals(assert, pool, m1)
+}
+
 func msgAsString(msg *types.SignedMessage) string {
 	// When using NewMessageForTestGetter msg.Method is set
 	// to "msgN" so we print that (it will correspond
@@ -150,7 +293,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m0],     Chain: b[m1]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 
 		m := types.NewSignedMsgs(2, mockSigner)
 		MustAdd(p, m[0], m[1])
@@ -170,7 +313,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m0, m1], Chain: b[m2]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 
 		m := types.NewSignedMsgs(3, mockSigner)
 		MustAdd(p, m[0], m[1])
@@ -187,7 +330,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m1],         Chain: b[m2, m3] -> b[m4] -> b[m0] -> b[] -> b[m5, m6]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 
 		m := types.NewSignedMsgs(7, mockSigner)
 		MustAdd(p, m[2], m[5])
@@ -213,7 +356,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m1],         Chain: b[m2, m3] -> {b[m4], b[m0], b[], b[]} -> {b[], b[m6,m5]}
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 
 		m := types.NewSignedMsgs(7, mockSigner)
 		MustAdd(p, m[2], m[5])
@@ -237,7 +380,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m1, m2],     Chain: b[m0] -> b[m3] -> b[m4, m5]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 
 		m := types.NewSignedMsgs(6, mockSigner)
 		MustAdd(p, m[3], m[5])
@@ -257,7 +400,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m6],         Chain: b[m0] -> b[m3] -> b[m4] -> b[m5] -> b[m1, m2]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 
 		m := types.NewSignedMsgs(7, mockSigner)
 		MustAdd(p, m[6])
@@ -286,7 +429,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m6],         Chain: {b[m0], b[m1]} -> b[m3] -> b[m4] -> {b[m5], b[m1, m2]}
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 
 		m := types.NewSignedMsgs(7, mockSigner)
 		MustAdd(p, m[6])
@@ -313,7 +456,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m3, m5],     Chain: {b[m0], b[m1], b[m2]}
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 
 		m := types.NewSignedMsgs(6, mockSigner)
 		MustAdd(p, m[3], m[5])
@@ -339,7 +482,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m2, m3],         Chain: b[m0] -> b[m1]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 		m := types.NewSignedMsgs(4, mockSigner)
 
 		oldChain := NewChainWithMessages(store, types.TipSet{},
@@ -360,7 +503,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [m0],     Chain: b[] -> b[m1, m2]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 
 		m := types.NewSignedMsgs(3, mockSigner)
 		MustAdd(p, m[0], m[1])
@@ -380,7 +523,7 @@ func TestUpdateMessagePool(t *testing.T) {
 		// to
 		// Msg pool: [],           Chain: b[m0] -> b[m1] -> b[m2, m3] -> b[m4] -> b[m5, m6]
 		store := hamt.NewCborStore()
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 
 		m := types.NewSignedMsgs(7, mockSigner)
 		MustAdd(p, m[2], m[5])
@@ -398,12 +541,53 @@ func TestUpdateMessagePool(t *testing.T) {
 		UpdateMessagePool(ctx, p, store, oldTipSet, newTipSet)
 		assertPoolEquals(assert, p)
 	})
+
+	t.Run("Reorg restores signatures of aggregated messages", func(t *testing.T) {
+		// Msg pool: [m0, m1], Chain: b[]
+		// to
+		// Msg pool: [],       Chain: b[] -> b[m0, m1, m2] (aggregated)
+		// to
+		// Msg pool: [m0, m1], Chain: b[] -> b[] -> b[]
+		require := require.New(t)
+		store := hamt.NewCborStore()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
+
+		blsSigner := types.NewMockSigner(types.MustGenerateBLSKeyInfo(3))
+		m := types.NewSignedMsgs(3, blsSigner)
+		MustAdd(p, m[0], m[1])
+
+		aggregated, aggregate, err := types.AggregateBLSSignatures(m)
+		require.NoError(err)
+		require.NotEmpty(aggregate)
+		for _, msg := range aggregated {
+			require.True(msg.IsAggregated())
+		}
+
+		rootChain := NewChainWithMessages(store, types.TipSet{}, msgsSet{msgs{}})
+		rootTipSet := headOf(rootChain)
+
+		oldChain := NewChainWithMessages(store, rootTipSet, msgsSet{msgs(aggregated)})
+		oldTipSet := headOf(oldChain)
+		require.NoError(UpdateMessagePool(ctx, p, store, rootTipSet, oldTipSet))
+		assertPoolEquals(assert, p)
+
+		newChain := NewChainWithMessages(store, rootTipSet, msgsSet{msgs{}}, msgsSet{msgs{}})
+		newTipSet := headOf(newChain)
+		require.NoError(UpdateMessagePool(ctx, p, store, oldTipSet, newTipSet))
+
+		// m2 was never in the pool, so its signature is unknown and it is dropped
+		assertPoolEquals(assert, p, m[0], m[1])
+		for _, msg := range p.Pending() {
+			assert.False(msg.IsAggregated())
+			assert.True(msg.VerifySignature())
+		}
+	})
 }
 
 func TestOrderMessagesByNonce(t *testing.T) {
 	t.Run("Empty pool", func(t *testing.T) {
 		assert := assert.New(t)
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 		ordered := OrderMessagesByNonce(p.Pending())
 		assert.Equal(0, len(ordered))
 	})
@@ -411,7 +595,7 @@ func TestOrderMessagesByNonce(t *testing.T) {
 	t.Run("Msgs in three orders", func(t *testing.T) {
 		assert := assert.New(t)
 		require := require.New(t)
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 
 		m := types.NewMsgsWithAddrs(9, mockSigner.Addresses)
 
@@ -460,7 +644,7 @@ func TestLargestNonce(t *testing.T) {
 	require := require.New(t)
 
 	t.Run("No matches", func(t *testing.T) {
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 
 		m := types.NewSignedMsgs(2, mockSigner)
 		MustAdd(p, m[0], m[1])
@@ -470,7 +654,7 @@ func TestLargestNonce(t *testing.T) {
 	})
 
 	t.Run("Match, largest is zero", func(t *testing.T) {
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 
 		m := types.NewMsgsWithAddrs(1, mockSigner.Addresses)
 		m[0].Nonce = 0
@@ -486,7 +670,7 @@ func TestLargestNonce(t *testing.T) {
 	})
 
 	t.Run("Match", func(t *testing.T) {
-		p := NewMessagePool()
+		p := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 
 		m := types.NewMsgsWithAddrs(3, mockSigner.Addresses)
 		m[1].Nonce = 1
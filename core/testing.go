@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"errors"
 	//	"math/big"
 	//	"math/rand"
 	"testing"
@@ -14,6 +15,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/actor/builtin"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -24,7 +26,7 @@ import (
 
 // MustGetNonce returns the next nonce for an actor at the given address or panics.
 func MustGetNonce(st state.Tree, a address.Address) uint64 {
-	mp := NewMessagePool()
+	mp := NewMessagePool(config.NewDefaultConfig().Mpool, NewMockMessagePoolValidator())
 	nonce, err := NextNonce(context.Background(), st, mp, a)
 	if err != nil {
 		panic(err)
@@ -36,12 +38,32 @@ func MustGetNonce(st state.Tree, a address.Address) uint64 {
 // cannot.
 func MustAdd(p *MessagePool, msgs ...*types.SignedMessage) {
 	for _, m := range msgs {
-		if _, err := p.Add(m); err != nil {
+		if _, err := p.Add(context.Background(), m); err != nil {
 			panic(err)
 		}
 	}
 }
 
+// MockMessagePoolValidator is a PoolValidator that admits all messages to
+// the pool, unless Valid is set to false.
+type MockMessagePoolValidator struct {
+	Valid bool
+}
+
+// NewMockMessagePoolValidator creates a MockMessagePoolValidator that admits
+// all messages.
+func NewMockMessagePoolValidator() *MockMessagePoolValidator {
+	return &MockMessagePoolValidator{Valid: true}
+}
+
+// Validate returns an error if Valid is false.
+func (v *MockMessagePoolValidator) Validate(ctx context.Context, msg *types.SignedMessage) error {
+	if !v.Valid {
+		return errors.New("mock validation error")
+	}
+	return nil
+}
+
 // MustConvertParams abi encodes the given parameters into a byte array (or panics)
 func MustConvertParams(params ...interface{}) []byte {
 	vals, err := abi.ToValues(params)
@@ -0,0 +1,40 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"hash"
+)
+
+// PBKDF2 derives a keyLen byte key from password and salt using PBKDF2 as
+// described in RFC 8018, with HMAC over the hash function h as the
+// pseudorandom function.
+func PBKDF2(password, salt []byte, iter, keyLen int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var buf [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt) // nolint: errcheck
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:4]) // nolint: errcheck
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+
+		for n := 2; n <= iter; n++ {
+			prf.Reset()
+			prf.Write(u) // nolint: errcheck
+			u = u[:0]
+			u = prf.Sum(u)
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
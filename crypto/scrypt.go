@@ -0,0 +1,122 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// Scrypt derives a keyLen byte key from password and salt using the scrypt
+// key derivation function described in RFC 7914. N is the CPU/memory cost
+// and must be a power of two greater than one, r is the block size and p the
+// parallelization parameter. r*p must be less than 2^30.
+//
+// Our gx dependencies do not include golang.org/x/crypto, so this is a
+// straightforward implementation of the RFC on top of the standard library.
+func Scrypt(password, salt []byte, N, r, p, keyLen int) ([]byte, error) {
+	if N <= 1 || N&(N-1) != 0 {
+		return nil, errors.New("scrypt: N must be a power of two greater than 1")
+	}
+	if r <= 0 || p <= 0 || keyLen <= 0 {
+		return nil, errors.New("scrypt: r, p and keyLen must be positive")
+	}
+	if uint64(r)*uint64(p) >= 1<<30 || r > (1<<31-1)/128/p || r > (1<<31-1)/256 || N > (1<<31-1)/128/r {
+		return nil, errors.New("scrypt: parameters are too large")
+	}
+
+	blockLen := 128 * r
+	b := PBKDF2(password, salt, 1, p*blockLen, sha256.New)
+	v := make([]uint32, 32*r*N)
+	x := make([]uint32, 32*r)
+	y := make([]uint32, 32*r)
+	for i := 0; i < p; i++ {
+		roMix(b[i*blockLen:(i+1)*blockLen], r, N, v, x, y)
+	}
+	return PBKDF2(password, b, 1, keyLen, sha256.New), nil
+}
+
+// roMix is the scryptROMix function of RFC 7914 section 5, operating in place
+// on b using v, x and y as scratch space.
+func roMix(b []byte, r, N int, v, x, y []uint32) {
+	R := 32 * r
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	for i := 0; i < N; i++ {
+		copy(v[i*R:], x)
+		blockMix(x, y, r)
+	}
+	for i := 0; i < N; i++ {
+		j := int(x[R-16] & uint32(N-1))
+		for k := range x {
+			x[k] ^= v[j*R+k]
+		}
+		blockMix(x, y, r)
+	}
+	for i, w := range x {
+		binary.LittleEndian.PutUint32(b[i*4:], w)
+	}
+}
+
+// blockMix is the scryptBlockMix function of RFC 7914 section 4. b holds 2*r
+// 64 byte blocks as little endian words and is overwritten with the result;
+// y is scratch space of the same size.
+func blockMix(b, y []uint32, r int) {
+	var x [16]uint32
+	copy(x[:], b[(2*r-1)*16:])
+	for i := 0; i < 2*r; i++ {
+		for k := range x {
+			x[k] ^= b[i*16+k]
+		}
+		salsa208(&x)
+		// even blocks go to the first half of the output, odd ones to the
+		// second half
+		out := (i/2)*16 + (i%2)*r*16
+		copy(y[out:], x[:])
+	}
+	copy(b, y)
+}
+
+// salsa208 applies the Salsa20/8 core to x in place.
+func salsa208(x *[16]uint32) {
+	w := *x
+	for i := 0; i < 8; i += 2 {
+		w[4] ^= bits.RotateLeft32(w[0]+w[12], 7)
+		w[8] ^= bits.RotateLeft32(w[4]+w[0], 9)
+		w[12] ^= bits.RotateLeft32(w[8]+w[4], 13)
+		w[0] ^= bits.RotateLeft32(w[12]+w[8], 18)
+		w[9] ^= bits.RotateLeft32(w[5]+w[1], 7)
+		w[13] ^= bits.RotateLeft32(w[9]+w[5], 9)
+		w[1] ^= bits.RotateLeft32(w[13]+w[9], 13)
+		w[5] ^= bits.RotateLeft32(w[1]+w[13], 18)
+		w[14] ^= bits.RotateLeft32(w[10]+w[6], 7)
+		w[2] ^= bits.RotateLeft32(w[14]+w[10], 9)
+		w[6] ^= bits.RotateLeft32(w[2]+w[14], 13)
+		w[10] ^= bits.RotateLeft32(w[6]+w[2], 18)
+		w[3] ^= bits.RotateLeft32(w[15]+w[11], 7)
+		w[7] ^= bits.RotateLeft32(w[3]+w[15], 9)
+		w[11] ^= bits.RotateLeft32(w[7]+w[3], 13)
+		w[15] ^= bits.RotateLeft32(w[11]+w[7], 18)
+
+		w[1] ^= bits.RotateLeft32(w[0]+w[3], 7)
+		w[2] ^= bits.RotateLeft32(w[1]+w[0], 9)
+		w[3] ^= bits.RotateLeft32(w[2]+w[1], 13)
+		w[0] ^= bits.RotateLeft32(w[3]+w[2], 18)
+		w[6] ^= bits.RotateLeft32(w[5]+w[4], 7)
+		w[7] ^= bits.RotateLeft32(w[6]+w[5], 9)
+		w[4] ^= bits.RotateLeft32(w[7]+w[6], 13)
+		w[5] ^= bits.RotateLeft32(w[4]+w[7], 18)
+		w[11] ^= bits.RotateLeft32(w[10]+w[9], 7)
+		w[8] ^= bits.RotateLeft32(w[11]+w[10], 9)
+		w[9] ^= bits.RotateLeft32(w[8]+w[11], 13)
+		w[10] ^= bits.RotateLeft32(w[9]+w[8], 18)
+		w[12] ^= bits.RotateLeft32(w[15]+w[14], 7)
+		w[13] ^= bits.RotateLeft32(w[12]+w[15], 9)
+		w[14] ^= bits.RotateLeft32(w[13]+w[12], 13)
+		w[15] ^= bits.RotateLeft32(w[14]+w[13], 18)
+	}
+	for i := range x {
+		x[i] += w[i]
+	}
+}
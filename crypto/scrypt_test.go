@@ -0,0 +1,26 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+)
+
+func TestScrypt(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// test vectors from RFC 7914 section 12
+	key, err := Scrypt([]byte(""), []byte(""), 16, 1, 1, 64)
+	require.NoError(err)
+	assert.Equal("77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906", hex.EncodeToString(key))
+
+	key, err = Scrypt([]byte("password"), []byte("NaCl"), 1024, 8, 16, 64)
+	require.NoError(err)
+	assert.Equal("fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640", hex.EncodeToString(key))
+
+	_, err = Scrypt([]byte("password"), []byte("NaCl"), 1000, 8, 16, 64)
+	assert.Error(err)
+}
@@ -10,8 +10,9 @@ import (
 
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 
-	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/proofs"
+	"github.com/filecoin-project/go-filecoin/state"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/vm"
 )
@@ -55,9 +56,12 @@ func (w *DefaultWorker) Generate(ctx context.Context,
 	}
 
 	pending := w.messagePool.Pending()
-	messages := make([]*types.SignedMessage, len(pending))
+	nonces, err := senderNonces(ctx, stateTree, pending)
+	if err != nil {
+		return nil, errors.Wrap(err, "get sender nonces")
+	}
 
-	copy(messages, core.OrderMessagesByNonce(pending))
+	messages := w.messageSelector.SelectMessages(ctx, pending, nonces)
 
 	vms := vm.NewStorageMap(w.blockstore)
 	res, err := w.processor.ApplyMessagesAndPayRewards(ctx, stateTree, vms, messages, w.minerAddr, types.NewBlockHeight(blockHeight), ancestors)
@@ -79,10 +83,16 @@ func (w *DefaultWorker) Generate(ctx context.Context,
 		receipts = append(receipts, r.Receipt)
 	}
 
+	blockMessages, blsAggregateSig, err := types.AggregateBLSSignatures(res.SuccessfulMessages)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate aggregate BLS signatures")
+	}
+
 	next := &types.Block{
 		Miner:           w.minerAddr,
 		Height:          types.Uint64(blockHeight),
-		Messages:        res.SuccessfulMessages,
+		Messages:        blockMessages,
+		BLSAggregateSig: blsAggregateSig,
 		MessageReceipts: receipts,
 		Parents:         baseTipSet.ToSortedCidSet(),
 		ParentWeight:    types.Uint64(weight),
@@ -112,3 +122,25 @@ func (w *DefaultWorker) Generate(ctx context.Context,
 
 	return next, nil
 }
+
+// senderNonces returns the nonce in st of the sender of each of msgs. Senders
+// that do not exist yet start at nonce 0.
+func senderNonces(ctx context.Context, st state.Tree, msgs []*types.SignedMessage) (map[address.Address]uint64, error) {
+	nonces := make(map[address.Address]uint64)
+	for _, msg := range msgs {
+		if _, ok := nonces[msg.From]; ok {
+			continue
+		}
+
+		fromActor, err := st.GetActor(ctx, msg.From)
+		if err != nil {
+			if state.IsActorNotFoundError(err) {
+				nonces[msg.From] = 0
+				continue
+			}
+			return nil, errors.Wrapf(err, "failed to load sender %s", msg.From)
+		}
+		nonces[msg.From] = uint64(fromActor.Nonce)
+	}
+	return nonces, nil
+}
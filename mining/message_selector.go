@@ -0,0 +1,188 @@
+package mining
+
+// The MessageSelector chooses which pending messages from the message pool go
+// into a new block, and in which order. The DefaultWorker asks its selector for
+// the messages of every block it generates, so operators can plug in their own
+// packing policies.
+
+import (
+	"context"
+	"math/big"
+	"sort"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// DefaultMaxBlockMessages is the largest number of messages the default
+// MessageSelector puts in a block.
+const DefaultMaxBlockMessages = 4000
+
+// DefaultMaxBlockMessageBytes is the largest total size in bytes of the
+// messages the default MessageSelector puts in a block.
+const DefaultMaxBlockMessageBytes = 1024 * 1024
+
+// MessageSelector chooses the messages to include in a new block from the
+// pending messages in the message pool. nonces holds the nonce of each
+// sender of a pending message in the state the block is built on. The
+// returned messages are applied in the order they are returned, so messages
+// from the same sender must be in nonce order, starting at its nonce.
+type MessageSelector interface {
+	SelectMessages(ctx context.Context, pending []*types.SignedMessage, nonces map[address.Address]uint64) []*types.SignedMessage
+}
+
+// GasPriceSelector is a MessageSelector that fills a block with the best paying
+// messages. It only considers the run of each sender's messages that starts at
+// the sender's nonce and has no gaps, as later messages could not be applied.
+// It keeps the messages of each sender in nonce order and picks
+// between senders by the effective gas price of their remaining messages, so a
+// cheap message is included ahead of a pricier message from the same sender
+// that depends on it. It stops adding messages once the next one would push
+// the total gas limit of the block over GasLimit, or the block over MaxMessages
+// messages or MaxBytes bytes of messages.
+type GasPriceSelector struct {
+	GasLimit    types.GasUnits
+	MaxMessages int
+	MaxBytes    int
+}
+
+// NewGasPriceSelector creates a new GasPriceSelector bounded by
+// types.BlockGasLimit and the default message count and size limits.
+func NewGasPriceSelector() *GasPriceSelector {
+	return &GasPriceSelector{
+		GasLimit:    types.BlockGasLimit,
+		MaxMessages: DefaultMaxBlockMessages,
+		MaxBytes:    DefaultMaxBlockMessageBytes,
+	}
+}
+
+// senderChain holds the not yet selected messages of a single sender, in
+// nonce order.
+type senderChain struct {
+	from address.Address
+	msgs []*types.SignedMessage
+	// effective gas price of msgs, as the fraction fee/gas
+	fee *types.AttoFIL
+	gas uint64
+}
+
+// update recomputes the effective gas price of the chain. It is the highest
+// average gas price, weighted by gas limit, of any run of messages at the
+// front of the chain: including the later, better paying messages requires
+// including the ones before them.
+func (c *senderChain) update() {
+	c.fee, c.gas = nil, 0
+	fee, gas := types.ZeroAttoFIL, uint64(0)
+	for _, msg := range c.msgs {
+		fee = fee.Add(msg.GasPrice.MulBigInt(new(big.Int).SetUint64(uint64(msg.GasLimit))))
+		gas += uint64(msg.GasLimit)
+		if c.fee == nil || compareGasPrice(fee, gas, c.fee, c.gas) > 0 {
+			c.fee, c.gas = fee, gas
+		}
+	}
+}
+
+// applicable trims msgs, sorted by nonce, to the run of messages that starts
+// at nonce and has no gaps.
+func applicable(msgs []*types.SignedMessage, nonce uint64) []*types.SignedMessage {
+	for len(msgs) > 0 && uint64(msgs[0].Nonce) < nonce {
+		msgs = msgs[1:]
+	}
+	for i, msg := range msgs {
+		if uint64(msg.Nonce) != nonce+uint64(i) {
+			return msgs[:i]
+		}
+	}
+	return msgs
+}
+
+// SelectMessages implements MessageSelector.
+func (s *GasPriceSelector) SelectMessages(ctx context.Context, pending []*types.SignedMessage, nonces map[address.Address]uint64) []*types.SignedMessage {
+	bySender := make(map[address.Address]*senderChain)
+	for _, msg := range pending {
+		chain, ok := bySender[msg.From]
+		if !ok {
+			chain = &senderChain{from: msg.From}
+			bySender[msg.From] = chain
+		}
+		chain.msgs = append(chain.msgs, msg)
+	}
+
+	var chains []*senderChain
+	for _, chain := range bySender {
+		sort.Slice(chain.msgs, func(i, j int) bool { return chain.msgs[i].Nonce < chain.msgs[j].Nonce })
+		chain.msgs = applicable(chain.msgs, nonces[chain.from])
+		if len(chain.msgs) == 0 {
+			continue
+		}
+		chain.update()
+		chains = append(chains, chain)
+	}
+
+	var selected []*types.SignedMessage
+	var gasUsed types.GasUnits
+	bytesUsed := 0
+	for len(chains) > 0 && len(selected) < s.MaxMessages {
+		best := 0
+		for i := 1; i < len(chains); i++ {
+			if betterChain(chains[i], chains[best]) {
+				best = i
+			}
+		}
+		chain := chains[best]
+		msg := chain.msgs[0]
+
+		size, err := msg.Marshal()
+		if err != nil || gasUsed+msg.GasLimit > s.GasLimit || bytesUsed+len(size) > s.MaxBytes {
+			// The later messages of this sender cannot be applied without this
+			// one, so drop the whole chain and keep filling the block with
+			// messages from other senders.
+			chains = append(chains[:best], chains[best+1:]...)
+			continue
+		}
+
+		selected = append(selected, msg)
+		gasUsed += msg.GasLimit
+		bytesUsed += len(size)
+
+		chain.msgs = chain.msgs[1:]
+		if len(chain.msgs) == 0 {
+			chains = append(chains[:best], chains[best+1:]...)
+			continue
+		}
+		chain.update()
+	}
+
+	return selected
+}
+
+// betterChain returns true if a should be selected from before b. Ties in
+// effective gas price are broken by address so the selection is deterministic.
+func betterChain(a, b *senderChain) bool {
+	cmp := compareGasPrice(a.fee, a.gas, b.fee, b.gas)
+	if cmp != 0 {
+		return cmp > 0
+	}
+	return a.from.String() < b.from.String()
+}
+
+// compareGasPrice compares the gas prices feeA/gasA and feeB/gasB. A zero gas
+// amount is treated as a single unit of gas.
+func compareGasPrice(feeA *types.AttoFIL, gasA uint64, feeB *types.AttoFIL, gasB uint64) int {
+	if gasA == 0 {
+		gasA = 1
+	}
+	if gasB == 0 {
+		gasB = 1
+	}
+	priceA := feeA.MulBigInt(new(big.Int).SetUint64(gasB))
+	priceB := feeB.MulBigInt(new(big.Int).SetUint64(gasA))
+	switch {
+	case priceA.GreaterThan(priceB):
+		return 1
+	case priceA.LessThan(priceB):
+		return -1
+	default:
+		return 0
+	}
+}
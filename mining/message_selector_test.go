@@ -0,0 +1,116 @@
+package mining_test
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/mining"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestGasPriceSelector(t *testing.T) {
+	ctx := context.Background()
+	mockSigner, _ := setupSigner()
+	alice, bob, carol := mockSigner.Addresses[0], mockSigner.Addresses[1], mockSigner.Addresses[2]
+	target := address.NewForTestGetter()()
+
+	signedMessage := func(require *require.Assertions, from address.Address, nonce uint64, gasPrice uint64, gasLimit uint64) *types.SignedMessage {
+		msg := types.NewMessage(from, target, nonce, types.NewAttoFILFromFIL(0), "", nil)
+		smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(int64(gasPrice)), types.NewGasUnits(gasLimit))
+		require.NoError(err)
+		return smsg
+	}
+
+	t.Run("orders senders by gas price and keeps each sender's nonce order", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		a0 := signedMessage(require, alice, 0, 5, 100)
+		a1 := signedMessage(require, alice, 1, 1, 100)
+		b0 := signedMessage(require, bob, 0, 3, 100)
+
+		selected := mining.NewGasPriceSelector().SelectMessages(ctx, []*types.SignedMessage{a1, b0, a0}, nil)
+		assert.Equal([]*types.SignedMessage{a0, b0, a1}, selected)
+	})
+
+	t.Run("ranks a sender by the price of messages queued behind its cheaper ones", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		a0 := signedMessage(require, alice, 0, 1, 100)
+		a1 := signedMessage(require, alice, 1, 10, 100)
+		b0 := signedMessage(require, bob, 0, 4, 100)
+
+		selected := mining.NewGasPriceSelector().SelectMessages(ctx, []*types.SignedMessage{b0, a1, a0}, nil)
+		assert.Equal([]*types.SignedMessage{a0, a1, b0}, selected)
+	})
+
+	t.Run("stops at the gas limit and skips the rest of a sender's messages that do not fit", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		a0 := signedMessage(require, alice, 0, 10, 600)
+		b0 := signedMessage(require, bob, 0, 8, 500)
+		b1 := signedMessage(require, bob, 1, 8, 100)
+		c0 := signedMessage(require, carol, 0, 1, 400)
+
+		selector := mining.NewGasPriceSelector()
+		selector.GasLimit = types.NewGasUnits(1000)
+
+		selected := selector.SelectMessages(ctx, []*types.SignedMessage{a0, b0, b1, c0}, nil)
+		assert.Equal([]*types.SignedMessage{a0, c0}, selected)
+	})
+
+	t.Run("caps the number of messages", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		a0 := signedMessage(require, alice, 0, 3, 100)
+		b0 := signedMessage(require, bob, 0, 2, 100)
+		c0 := signedMessage(require, carol, 0, 1, 100)
+
+		selector := mining.NewGasPriceSelector()
+		selector.MaxMessages = 2
+
+		selected := selector.SelectMessages(ctx, []*types.SignedMessage{c0, b0, a0}, nil)
+		assert.Equal([]*types.SignedMessage{a0, b0}, selected)
+	})
+
+	t.Run("caps the size of the messages", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		a0 := signedMessage(require, alice, 0, 3, 100)
+		b0 := signedMessage(require, bob, 0, 2, 100)
+		size, err := a0.Marshal()
+		require.NoError(err)
+
+		selector := mining.NewGasPriceSelector()
+		selector.MaxBytes = len(size)
+
+		selected := selector.SelectMessages(ctx, []*types.SignedMessage{b0, a0}, nil)
+		assert.Equal([]*types.SignedMessage{a0}, selected)
+	})
+	t.Run("only selects each sender's messages from its nonce up to the first gap", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		a0 := signedMessage(require, alice, 0, 1, 100)
+		a1 := signedMessage(require, alice, 1, 1, 100)
+		a2 := signedMessage(require, alice, 2, 1, 100)
+		b1 := signedMessage(require, bob, 1, 5, 100)
+		b2 := signedMessage(require, bob, 2, 5, 100)
+		c0 := signedMessage(require, carol, 0, 9, 100)
+		c2 := signedMessage(require, carol, 2, 9, 100)
+
+		// alice already applied her first message, bob has not sent his
+		nonces := map[address.Address]uint64{alice: 1, bob: 0}
+
+		selected := mining.NewGasPriceSelector().SelectMessages(ctx, []*types.SignedMessage{a0, a1, a2, b1, b2, c0, c2}, nonces)
+		assert.Equal([]*types.SignedMessage{c0, a1, a2}, selected)
+	})
+}
@@ -77,12 +77,13 @@ type DefaultWorker struct {
 	getAncestors GetAncestors
 
 	// core filecoin things
-	messagePool *core.MessagePool
-	processor   MessageApplier
-	powerTable  consensus.PowerTableView
-	blockstore  blockstore.Blockstore
-	cstore      *hamt.CborIpldStore
-	blockTime   time.Duration
+	messagePool     *core.MessagePool
+	messageSelector MessageSelector
+	processor       MessageApplier
+	powerTable      consensus.PowerTableView
+	blockstore      blockstore.Blockstore
+	cstore          *hamt.CborIpldStore
+	blockTime       time.Duration
 }
 
 // NewDefaultWorker instantiates a new Worker.
@@ -139,6 +140,7 @@ func NewDefaultWorkerWithDeps(messagePool *core.MessagePool,
 		getWeight:       getWeight,
 		getAncestors:    getAncestors,
 		messagePool:     messagePool,
+		messageSelector: NewGasPriceSelector(),
 		processor:       processor,
 		powerTable:      powerTable,
 		blockstore:      bs,
@@ -151,6 +153,12 @@ func NewDefaultWorkerWithDeps(messagePool *core.MessagePool,
 	}
 }
 
+// SetMessageSelector replaces the MessageSelector the worker uses to choose
+// the messages of the blocks it generates.
+func (w *DefaultWorker) SetMessageSelector(selector MessageSelector) {
+	w.messageSelector = selector
+}
+
 // DoSomeWorkFunc is a dummy function that mimics doing something time-consuming
 // in the mining loop such as computing proofs. Pass a function that calls Sleep()
 // is a good idea for now.
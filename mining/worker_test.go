@@ -15,6 +15,7 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/config"
 	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/core"
 	"github.com/filecoin-project/go-filecoin/mining"
@@ -95,7 +96,7 @@ func TestGenerate(t *testing.T) {
 
 func sharedSetupInitial() (*hamt.CborIpldStore, *core.MessagePool, cid.Cid) {
 	cst := hamt.NewCborStore()
-	pool := core.NewMessagePool()
+	pool := core.NewMessagePool(config.NewDefaultConfig().Mpool, core.NewMockMessagePoolValidator())
 	// Install the fake actor so we can execute it.
 	fakeActorCodeCid := types.AccountActorCodeCid
 	return cst, pool, fakeActorCodeCid
@@ -274,10 +275,10 @@ func TestGeneratePoolBlockResults(t *testing.T) {
 	smsg4, err := types.NewSignedMessage(*msg4, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
 	require.NoError(err)
 
-	pool.Add(smsg1)
-	pool.Add(smsg2)
-	pool.Add(smsg3)
-	pool.Add(smsg4)
+	pool.Add(ctx, smsg1)
+	pool.Add(ctx, smsg2)
+	pool.Add(ctx, smsg3)
+	pool.Add(ctx, smsg4)
 
 	assert.Len(pool.Pending(), 4)
 	baseBlock := types.Block{
@@ -377,6 +378,110 @@ func TestGenerateWithoutMessages(t *testing.T) {
 	assert.Len(blk.Messages, 0)
 }
 
+func TestGenerateAggregatesBLSSignatures(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	CreatePoSTFunc := func() {}
+
+	ctx := context.Background()
+	// the first two accounts are BLS-controlled
+	kis := append(types.MustGenerateBLSKeyInfo(2), types.MustGenerateKeyInfo(10, types.GenerateKeyInfoSeed())...)
+	mockSigner := types.NewMockSigner(kis)
+	blockSignerAddr := mockSigner.Addresses[len(mockSigner.Addresses)-1]
+	newCid := types.NewCidForTestGetter()
+
+	st, pool, addrs, cst, bs := sharedSetup(t, mockSigner)
+	getStateTree := func(c context.Context, ts types.TipSet) (state.Tree, error) {
+		return st, nil
+	}
+	getAncestors := func(ctx context.Context, ts types.TipSet, newBlockHeight *types.BlockHeight) ([]types.TipSet, error) {
+		return nil, nil
+	}
+	worker := mining.NewDefaultWorkerWithDeps(pool, getStateTree, getWeightTest, getAncestors, consensus.NewDefaultProcessor(),
+		&th.TestView{}, bs, cst, addrs[3], blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+
+	msg1 := types.NewMessage(addrs[0], addrs[1], 0, nil, "", nil)
+	smsg1, err := types.NewSignedMessage(*msg1, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+	require.NoError(err)
+	msg2 := types.NewMessage(addrs[1], addrs[0], 0, nil, "", nil)
+	smsg2, err := types.NewSignedMessage(*msg2, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+	require.NoError(err)
+	pool.Add(ctx, smsg1)
+	pool.Add(ctx, smsg2)
+
+	baseBlock := types.Block{
+		Parents:   types.NewSortedCidSet(newCid()),
+		Height:    types.Uint64(100),
+		StateRoot: newCid(),
+		Proof:     proofs.PoStProof{},
+	}
+	blk, err := worker.Generate(ctx, th.RequireNewTipSet(require, &baseBlock), nil, proofs.PoStProof{}, 0)
+	require.NoError(err)
+
+	require.Len(blk.Messages, 2)
+	for _, msg := range blk.Messages {
+		assert.True(msg.IsAggregated())
+	}
+	assert.True(types.SmsgCidsEqual(smsg1, blk.Messages[0]) || types.SmsgCidsEqual(smsg1, blk.Messages[1]))
+	assert.True(types.VerifyBLSAggregate(blk.Messages, blk.BLSAggregateSig))
+}
+
+type testMessageSelector struct {
+	selected []*types.SignedMessage
+}
+
+func (s *testMessageSelector) SelectMessages(ctx context.Context, pending []*types.SignedMessage, nonces map[address.Address]uint64) []*types.SignedMessage {
+	return s.selected
+}
+
+func TestGenerateWithMessageSelector(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	CreatePoSTFunc := func() {}
+
+	ctx := context.Background()
+	mockSigner, blockSignerAddr := setupSigner()
+	newCid := types.NewCidForTestGetter()
+
+	st, pool, addrs, cst, bs := sharedSetup(t, mockSigner)
+	getStateTree := func(c context.Context, ts types.TipSet) (state.Tree, error) {
+		return st, nil
+	}
+	getAncestors := func(ctx context.Context, ts types.TipSet, newBlockHeight *types.BlockHeight) ([]types.TipSet, error) {
+		return nil, nil
+	}
+	worker := mining.NewDefaultWorkerWithDeps(pool, getStateTree, getWeightTest, getAncestors, consensus.NewDefaultProcessor(),
+		&th.TestView{}, bs, cst, addrs[3], blockSignerAddr, mockSigner, th.BlockTimeTest, CreatePoSTFunc)
+
+	msg1 := types.NewMessage(addrs[0], addrs[1], 0, nil, "", nil)
+	smsg1, err := types.NewSignedMessage(*msg1, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+	require.NoError(err)
+	msg2 := types.NewMessage(addrs[1], addrs[0], 0, nil, "", nil)
+	smsg2, err := types.NewSignedMessage(*msg2, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
+	require.NoError(err)
+	_, err = pool.Add(ctx, smsg1)
+	require.NoError(err)
+	_, err = pool.Add(ctx, smsg2)
+	require.NoError(err)
+
+	// only the messages chosen by the selector go into the block
+	worker.SetMessageSelector(&testMessageSelector{selected: []*types.SignedMessage{smsg2}})
+
+	baseBlock := types.Block{
+		Parents:   types.NewSortedCidSet(newCid()),
+		Height:    types.Uint64(100),
+		StateRoot: newCid(),
+		Proof:     proofs.PoStProof{},
+	}
+	blk, err := worker.Generate(ctx, th.RequireNewTipSet(require, &baseBlock), nil, proofs.PoStProof{}, 0)
+	require.NoError(err)
+
+	assert.Equal([]*types.SignedMessage{smsg2}, blk.Messages)
+	assert.Len(pool.Pending(), 2)
+}
+
 // If something goes wrong while generating a new block, even as late as when flushing it,
 // no block should be returned, and the message pool should not be pruned.
 func TestGenerateError(t *testing.T) {
@@ -402,7 +507,7 @@ func TestGenerateError(t *testing.T) {
 	msg := types.NewMessage(addrs[0], addrs[1], 0, nil, "", nil)
 	smsg, err := types.NewSignedMessage(*msg, &mockSigner, types.NewGasPrice(0), types.NewGasUnits(0))
 	require.NoError(err)
-	pool.Add(smsg)
+	pool.Add(ctx, smsg)
 
 	assert.Len(pool.Pending(), 1)
 	baseBlock := types.Block{
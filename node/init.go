@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
 	offline "gx/ipfs/QmSz8kAe2JCKp2dWSG8gHSWnwSmne8YfRXTeK5HBmc9L7t/go-ipfs-exchange-offline"
 	ci "gx/ipfs/QmTW4SdgBWq9GjsBsHeUx8WuGxzhgzAf88UMH2w62PC8yK/go-libp2p-crypto"
@@ -24,6 +25,7 @@ type InitCfg struct {
 	PeerKey                 ci.PrivKey
 	DefaultWalletAddress    address.Address
 	AutoSealIntervalSeconds uint
+	Snapshot                cid.Cid
 }
 
 // InitOpt is an init option function
@@ -51,6 +53,15 @@ func AutoSealIntervalSecondsOpt(autoSealIntervalSeconds uint) InitOpt {
 	}
 }
 
+// SnapshotOpt initializes the node's chain from the chain snapshot with the
+// given root instead of from the genesis block. The snapshot must already be
+// loaded into the repo's datastore.
+func SnapshotOpt(root cid.Cid) InitOpt {
+	return func(c *InitCfg) {
+		c.Snapshot = root
+	}
+}
+
 // Init initializes a filecoin node in the given repo.
 func Init(ctx context.Context, r repo.Repo, gen consensus.GenesisInitFunc, opts ...InitOpt) error {
 	cfg := new(InitCfg)
@@ -63,7 +74,11 @@ func Init(ctx context.Context, r repo.Repo, gen consensus.GenesisInitFunc, opts
 	bs := bstore.NewBlockstore(r.Datastore())
 	cst := &hamt.CborIpldStore{Blocks: bserv.New(bs, offline.Exchange(bs))}
 
-	if _, err := chain.Init(ctx, r, bs, cst, gen); err != nil {
+	if cfg.Snapshot.Defined() {
+		if _, err := chain.InitFromSnapshot(ctx, r, bs, cst, cfg.Snapshot); err != nil {
+			return errors.Wrap(err, "Could not Init Node from snapshot")
+		}
+	} else if _, err := chain.Init(ctx, r, bs, cst, gen); err != nil {
 		return errors.Wrap(err, "Could not Init Node")
 	}
 
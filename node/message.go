@@ -4,6 +4,7 @@ import (
 	"context"
 	"gx/ipfs/QmepvmmYNM6q4RaUiwEikQFhgMFHXg2PLhx2E9iaRd3jmS/go-libp2p-pubsub"
 
+	"github.com/filecoin-project/go-filecoin/core"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -21,6 +22,30 @@ func (node *Node) processMessage(ctx context.Context, pubSubMsg *pubsub.Message)
 
 	log.Debugf("Received new message from network: %s", unmarshaled)
 
-	_, err = node.MsgPool.Add(unmarshaled)
+	_, err = node.MsgPool.Add(ctx, unmarshaled)
 	return err
 }
+
+// messageTopicValidator returns a pubsub validator for the messages topic
+// that rejects the messages validator would not admit to the message pool,
+// so that they are not propagated to other peers.
+func messageTopicValidator(validator core.PoolValidator) pubsub.Validator {
+	return func(ctx context.Context, pubSubMsg *pubsub.Message) bool {
+		unmarshaled := &types.SignedMessage{}
+		if err := unmarshaled.Unmarshal(pubSubMsg.GetData()); err != nil {
+			log.Debugf("rejecting malformed message from network: %s", err)
+			return false
+		}
+
+		if !unmarshaled.VerifySignature() {
+			log.Debugf("rejecting message with invalid signature from network: %s", unmarshaled)
+			return false
+		}
+
+		if err := validator.Validate(ctx, unmarshaled); err != nil {
+			log.Debugf("rejecting invalid message from network: %s", err)
+			return false
+		}
+		return true
+	}
+}
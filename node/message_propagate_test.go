@@ -19,7 +19,10 @@ func TestMessagePropagation(t *testing.T) {
 	defer cancel()
 	require := require.New(t)
 
-	nodes := MakeNodesUnstarted(t, 5, false, true)
+	// the sender must exist and be able to pay for its message for it to be propagated
+	seed := MakeChainSeed(t, TestGenCfg)
+	nodes := MakeNodesUnstartedWithGif(t, 5, false, seed.GenesisInitFunc, configureFakeVerifier(nil))
+	senderAddr := seed.GiveKey(t, nodes[0], 0)
 	startNodes(t, nodes)
 	defer stopNodes(nodes)
 	connect(t, nodes[0], nodes[1])
@@ -36,16 +39,13 @@ func TestMessagePropagation(t *testing.T) {
 	require.Equal(0, len(nodes[3].MsgPool.Pending()))
 	require.Equal(0, len(nodes[4].MsgPool.Pending()))
 
-	nd0Addr, err := nodes[0].NewAddress()
-	require.NoError(err)
-
 	gasPrice := types.NewGasPrice(0)
 	gasLimit := types.NewGasUnits(0)
 
 	t.Run("Make sure new message makes it to every node message pool and is correctly propagated", func(t *testing.T) {
-		_, err = nodes[0].PorcelainAPI.MessageSendWithDefaultAddress(
+		_, err := nodes[0].PorcelainAPI.MessageSendWithDefaultAddress(
 			ctx,
-			nd0Addr,
+			senderAddr,
 			address.NetworkAddress,
 			types.NewAttoFILFromFIL(123),
 			gasPrice,
@@ -57,6 +57,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/porcelain"
 	"github.com/filecoin-project/go-filecoin/proofs"
 	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/protocol/blocksync"
 	"github.com/filecoin-project/go-filecoin/protocol/hello"
 	"github.com/filecoin-project/go-filecoin/protocol/retrieval"
 	"github.com/filecoin-project/go-filecoin/protocol/storage"
@@ -71,6 +72,16 @@ var filecoinDHTProtocol dhtprotocol.ID = "/fil/kad/1.0.0"
 
 var log = logging.Logger("node") // nolint: deadcode
 
+// commitSectorGasLimit is the gas limit of commitSector messages if estimating
+// their gas fails.
+const commitSectorGasLimit = 300
+
+// publishDealsAttempts is the number of times the deals stored in a sealed
+// sector are published before the sector is given up on, waiting
+// publishDealsRetryDelay between attempts.
+const publishDealsAttempts = 10
+const publishDealsRetryDelay = time.Minute
+
 var (
 	// ErrNoMinerAddress is returned when the node is not configured to have any miner addresses.
 	ErrNoMinerAddress = errors.New("no miner addresses configured")
@@ -96,6 +107,12 @@ type Node struct {
 	// arrive async. It's called after handling a new heaviest tipset.
 	HeaviestTipSetHandled func()
 	MsgPool               *core.MessagePool
+	// MsgIndex maps the messages in the chain to where they were included.
+	MsgIndex *msg.MessageIndex
+	// MsgJournal persists the messages this node sent until the chain includes them.
+	MsgJournal *core.MessageJournal
+	// ChainEvents calls handlers on changes of the chain.
+	ChainEvents *chain.Events
 
 	Wallet *wallet.Wallet
 
@@ -124,6 +141,7 @@ type Node struct {
 	MessageSub   *pubsub.Subscription
 	Ping         *ping.PingService
 	HelloSvc     *hello.Handler
+	BlockSync    *blocksync.Handler
 	Bootstrapper *filnet.Bootstrapper
 	OnlineStore  *hamt.CborIpldStore
 
@@ -365,7 +383,8 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 		return nil, err
 	}
 
-	var chainStore chain.Store = chain.NewDefaultStore(nc.Repo.ChainDatastore(), &cstOffline, genCid)
+	defaultStore := chain.NewDefaultStore(nc.Repo.ChainDatastore(), &cstOffline, genCid)
+	var chainStore chain.Store = defaultStore
 	powerTable := &consensus.MarketView{}
 
 	var processor consensus.Processor
@@ -382,33 +401,60 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 		nodeConsensus = consensus.NewExpected(&cstOffline, bs, processor, powerTable, genCid, nc.Verifier)
 	}
 
+	// serve and fetch runs of tipsets to sync faster than over bitswap
+	blockSync := blocksync.New(peerHost, chainStore)
+
 	// only the syncer gets the storage which is online connected
-	chainSyncer := chain.NewDefaultSyncer(&cstOnline, &cstOffline, nodeConsensus, chainStore)
+	chainSyncer := chain.NewDefaultSyncer(&cstOnline, &cstOffline, nodeConsensus, chainStore, blockSync)
+	garbageCollector := chain.NewGarbageCollector(defaultStore, chainSyncer, nc.Repo.Datastore())
 	chainReader, ok := chainStore.(chain.ReadStore)
 	if !ok {
 		return nil, errors.New("failed to cast chain.Store to chain.ReadStore")
 	}
-	msgPool := core.NewMessagePool()
+	// the validator checks that senders can pay for all their messages in the pool
+	var msgPool *core.MessagePool
+	msgValidator := consensus.NewIngestionValidator(consensus.NewDefaultMessageValidator(), chainReader.LatestState, func(addr address.Address) []*types.SignedMessage {
+		return msgPool.PendingFrom(addr)
+	})
+	msgPool = core.NewMessagePool(nc.Repo.Config().Mpool, msgValidator)
+	msgJournal := core.NewMessageJournal(nc.Repo.Datastore())
 
 	// Set up libp2p pubsub
 	fsub, err := pubsub.NewFloodSub(ctx, peerHost)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to set up pubsub")
 	}
+	if err := fsub.RegisterTopicValidator(msg.Topic, messageTopicValidator(msgValidator)); err != nil {
+		return nil, errors.Wrap(err, "failed to register message topic validator")
+	}
 	backend, err := wallet.NewDSBackend(nc.Repo.WalletDatastore())
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to set up wallet backend")
 	}
-	fcWallet := wallet.New(backend)
+	backends := []wallet.Backend{backend}
+	if walletCfg := nc.Repo.Config().Wallet; walletCfg.RemoteSigner != "" {
+		remote, err := wallet.NewRemoteBackend(walletCfg.RemoteSigner, walletCfg.RemoteSignerToken)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to set up remote signer")
+		}
+		backends = append(backends, remote)
+	}
+	fcWallet := wallet.New(backends...)
+
+	msgIndex := msg.NewMessageIndex(nc.Repo.Datastore(), chainReader, bs, &cstOffline)
 
 	PorcelainAPI := porcelain.New(plumbing.New(&plumbing.APIDeps{
+		Blockstore:   bs,
 		Chain:        chainReader,
 		Config:       cfg.NewConfig(nc.Repo),
+		GC:           garbageCollector,
 		MessagePool:  msgPool,
+		MsgIndex:     msgIndex,
+		MsgJournal:   msgJournal,
 		MsgPreviewer: msg.NewPreviewer(fcWallet, chainReader, &cstOffline, bs),
 		MsgQueryer:   msg.NewQueryer(nc.Repo, fcWallet, chainReader, &cstOffline, bs),
-		MsgSender:    msg.NewSender(nc.Repo, fcWallet, chainReader, msgPool, fsub.Publish),
-		MsgWaiter:    msg.NewWaiter(chainReader, bs, &cstOffline),
+		MsgSender:    msg.NewSender(nc.Repo, fcWallet, chainReader, msgPool, msgJournal, fsub.Publish),
+		MsgWaiter:    msg.NewWaiter(chainReader, msgIndex),
 		Subscriber:   ps.NewSubscriber(fsub),
 		Publisher:    ps.NewPublisher(fsub),
 		Network:      ntwk.NewNetwork(peerHost),
@@ -424,11 +470,15 @@ func (nc *Config) Build(ctx context.Context) (*Node, error) {
 		Consensus:    nodeConsensus,
 		ChainReader:  chainReader,
 		Syncer:       chainSyncer,
+		BlockSync:    blockSync,
 		PowerTable:   powerTable,
 		PorcelainAPI: PorcelainAPI,
 		Exchange:     bswap,
 		host:         peerHost,
 		MsgPool:      msgPool,
+		MsgIndex:     msgIndex,
+		MsgJournal:   msgJournal,
+		ChainEvents:  chain.NewEvents(chainReader, msgIndex.FindTipSet),
 		OfflineMode:  nc.OfflineMode,
 		PeerHost:     peerHost,
 		Ping:         pinger,
@@ -479,9 +529,9 @@ func (node *Node) Start(ctx context.Context) error {
 
 	// Start up 'hello' handshake service
 	syncCallBack := func(pid libp2ppeer.ID, cids []cid.Cid, height uint64) {
-		// TODO it is possible the syncer interface should be modified to
-		// make use of the additional context not used here (from addr + height).
-		// To keep things simple for now this info is not used.
+		// The syncer fetches tipsets from the peers with the highest chains
+		// first.
+		node.BlockSync.AddPeer(pid, height)
 		err := node.Syncer.HandleNewBlocks(context.Background(), cids)
 		if err != nil {
 			log.Infof("error handling blocks: %s", types.NewSortedCidSet(cids...).String())
@@ -496,8 +546,8 @@ func (node *Node) Start(ctx context.Context) error {
 		return errors.Wrap(err, "Could not make new storage client")
 	}
 
-	node.RetrievalClient = retrieval.NewClient(node)
-	node.RetrievalMiner = retrieval.NewMiner(node)
+	node.RetrievalClient = retrieval.NewClient(node, node.PorcelainAPI)
+	node.RetrievalMiner = retrieval.NewMiner(node, node.PorcelainAPI, node.Repo.DealsDatastore())
 
 	// subscribe to block notifications
 	blkSub, err := node.PorcelainAPI.PubSubSubscribe(BlockTopic)
@@ -519,9 +569,24 @@ func (node *Node) Start(ctx context.Context) error {
 	go node.handleSubscription(cctx, node.processBlock, "processBlock", node.BlockSub, "BlockSub")
 	go node.handleSubscription(cctx, node.processMessage, "processMessage", node.MessageSub, "MessageSub")
 
+	// put the messages we sent before stopping back into the message pool
+	if err := node.PorcelainAPI.MessageRepublish(ctx); err != nil {
+		return errors.Wrap(err, "failed to republish journaled messages")
+	}
+
 	node.HeaviestTipSetHandled = func() {}
 	node.HeaviestTipSetCh = node.ChainReader.HeadEvents().Sub(chain.NewHeadTopic)
 	go node.handleNewHeaviestTipSet(cctx, node.ChainReader.Head())
+	go node.handleHeadChanges(cctx, node.ChainEvents.HeadChanges().Sub(chain.HeadChangeTopic))
+	node.ChainEvents.Start(cctx)
+
+	if gcPeriod := node.Repo.Config().Datastore.GCPeriod; gcPeriod != "" {
+		period, err := time.ParseDuration(gcPeriod)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't parse garbage collection period %s", gcPeriod)
+		}
+		go node.collectGarbagePeriodically(cctx, period)
+	}
 
 	if !node.OfflineMode {
 		node.Bootstrapper.Start(context.Background())
@@ -613,6 +678,63 @@ func (node *Node) handleNewMiningOutput(miningOutCh <-chan mining.Output) {
 
 }
 
+// handleHeadChanges keeps the message journal in step with the chain. The
+// messages of the tipsets a head change applied made it into the chain and
+// are removed from the journal. The messages this node sent in the tipsets it
+// reverted go back into the message pool, so they are journaled again along
+// with their signatures.
+func (node *Node) handleHeadChanges(ctx context.Context, changes chan interface{}) {
+	defer node.ChainEvents.HeadChanges().Unsub(changes, chain.HeadChangeTopic)
+	for {
+		select {
+		case raw, ok := <-changes:
+			if !ok {
+				return
+			}
+			change, ok := raw.(*chain.HeadChange)
+			if !ok {
+				log.Error("non-head change published on head change channel")
+				continue
+			}
+			if err := node.updateMessageJournal(change); err != nil {
+				log.Errorf("error updating message journal for new head: %s", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (node *Node) updateMessageJournal(change *chain.HeadChange) error {
+	for _, ts := range change.Revert {
+		for _, blk := range ts {
+			for _, smsg := range blk.Messages {
+				if !node.Wallet.HasAddress(smsg.From) {
+					continue
+				}
+				// the block only carries the public key of an aggregated
+				// message, so journal the signed copy the pool kept
+				signed, ok := node.MsgPool.SignedIncluded(smsg)
+				if !ok {
+					log.Warningf("not journaling reverted message from %s at nonce %d, its signature is unknown", smsg.From, smsg.Nonce)
+					continue
+				}
+				if err := node.MsgJournal.Record(signed); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, ts := range change.Apply {
+		for _, blk := range ts {
+			if err := node.MsgJournal.RemoveIncluded(blk.Messages); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet) {
 	for {
 		select {
@@ -638,9 +760,14 @@ func (node *Node) handleNewHeaviestTipSet(ctx context.Context, head types.TipSet
 			}
 			head = newHead
 
+			if err := node.MsgIndex.Update(ctx, newHead); err != nil {
+				log.Error("error updating message index for new tipset:", err)
+			}
+
 			if node.StorageMiner != nil {
 				node.StorageMiner.OnNewHeaviestTipSet(newHead)
 			}
+			node.RetrievalMiner.OnNewHeaviestTipSet(newHead)
 			node.HeaviestTipSetHandled()
 		case <-ctx.Done():
 			return
@@ -692,6 +819,24 @@ func (node *Node) Stop(ctx context.Context) {
 	fmt.Println("stopping filecoin :(")
 }
 
+// collectGarbagePeriodically collects garbage in the repo every period until
+// ctx is done.
+func (node *Node) collectGarbagePeriodically(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			retention := node.Repo.Config().Datastore.GCRetention
+			if _, err := node.PorcelainAPI.RepoGC(ctx, retention); err != nil {
+				log.Warningf("failed to collect garbage: %s", err)
+			}
+		}
+	}
+}
+
 type newBlockFunc func(context.Context, *types.Block)
 
 func (node *Node) addNewlyMinedBlock(ctx context.Context, b *types.Block) {
@@ -756,11 +901,10 @@ func (node *Node) StartMining(ctx context.Context) error {
 		}
 	}
 
-	minerOwnerAddr, err := node.miningOwnerAddress(ctx, minerAddr)
-	minerSigningAddress := node.MiningSignerAddress()
-	if err != nil {
+	if _, err := node.miningOwnerAddress(ctx, minerAddr); err != nil {
 		return errors.Wrapf(err, "failed to get mining owner address for miner %s", minerAddr)
 	}
+	minerSigningAddress := node.MiningSignerAddress()
 
 	blockTime, mineDelay := node.MiningTimes()
 
@@ -826,34 +970,9 @@ func (node *Node) StartMining(ctx context.Context) error {
 				if result.SealingErr != nil {
 					log.Errorf("failed to seal sector with id %d: %s", result.SectorID, result.SealingErr.Error())
 				} else if result.SealingResult != nil {
-
-					// TODO: determine these algorithmically by simulating call and querying historical prices
-					gasPrice := types.NewGasPrice(0)
-					gasUnits := types.NewGasUnits(300)
-
-					val := result.SealingResult
-					// This call can fail due to, e.g. nonce collisions. Our miners existence depends on this.
-					// We should deal with this, but MessageSendWithRetry is problematic.
-					_, err := node.PorcelainAPI.MessageSend(
-						node.miningCtx,
-						minerOwnerAddr,
-						minerAddr,
-						nil,
-						gasPrice,
-						gasUnits,
-						"commitSector",
-						val.SectorID,
-						val.CommD[:],
-						val.CommR[:],
-						val.CommRStar[:],
-						val.Proof[:],
-					)
-					if err != nil {
-						log.Errorf("failed to send commitSector message from %s to %s for sector with id %d: %s", minerOwnerAddr, minerAddr, val.SectorID, err)
-						continue
-					}
-
-					node.StorageMiner.OnCommitmentAddedToChain(val, nil)
+					// publishing the deals of the sector waits for a message to be mined, which must not hold
+					// up the results of other sectors
+					go node.commitSector(minerAddr, result.SealingResult)
 				}
 			case <-node.miningCtx.Done():
 				return
@@ -960,6 +1079,94 @@ func initStorageMinerForNode(ctx context.Context, node *Node) (*storage.Miner, e
 	return miner, nil
 }
 
+// commitSector publishes the deals stored in a sealed sector, sends the message committing the sector to the
+// chain and waits for it to be mined. A sector is never committed without its deals, since their vouchers can
+// only be redeemed once the storage market knows the sector stores them.
+func (node *Node) commitSector(minerAddr address.Address, val *sectorbuilder.SealedSectorMetadata) {
+	// commitments are sent by the miner's worker, which the owner may change at any time
+	workerAddr, err := node.PorcelainAPI.MinerGetWorkerAddress(node.miningCtx, minerAddr)
+	if err != nil {
+		log.Errorf("failed to get worker of miner %s for sector with id %d: %s", minerAddr, val.SectorID, err)
+		return
+	}
+
+	// deals stored in the sector must be published before the commitment can refer to them
+	dealIDs, err := node.publishDealsForSector(val.SectorID)
+	if err != nil {
+		node.StorageMiner.OnCommitmentAddedToChain(val, errors.Wrap(err, "failed to publish deals"))
+		return
+	}
+
+	params := []interface{}{
+		val.SectorID,
+		val.CommD[:],
+		val.CommR[:],
+		val.CommRStar[:],
+		val.Proof[:],
+		dealIDs,
+	}
+
+	gasPrice, err := node.PorcelainAPI.GasPriceSuggest(node.miningCtx)
+	if err != nil {
+		log.Warningf("failed to suggest gas price for sector with id %d, using zero: %s", val.SectorID, err)
+		gasPrice = types.NewGasPrice(0)
+	}
+	gasUnits, err := node.PorcelainAPI.MessageEstimateGas(node.miningCtx, workerAddr, minerAddr, nil, "commitSector", params...)
+	if err != nil {
+		log.Warningf("failed to estimate gas for sector with id %d, using %d: %s", val.SectorID, commitSectorGasLimit, err)
+		gasUnits = types.NewGasUnits(commitSectorGasLimit)
+	}
+
+	// This call can fail due to, e.g. nonce collisions. Our miners existence depends on this.
+	// We should deal with this, but MessageSendWithRetry is problematic.
+	msgCid, err := node.PorcelainAPI.MessageSend(
+		node.miningCtx,
+		workerAddr,
+		minerAddr,
+		nil,
+		gasPrice,
+		gasUnits,
+		"commitSector",
+		params...,
+	)
+	if err != nil {
+		log.Errorf("failed to send commitSector message from %s to %s for sector with id %d: %s", workerAddr, minerAddr, val.SectorID, err)
+		return
+	}
+
+	err = node.PorcelainAPI.MessageWait(node.miningCtx, msgCid, func(blk *types.Block, smsg *types.SignedMessage, receipt *types.MessageReceipt) error {
+		if receipt.ExitCode != uint8(0) {
+			return fmt.Errorf("commitSector message failed with exit code %d", receipt.ExitCode)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("failed to commit sector with id %d: %s", val.SectorID, err)
+	}
+	node.StorageMiner.OnCommitmentAddedToChain(val, err)
+}
+
+// publishDealsForSector publishes the deals stored in the sector with the given id, retrying until all of them
+// are published or publishDealsAttempts is exhausted.
+func (node *Node) publishDealsForSector(sectorID uint64) ([]uint64, error) {
+	var err error
+	for attempt := 1; attempt <= publishDealsAttempts; attempt++ {
+		var dealIDs []uint64
+		dealIDs, err = node.StorageMiner.PublishDealsForSector(node.miningCtx, sectorID)
+		if err == nil {
+			return dealIDs, nil
+		}
+		log.Warningf("failed to publish deals for sector with id %d (attempt %d of %d): %s", sectorID, attempt, publishDealsAttempts, err)
+
+		select {
+		case <-node.miningCtx.Done():
+			return nil, node.miningCtx.Err()
+		case <-time.After(publishDealsRetryDelay):
+		}
+	}
+	return nil, err
+}
+
 // StopMining stops mining on new blocks.
 func (node *Node) StopMining(ctx context.Context) {
 	node.setIsMining(false)
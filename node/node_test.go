@@ -164,8 +164,8 @@ func TestNodeStartMining(t *testing.T) {
 		Config:       pbConfig.NewConfig(minerNode.Repo),
 		MsgPreviewer: msg.NewPreviewer(minerNode.Wallet, minerNode.ChainReader, minerNode.CborStore(), minerNode.Blockstore),
 		MsgQueryer:   msg.NewQueryer(minerNode.Repo, minerNode.Wallet, minerNode.ChainReader, minerNode.CborStore(), minerNode.Blockstore),
-		MsgSender:    msg.NewSender(minerNode.Repo, minerNode.Wallet, minerNode.ChainReader, minerNode.MsgPool, minerNode.PorcelainAPI.PubSubPublish),
-		MsgWaiter:    msg.NewWaiter(minerNode.ChainReader, minerNode.Blockstore, minerNode.CborStore()),
+		MsgSender:    msg.NewSender(minerNode.Repo, minerNode.Wallet, minerNode.ChainReader, minerNode.MsgPool, core.NewMessageJournal(minerNode.Repo.Datastore()), minerNode.PorcelainAPI.PubSubPublish),
+		MsgWaiter:    msg.NewWaiter(minerNode.ChainReader, minerNode.MsgIndex),
 		Network:      ntwk.NewNetwork(minerNode.Host()),
 		SigGetter:    mthdsig.NewGetter(minerNode.ChainReader),
 		Wallet:       wallet.New(walletBackend),
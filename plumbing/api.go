@@ -3,11 +3,15 @@ package plumbing
 import (
 	"context"
 	"gx/ipfs/QmepvmmYNM6q4RaUiwEikQFhgMFHXg2PLhx2E9iaRd3jmS/go-libp2p-pubsub"
+	"io"
+	"time"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
 
+	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/chain"
 	"github.com/filecoin-project/go-filecoin/core"
@@ -19,6 +23,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/plumbing/ps"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/wallet"
+	"github.com/filecoin-project/go-filecoin/wallet/hd"
 )
 
 // API is the plumbing implementation, the irreducible set of calls required
@@ -29,9 +34,13 @@ import (
 type API struct {
 	logger logging.EventLogger
 
+	blockstore   bstore.Blockstore
 	chain        chain.ReadStore
 	config       *cfg.Config
+	gc           *chain.GarbageCollector
 	messagePool  *core.MessagePool
+	msgIndex     *msg.MessageIndex
+	msgJournal   *core.MessageJournal
 	msgPreviewer *msg.Previewer
 	msgQueryer   *msg.Queryer
 	msgSender    *msg.Sender
@@ -45,9 +54,13 @@ type API struct {
 
 // APIDeps contains all the API's dependencies
 type APIDeps struct {
+	Blockstore   bstore.Blockstore
 	Chain        chain.ReadStore
 	Config       *cfg.Config
+	GC           *chain.GarbageCollector
 	MessagePool  *core.MessagePool
+	MsgIndex     *msg.MessageIndex
+	MsgJournal   *core.MessageJournal
 	MsgPreviewer *msg.Previewer
 	MsgQueryer   *msg.Queryer
 	MsgSender    *msg.Sender
@@ -64,9 +77,13 @@ func New(deps *APIDeps) *API {
 	return &API{
 		logger: logging.Logger("porcelain"),
 
+		blockstore:   deps.Blockstore,
 		chain:        deps.Chain,
 		config:       deps.Config,
+		gc:           deps.GC,
 		messagePool:  deps.MessagePool,
+		msgIndex:     deps.MsgIndex,
+		msgJournal:   deps.MsgJournal,
 		msgPreviewer: deps.MsgPreviewer,
 		msgQueryer:   deps.MsgQueryer,
 		msgSender:    deps.MsgSender,
@@ -79,6 +96,17 @@ func New(deps *APIDeps) *API {
 	}
 }
 
+// ActorGet returns the actor at the given address in the state of the head
+// of the chain. The error satisfies state.IsActorNotFoundError if there is no
+// such actor.
+func (api *API) ActorGet(ctx context.Context, addr address.Address) (*actor.Actor, error) {
+	st, err := api.chain.LatestState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return st.GetActor(ctx, addr)
+}
+
 // ActorGetSignature returns the signature of the given actor's given method.
 // The function signature is typically used to enable a caller to decode the
 // output of an actor method call (message).
@@ -112,20 +140,56 @@ func (api *API) ChainLs(ctx context.Context) <-chan interface{} {
 	return api.chain.BlockHistory(ctx, api.chain.Head())
 }
 
+// ChainExport writes a snapshot of the depth most recent tipsets of the chain,
+// with their state, to w as a CAR file.
+func (api *API) ChainExport(ctx context.Context, depth int, w io.Writer) error {
+	return chain.ExportSnapshot(ctx, api.chain, api.blockstore, depth, w)
+}
+
+// RepoGC deletes the state of all but the tipsets of the retention most
+// recent chain heights, and the forks that branched off before them, from the
+// repo.
+func (api *API) RepoGC(ctx context.Context, retention uint64) (*chain.GCResult, error) {
+	return api.gc.Collect(ctx, retention)
+}
+
 // BlockGet gets a block by CID
 func (api *API) BlockGet(ctx context.Context, id cid.Cid) (*types.Block, error) {
 	return api.chain.GetBlock(ctx, id)
 }
 
-// MessagePoolRemove removes a message from the message pool
+// MessagePoolGet returns the message with the given cid from the message
+// pool, and whether it is there.
+func (api *API) MessagePoolGet(msgCid cid.Cid) (*types.SignedMessage, bool) {
+	return api.messagePool.Get(msgCid)
+}
+
+// MessagePoolRemove removes a message from the message pool, and from the
+// journal of messages sent by this node so it is not republished on restart.
 func (api *API) MessagePoolRemove(cid cid.Cid) {
 	api.messagePool.Remove(cid)
+	if err := api.msgJournal.Remove(cid); err != nil {
+		api.logger.Warningf("failed to remove message from journal: %s", err)
+	}
+}
+
+// MessageFind returns where the message with the given cid was included in
+// the chain, or nil if it is not in the chain. It looks the message up in an
+// index rather than traversing the chain.
+func (api *API) MessageFind(ctx context.Context, msgCid cid.Cid) (*msg.MessageLocation, error) {
+	return api.msgIndex.Get(ctx, msgCid)
 }
 
 // MessagePreview previews the Gas cost of a message by running it locally on the client and
 // recording the amount of Gas used.
 func (api *API) MessagePreview(ctx context.Context, from, to address.Address, method string, params ...interface{}) (types.GasUnits, error) {
-	return api.msgPreviewer.Preview(ctx, from, to, method, params...)
+	return api.msgPreviewer.Preview(ctx, from, to, nil, method, params...)
+}
+
+// MessagePreviewWithValue is MessagePreview for a message that also transfers value from the
+// from address to the to address.
+func (api *API) MessagePreviewWithValue(ctx context.Context, from, to address.Address, value *types.AttoFIL, method string, params ...interface{}) (types.GasUnits, error) {
+	return api.msgPreviewer.Preview(ctx, from, to, value, method, params...)
 }
 
 // MessageQuery calls an actor's method using the most recent chain state. It is read-only,
@@ -144,6 +208,37 @@ func (api *API) MessageSend(ctx context.Context, from, to address.Address, value
 	return api.msgSender.Send(ctx, from, to, value, gasPrice, gasLimit, method, params...)
 }
 
+// MessageReplace replaces a pending message in the message pool that was
+// sent from an address in the wallet with a copy of it paying the given gas
+// price and limit, and broadcasts the replacement to the network. The message
+// pool only accepts the replacement if its gas price is sufficiently higher.
+func (api *API) MessageReplace(ctx context.Context, msgCid cid.Cid, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	return api.msgSender.Replace(ctx, msgCid, gasPrice, gasLimit)
+}
+
+// MessageNonceStatus returns the status of the nonces of the messages sent
+// from an address in the wallet: the nonce the chain expects next, the nonce
+// the next message sent gets, the nonces of the messages in the message pool
+// and the gaps between them that keep later messages out of the chain.
+func (api *API) MessageNonceStatus(ctx context.Context, from address.Address) (*msg.NonceStatus, error) {
+	return api.msgSender.NonceStatus(ctx, from)
+}
+
+// MessageResend fills the gaps in the nonces of the messages sent from an
+// address in the wallet, with the original messages if they are still valid
+// and otherwise with empty messages paying the given gas price and limit, and
+// broadcasts the pending messages from the address to the network again.
+func (api *API) MessageResend(ctx context.Context, from address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits) ([]cid.Cid, error) {
+	return api.msgSender.Resend(ctx, from, gasPrice, gasLimit)
+}
+
+// MessageRepublish adds the messages this node sent that were not yet
+// included in the chain when it last stopped back to the message pool, and
+// broadcasts them to the network again.
+func (api *API) MessageRepublish(ctx context.Context) error {
+	return api.msgSender.Republish(ctx)
+}
+
 // MessageWait invokes the callback when a message with the given cid appears on chain.
 // It will find the message in both the case that it is already on chain and
 // the case that it appears in a newly mined block. An error is returned if one is
@@ -187,3 +282,86 @@ func (api *API) WalletFind(address address.Address) (wallet.Backend, error) {
 func (api *API) WalletNewAddress() (address.Address, error) {
 	return wallet.NewAddress(api.wallet)
 }
+
+// WalletNewAddressWithCurve generates a new wallet address of a key of the
+// given curve, wallet.SECP256K1 or wallet.BLS.
+func (api *API) WalletNewAddressWithCurve(curve string) (address.Address, error) {
+	return wallet.NewAddressWithCurve(api.wallet, curve)
+}
+
+// WalletEncrypt encrypts the keys of the default wallet backend with
+// passphrase and locks it.
+func (api *API) WalletEncrypt(passphrase string) error {
+	backend, err := wallet.DefaultBackend(api.wallet)
+	if err != nil {
+		return err
+	}
+	return backend.Encrypt(passphrase)
+}
+
+// WalletUnlock makes the keys of the encrypted default wallet backend usable
+// until timeout has passed, or until it is locked if timeout is zero.
+func (api *API) WalletUnlock(passphrase string, timeout time.Duration) error {
+	backend, err := wallet.DefaultBackend(api.wallet)
+	if err != nil {
+		return err
+	}
+	return backend.Unlock(passphrase, timeout)
+}
+
+// WalletLock locks the encrypted default wallet backend.
+func (api *API) WalletLock() error {
+	backend, err := wallet.DefaultBackend(api.wallet)
+	if err != nil {
+		return err
+	}
+	return backend.Lock()
+}
+
+// WalletChangePassphrase re-encrypts the keys of the encrypted default wallet
+// backend with a new passphrase.
+func (api *API) WalletChangePassphrase(oldPassphrase, newPassphrase string) error {
+	backend, err := wallet.DefaultBackend(api.wallet)
+	if err != nil {
+		return err
+	}
+	return backend.ChangePassphrase(oldPassphrase, newPassphrase)
+}
+
+// WalletNewMnemonic generates a mnemonic and makes the default wallet backend
+// derive new secp256k1 addresses from its seed. The mnemonic is returned so
+// it can be written down; it is not stored.
+func (api *API) WalletNewMnemonic() (string, error) {
+	backend, err := wallet.DefaultBackend(api.wallet)
+	if err != nil {
+		return "", err
+	}
+	mnemonic, err := hd.NewMnemonic(256)
+	if err != nil {
+		return "", err
+	}
+	seed, err := hd.MnemonicToSeed(mnemonic, "")
+	if err != nil {
+		return "", err
+	}
+	if err := backend.SetSeed(seed); err != nil {
+		return "", err
+	}
+	return mnemonic, nil
+}
+
+// WalletRestoreMnemonic sets the seed of the default wallet backend to the
+// seed of mnemonic and imports the addresses derived from it for which used
+// returns true.
+func (api *API) WalletRestoreMnemonic(mnemonic string, used func(address.Address) (bool, error)) error {
+	backend, err := wallet.DefaultBackend(api.wallet)
+	if err != nil {
+		return err
+	}
+
+	seed, err := hd.MnemonicToSeed(mnemonic, "")
+	if err != nil {
+		return err
+	}
+	return backend.RestoreSeed(seed, used)
+}
@@ -0,0 +1,429 @@
+package msg
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"gx/ipfs/QmNf3wujpV2Y7Lnj2hy2UrmuX8bhMDStRHbnSLh7Ypf36h/go-hamt-ipld"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/consensus"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/vm"
+)
+
+const messageIndexPrefix = "msgindex"
+
+var messageIndexHeadKey = datastore.KeyWithNamespaces([]string{messageIndexPrefix, "head"})
+
+// MessageLocation is where a message was included in the chain.
+type MessageLocation struct {
+	// TipSet is the tipset that includes the message.
+	TipSet types.SortedCidSet
+	// Height is the height of the tipset.
+	Height uint64
+	// Block is the first block of the tipset, in message application
+	// order, that includes the message.
+	Block cid.Cid
+	// Receipt is the receipt of applying the message in the tipset. It is
+	// nil if the message was not applied because it conflicted with another
+	// message of the tipset, or if the garbage collector deleted the state
+	// needed to find it.
+	Receipt *types.MessageReceipt
+	// StateRoot is the root of the state after applying the tipset. It is
+	// undefined if the garbage collector deleted that state.
+	StateRoot cid.Cid
+}
+
+// MessageIndex maps the cids of the messages in the chain to where they were
+// included, so finding a message does not traverse the chain. It persists the
+// index and the head it was built for, and on a new head undoes the tipsets
+// the head no longer descends from and adds the ones it gained, so the index
+// follows reorgs.
+type MessageIndex struct {
+	ds          repo.Datastore
+	chainReader chain.ReadStore
+	cst         *hamt.CborIpldStore
+	bs          bstore.Blockstore
+
+	mu sync.Mutex
+}
+
+// NewMessageIndex returns a new MessageIndex persisting the index in ds.
+func NewMessageIndex(ds repo.Datastore, chainReader chain.ReadStore, bs bstore.Blockstore, cst *hamt.CborIpldStore) *MessageIndex {
+	return &MessageIndex{
+		ds:          ds,
+		chainReader: chainReader,
+		cst:         cst,
+		bs:          bs,
+	}
+}
+
+// Get returns where the message with the given cid was included in the
+// chain, or nil if it is not in the chain. It brings the index up to date
+// with the head of the chain first.
+func (mi *MessageIndex) Get(ctx context.Context, msgCid cid.Cid) (*MessageLocation, error) {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	if err := mi.update(ctx, mi.chainReader.Head()); err != nil {
+		return nil, err
+	}
+	return mi.get(msgCid)
+}
+
+// FindTipSet returns the tipset that included the message with the given
+// cid, or an empty tipset if it is not in the chain.
+func (mi *MessageIndex) FindTipSet(ctx context.Context, msgCid cid.Cid) (types.TipSet, error) {
+	loc, err := mi.Get(ctx, msgCid)
+	if err != nil || loc == nil {
+		return nil, err
+	}
+	tsas, err := mi.chainReader.GetTipSetAndState(ctx, loc.TipSet.String())
+	if err != nil {
+		return nil, err
+	}
+	return tsas.TipSet, nil
+}
+
+// Update brings the index up to date with the given head.
+func (mi *MessageIndex) Update(ctx context.Context, head types.TipSet) error {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	return mi.update(ctx, head)
+}
+
+// update is Update for callers holding mu.
+func (mi *MessageIndex) update(ctx context.Context, head types.TipSet) error {
+	if len(head) == 0 {
+		return nil
+	}
+
+	indexed, err := mi.loadHead()
+	if err != nil {
+		return err
+	}
+	if indexed.Equals(head.ToSortedCidSet()) {
+		return nil
+	}
+
+	var removed []types.TipSet
+	var added []*chain.TipSetAndState
+	rebuild := indexed.Len() == 0
+	if !rebuild {
+		removed, added, err = mi.fork(ctx, indexed, head)
+		if err != nil {
+			// the indexed head is gone, e.g. the chain was replaced
+			log.Warningf("rebuilding message index, failed to find common ancestor of %s and %s: %s", indexed.String(), head.String(), err)
+			if err := mi.clear(); err != nil {
+				return err
+			}
+			rebuild = true
+		}
+	}
+	if rebuild {
+		removed = nil
+		added, err = mi.history(ctx, head)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ts := range removed {
+		if err := mi.remove(ts); err != nil {
+			return err
+		}
+	}
+	// add the oldest tipsets first, so a message included more than once
+	// is found where it was first included
+	for i := len(added) - 1; i >= 0; i-- {
+		if err := mi.add(ctx, added[i]); err != nil {
+			return err
+		}
+	}
+
+	return mi.writeHead(head.ToSortedCidSet())
+}
+
+// history returns the tipsets from head back to the start of the chain.
+func (mi *MessageIndex) history(ctx context.Context, head types.TipSet) ([]*chain.TipSetAndState, error) {
+	var tsass []*chain.TipSetAndState
+	for raw := range mi.chainReader.BlockHistory(ctx, head) {
+		switch v := raw.(type) {
+		case error:
+			return nil, errors.Wrap(v, "failed to walk chain")
+		case types.TipSet:
+			tsas, err := mi.chainReader.GetTipSetAndState(ctx, v.String())
+			if err != nil {
+				return nil, err
+			}
+			tsass = append(tsass, tsas)
+		}
+	}
+	return tsass, ctx.Err()
+}
+
+// fork returns the tipsets the head with cids old no longer descends from,
+// and the ones new descends from that old did not, newest first.
+func (mi *MessageIndex) fork(ctx context.Context, old types.SortedCidSet, new types.TipSet) (removed []types.TipSet, added []*chain.TipSetAndState, err error) {
+	oldTsas, err := mi.chainReader.GetTipSetAndState(ctx, old.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	change, err := chain.CollectHeadChange(ctx, mi.chainReader, oldTsas.TipSet, new)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := len(change.Apply) - 1; i >= 0; i-- {
+		tsas, err := mi.chainReader.GetTipSetAndState(ctx, change.Apply[i].String())
+		if err != nil {
+			return nil, nil, err
+		}
+		added = append(added, tsas)
+	}
+	return change.Revert, added, nil
+}
+
+// add indexes the messages of a tipset the head gained.
+func (mi *MessageIndex) add(ctx context.Context, tsas *chain.TipSetAndState) error {
+	height, err := tsas.TipSet.Height()
+	if err != nil {
+		return err
+	}
+	if height == 0 {
+		return nil
+	}
+
+	receipts, err := mi.receipts(ctx, tsas.TipSet)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get receipts of tipset %s", tsas.TipSet.String())
+	}
+
+	blks := tsas.TipSet.ToSlice()
+	types.SortBlocks(blks)
+	for _, blk := range blks {
+		for _, msg := range blk.Messages {
+			c, err := msg.Cid()
+			if err != nil {
+				return err
+			}
+			loc, err := mi.get(c)
+			if err != nil {
+				return err
+			}
+			if loc != nil {
+				continue
+			}
+
+			err = mi.put(c, &MessageLocation{
+				TipSet:    tsas.TipSet.ToSortedCidSet(),
+				Height:    height,
+				Block:     blk.Cid(),
+				Receipt:   receipts[c],
+				StateRoot: tsas.TipSetStateRoot,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// remove drops the messages of a tipset the head no longer descends from.
+func (mi *MessageIndex) remove(ts types.TipSet) error {
+	for _, blk := range ts {
+		for _, msg := range blk.Messages {
+			c, err := msg.Cid()
+			if err != nil {
+				return err
+			}
+			loc, err := mi.get(c)
+			if err != nil {
+				return err
+			}
+			if loc == nil || !loc.TipSet.Equals(ts.ToSortedCidSet()) {
+				continue
+			}
+			if err := mi.ds.Delete(messageIndexKey(c)); err != nil {
+				return errors.Wrapf(err, "failed to remove message %s from index", c.String())
+			}
+		}
+	}
+	return nil
+}
+
+// receipts returns the receipts of the messages of a tipset. Conflicting
+// messages that were not applied map to nil. A tipset of a single block
+// carries the receipts of its messages, the messages of larger tipsets are
+// applied again to find theirs, since the receipts in each block only account
+// for the messages of that block.
+func (mi *MessageIndex) receipts(ctx context.Context, ts types.TipSet) (map[cid.Cid]*types.MessageReceipt, error) {
+	if len(ts) == 1 {
+		// TODO: a missing receipt should be an error. Right now that
+		// breaks tests because our test helpers don't correctly apply
+		// messages when making test chains.
+		return matchReceipts(ts, types.SortedCidSet{}, ts.ToSlice()[0].MessageReceipts)
+	}
+
+	ids, err := ts.Parents()
+	if err != nil {
+		return nil, err
+	}
+	tsas, err := mi.chainReader.GetTipSetAndState(ctx, ids.String())
+	if err != nil {
+		return nil, err
+	}
+	if !tsas.TipSetStateRoot.Defined() {
+		// the state was garbage collected, the receipts are unknown
+		return nil, nil
+	}
+	st, err := state.LoadStateTree(ctx, mi.cst, tsas.TipSetStateRoot, builtin.Actors)
+	if err != nil {
+		return nil, err
+	}
+
+	tsHeight, err := ts.Height()
+	if err != nil {
+		return nil, err
+	}
+	tsBlockHeight := types.NewBlockHeight(tsHeight)
+	ancestors, err := chain.GetRecentAncestors(ctx, tsas.TipSet, mi.chainReader, tsBlockHeight, consensus.AncestorRoundsNeeded, consensus.LookBackParameter)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := consensus.NewDefaultProcessor().ProcessTipSet(ctx, st, vm.NewStorageMap(mi.bs), ts, ancestors)
+	if err != nil {
+		return nil, err
+	}
+
+	receipts := make([]*types.MessageReceipt, len(res.Results))
+	for i, r := range res.Results {
+		receipts[i] = r.Receipt
+	}
+	return matchReceipts(ts, res.Failures, receipts)
+}
+
+// matchReceipts pairs the messages of a tipset in canonical message order,
+// leaving out duplicates and the failed messages in fails, with the receipts
+// in order. The failed messages map to nil.
+func matchReceipts(ts types.TipSet, fails types.SortedCidSet, receipts []*types.MessageReceipt) (map[cid.Cid]*types.MessageReceipt, error) {
+	blks := ts.ToSlice()
+	types.SortBlocks(blks)
+	matched := make(map[cid.Cid]*types.MessageReceipt)
+	var msgCnt int
+	for _, b := range blks {
+		for _, msg := range b.Messages {
+			c, err := msg.Cid()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := matched[c]; ok {
+				continue
+			}
+			if fails.Has(c) {
+				matched[c] = nil
+				continue
+			}
+			// TODO: out of bounds receipt index should return an error.
+			if msgCnt < len(receipts) {
+				matched[c] = receipts[msgCnt]
+			} else {
+				matched[c] = nil
+			}
+			msgCnt++
+		}
+	}
+	return matched, nil
+}
+
+func (mi *MessageIndex) get(msgCid cid.Cid) (*MessageLocation, error) {
+	data, err := mi.ds.Get(messageIndexKey(msgCid))
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read message %s from index", msgCid.String())
+	}
+
+	var loc MessageLocation
+	if err := json.Unmarshal(data, &loc); err != nil {
+		return nil, errors.Wrapf(err, "invalid index entry of message %s", msgCid.String())
+	}
+	return &loc, nil
+}
+
+func (mi *MessageIndex) put(msgCid cid.Cid, loc *MessageLocation) error {
+	data, err := json.Marshal(loc)
+	if err != nil {
+		return err
+	}
+	if err := mi.ds.Put(messageIndexKey(msgCid), data); err != nil {
+		return errors.Wrapf(err, "failed to add message %s to index", msgCid.String())
+	}
+	return nil
+}
+
+// clear removes every message and the head from the index.
+func (mi *MessageIndex) clear() error {
+	res, err := mi.ds.Query(query.Query{Prefix: datastore.NewKey(messageIndexPrefix).String(), KeysOnly: true})
+	if err != nil {
+		return errors.Wrap(err, "failed to query message index")
+	}
+	defer res.Close() // nolint: errcheck
+
+	var keys []datastore.Key
+	for entry := range res.Next() {
+		if entry.Error != nil {
+			return errors.Wrap(entry.Error, "failed to read message index")
+		}
+		keys = append(keys, datastore.NewKey(entry.Key))
+	}
+	for _, key := range keys {
+		if err := mi.ds.Delete(key); err != nil {
+			return errors.Wrap(err, "failed to clear message index")
+		}
+	}
+	return nil
+}
+
+func (mi *MessageIndex) loadHead() (types.SortedCidSet, error) {
+	var cids types.SortedCidSet
+	data, err := mi.ds.Get(messageIndexHeadKey)
+	if err == datastore.ErrNotFound {
+		return cids, nil
+	} else if err != nil {
+		return cids, errors.Wrap(err, "failed to read message index head")
+	}
+
+	if err := json.Unmarshal(data, &cids); err != nil {
+		return cids, errors.Wrap(err, "invalid message index head")
+	}
+	return cids, nil
+}
+
+func (mi *MessageIndex) writeHead(cids types.SortedCidSet) error {
+	data, err := json.Marshal(cids)
+	if err != nil {
+		return err
+	}
+	if err := mi.ds.Put(messageIndexHeadKey, data); err != nil {
+		return errors.Wrap(err, "failed to write message index head")
+	}
+	return nil
+}
+
+func messageIndexKey(msgCid cid.Cid) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{messageIndexPrefix, "msgs", msgCid.String()})
+}
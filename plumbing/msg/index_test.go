@@ -0,0 +1,114 @@
+package msg
+
+import (
+	"context"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func requirePutChain(ctx context.Context, require *require.Assertions, chainStore *chain.DefaultStore, tipsets []types.TipSet) {
+	for _, ts := range tipsets {
+		chain.RequirePutTsas(ctx, require, chainStore, &chain.TipSetAndState{
+			TipSet:          ts,
+			TipSetStateRoot: ts.ToSlice()[0].StateRoot,
+		})
+	}
+}
+
+func requireFind(ctx context.Context, require *require.Assertions, index *MessageIndex, msg *types.SignedMessage) *MessageLocation {
+	c, err := msg.Cid()
+	require.NoError(err)
+	loc, err := index.Get(ctx, c)
+	require.NoError(err)
+	return loc
+}
+
+func TestMessageIndex(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("finds the messages in the chain", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		d := requireCommonDeps(require)
+		index := NewMessageIndex(d.repo.Datastore(), d.chainStore, d.blockstore, d.cst)
+
+		m1, m2, m3 := newSignedMessage(), newSignedMessage(), newSignedMessage()
+		tipsets := core.NewChainWithMessages(d.cst, d.chainStore.Head(), smsgsSet{smsgs{m1}}, smsgsSet{smsgs{m2}})
+		requirePutChain(ctx, require, d.chainStore, tipsets[1:])
+		require.NoError(d.chainStore.SetHead(ctx, tipsets[2]))
+
+		loc := requireFind(ctx, require, index, m1)
+		require.NotNil(loc)
+		assert.Equal(uint64(1), loc.Height)
+		assert.True(loc.TipSet.Equals(tipsets[1].ToSortedCidSet()))
+		assert.Equal(tipsets[1].ToSlice()[0].Cid(), loc.Block)
+
+		loc = requireFind(ctx, require, index, m2)
+		require.NotNil(loc)
+		assert.Equal(uint64(2), loc.Height)
+
+		assert.Nil(requireFind(ctx, require, index, m3))
+
+		// the index is persisted with the head it was built for
+		reopened := NewMessageIndex(d.repo.Datastore(), d.chainStore, d.blockstore, d.cst)
+		indexed, err := reopened.loadHead()
+		require.NoError(err)
+		assert.True(indexed.Equals(tipsets[2].ToSortedCidSet()))
+		assert.NotNil(requireFind(ctx, require, reopened, m2))
+	})
+
+	t.Run("follows reorgs", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		d := requireCommonDeps(require)
+		index := NewMessageIndex(d.repo.Datastore(), d.chainStore, d.blockstore, d.cst)
+		genesis := d.chainStore.Head()
+
+		m1, m2, m3 := newSignedMessage(), newSignedMessage(), newSignedMessage()
+		forkA := core.NewChainWithMessages(d.cst, genesis, smsgsSet{smsgs{m1}}, smsgsSet{smsgs{m2}})
+		forkB := core.NewChainWithMessages(d.cst, genesis, smsgsSet{smsgs{m3}}, smsgsSet{smsgs{m1}}, smsgsSet{})
+		requirePutChain(ctx, require, d.chainStore, forkA[1:])
+		requirePutChain(ctx, require, d.chainStore, forkB[1:])
+
+		require.NoError(d.chainStore.SetHead(ctx, forkA[2]))
+		require.NoError(index.Update(ctx, forkA[2]))
+		assert.Equal(uint64(1), requireFind(ctx, require, index, m1).Height)
+		assert.NotNil(requireFind(ctx, require, index, m2))
+		assert.Nil(requireFind(ctx, require, index, m3))
+
+		require.NoError(d.chainStore.SetHead(ctx, forkB[3]))
+		require.NoError(index.Update(ctx, forkB[3]))
+		loc := requireFind(ctx, require, index, m1)
+		require.NotNil(loc)
+		assert.Equal(uint64(2), loc.Height)
+		assert.True(loc.TipSet.Equals(forkB[2].ToSortedCidSet()))
+		assert.Nil(requireFind(ctx, require, index, m2))
+		assert.Equal(uint64(1), requireFind(ctx, require, index, m3).Height)
+	})
+
+	t.Run("fails if the chain is missing tipsets", func(t *testing.T) {
+		require := require.New(t)
+
+		d := requireCommonDeps(require)
+		index := NewMessageIndex(d.repo.Datastore(), d.chainStore, d.blockstore, d.cst)
+
+		m1 := newSignedMessage()
+		tipsets := core.NewChainWithMessages(d.cst, d.chainStore.Head(), smsgsSet{smsgs{m1}}, smsgsSet{})
+		require.NoError(d.chainStore.SetHead(ctx, tipsets[2]))
+
+		c, err := m1.Cid()
+		require.NoError(err)
+		_, err = index.Get(ctx, c)
+		require.Error(err)
+	})
+}
@@ -0,0 +1,211 @@
+package msg
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/core"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/state"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+const nonceReservationPrefix = "nonces"
+
+// NonceStatus describes the nonces of the messages sent from an address.
+type NonceStatus struct {
+	// ChainNonce is the nonce of the next message from the address the chain
+	// will accept.
+	ChainNonce uint64
+	// NextNonce is the nonce the next message sent from the address gets.
+	NextNonce uint64
+	// Pending are the nonces of the messages from the address in the message
+	// pool, in order.
+	Pending []uint64
+	// Gaps are the nonces between ChainNonce and NextNonce for which there
+	// is no message in the message pool, in order. The messages with later
+	// nonces cannot be included in the chain until the gaps are filled.
+	Gaps []uint64
+}
+
+// NonceManager assigns nonces to the messages the node sends. It serializes
+// assignment per address, so messages from different addresses are sent
+// concurrently, and persists the nonces it hands out. A nonce whose message
+// later disappears from the message pool, for example because it expired or a
+// reorg dropped the block including it, shows up as a gap in the status of
+// the address. The Sender puts the journaled message of a gap back into the
+// message pool before reserving a nonce, so the gaps that are left have no
+// message that could still make it into the chain, and reserve hands them
+// out again before moving past them.
+type NonceManager struct {
+	ds          repo.Datastore
+	chainReader chain.ReadStore
+	msgPool     *core.MessagePool
+
+	locksLk sync.Mutex
+	locks   map[address.Address]*sync.Mutex
+}
+
+// NewNonceManager returns a new NonceManager persisting reservations in ds.
+func NewNonceManager(ds repo.Datastore, chainReader chain.ReadStore, msgPool *core.MessagePool) *NonceManager {
+	return &NonceManager{
+		ds:          ds,
+		chainReader: chainReader,
+		msgPool:     msgPool,
+		locks:       make(map[address.Address]*sync.Mutex),
+	}
+}
+
+// lock locks nonce assignment for an address and returns a function that
+// unlocks it.
+func (nm *NonceManager) lock(addr address.Address) func() {
+	nm.locksLk.Lock()
+	l, ok := nm.locks[addr]
+	if !ok {
+		l = &sync.Mutex{}
+		nm.locks[addr] = l
+	}
+	nm.locksLk.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// reserve returns the first gap in the nonces of addr, or the next nonce if
+// there is none, for a message from addr and persists it as used. The caller
+// must hold the lock for addr and have restored the journaled messages of the
+// gaps it does not want reused.
+func (nm *NonceManager) reserve(ctx context.Context, addr address.Address) (uint64, error) {
+	status, err := nm.status(ctx, addr)
+	if err != nil {
+		return 0, err
+	}
+	if len(status.Gaps) > 0 {
+		log.Infof("reusing nonce %d of %s, its message is no longer pending", status.Gaps[0], addr)
+		return status.Gaps[0], nil
+	}
+
+	if err := nm.putReserved(addr, status.NextNonce+1); err != nil {
+		return 0, err
+	}
+	return status.NextNonce, nil
+}
+
+// release gives back a nonce returned by reserve when the message using it
+// could not be sent. A reused gap stays a gap, so only the last reserved nonce
+// needs to be given back. The caller must hold the lock for addr and not have
+// reserved another nonce for it since.
+func (nm *NonceManager) release(addr address.Address, nonce uint64) {
+	reserved, err := nm.getReserved(addr)
+	if err != nil {
+		log.Warningf("failed to release nonce %d of %s: %s", nonce, addr, err)
+		return
+	}
+	if reserved != nonce+1 {
+		return
+	}
+	if err := nm.putReserved(addr, nonce); err != nil {
+		log.Warningf("failed to release nonce %d of %s: %s", nonce, addr, err)
+	}
+}
+
+// Status returns the nonce status of addr.
+func (nm *NonceManager) Status(ctx context.Context, addr address.Address) (*NonceStatus, error) {
+	unlock := nm.lock(addr)
+	defer unlock()
+
+	return nm.status(ctx, addr)
+}
+
+// status is Status for callers holding the lock for addr.
+func (nm *NonceManager) status(ctx context.Context, addr address.Address) (*NonceStatus, error) {
+	chainNonce, err := nm.chainNonce(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	reserved, err := nm.getReserved(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &NonceStatus{ChainNonce: chainNonce, NextNonce: chainNonce}
+	if reserved > status.NextNonce {
+		status.NextNonce = reserved
+	}
+
+	pending := make(map[uint64]bool)
+	for _, msg := range nm.msgPool.Pending() {
+		nonce := uint64(msg.Nonce)
+		if msg.From != addr || nonce < chainNonce {
+			continue
+		}
+		pending[nonce] = true
+		status.Pending = append(status.Pending, nonce)
+		if nonce >= status.NextNonce {
+			status.NextNonce = nonce + 1
+		}
+	}
+	sort.Slice(status.Pending, func(i, j int) bool { return status.Pending[i] < status.Pending[j] })
+
+	for nonce := chainNonce; nonce < status.NextNonce; nonce++ {
+		if !pending[nonce] {
+			status.Gaps = append(status.Gaps, nonce)
+		}
+	}
+
+	return status, nil
+}
+
+// chainNonce returns the nonce of the actor at addr in the head state.
+func (nm *NonceManager) chainNonce(ctx context.Context, addr address.Address) (uint64, error) {
+	st, err := nm.chainReader.LatestState(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to load head state")
+	}
+
+	actor, err := st.GetActor(ctx, addr)
+	if state.IsActorNotFoundError(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if actor.Code.Defined() && !actor.Code.Equals(types.AccountActorCodeCid) {
+		return 0, errors.New("actor not an account or empty actor")
+	}
+
+	return uint64(actor.Nonce), nil
+}
+
+func (nm *NonceManager) getReserved(addr address.Address) (uint64, error) {
+	data, err := nm.ds.Get(nonceReservationKey(addr))
+	if err == datastore.ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Wrapf(err, "failed to load nonce reservation of %s", addr)
+	}
+
+	reserved, err := strconv.ParseUint(string(data), 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid nonce reservation of %s", addr)
+	}
+	return reserved, nil
+}
+
+func (nm *NonceManager) putReserved(addr address.Address, next uint64) error {
+	if err := nm.ds.Put(nonceReservationKey(addr), []byte(strconv.FormatUint(next, 10))); err != nil {
+		return errors.Wrapf(err, "failed to persist nonce reservation of %s", addr)
+	}
+	return nil
+}
+
+func nonceReservationKey(addr address.Address) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{nonceReservationPrefix, addr.String()})
+}
@@ -34,8 +34,9 @@ func NewPreviewer(wallet *wallet.Wallet, chainReader chain.ReadStore, cst *hamt.
 	return &Previewer{wallet, chainReader, cst, bs}
 }
 
-// Preview sends a read-only message to an actor.
-func (p *Previewer) Preview(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) (types.GasUnits, error) {
+// Preview sends a read-only message to an actor. If optValue is not nil the
+// message also transfers it from optFrom to the actor.
+func (p *Previewer) Preview(ctx context.Context, optFrom, to address.Address, optValue *types.AttoFIL, method string, params ...interface{}) (types.GasUnits, error) {
 	encodedParams, err := abi.ToEncodedValues(params...)
 	if err != nil {
 		return types.NewGasUnits(0), errors.Wrap(err, "couldnt encode message params")
@@ -56,7 +57,7 @@ func (p *Previewer) Preview(ctx context.Context, optFrom, to address.Address, me
 	}
 
 	vms := vm.NewStorageMap(p.bs)
-	usedGas, err := consensus.PreviewQueryMethod(ctx, st, vms, to, method, encodedParams, optFrom, types.NewBlockHeight(h))
+	usedGas, err := consensus.PreviewQueryMethod(ctx, st, vms, to, optValue, method, encodedParams, optFrom, types.NewBlockHeight(h))
 	if err != nil {
 		return types.NewGasUnits(0), errors.Wrap(err, "query method returned an error")
 	}
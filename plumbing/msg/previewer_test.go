@@ -49,9 +49,31 @@ func TestPreview(t *testing.T) {
 		deps := requireCommonDepsWithGifAndBlockstore(require, testGen, r, bs)
 
 		previewer := NewPreviewer(deps.wallet, deps.chainStore, deps.cst, deps.blockstore)
-		returnValue, err := previewer.Preview(ctx, fromAddr, fakeActorAddr, "hasReturnValue")
+		returnValue, err := previewer.Preview(ctx, fromAddr, fakeActorAddr, nil, "hasReturnValue")
 		require.NoError(err)
 		require.NotNil(returnValue)
 		assert.Equal(types.NewGasUnits(100), returnValue)
 	})
+
+	t.Run("previews transferring value", func(t *testing.T) {
+		require := require.New(t)
+		newAddr := address.NewForTestGetter()
+		ctx := context.Background()
+		r := repo.NewInMemoryRepo()
+		bs := bstore.NewBlockstore(r.Datastore())
+
+		fromAddr := newAddr()
+		testGen := consensus.MakeGenesisFunc(
+			consensus.ActorAccount(fromAddr, types.NewAttoFILFromFIL(10)),
+		)
+		deps := requireCommonDepsWithGifAndBlockstore(require, testGen, r, bs)
+		previewer := NewPreviewer(deps.wallet, deps.chainStore, deps.cst, deps.blockstore)
+
+		// the recipient does not exist yet, as when sending to a new address
+		_, err := previewer.Preview(ctx, fromAddr, newAddr(), types.NewAttoFILFromFIL(5), "")
+		require.NoError(err)
+
+		_, err = previewer.Preview(ctx, fromAddr, newAddr(), types.NewAttoFILFromFIL(11), "")
+		require.Error(err)
+	})
 }
@@ -2,7 +2,7 @@ package msg
 
 import (
 	"context"
-	"sync"
+	"sort"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
@@ -28,21 +28,30 @@ type Sender struct {
 	repo   repo.Repo
 	wallet *wallet.Wallet
 
-	// For getting the latest nonce and enqueuing messages.
-	chainReader chain.ReadStore
-	msgPool     *core.MessagePool
+	// For enqueuing messages.
+	msgPool *core.MessagePool
+
+	// For assigning nonces to messages.
+	nonces *NonceManager
+
+	// To keep sent messages across restarts.
+	journal *core.MessageJournal
 
 	// To publish the new message to the network.
 	publish PublishFunc
-
-	// Locking in send reduces the chance of nonce collision.
-	l sync.Mutex
 }
 
 // NewSender returns a new Sender. There should be exactly one of these per node because
-// sending locks to reduce nonce collisions.
-func NewSender(repo repo.Repo, wallet *wallet.Wallet, chainReader chain.ReadStore, msgPool *core.MessagePool, publish PublishFunc) *Sender {
-	return &Sender{repo: repo, wallet: wallet, chainReader: chainReader, msgPool: msgPool, publish: publish}
+// its nonce manager serializes the nonces of the messages the node sends.
+func NewSender(repo repo.Repo, wallet *wallet.Wallet, chainReader chain.ReadStore, msgPool *core.MessagePool, journal *core.MessageJournal, publish PublishFunc) *Sender {
+	return &Sender{
+		repo:    repo,
+		wallet:  wallet,
+		msgPool: msgPool,
+		nonces:  NewNonceManager(repo.Datastore(), chainReader, msgPool),
+		journal: journal,
+		publish: publish,
+	}
 }
 
 // Send sends a message. See api description.
@@ -53,10 +62,14 @@ func (s *Sender) Send(ctx context.Context, from, to address.Address, value *type
 	}
 
 	// Lock to avoid race for message nonce.
-	s.l.Lock()
-	defer s.l.Unlock()
+	unlock := s.nonces.lock(from)
+	defer unlock()
 
-	nonce, err := nextNonce(ctx, s.chainReader, s.msgPool, from)
+	if err := s.restoreGaps(ctx, from); err != nil {
+		return cid.Undef, errors.Wrap(err, "couldn't restore missing messages")
+	}
+
+	nonce, err := s.nonces.reserve(ctx, from)
 	if err != nil {
 		return cid.Undef, errors.Wrap(err, "couldn't get next nonce")
 	}
@@ -64,40 +77,237 @@ func (s *Sender) Send(ctx context.Context, from, to address.Address, value *type
 	msg := types.NewMessage(from, to, nonce, value, method, encodedParams)
 	smsg, err := types.NewSignedMessage(*msg, s.wallet, gasPrice, gasLimit)
 	if err != nil {
+		s.nonces.release(from, nonce)
 		return cid.Undef, errors.Wrap(err, "failed to sign message")
 	}
 
-	smsgdata, err := smsg.Marshal()
+	if err := s.addAndPublish(ctx, smsg); err != nil {
+		s.nonces.release(from, nonce)
+		return cid.Undef, err
+	}
+
+	log.Debugf("MessageSend with message: %s", smsg)
+
+	return smsg.Cid()
+}
+
+// Replace replaces a pending message sent from an address in the wallet with
+// a copy paying a different gas price and limit. See api description.
+func (s *Sender) Replace(ctx context.Context, msgCid cid.Cid, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	pending, ok := s.msgPool.Get(msgCid)
+	if !ok {
+		return cid.Undef, errors.Errorf("message %s is not in the message pool", msgCid.String())
+	}
+
+	smsg, err := types.NewSignedMessage(pending.Message, s.wallet, gasPrice, gasLimit)
 	if err != nil {
-		return cid.Undef, errors.Wrap(err, "failed to marshal message")
+		return cid.Undef, errors.Wrap(err, "failed to sign message")
 	}
 
-	if _, err := s.msgPool.Add(smsg); err != nil {
-		return cid.Undef, errors.Wrap(err, "failed to add message to the message pool")
+	if err := s.addAndPublish(ctx, smsg); err != nil {
+		return cid.Undef, err
 	}
 
-	if err = s.publish(Topic, smsgdata); err != nil {
-		return cid.Undef, errors.Wrap(err, "couldnt publish new message to network")
+	if err := s.journal.Remove(msgCid); err != nil {
+		log.Warningf("failed to remove replaced message from journal: %s", err)
 	}
 
-	log.Debugf("MessageSend with message: %s", smsg)
+	log.Debugf("MessageReplace of %s with message: %s", msgCid.String(), smsg)
 
 	return smsg.Cid()
 }
 
-// nextNonce returns the next nonce for the given address. It checks
-// the actor's memory and also scans the message pool for any pending
-// messages.
-func nextNonce(ctx context.Context, chainReader chain.ReadStore, msgPool *core.MessagePool, address address.Address) (nonce uint64, err error) {
-	st, err := chainReader.LatestState(ctx)
+// Republish adds the messages sent before the node last stopped that are still
+// journaled back to the message pool, which validates them against the head
+// state, and publishes them to the network again. Messages that are no longer
+// valid, for example because they were included in the chain, are dropped
+// from the journal.
+func (s *Sender) Republish(ctx context.Context) error {
+	msgs, err := s.journal.Messages()
 	if err != nil {
-		return 0, err
+		return err
+	}
+
+	for _, smsg := range msgs {
+		c, err := smsg.Cid()
+		if err != nil {
+			return errors.Wrap(err, "failed to create CID")
+		}
+
+		if err := s.addAndPublish(ctx, smsg); err != nil {
+			log.Infof("dropping journaled message %s: %s", c.String(), err)
+			if err := s.journal.Remove(c); err != nil {
+				return err
+			}
+			continue
+		}
+
+		log.Debugf("republished journaled message: %s", smsg)
 	}
 
-	nonce, err = core.NextNonce(ctx, st, msgPool, address)
+	return nil
+}
+
+// restoreGaps puts the journaled messages from an address whose nonces are
+// gaps, for example because they expired from the message pool, back into the
+// message pool and publishes them again, so the messages after them are not
+// stuck. Journaled messages that are no longer valid are dropped from the
+// journal, which leaves their nonces to be reused. The caller must hold the
+// nonce lock for the address.
+func (s *Sender) restoreGaps(ctx context.Context, from address.Address) error {
+	status, err := s.nonces.status(ctx, from)
 	if err != nil {
-		return 0, err
+		return err
+	}
+	if len(status.Gaps) == 0 {
+		return nil
+	}
+
+	gaps := make(map[uint64]bool, len(status.Gaps))
+	for _, nonce := range status.Gaps {
+		gaps[nonce] = true
+	}
+
+	msgs, err := s.journal.Messages()
+	if err != nil {
+		return err
+	}
+	for _, smsg := range msgs {
+		if smsg.From != from || !gaps[uint64(smsg.Nonce)] {
+			continue
+		}
+
+		c, err := smsg.Cid()
+		if err != nil {
+			return errors.Wrap(err, "failed to create CID")
+		}
+
+		if err := s.addAndPublish(ctx, smsg); err != nil {
+			log.Infof("dropping journaled message %s: %s", c.String(), err)
+			if err := s.journal.Remove(c); err != nil {
+				return err
+			}
+			continue
+		}
+		delete(gaps, uint64(smsg.Nonce))
+
+		log.Debugf("restored journaled message: %s", smsg)
+	}
+
+	return nil
+}
+
+// NonceStatus returns the status of the nonces of the messages sent from an
+// address. See api description.
+func (s *Sender) NonceStatus(ctx context.Context, from address.Address) (*NonceStatus, error) {
+	return s.nonces.Status(ctx, from)
+}
+
+// Resend unsticks the messages sent from an address that cannot be included
+// in the chain because of gaps in their nonces. It fills every gap with the
+// journaled message that used the nonce if it is still valid, and otherwise
+// with an empty message from the address to the burn address paying gasPrice
+// and gasLimit, as messages to their sender are invalid. It then publishes the other pending messages from the address to
+// the network again. It returns the CIDs of all messages it sent, in nonce
+// order.
+func (s *Sender) Resend(ctx context.Context, from address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits) ([]cid.Cid, error) {
+	unlock := s.nonces.lock(from)
+	defer unlock()
+
+	status, err := s.nonces.status(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+
+	journaled := make(map[uint64]*types.SignedMessage)
+	if len(status.Gaps) > 0 {
+		msgs, err := s.journal.Messages()
+		if err != nil {
+			return nil, err
+		}
+		for _, smsg := range msgs {
+			if smsg.From == from {
+				journaled[uint64(smsg.Nonce)] = smsg
+			}
+		}
+	}
+
+	sent := make(map[uint64]*types.SignedMessage)
+	for _, nonce := range status.Gaps {
+		if smsg, ok := journaled[nonce]; ok {
+			if err := s.addAndPublish(ctx, smsg); err == nil {
+				sent[nonce] = smsg
+				continue
+			}
+			log.Infof("journaled message from %s with nonce %d is no longer valid, filling its nonce with an empty message", from, nonce)
+		}
+
+		msg := types.NewMessage(from, address.BurnAddress, nonce, types.NewZeroAttoFIL(), "", nil)
+		smsg, err := types.NewSignedMessage(*msg, s.wallet, gasPrice, gasLimit)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to sign message")
+		}
+		if err := s.addAndPublish(ctx, smsg); err != nil {
+			return nil, errors.Wrapf(err, "failed to fill nonce %d", nonce)
+		}
+		sent[nonce] = smsg
+	}
+
+	for _, smsg := range s.msgPool.Pending() {
+		nonce := uint64(smsg.Nonce)
+		if smsg.From != from || nonce < status.ChainNonce || sent[nonce] != nil {
+			continue
+		}
+
+		smsgdata, err := smsg.Marshal()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal message")
+		}
+		if err := s.publish(Topic, smsgdata); err != nil {
+			return nil, errors.Wrap(err, "couldnt publish message to network")
+		}
+		sent[nonce] = smsg
+	}
+
+	var nonces []uint64
+	for nonce := range sent {
+		nonces = append(nonces, nonce)
+	}
+	sort.Slice(nonces, func(i, j int) bool { return nonces[i] < nonces[j] })
+
+	cids := make([]cid.Cid, len(nonces))
+	for i, nonce := range nonces {
+		c, err := sent[nonce].Cid()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create CID")
+		}
+		cids[i] = c
+	}
+
+	log.Debugf("MessageResend from %s sent %d messages", from, len(cids))
+
+	return cids, nil
+}
+
+// addAndPublish adds a signed message to the message pool, journals it and
+// publishes it to the network.
+func (s *Sender) addAndPublish(ctx context.Context, smsg *types.SignedMessage) error {
+	smsgdata, err := smsg.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal message")
+	}
+
+	if _, err := s.msgPool.Add(ctx, smsg); err != nil {
+		return errors.Wrap(err, "failed to add message to the message pool")
+	}
+
+	if err := s.journal.Record(smsg); err != nil {
+		return err
+	}
+
+	if err = s.publish(Topic, smsgdata); err != nil {
+		return errors.Wrap(err, "couldnt publish new message to network")
 	}
 
-	return nonce, nil
+	return nil
 }
@@ -9,12 +9,16 @@ import (
 
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/chain"
+	"github.com/filecoin-project/go-filecoin/config"
+	"github.com/filecoin-project/go-filecoin/consensus"
 	"github.com/filecoin-project/go-filecoin/core"
 	"github.com/filecoin-project/go-filecoin/repo"
 	"github.com/filecoin-project/go-filecoin/types"
 	"github.com/filecoin-project/go-filecoin/wallet"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	bstore "gx/ipfs/QmRu7tiRnFk9mMPpVECQTBQJqXtmG132jJxA1w9A7TtpBz/go-ipfs-blockstore"
 )
 
 func TestSend(t *testing.T) {
@@ -35,7 +39,7 @@ func TestSend(t *testing.T) {
 			return nil
 		}
 
-		s := NewSender(repo, w, chainStore, msgPool, publish)
+		s := NewSender(repo, w, chainStore, msgPool, core.NewMessageJournal(repo.Datastore()), publish)
 		require.Equal(0, len(msgPool.Pending()))
 		_, err = s.Send(context.Background(), addr, addr, types.NewAttoFILFromFIL(uint64(2)), types.NewGasPrice(0), types.NewGasUnits(0), "")
 		require.NoError(err)
@@ -52,7 +56,7 @@ func TestSend(t *testing.T) {
 		addr, err := wallet.NewAddress(w)
 		require.NoError(err)
 		nopPublish := func(string, []byte) error { return nil }
-		s := NewSender(repo, w, chainStore, msgPool, nopPublish)
+		s := NewSender(repo, w, chainStore, msgPool, core.NewMessageJournal(repo.Datastore()), nopPublish)
 
 		var wg sync.WaitGroup
 		addTwentyMessages := func(batch int) {
@@ -84,7 +88,115 @@ func TestSend(t *testing.T) {
 
 }
 
-func TestNextNonce(t *testing.T) {
+func TestReplace(t *testing.T) {
+	t.Parallel()
+
+	t.Run("replace swaps the pending message and calls publish", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx := context.Background()
+
+		repo, w, chainStore, msgPool := setupSendTest(require)
+		addr, err := wallet.NewAddress(w)
+		require.NoError(err)
+
+		publishCount := 0
+		publish := func(topic string, data []byte) error {
+			publishCount++
+			return nil
+		}
+
+		s := NewSender(repo, w, chainStore, msgPool, core.NewMessageJournal(repo.Datastore()), publish)
+		original, err := s.Send(ctx, addr, addr, types.NewAttoFILFromFIL(uint64(2)), types.NewGasPrice(10), types.NewGasUnits(100), "")
+		require.NoError(err)
+
+		replaced, err := s.Replace(ctx, original, types.NewGasPrice(20), types.NewGasUnits(100))
+		require.NoError(err)
+		assert.Equal(2, publishCount)
+
+		pending := msgPool.Pending()
+		require.Equal(1, len(pending))
+		c, err := pending[0].Cid()
+		require.NoError(err)
+		assert.Equal(replaced, c)
+		assert.Equal(types.NewGasPrice(20), pending[0].GasPrice)
+		assert.Equal(types.Uint64(0), pending[0].Nonce)
+	})
+
+	t.Run("replace fails for messages not in the pool", func(t *testing.T) {
+		require := require.New(t)
+
+		repo, w, chainStore, msgPool := setupSendTest(require)
+		nopPublish := func(string, []byte) error { return nil }
+		s := NewSender(repo, w, chainStore, msgPool, core.NewMessageJournal(repo.Datastore()), nopPublish)
+
+		_, err := s.Replace(context.Background(), types.SomeCid(), types.NewGasPrice(20), types.NewGasUnits(100))
+		require.Error(err)
+	})
+}
+
+func TestRepublish(t *testing.T) {
+	t.Parallel()
+
+	t.Run("republish restores journaled messages to the pool and publishes them", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx := context.Background()
+
+		repo, w, chainStore, msgPool := setupSendTest(require)
+		addr, err := wallet.NewAddress(w)
+		require.NoError(err)
+		journal := core.NewMessageJournal(repo.Datastore())
+
+		nopPublish := func(string, []byte) error { return nil }
+		sent, err := NewSender(repo, w, chainStore, msgPool, journal, nopPublish).Send(ctx, addr, addr, types.NewAttoFILFromFIL(uint64(2)), types.NewGasPrice(0), types.NewGasUnits(0), "")
+		require.NoError(err)
+
+		// a restarted node has an empty pool but the same journal
+		restartedPool := core.NewMessagePool(config.NewDefaultConfig().Mpool, core.NewMockMessagePoolValidator())
+		publishCalled := false
+		publish := func(topic string, data []byte) error {
+			assert.Equal(Topic, topic)
+			publishCalled = true
+			return nil
+		}
+		require.NoError(NewSender(repo, w, chainStore, restartedPool, journal, publish).Republish(ctx))
+
+		pending := restartedPool.Pending()
+		require.Equal(1, len(pending))
+		c, err := pending[0].Cid()
+		require.NoError(err)
+		assert.Equal(sent, c)
+		assert.True(publishCalled)
+	})
+
+	t.Run("republish drops messages that are no longer valid", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+		ctx := context.Background()
+
+		repo, w, chainStore, msgPool := setupSendTest(require)
+		addr, err := wallet.NewAddress(w)
+		require.NoError(err)
+		journal := core.NewMessageJournal(repo.Datastore())
+
+		nopPublish := func(string, []byte) error { return nil }
+		_, err = NewSender(repo, w, chainStore, msgPool, journal, nopPublish).Send(ctx, addr, addr, types.NewAttoFILFromFIL(uint64(2)), types.NewGasPrice(0), types.NewGasUnits(0), "")
+		require.NoError(err)
+
+		validator := core.NewMockMessagePoolValidator()
+		validator.Valid = false
+		restartedPool := core.NewMessagePool(config.NewDefaultConfig().Mpool, validator)
+		require.NoError(NewSender(repo, w, chainStore, restartedPool, journal, nopPublish).Republish(ctx))
+
+		assert.Equal(0, len(restartedPool.Pending()))
+		journaled, err := journal.Messages()
+		require.NoError(err)
+		assert.Equal(0, len(journaled))
+	})
+}
+
+func TestNonceStatus(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
@@ -93,19 +205,20 @@ func TestNextNonce(t *testing.T) {
 		assert := assert.New(t)
 		require := require.New(t)
 
-		_, _, chainStore, msgPool := setupSendTest(require)
+		repo, _, chainStore, msgPool := setupSendTest(require)
 
 		noActorAddress := address.NewForTestGetter()()
-		n, err := nextNonce(ctx, chainStore, msgPool, noActorAddress)
+		status, err := NewNonceManager(repo.Datastore(), chainStore, msgPool).Status(ctx, noActorAddress)
 		require.NoError(err)
-		assert.Equal(uint64(0), n)
+		assert.Equal(uint64(0), status.NextNonce)
+		assert.Empty(status.Gaps)
 	})
 
 	t.Run("account exists, largest value is in message pool", func(t *testing.T) {
 		assert := assert.New(t)
 		require := require.New(t)
 
-		_, w, chainStore, msgPool := setupSendTest(require)
+		repo, w, chainStore, msgPool := setupSendTest(require)
 		addr, err := wallet.NewAddress(w)
 		require.NoError(err)
 
@@ -115,13 +228,271 @@ func TestNextNonce(t *testing.T) {
 		assert.NoError(err)
 		core.MustAdd(msgPool, smsg)
 
-		nonce, err := nextNonce(ctx, chainStore, msgPool, addr)
+		status, err := NewNonceManager(repo.Datastore(), chainStore, msgPool).Status(ctx, addr)
 		assert.NoError(err)
-		assert.Equal(uint64(43), nonce)
+		assert.Equal(uint64(43), status.NextNonce)
+		assert.Equal([]uint64{42}, status.Pending)
+		assert.Len(status.Gaps, 42)
+	})
+
+	t.Run("reserved nonces survive restarts and show up as gaps once their messages are gone", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		repo, w, chainStore, msgPool := setupSendTest(require)
+		addr, err := wallet.NewAddress(w)
+		require.NoError(err)
+		nopPublish := func(string, []byte) error { return nil }
+
+		s := NewSender(repo, w, chainStore, msgPool, core.NewMessageJournal(repo.Datastore()), nopPublish)
+		for i := 0; i < 3; i++ {
+			_, err := s.Send(ctx, addr, addr, types.NewZeroAttoFIL(), types.NewGasPrice(0), types.NewGasUnits(0), "")
+			require.NoError(err)
+		}
+
+		// a restarted node has an empty pool but the same datastore
+		restartedPool := core.NewMessagePool(config.NewDefaultConfig().Mpool, core.NewMockMessagePoolValidator())
+		restarted := NewSender(repo, w, chainStore, restartedPool, core.NewMessageJournal(repo.Datastore()), nopPublish)
+
+		status, err := restarted.NonceStatus(ctx, addr)
+		require.NoError(err)
+		assert.Equal(uint64(0), status.ChainNonce)
+		assert.Equal(uint64(3), status.NextNonce)
+		assert.Empty(status.Pending)
+		assert.Equal([]uint64{0, 1, 2}, status.Gaps)
+
+		c, err := restarted.Send(ctx, addr, addr, types.NewZeroAttoFIL(), types.NewGasPrice(0), types.NewGasUnits(0), "")
+		require.NoError(err)
+		sent, ok := restartedPool.Get(c)
+		require.True(ok)
+		assert.Equal(types.Uint64(3), sent.Nonce)
+
+		// the journaled messages of the gaps went back into the pool
+		assert.Equal(4, len(restartedPool.Pending()))
+	})
+
+	t.Run("send restores journaled messages missing from the pool", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		repo, w, chainStore, msgPool := setupSendTest(require)
+		addr, err := wallet.NewAddress(w)
+		require.NoError(err)
+		nopPublish := func(string, []byte) error { return nil }
+
+		s := NewSender(repo, w, chainStore, msgPool, core.NewMessageJournal(repo.Datastore()), nopPublish)
+		var sent []cid.Cid
+		for i := 0; i < 3; i++ {
+			c, err := s.Send(ctx, addr, addr, types.NewZeroAttoFIL(), types.NewGasPrice(0), types.NewGasUnits(0), "")
+			require.NoError(err)
+			sent = append(sent, c)
+		}
+
+		// the message with nonce 1 disappears from the pool, e.g. because it expired
+		msgPool.Remove(sent[1])
+
+		c, err := s.Send(ctx, addr, addr, types.NewZeroAttoFIL(), types.NewGasPrice(0), types.NewGasUnits(0), "")
+		require.NoError(err)
+		next, ok := msgPool.Get(c)
+		require.True(ok)
+		assert.Equal(types.Uint64(3), next.Nonce)
+
+		_, ok = msgPool.Get(sent[1])
+		assert.True(ok)
+
+		status, err := s.NonceStatus(ctx, addr)
+		require.NoError(err)
+		assert.Empty(status.Gaps)
+	})
+
+	t.Run("send reuses nonces whose messages are neither pending nor journaled", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		repo, w, chainStore, msgPool := setupSendTest(require)
+		addr, err := wallet.NewAddress(w)
+		require.NoError(err)
+		journal := core.NewMessageJournal(repo.Datastore())
+		nopPublish := func(string, []byte) error { return nil }
+
+		s := NewSender(repo, w, chainStore, msgPool, journal, nopPublish)
+		var sent []cid.Cid
+		for i := 0; i < 2; i++ {
+			c, err := s.Send(ctx, addr, addr, types.NewZeroAttoFIL(), types.NewGasPrice(0), types.NewGasUnits(0), "")
+			require.NoError(err)
+			sent = append(sent, c)
+		}
+
+		msgPool.Remove(sent[0])
+		require.NoError(journal.Remove(sent[0]))
+
+		c, err := s.Send(ctx, addr, addr, types.NewZeroAttoFIL(), types.NewGasPrice(0), types.NewGasUnits(0), "")
+		require.NoError(err)
+		reused, ok := msgPool.Get(c)
+		require.True(ok)
+		assert.Equal(types.Uint64(0), reused.Nonce)
+
+		status, err := s.NonceStatus(ctx, addr)
+		require.NoError(err)
+		assert.Equal(uint64(2), status.NextNonce)
+		assert.Empty(status.Gaps)
+	})
+
+	t.Run("failed sends release their nonce", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		repo, w, chainStore, _ := setupSendTest(require)
+		addr, err := wallet.NewAddress(w)
+		require.NoError(err)
+		nopPublish := func(string, []byte) error { return nil }
+
+		validator := core.NewMockMessagePoolValidator()
+		validator.Valid = false
+		msgPool := core.NewMessagePool(config.NewDefaultConfig().Mpool, validator)
+		s := NewSender(repo, w, chainStore, msgPool, core.NewMessageJournal(repo.Datastore()), nopPublish)
+
+		_, err = s.Send(ctx, addr, addr, types.NewZeroAttoFIL(), types.NewGasPrice(0), types.NewGasUnits(0), "")
+		require.Error(err)
+
+		validator.Valid = true
+		c, err := s.Send(ctx, addr, addr, types.NewZeroAttoFIL(), types.NewGasPrice(0), types.NewGasUnits(0), "")
+		require.NoError(err)
+		sent, ok := msgPool.Get(c)
+		require.True(ok)
+		assert.Equal(types.Uint64(0), sent.Nonce)
+
+		status, err := s.NonceStatus(ctx, addr)
+		require.NoError(err)
+		assert.Empty(status.Gaps)
+	})
+}
+
+func TestResend(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("resend fills gaps with journaled messages and republishes pending ones", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		repo, w, chainStore, msgPool := setupSendTest(require)
+		addr, err := wallet.NewAddress(w)
+		require.NoError(err)
+		journal := core.NewMessageJournal(repo.Datastore())
+		nopPublish := func(string, []byte) error { return nil }
+
+		s := NewSender(repo, w, chainStore, msgPool, journal, nopPublish)
+		var sent []cid.Cid
+		for i := 0; i < 3; i++ {
+			c, err := s.Send(ctx, addr, addr, types.NewZeroAttoFIL(), types.NewGasPrice(0), types.NewGasUnits(0), "")
+			require.NoError(err)
+			sent = append(sent, c)
+		}
+
+		// the message with nonce 1 disappears from the pool, e.g. because it expired
+		msgPool.Remove(sent[1])
+
+		publishCount := 0
+		countingPublish := func(string, []byte) error {
+			publishCount++
+			return nil
+		}
+		resent, err := NewSender(repo, w, chainStore, msgPool, journal, countingPublish).Resend(ctx, addr, types.NewGasPrice(1), types.NewGasUnits(100))
+		require.NoError(err)
+		assert.Equal(sent, resent)
+		assert.Equal(3, publishCount)
+		assert.Equal(3, len(msgPool.Pending()))
 	})
+
+	t.Run("resend fills gaps without journaled messages with empty messages", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		repo, w, chainStore, msgPool := setupSendTest(require)
+		addr, err := wallet.NewAddress(w)
+		require.NoError(err)
+		journal := core.NewMessageJournal(repo.Datastore())
+		nopPublish := func(string, []byte) error { return nil }
+
+		s := NewSender(repo, w, chainStore, msgPool, journal, nopPublish)
+		var sent []cid.Cid
+		for i := 0; i < 2; i++ {
+			c, err := s.Send(ctx, addr, addr, types.NewAttoFILFromFIL(1), types.NewGasPrice(0), types.NewGasUnits(0), "")
+			require.NoError(err)
+			sent = append(sent, c)
+		}
+
+		msgPool.Remove(sent[0])
+		require.NoError(journal.Remove(sent[0]))
+
+		resent, err := s.Resend(ctx, addr, types.NewGasPrice(1), types.NewGasUnits(100))
+		require.NoError(err)
+		require.Equal(2, len(resent))
+		assert.Equal(sent[1], resent[1])
+
+		filler, ok := msgPool.Get(resent[0])
+		require.True(ok)
+		assert.Equal(types.Uint64(0), filler.Nonce)
+		assert.Equal(address.BurnAddress, filler.To)
+		assert.Equal(types.NewZeroAttoFIL(), filler.Value)
+		assert.Equal(types.NewGasPrice(1), filler.GasPrice)
+		assert.Equal(types.NewGasUnits(100), filler.GasLimit)
+
+		status, err := s.NonceStatus(ctx, addr)
+		require.NoError(err)
+		assert.Empty(status.Gaps)
+	})
+}
+
+func TestResendWithMessageValidator(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+	require := require.New(t)
+	ctx := context.Background()
+
+	// the sender needs funds in the genesis state to pass the validator
+	r := repo.NewInMemoryRepo()
+	backend, err := wallet.NewDSBackend(r.WalletDatastore())
+	require.NoError(err)
+	addr, err := wallet.NewAddress(wallet.New(backend))
+	require.NoError(err)
+	gif := consensus.MakeGenesisFunc(consensus.ActorAccount(addr, types.NewAttoFILFromFIL(100)))
+	d := requireCommonDepsWithGifAndBlockstore(require, gif, r, bstore.NewBlockstore(r.Datastore()))
+
+	var msgPool *core.MessagePool
+	validator := consensus.NewIngestionValidator(consensus.NewDefaultMessageValidator(), d.chainStore.LatestState, func(addr address.Address) []*types.SignedMessage {
+		return msgPool.PendingFrom(addr)
+	})
+	msgPool = core.NewMessagePool(config.NewDefaultConfig().Mpool, validator)
+	journal := core.NewMessageJournal(r.Datastore())
+	nopPublish := func(string, []byte) error { return nil }
+
+	s := NewSender(r, d.wallet, d.chainStore, msgPool, journal, nopPublish)
+	var sent []cid.Cid
+	for i := 0; i < 2; i++ {
+		c, err := s.Send(ctx, addr, address.TestAddress, types.NewAttoFILFromFIL(1), types.NewGasPrice(0), types.NewGasUnits(0), "")
+		require.NoError(err)
+		sent = append(sent, c)
+	}
+
+	msgPool.Remove(sent[0])
+	require.NoError(journal.Remove(sent[0]))
+
+	resent, err := s.Resend(ctx, addr, types.NewGasPrice(1), types.NewGasUnits(100))
+	require.NoError(err)
+	require.Equal(2, len(resent))
+	assert.Equal(sent[1], resent[1])
+
+	filler, ok := msgPool.Get(resent[0])
+	require.True(ok)
+	assert.Equal(types.Uint64(0), filler.Nonce)
+	assert.NotEqual(addr, filler.To)
 }
 
 func setupSendTest(require *require.Assertions) (repo.Repo, *wallet.Wallet, *chain.DefaultStore, *core.MessagePool) {
 	d := requireCommonDeps(require)
-	return d.repo, d.wallet, d.chainStore, core.NewMessagePool()
+	return d.repo, d.wallet, d.chainStore, core.NewMessagePool(config.NewDefaultConfig().Mpool, core.NewMockMessagePoolValidator())
 }
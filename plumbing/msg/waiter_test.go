@@ -47,12 +47,12 @@ type smsgsSet [][]*types.SignedMessage
 
 func setupTest(require *require.Assertions) (*hamt.CborIpldStore, *chain.DefaultStore, *Waiter) {
 	d := requireCommonDeps(require)
-	return d.cst, d.chainStore, NewWaiter(d.chainStore, d.blockstore, d.cst)
+	return d.cst, d.chainStore, NewWaiter(d.chainStore, NewMessageIndex(d.repo.Datastore(), d.chainStore, d.blockstore, d.cst))
 }
 
 func setupTestWithGif(require *require.Assertions, gif consensus.GenesisInitFunc) (*hamt.CborIpldStore, *chain.DefaultStore, *Waiter) {
 	d := requireCommonDepsWithGif(require, gif)
-	return d.cst, d.chainStore, NewWaiter(d.chainStore, d.blockstore, d.cst)
+	return d.cst, d.chainStore, NewWaiter(d.chainStore, NewMessageIndex(d.repo.Datastore(), d.chainStore, d.blockstore, d.cst))
 }
 
 func TestWait(t *testing.T) {
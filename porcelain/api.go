@@ -51,6 +51,24 @@ func (a *API) CreatePayments(ctx context.Context, config CreatePaymentsParams) (
 	return CreatePayments(ctx, a, config)
 }
 
+// GasPriceSuggest suggests a gas price for a new message based on the gas prices
+// of messages in recent tipsets
+func (a *API) GasPriceSuggest(ctx context.Context) (types.AttoFIL, error) {
+	return GasPriceSuggest(ctx, a)
+}
+
+// MessageEstimateGas estimates the gas limit for a message by previewing it
+// and adding a safety margin
+func (a *API) MessageEstimateGas(ctx context.Context, from, to address.Address, value *types.AttoFIL, method string, params ...interface{}) (types.GasUnits, error) {
+	return MessageEstimateGas(ctx, a, from, to, value, method, params...)
+}
+
+// MessageStatus returns where a message was included in the chain, or
+// whether it is waiting in the message pool
+func (a *API) MessageStatus(ctx context.Context, msgCid cid.Cid) (*MessageStatus, error) {
+	return MessageStatus(ctx, a, msgCid)
+}
+
 // MessageSendWithDefaultAddress calls MessageSend but with a default from
 // address if none is provided
 func (a *API) MessageSendWithDefaultAddress(
@@ -97,6 +115,11 @@ func (a *API) MinerGetOwnerAddress(ctx context.Context, minerAddr address.Addres
 	return MinerGetOwnerAddress(ctx, a, minerAddr)
 }
 
+// MinerGetWorkerAddress queries for the worker address of the given miner
+func (a *API) MinerGetWorkerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error) {
+	return MinerGetWorkerAddress(ctx, a, minerAddr)
+}
+
 // MinerGetPeerID queries for the peer id of the given miner
 func (a *API) MinerGetPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error) {
 	return MinerGetPeerID(ctx, a, minerAddr)
@@ -119,6 +142,82 @@ func (a *API) MinerPreviewSetPrice(
 	return MinerPreviewSetPrice(ctx, a, from, miner, price, expiry)
 }
 
+// MinerAddCollateral adds collateral to a miner. See implementation for details.
+func (a *API) MinerAddCollateral(ctx context.Context, from, miner address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, amount *types.AttoFIL) (cid.Cid, error) {
+	return MinerAddCollateral(ctx, a, from, miner, gasPrice, gasLimit, amount)
+}
+
+// MinerPreviewAddCollateral calculates the amount of Gas needed for a call to MinerAddCollateral.
+func (a *API) MinerPreviewAddCollateral(ctx context.Context, from, miner address.Address) (types.GasUnits, error) {
+	return MinerPreviewAddCollateral(ctx, a, from, miner)
+}
+
+// MinerWithdrawCollateral withdraws collateral from a miner. See implementation for details.
+func (a *API) MinerWithdrawCollateral(ctx context.Context, from, miner address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, amount *types.AttoFIL) (cid.Cid, error) {
+	return MinerWithdrawCollateral(ctx, a, from, miner, gasPrice, gasLimit, amount)
+}
+
+// MinerPreviewWithdrawCollateral calculates the amount of Gas needed for a call to MinerWithdrawCollateral.
+func (a *API) MinerPreviewWithdrawCollateral(ctx context.Context, from, miner address.Address, amount *types.AttoFIL) (types.GasUnits, error) {
+	return MinerPreviewWithdrawCollateral(ctx, a, from, miner, amount)
+}
+
+// MinerSetPledge changes the pledge of a miner. See implementation for details.
+func (a *API) MinerSetPledge(ctx context.Context, from, miner address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, pledge uint64) (cid.Cid, error) {
+	return MinerSetPledge(ctx, a, from, miner, gasPrice, gasLimit, pledge)
+}
+
+// MinerPreviewSetPledge calculates the amount of Gas needed for a call to MinerSetPledge.
+func (a *API) MinerPreviewSetPledge(ctx context.Context, from, miner address.Address, pledge uint64) (types.GasUnits, error) {
+	return MinerPreviewSetPledge(ctx, a, from, miner, pledge)
+}
+
+// MinerExit returns the collateral of a miner to its owner. See implementation for details.
+func (a *API) MinerExit(ctx context.Context, from, miner address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	return MinerExit(ctx, a, from, miner, gasPrice, gasLimit)
+}
+
+// MinerPreviewExit calculates the amount of Gas needed for a call to MinerExit.
+func (a *API) MinerPreviewExit(ctx context.Context, from, miner address.Address) (types.GasUnits, error) {
+	return MinerPreviewExit(ctx, a, from, miner)
+}
+
+// MinerChangeWorker replaces the worker of a miner. See implementation for details.
+func (a *API) MinerChangeWorker(ctx context.Context, from, miner address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, worker address.Address) (cid.Cid, error) {
+	return MinerChangeWorker(ctx, a, from, miner, gasPrice, gasLimit, worker)
+}
+
+// MinerPreviewChangeWorker calculates the amount of Gas needed for a call to MinerChangeWorker.
+func (a *API) MinerPreviewChangeWorker(ctx context.Context, from, miner, worker address.Address) (types.GasUnits, error) {
+	return MinerPreviewChangeWorker(ctx, a, from, miner, worker)
+}
+
+// MinerProposeOwner proposes a new owner for a miner. See implementation for details.
+func (a *API) MinerProposeOwner(ctx context.Context, from, miner address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, owner address.Address) (cid.Cid, error) {
+	return MinerProposeOwner(ctx, a, from, miner, gasPrice, gasLimit, owner)
+}
+
+// MinerPreviewProposeOwner calculates the amount of Gas needed for a call to MinerProposeOwner.
+func (a *API) MinerPreviewProposeOwner(ctx context.Context, from, miner, owner address.Address) (types.GasUnits, error) {
+	return MinerPreviewProposeOwner(ctx, a, from, miner, owner)
+}
+
+// MinerAcceptOwner accepts the transfer of a miner. See implementation for details.
+func (a *API) MinerAcceptOwner(ctx context.Context, from, miner address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	return MinerAcceptOwner(ctx, a, from, miner, gasPrice, gasLimit)
+}
+
+// MinerPreviewAcceptOwner calculates the amount of Gas needed for a call to MinerAcceptOwner.
+func (a *API) MinerPreviewAcceptOwner(ctx context.Context, from, miner address.Address) (types.GasUnits, error) {
+	return MinerPreviewAcceptOwner(ctx, a, from, miner)
+}
+
+// WalletRestore rebuilds the addresses derived from the seed of mnemonic
+// that have on-chain activity
+func (a *API) WalletRestore(ctx context.Context, mnemonic string) error {
+	return WalletRestore(ctx, a, mnemonic)
+}
+
 // GetAndMaybeSetDefaultSenderAddress returns a default address from which to
 // send messsages. If none is set it picks the first address in the wallet and
 // sets it as the default in the config.
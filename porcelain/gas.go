@@ -0,0 +1,78 @@
+package porcelain
+
+import (
+	"context"
+	"sort"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// GasEstimateMarginPercent is the margin, in percent of the gas a preview of a
+// message uses, that MessageEstimateGas adds to its estimate in case the state
+// changes before the message is applied.
+const GasEstimateMarginPercent = 20
+
+// GasPriceSampleTipSets is the number of most recent tipsets GasPriceSuggest
+// samples the gas prices of.
+const GasPriceSampleTipSets = 10
+
+// megAPI is the subset of the plumbing.API that MessageEstimateGas uses.
+type megAPI interface {
+	MessagePreviewWithValue(ctx context.Context, from, to address.Address, value *types.AttoFIL, method string, params ...interface{}) (types.GasUnits, error)
+}
+
+// MessageEstimateGas estimates the gas limit for a message transferring value,
+// which may be nil, by previewing it against the head state and adding
+// GasEstimateMarginPercent to the gas it used.
+func MessageEstimateGas(ctx context.Context, plumbing megAPI, from, to address.Address, value *types.AttoFIL, method string, params ...interface{}) (types.GasUnits, error) {
+	used, err := plumbing.MessagePreviewWithValue(ctx, from, to, value, method, params...)
+	if err != nil {
+		return types.NewGasUnits(0), errors.Wrap(err, "failed to preview message")
+	}
+
+	margin := (uint64(used)*GasEstimateMarginPercent + 99) / 100
+	return types.NewGasUnits(uint64(used) + margin), nil
+}
+
+// gpsAPI is the subset of the plumbing.API that GasPriceSuggest uses.
+type gpsAPI interface {
+	ChainLs(ctx context.Context) <-chan interface{}
+}
+
+// GasPriceSuggest suggests a gas price for a new message: the median gas price
+// of the messages in the most recent GasPriceSampleTipSets tipsets. It
+// suggests zero if those tipsets contain no messages.
+func GasPriceSuggest(ctx context.Context, plumbing gpsAPI) (types.AttoFIL, error) {
+	lsCtx, cancelLs := context.WithCancel(ctx)
+	defer cancelLs()
+
+	var prices []*types.AttoFIL
+	sampled := 0
+	for raw := range plumbing.ChainLs(lsCtx) {
+		switch v := raw.(type) {
+		case error:
+			return *types.NewZeroAttoFIL(), errors.Wrap(v, "failed to walk chain")
+		case types.TipSet:
+			for _, blk := range v {
+				for _, msg := range blk.Messages {
+					prices = append(prices, &msg.GasPrice)
+				}
+			}
+		}
+
+		sampled++
+		if sampled >= GasPriceSampleTipSets {
+			break
+		}
+	}
+
+	if len(prices) == 0 {
+		return *types.NewZeroAttoFIL(), nil
+	}
+
+	sort.Slice(prices, func(i, j int) bool { return prices[i].LessThan(prices[j]) })
+	return *prices[len(prices)/2], nil
+}
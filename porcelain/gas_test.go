@@ -0,0 +1,152 @@
+package porcelain_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+type fakeMessageEstimateGasPlumbing struct {
+	used  types.GasUnits
+	err   error
+	value *types.AttoFIL
+}
+
+func (fmegp *fakeMessageEstimateGasPlumbing) MessagePreviewWithValue(ctx context.Context, from, to address.Address, value *types.AttoFIL, method string, params ...interface{}) (types.GasUnits, error) {
+	fmegp.value = value
+	return fmegp.used, fmegp.err
+}
+
+func TestMessageEstimateGas(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	addr := address.NewForTestGetter()()
+
+	t.Run("adds a margin to the previewed gas", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		fp := &fakeMessageEstimateGasPlumbing{used: types.NewGasUnits(100)}
+		estimate, err := porcelain.MessageEstimateGas(ctx, fp, addr, addr, nil, "foo")
+		require.NoError(err)
+		assert.Equal(types.NewGasUnits(100+porcelain.GasEstimateMarginPercent), estimate)
+	})
+
+	t.Run("rounds the margin up", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		fp := &fakeMessageEstimateGasPlumbing{used: types.NewGasUnits(1)}
+		estimate, err := porcelain.MessageEstimateGas(ctx, fp, addr, addr, nil, "foo")
+		require.NoError(err)
+		assert.Equal(types.NewGasUnits(2), estimate)
+	})
+
+	t.Run("previews the value of the message", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		fp := &fakeMessageEstimateGasPlumbing{used: types.NewGasUnits(100)}
+		_, err := porcelain.MessageEstimateGas(ctx, fp, addr, addr, types.NewAttoFILFromFIL(3), "foo")
+		require.NoError(err)
+		assert.Equal(types.NewAttoFILFromFIL(3), fp.value)
+	})
+
+	t.Run("fails if the preview fails", func(t *testing.T) {
+		fp := &fakeMessageEstimateGasPlumbing{err: errors.New("boom")}
+		_, err := porcelain.MessageEstimateGas(ctx, fp, addr, addr, nil, "foo")
+		assert.Error(t, err)
+	})
+}
+
+type fakeGasPriceSuggestPlumbing struct {
+	chain []interface{}
+}
+
+func (fgpsp *fakeGasPriceSuggestPlumbing) ChainLs(ctx context.Context) <-chan interface{} {
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		for _, raw := range fgpsp.chain {
+			select {
+			case <-ctx.Done():
+				return
+			case out <- raw:
+			}
+		}
+	}()
+	return out
+}
+
+func TestGasPriceSuggest(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ki := types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed())
+	mockSigner := types.NewMockSigner(ki)
+
+	tipSetWithPrices := func(require *require.Assertions, height uint64, prices ...int64) types.TipSet {
+		var msgs []*types.SignedMessage
+		for i, price := range prices {
+			msg := types.NewMessage(mockSigner.Addresses[0], address.NewForTestGetter()(), uint64(i), types.NewAttoFILFromFIL(0), "", nil)
+			smsg, err := types.NewSignedMessage(*msg, mockSigner, types.NewGasPrice(price), types.NewGasUnits(0))
+			require.NoError(err)
+			msgs = append(msgs, smsg)
+		}
+		return types.RequireNewTipSet(require, &types.Block{Height: types.Uint64(height), Messages: msgs})
+	}
+
+	t.Run("suggests the median price of recent messages", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		fp := &fakeGasPriceSuggestPlumbing{chain: []interface{}{
+			tipSetWithPrices(require, 3, 5, 1),
+			tipSetWithPrices(require, 2),
+			tipSetWithPrices(require, 1, 3),
+		}}
+		price, err := porcelain.GasPriceSuggest(ctx, fp)
+		require.NoError(err)
+		assert.Equal(types.NewGasPrice(3), price)
+	})
+
+	t.Run("only samples the most recent tipsets", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		var chain []interface{}
+		for i := 0; i < porcelain.GasPriceSampleTipSets; i++ {
+			chain = append(chain, tipSetWithPrices(require, uint64(100-i), 7))
+		}
+		chain = append(chain, tipSetWithPrices(require, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1))
+
+		fp := &fakeGasPriceSuggestPlumbing{chain: chain}
+		price, err := porcelain.GasPriceSuggest(ctx, fp)
+		require.NoError(err)
+		assert.Equal(types.NewGasPrice(7), price)
+	})
+
+	t.Run("suggests zero without messages", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		fp := &fakeGasPriceSuggestPlumbing{chain: []interface{}{tipSetWithPrices(require, 1)}}
+		price, err := porcelain.GasPriceSuggest(ctx, fp)
+		require.NoError(err)
+		assert.True(price.IsZero())
+	})
+
+	t.Run("fails if the chain can not be walked", func(t *testing.T) {
+		fp := &fakeGasPriceSuggestPlumbing{chain: []interface{}{errors.New("boom")}}
+		_, err := porcelain.GasPriceSuggest(ctx, fp)
+		assert.Error(t, err)
+	})
+}
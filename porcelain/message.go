@@ -7,6 +7,7 @@ import (
 	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/plumbing/msg"
 	"github.com/filecoin-project/go-filecoin/types"
 )
 
@@ -78,3 +79,29 @@ func GetAndMaybeSetDefaultSenderAddress(plumbing gamsdsaAPI) (address.Address, e
 
 	return address.Address{}, ErrNoDefaultFromAddress
 }
+
+// MessageStatus describes where a message is.
+type MessageStatus struct {
+	// Location is where the message was included in the chain, nil if it
+	// is not in the chain.
+	Location *msg.MessageLocation
+	// Pending is whether the message is waiting in the message pool.
+	Pending bool
+}
+
+// msAPI is the subset of the plumbing.API that MessageStatus uses.
+type msAPI interface {
+	MessageFind(ctx context.Context, msgCid cid.Cid) (*msg.MessageLocation, error)
+	MessagePoolGet(msgCid cid.Cid) (*types.SignedMessage, bool)
+}
+
+// MessageStatus returns where the message with the given cid was included in
+// the chain, or whether it is waiting in the message pool.
+func MessageStatus(ctx context.Context, plumbing msAPI, msgCid cid.Cid) (*MessageStatus, error) {
+	loc, err := plumbing.MessageFind(ctx, msgCid)
+	if err != nil {
+		return nil, err
+	}
+	_, pending := plumbing.MessagePoolGet(msgCid)
+	return &MessageStatus{Location: loc, Pending: pending}, nil
+}
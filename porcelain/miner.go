@@ -214,6 +214,21 @@ func MinerGetOwnerAddress(ctx context.Context, plumbing mgoaAPI, minerAddr addre
 	return address.NewFromBytes(res[0])
 }
 
+// mgwaAPI is the subset of the plumbing.API that MinerGetWorkerAddress uses.
+type mgwaAPI interface {
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
+}
+
+// MinerGetWorkerAddress queries for the worker address of the given miner
+func MinerGetWorkerAddress(ctx context.Context, plumbing mgwaAPI, minerAddr address.Address) (address.Address, error) {
+	res, _, err := plumbing.MessageQuery(ctx, address.Address{}, minerAddr, "getWorker")
+	if err != nil {
+		return address.Address{}, err
+	}
+
+	return address.NewFromBytes(res[0])
+}
+
 // mgaAPI is the subset of the plumbing.API that MinerGetAsk uses.
 type mgaAPI interface {
 	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
@@ -252,3 +267,165 @@ func MinerGetPeerID(ctx context.Context, plumbing mgpidAPI, minerAddr address.Ad
 	}
 	return pid, nil
 }
+
+// minerConfigAPI is the subset of the plumbing.API that minerAddressOrDefault uses.
+type minerConfigAPI interface {
+	ConfigGet(dottedPath string) (interface{}, error)
+}
+
+// minerSendAPI is the subset of the plumbing.API that the methods sending a message to a miner and waiting for
+// it use.
+type minerSendAPI interface {
+	ConfigGet(dottedPath string) (interface{}, error)
+	MessageSendWithDefaultAddress(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
+	MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error
+}
+
+// minerPreviewAPI is the subset of the plumbing.API that the methods previewing a message to a miner use.
+type minerPreviewAPI interface {
+	ConfigGet(dottedPath string) (interface{}, error)
+	MessagePreview(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) (types.GasUnits, error)
+}
+
+// MinerAddCollateral sends amount to the miner as additional collateral and waits for the message to be mined.
+// If minerAddr is empty, the default miner will be used.
+func MinerAddCollateral(ctx context.Context, plumbing minerSendAPI, from, minerAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, amount *types.AttoFIL) (cid.Cid, error) {
+	return minerSendAndWait(ctx, plumbing, from, minerAddr, amount, gasPrice, gasLimit, "addCollateral")
+}
+
+// MinerPreviewAddCollateral calculates the amount of Gas needed for a call to MinerAddCollateral.
+func MinerPreviewAddCollateral(ctx context.Context, plumbing minerPreviewAPI, from, minerAddr address.Address) (types.GasUnits, error) {
+	return minerPreview(ctx, plumbing, from, minerAddr, "addCollateral")
+}
+
+// MinerWithdrawCollateral withdraws amount of the miner's collateral to its owner and waits for the message to be
+// mined. Only collateral that does not back the miner's pledge can be withdrawn.
+// If minerAddr is empty, the default miner will be used.
+func MinerWithdrawCollateral(ctx context.Context, plumbing minerSendAPI, from, minerAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, amount *types.AttoFIL) (cid.Cid, error) {
+	return minerSendAndWait(ctx, plumbing, from, minerAddr, types.NewZeroAttoFIL(), gasPrice, gasLimit, "withdrawCollateral", amount)
+}
+
+// MinerPreviewWithdrawCollateral calculates the amount of Gas needed for a call to MinerWithdrawCollateral.
+func MinerPreviewWithdrawCollateral(ctx context.Context, plumbing minerPreviewAPI, from, minerAddr address.Address, amount *types.AttoFIL) (types.GasUnits, error) {
+	return minerPreview(ctx, plumbing, from, minerAddr, "withdrawCollateral", amount)
+}
+
+// MinerSetPledge changes the number of sectors the miner pledges and waits for the message to be mined. The
+// miner's collateral must cover the new pledge, which can not be lower than the storage market's minimum or the
+// number of committed sectors.
+// If minerAddr is empty, the default miner will be used.
+func MinerSetPledge(ctx context.Context, plumbing minerSendAPI, from, minerAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, pledge uint64) (cid.Cid, error) {
+	return minerSendAndWait(ctx, plumbing, from, minerAddr, types.NewZeroAttoFIL(), gasPrice, gasLimit, "setPledge", big.NewInt(0).SetUint64(pledge))
+}
+
+// MinerPreviewSetPledge calculates the amount of Gas needed for a call to MinerSetPledge.
+func MinerPreviewSetPledge(ctx context.Context, plumbing minerPreviewAPI, from, minerAddr address.Address, pledge uint64) (types.GasUnits, error) {
+	return minerPreview(ctx, plumbing, from, minerAddr, "setPledge", big.NewInt(0).SetUint64(pledge))
+}
+
+// MinerExit returns all of the miner's collateral to its owner, removes the miner from the storage market and waits
+// for the message to be mined. Every deal committed to the miner's sectors must have expired.
+// If minerAddr is empty, the default miner will be used.
+func MinerExit(ctx context.Context, plumbing minerSendAPI, from, minerAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	return minerSendAndWait(ctx, plumbing, from, minerAddr, types.NewZeroAttoFIL(), gasPrice, gasLimit, "exit")
+}
+
+// MinerPreviewExit calculates the amount of Gas needed for a call to MinerExit.
+func MinerPreviewExit(ctx context.Context, plumbing minerPreviewAPI, from, minerAddr address.Address) (types.GasUnits, error) {
+	return minerPreview(ctx, plumbing, from, minerAddr, "exit")
+}
+
+// MinerChangeWorker replaces the miner's worker and waits for the message to be mined. It must be sent by the
+// miner's owner.
+// If minerAddr is empty, the default miner will be used.
+func MinerChangeWorker(ctx context.Context, plumbing minerSendAPI, from, minerAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, worker address.Address) (cid.Cid, error) {
+	return minerSendAndWait(ctx, plumbing, from, minerAddr, types.NewZeroAttoFIL(), gasPrice, gasLimit, "changeWorker", worker)
+}
+
+// MinerPreviewChangeWorker calculates the amount of Gas needed for a call to MinerChangeWorker.
+func MinerPreviewChangeWorker(ctx context.Context, plumbing minerPreviewAPI, from, minerAddr, worker address.Address) (types.GasUnits, error) {
+	return minerPreview(ctx, plumbing, from, minerAddr, "changeWorker", worker)
+}
+
+// MinerProposeOwner proposes to transfer the miner to a new owner and waits for the message to be mined. The
+// transfer completes once the new owner accepts it with MinerAcceptOwner.
+// If minerAddr is empty, the default miner will be used.
+func MinerProposeOwner(ctx context.Context, plumbing minerSendAPI, from, minerAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits, owner address.Address) (cid.Cid, error) {
+	return minerSendAndWait(ctx, plumbing, from, minerAddr, types.NewZeroAttoFIL(), gasPrice, gasLimit, "proposeOwner", owner)
+}
+
+// MinerPreviewProposeOwner calculates the amount of Gas needed for a call to MinerProposeOwner.
+func MinerPreviewProposeOwner(ctx context.Context, plumbing minerPreviewAPI, from, minerAddr, owner address.Address) (types.GasUnits, error) {
+	return minerPreview(ctx, plumbing, from, minerAddr, "proposeOwner", owner)
+}
+
+// MinerAcceptOwner accepts a proposed transfer of the miner and waits for the message to be mined. It must be
+// sent from the proposed owner.
+// If minerAddr is empty, the default miner will be used.
+func MinerAcceptOwner(ctx context.Context, plumbing minerSendAPI, from, minerAddr address.Address, gasPrice types.AttoFIL, gasLimit types.GasUnits) (cid.Cid, error) {
+	return minerSendAndWait(ctx, plumbing, from, minerAddr, types.NewZeroAttoFIL(), gasPrice, gasLimit, "acceptOwner")
+}
+
+// MinerPreviewAcceptOwner calculates the amount of Gas needed for a call to MinerAcceptOwner.
+func MinerPreviewAcceptOwner(ctx context.Context, plumbing minerPreviewAPI, from, minerAddr address.Address) (types.GasUnits, error) {
+	return minerPreview(ctx, plumbing, from, minerAddr, "acceptOwner")
+}
+
+// minerSendAndWait sends a message to the miner and waits for it to be mined, returning the error of the miner
+// actor if the message failed.
+func minerSendAndWait(ctx context.Context, plumbing minerSendAPI, from, minerAddr address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error) {
+	minerAddr, err := minerAddressOrDefault(plumbing, minerAddr)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	msgCid, err := plumbing.MessageSendWithDefaultAddress(ctx, from, minerAddr, value, gasPrice, gasLimit, method, params...)
+	if err != nil {
+		return cid.Undef, errors.Wrap(err, "couldn't send message")
+	}
+
+	err = plumbing.MessageWait(ctx, msgCid, func(blk *types.Block, smsg *types.SignedMessage, receipt *types.MessageReceipt) error {
+		if receipt.ExitCode != uint8(0) {
+			return vmErrors.VMExitCodeToError(receipt.ExitCode, minerActor.Errors)
+		}
+		return nil
+	})
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	return msgCid, nil
+}
+
+// minerPreview calculates the amount of Gas needed to send a message to the miner.
+func minerPreview(ctx context.Context, plumbing minerPreviewAPI, from, minerAddr address.Address, method string, params ...interface{}) (types.GasUnits, error) {
+	minerAddr, err := minerAddressOrDefault(plumbing, minerAddr)
+	if err != nil {
+		return types.NewGasUnits(0), err
+	}
+
+	usedGas, err := plumbing.MessagePreview(ctx, from, minerAddr, method, params...)
+	if err != nil {
+		return types.NewGasUnits(0), errors.Wrap(err, "couldn't preview message")
+	}
+
+	return usedGas, nil
+}
+
+// minerAddressOrDefault returns minerAddr, or the configured miner address if minerAddr is empty.
+func minerAddressOrDefault(plumbing minerConfigAPI, minerAddr address.Address) (address.Address, error) {
+	if !minerAddr.Empty() {
+		return minerAddr, nil
+	}
+
+	minerValue, err := plumbing.ConfigGet("mining.minerAddress")
+	if err != nil {
+		return address.Address{}, errors.Wrap(err, "Could not get miner address in config")
+	}
+	configuredAddr, ok := minerValue.(address.Address)
+	if !ok || configuredAddr.Empty() {
+		return address.Address{}, errors.New("Configured miner is not an address")
+	}
+
+	return configuredAddr, nil
+}
@@ -418,3 +418,66 @@ func requirePeerID() peer.ID {
 	}
 	return id
 }
+
+func TestMinerCollateralAndPledge(t *testing.T) {
+	t.Run("sends collateral as the value of the message", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		plumbing := newMinerSetPricePlumbing(assert, require)
+		minerAddr := address.NewForTestGetter()()
+		amount := types.NewAttoFILFromFIL(10)
+
+		plumbing.messageSend = func(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error) {
+			assert.Equal(minerAddr, to)
+			assert.Equal("addCollateral", method)
+			assert.True(amount.Equal(value))
+			return types.NewCidForTestGetter()(), nil
+		}
+
+		msgCid, err := MinerAddCollateral(context.Background(), plumbing, address.Address{}, minerAddr, types.NewGasPrice(0), types.NewGasUnits(0), amount)
+		require.NoError(err)
+		assert.Equal(plumbing.msgCid, msgCid)
+	})
+
+	t.Run("sets pledge of the default miner", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		plumbing := newMinerSetPricePlumbing(assert, require)
+		minerAddr := address.NewForTestGetter()()
+		require.NoError(plumbing.config.Set("mining.minerAddress", minerAddr.String()))
+
+		plumbing.messageSend = func(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error) {
+			assert.Equal(minerAddr, to)
+			assert.Equal("setPledge", method)
+			assert.Equal(big.NewInt(20), params[0])
+			return types.NewCidForTestGetter()(), nil
+		}
+
+		_, err := MinerSetPledge(context.Background(), plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), 20)
+		require.NoError(err)
+	})
+
+	t.Run("reports error when there is no miner", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		plumbing := newMinerSetPricePlumbing(assert, require)
+
+		_, err := MinerWithdrawCollateral(context.Background(), plumbing, address.Address{}, address.Address{}, types.NewGasPrice(0), types.NewGasUnits(0), types.NewAttoFILFromFIL(1))
+		require.Error(err)
+		assert.Contains(err.Error(), "Configured miner is not an address")
+	})
+
+	t.Run("previews the gas of an exit", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		plumbing := newMinerPreviewCreate(require)
+
+		usedGas, err := MinerPreviewExit(context.Background(), plumbing, address.Address{}, address.NewForTestGetter()())
+		require.NoError(err)
+		assert.Equal(types.NewGasUnits(5), usedGas)
+	})
+}
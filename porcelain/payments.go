@@ -24,7 +24,8 @@ type cpPlumbing interface {
 	SignBytes(data []byte, addr address.Address) (types.Signature, error)
 }
 
-// CreatePaymentsParams structures all the parameters for the CreatePayments command. All values are required.
+// CreatePaymentsParams structures all the parameters for the CreatePayments command. All values but Channel,
+// Lane and Condition are required.
 // The first payment will be valid at PaymentStart+PaymentInterval. Payment voucher will be created for every
 // PaymentInterval after that until PaymentStart+Duration is reached.
 // ChannelExpiry is when the channel closes and must be after the final payment is valid.
@@ -53,6 +54,18 @@ type CreatePaymentsParams struct {
 
 	// GasLimit is the maximum amount of gas to be paid creating the payment channel.
 	GasLimit types.GasUnits
+
+	// Condition is optional. If set, the target may only redeem the vouchers
+	// while it succeeds.
+	Condition *paymentbroker.Condition
+
+	// Channel is optional. If set, the payments are made on Lane of this
+	// existing channel instead of a new one, which must hold Value for them.
+	Channel *types.ChannelID
+
+	// Lane is the lane of the channel the vouchers pay on. Payments for
+	// different deals on the same channel must use different lanes.
+	Lane uint64
 }
 
 // CreatePaymentsReturn collects relevant stats from the create payments process
@@ -102,31 +115,10 @@ func CreatePayments(ctx context.Context, plumbing cpPlumbing, config CreatePayme
 		CreatePaymentsParams: config,
 	}
 
-	// Create channel
-	response.ChannelMsgCid, err = plumbing.MessageSend(ctx,
-		config.From,
-		address.PaymentBrokerAddress,
-		&config.Value,
-		config.GasPrice,
-		config.GasLimit,
-		"createChannel",
-		config.To,
-		&config.ChannelExpiry)
-	if err != nil {
-		return response, err
-	}
-
-	// wait for response
-	err = plumbing.MessageWait(ctx, response.ChannelMsgCid, func(block *types.Block, message *types.SignedMessage, receipt *types.MessageReceipt) error {
-		if receipt.ExitCode != 0 {
-			return fmt.Errorf("createChannel failed %d", receipt.ExitCode)
-		}
-
-		response.Channel = types.NewChannelIDFromBytes(receipt.Return[0])
-		response.GasAttoFIL = receipt.GasAttoFIL
-		return nil
-	})
-	if err != nil {
+	if config.Channel != nil {
+		response.Channel = config.Channel
+		response.GasAttoFIL = types.NewZeroAttoFIL()
+	} else if err := createChannel(ctx, plumbing, response); err != nil {
 		return response, err
 	}
 
@@ -163,6 +155,34 @@ func CreatePayments(ctx context.Context, plumbing cpPlumbing, config CreatePayme
 	return response, nil
 }
 
+// createChannel creates the payment channel the payments are made on.
+func createChannel(ctx context.Context, plumbing cpPlumbing, response *CreatePaymentsReturn) error {
+	var err error
+	response.ChannelMsgCid, err = plumbing.MessageSend(ctx,
+		response.From,
+		address.PaymentBrokerAddress,
+		&response.Value,
+		response.GasPrice,
+		response.GasLimit,
+		"createChannel",
+		response.To,
+		&response.ChannelExpiry)
+	if err != nil {
+		return err
+	}
+
+	// wait for response
+	return plumbing.MessageWait(ctx, response.ChannelMsgCid, func(block *types.Block, message *types.SignedMessage, receipt *types.MessageReceipt) error {
+		if receipt.ExitCode != 0 {
+			return fmt.Errorf("createChannel failed %d", receipt.ExitCode)
+		}
+
+		response.Channel = types.NewChannelIDFromBytes(receipt.Return[0])
+		response.GasAttoFIL = receipt.GasAttoFIL
+		return nil
+	})
+}
+
 func createPayment(ctx context.Context, plumbing cpPlumbing, response *CreatePaymentsReturn, amount *types.AttoFIL, validAt *types.BlockHeight) error {
 	ret, _, err := plumbing.MessageQuery(ctx,
 		response.From,
@@ -180,7 +200,10 @@ func createPayment(ctx context.Context, plumbing cpPlumbing, response *CreatePay
 		return err
 	}
 
-	sig, err := paymentbroker.SignVoucher(&voucher.Channel, amount, validAt, voucher.Payer, plumbing)
+	voucher.Lane = response.Lane
+	voucher.Condition = response.Condition
+
+	sig, err := paymentbroker.SignVoucher(&voucher, plumbing)
 	if err != nil {
 		return err
 	}
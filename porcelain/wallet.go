@@ -0,0 +1,30 @@
+package porcelain
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/state"
+)
+
+type wrPlumbing interface {
+	ActorGet(ctx context.Context, addr address.Address) (*actor.Actor, error)
+	WalletRestoreMnemonic(mnemonic string, used func(address.Address) (bool, error)) error
+}
+
+// WalletRestore rebuilds the addresses derived from the seed of mnemonic
+// that have an actor in the latest state, and makes the wallet derive new
+// addresses after them.
+func WalletRestore(ctx context.Context, plumbing wrPlumbing, mnemonic string) error {
+	return plumbing.WalletRestoreMnemonic(mnemonic, func(addr address.Address) (bool, error) {
+		_, err := plumbing.ActorGet(ctx, addr)
+		if state.IsActorNotFoundError(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+}
@@ -0,0 +1,78 @@
+package porcelain_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/porcelain"
+)
+
+type actorNotFoundError struct{}
+
+func (actorNotFoundError) Error() string       { return "actor not found" }
+func (actorNotFoundError) ActorNotFound() bool { return true }
+
+type fakeWalletRestorePlumbing struct {
+	actors    map[address.Address]*actor.Actor
+	err       error
+	candidate []address.Address
+	used      []address.Address
+}
+
+func (fwrp *fakeWalletRestorePlumbing) ActorGet(ctx context.Context, addr address.Address) (*actor.Actor, error) {
+	if fwrp.err != nil {
+		return nil, fwrp.err
+	}
+	act, ok := fwrp.actors[addr]
+	if !ok {
+		return nil, actorNotFoundError{}
+	}
+	return act, nil
+}
+
+func (fwrp *fakeWalletRestorePlumbing) WalletRestoreMnemonic(mnemonic string, used func(address.Address) (bool, error)) error {
+	for _, addr := range fwrp.candidate {
+		ok, err := used(addr)
+		if err != nil {
+			return err
+		}
+		if ok {
+			fwrp.used = append(fwrp.used, addr)
+		}
+	}
+	return nil
+}
+
+func TestWalletRestore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	addrGetter := address.NewForTestGetter()
+	active, inactive := addrGetter(), addrGetter()
+
+	t.Run("imports addresses with an actor", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		fp := &fakeWalletRestorePlumbing{
+			actors:    map[address.Address]*actor.Actor{active: {}},
+			candidate: []address.Address{inactive, active},
+		}
+		require.NoError(porcelain.WalletRestore(ctx, fp, "mnemonic"))
+		assert.Equal([]address.Address{active}, fp.used)
+	})
+
+	t.Run("fails if the state can not be read", func(t *testing.T) {
+		fp := &fakeWalletRestorePlumbing{
+			err:       errors.New("boom"),
+			candidate: []address.Address{active},
+		}
+		assert.Error(t, porcelain.WalletRestore(ctx, fp, "mnemonic"))
+	})
+}
@@ -0,0 +1,348 @@
+package blocksync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	net "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
+	peer "gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+	host "gx/ipfs/Qmd52WKRSwrBK5gUaJKawryZQ5by6UbNB8KVW2Zy6JtbyW/go-libp2p-host"
+
+	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// protocol is the libp2p protocol identifier for the block sync protocol.
+const protocol = "/fil/sync/blk/1.0.0"
+
+// MaxRequestLength is the largest number of tipsets a peer returns in
+// response to a single request.
+const MaxRequestLength = 100
+
+const (
+	// rateLimitRequests is the number of requests a peer may make every
+	// rateLimitPeriod.
+	rateLimitRequests = 20
+	rateLimitPeriod   = 10 * time.Second
+
+	// fetchTimeout is how long a fetch waits for a peer to send a run of
+	// tipsets.
+	fetchTimeout = 30 * time.Second
+)
+
+var log = logging.Logger("/fil/sync/blk")
+
+// chainReader is the subset of the chain.ReadStore the Handler serves blocks
+// from.
+type chainReader interface {
+	GetBlock(ctx context.Context, id cid.Cid) (*types.Block, error)
+}
+
+// Handler implements the block sync protocol. Peers use it to fetch a run of
+// tipsets, with their messages and receipts, in a single request instead of
+// resolving the blocks one by one over bitswap. The Handler serves requests
+// from the node's chain, limiting how many requests each peer can make, and
+// fetches tipsets from the peers that told the node about the heaviest
+// chains in their hello messages.
+type Handler struct {
+	host  host.Host
+	chain chainReader
+
+	limiter *rateLimiter
+
+	// peers are the heights of the heaviest tipsets of the peers to fetch
+	// tipsets from.
+	peers   map[peer.ID]uint64
+	peersLk sync.Mutex
+}
+
+// New creates a new instance of the block sync protocol and registers it to
+// the given host.
+func New(h host.Host, chain chainReader) *Handler {
+	handler := &Handler{
+		host:    h,
+		chain:   chain,
+		limiter: newRateLimiter(rateLimitRequests, rateLimitPeriod),
+		peers:   make(map[peer.ID]uint64),
+	}
+	h.SetStreamHandler(protocol, handler.handleNewStream)
+
+	return handler
+}
+
+// AddPeer records the height of the heaviest tipset of a peer, as told in its
+// hello message. FetchTipSets asks the peers with the highest chains first.
+func (h *Handler) AddPeer(p peer.ID, height uint64) {
+	h.peersLk.Lock()
+	defer h.peersLk.Unlock()
+
+	h.peers[p] = height
+}
+
+// removePeer stops fetching from a peer until it is added again.
+func (h *Handler) removePeer(p peer.ID) {
+	h.peersLk.Lock()
+	defer h.peersLk.Unlock()
+
+	delete(h.peers, p)
+}
+
+// peersByHeight returns the known peers, highest chain first.
+func (h *Handler) peersByHeight() []peer.ID {
+	h.peersLk.Lock()
+	defer h.peersLk.Unlock()
+
+	peers := make([]peer.ID, 0, len(h.peers))
+	for p := range h.peers {
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		if h.peers[peers[i]] != h.peers[peers[j]] {
+			return h.peers[peers[i]] > h.peers[peers[j]]
+		}
+		return peers[i] < peers[j]
+	})
+	return peers
+}
+
+// FetchTipSets fetches a run of up to count tipsets, starting with the tipset
+// made of the blocks with cids start and continuing with its ancestors. It
+// asks the known peers in order of the height of their chains until one of
+// them returns a run that links up. It returns the blocks of each tipset in
+// the run.
+func (h *Handler) FetchTipSets(ctx context.Context, start []cid.Cid, count int) ([][]*types.Block, error) {
+	if count > MaxRequestLength {
+		count = MaxRequestLength
+	}
+	req := Request{
+		Start:  start,
+		Length: uint64(count),
+	}
+
+	peers := h.peersByHeight()
+	if len(peers) == 0 {
+		return nil, errors.New("no peers to fetch tipsets from")
+	}
+
+	for _, p := range peers {
+		tipsets, err := h.fetchFrom(ctx, p, &req)
+		if err == nil {
+			return tipsets, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Debugf("failed to fetch tipsets from peer %s: %s", p, err)
+	}
+
+	return nil, errors.Errorf("none of %d peers returned the tipsets", len(peers))
+}
+
+func (h *Handler) fetchFrom(ctx context.Context, p peer.ID, req *Request) ([][]*types.Block, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	s, err := h.host.NewStream(ctx, p, protocol)
+	if err != nil {
+		h.removePeer(p)
+		return nil, errors.Wrap(err, "failed to create stream to peer")
+	}
+	defer s.Close() // nolint: errcheck
+
+	if err := cbu.NewMsgWriter(s).WriteMsg(req); err != nil {
+		h.removePeer(p)
+		return nil, errors.Wrap(err, "failed to write request to stream")
+	}
+
+	reader := cbu.NewMsgReader(s)
+	var res Response
+	if err := reader.ReadMsg(&res); err != nil {
+		h.removePeer(p)
+		return nil, errors.Wrap(err, "failed to read response from stream")
+	}
+	if res.Status != Success {
+		return nil, errors.Errorf("peer did not serve request: %s", res.ErrorMessage)
+	}
+	if res.Count == 0 || res.Count > req.Length {
+		h.removePeer(p)
+		return nil, errors.Errorf("peer returned %d tipsets for a request of %d", res.Count, req.Length)
+	}
+
+	tipsets := make([][]*types.Block, res.Count)
+	for i := range tipsets {
+		var bundle TipSetBundle
+		if err := reader.ReadMsg(&bundle); err != nil {
+			h.removePeer(p)
+			return nil, errors.Wrap(err, "failed to read tipset from stream")
+		}
+		tipsets[i] = bundle.Blocks
+	}
+
+	if err := checkRun(req.Start, tipsets); err != nil {
+		h.removePeer(p)
+		return nil, err
+	}
+
+	return tipsets, nil
+}
+
+// checkRun checks that a run of tipsets starts with the blocks with cids
+// start and that each tipset is made of the parents of the one before it.
+func checkRun(start []cid.Cid, tipsets [][]*types.Block) error {
+	want := types.NewSortedCidSet(start...)
+	for i, blks := range tipsets {
+		if len(blks) == 0 {
+			return errors.Errorf("tipset %d of the run is empty", i)
+		}
+
+		var got types.SortedCidSet
+		for _, blk := range blks {
+			got.Add(blk.Cid())
+		}
+		if !got.Equals(want) {
+			return errors.Errorf("tipset %d of the run is %s, expected %s", i, got.String(), want.String())
+		}
+
+		want = blks[0].Parents
+	}
+	return nil
+}
+
+func (h *Handler) handleNewStream(s net.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	from := s.Conn().RemotePeer()
+
+	var req Request
+	if err := cbu.NewMsgReader(s).ReadMsg(&req); err != nil {
+		log.Warningf("bad block sync request from peer %s: %s", from, err)
+		return
+	}
+
+	writer := cbu.NewMsgWriter(s)
+	if !h.limiter.allow(from, time.Now()) {
+		writeResponse(writer, from, &Response{Status: RateLimited, ErrorMessage: "too many requests"})
+		return
+	}
+	if len(req.Start) == 0 || req.Length == 0 || req.Length > MaxRequestLength {
+		writeResponse(writer, from, &Response{Status: BadRequest, ErrorMessage: fmt.Sprintf("request must ask for 1 to %d tipsets", MaxRequestLength)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	bundles, err := h.collectRun(ctx, &req)
+	if err != nil {
+		writeResponse(writer, from, &Response{Status: NotFound, ErrorMessage: err.Error()})
+		return
+	}
+
+	if !writeResponse(writer, from, &Response{Status: Success, Count: uint64(len(bundles))}) {
+		return
+	}
+	for _, bundle := range bundles {
+		if err := writer.WriteMsg(bundle); err != nil {
+			log.Warningf("failed to write tipset to peer %s: %s", from, err)
+			return
+		}
+	}
+}
+
+// collectRun loads the run of tipsets asked for by req from the chain. The
+// run ends early at the genesis block or before a tipset too big to send in
+// a single message.
+func (h *Handler) collectRun(ctx context.Context, req *Request) ([]*TipSetBundle, error) {
+	var bundles []*TipSetBundle
+	next := req.Start
+	for uint64(len(bundles)) < req.Length && len(next) > 0 {
+		bundle := &TipSetBundle{}
+		for _, c := range next {
+			blk, err := h.chain.GetBlock(ctx, c)
+			if err != nil {
+				if len(bundles) == 0 {
+					return nil, errors.Wrapf(err, "failed to load block %s", c.String())
+				}
+				// serve the part of the run we have
+				return bundles, nil
+			}
+			bundle.Blocks = append(bundle.Blocks, blk)
+		}
+
+		data, err := cbor.DumpObject(bundle)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode tipset")
+		}
+		if len(data) > cbu.MaxMessageSize {
+			break
+		}
+
+		bundles = append(bundles, bundle)
+		next = bundle.Blocks[0].Parents.ToSlice()
+	}
+
+	if len(bundles) == 0 {
+		return nil, errors.New("start tipset is too big to send")
+	}
+	return bundles, nil
+}
+
+func writeResponse(writer *cbu.MsgWriter, to peer.ID, res *Response) bool {
+	if err := writer.WriteMsg(res); err != nil {
+		log.Warningf("failed to write block sync response to peer %s: %s", to, err)
+		return false
+	}
+	return true
+}
+
+// rateLimiter limits the number of requests each peer can make in a period.
+type rateLimiter struct {
+	limit  int
+	period time.Duration
+
+	windows map[peer.ID]*rateWindow
+	lk      sync.Mutex
+}
+
+// rateWindow counts the requests a peer made since start.
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, period time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:   limit,
+		period:  period,
+		windows: make(map[peer.ID]*rateWindow),
+	}
+}
+
+// allow records a request from p at now and returns true if p has not made
+// more than limit requests in the current period.
+func (rl *rateLimiter) allow(p peer.ID, now time.Time) bool {
+	rl.lk.Lock()
+	defer rl.lk.Unlock()
+
+	w, ok := rl.windows[p]
+	if !ok || now.Sub(w.start) >= rl.period {
+		// forget the windows of peers that have not made requests in a while
+		for other, ow := range rl.windows {
+			if now.Sub(ow.start) >= rl.period {
+				delete(rl.windows, other)
+			}
+		}
+		w = &rateWindow{start: now}
+		rl.windows[p] = w
+	}
+
+	w.count++
+	return w.count <= rl.limit
+}
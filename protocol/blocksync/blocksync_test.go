@@ -0,0 +1,167 @@
+package blocksync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+	"gx/ipfs/QmcNGX5RaxPPCYwa6yGXM1EcUbrreTTinixLcYGmMwf1sx/go-libp2p/p2p/net/mock"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+type testChain map[cid.Cid]*types.Block
+
+func (tc testChain) GetBlock(ctx context.Context, id cid.Cid) (*types.Block, error) {
+	blk, ok := tc[id]
+	if !ok {
+		return nil, errors.New("block not found")
+	}
+	return blk, nil
+}
+
+// newTestChain makes a chain of single block tipsets of the given length,
+// returning the blocks in order from genesis.
+func newTestChain(length int) (testChain, []*types.Block) {
+	tc := testChain{}
+	var blks []*types.Block
+	parents := types.SortedCidSet{}
+	for i := 0; i < length; i++ {
+		blk := &types.Block{Height: types.Uint64(i), Nonce: 42, Parents: parents}
+		tc[blk.Cid()] = blk
+		blks = append(blks, blk)
+		parents = types.NewSortedCidSet(blk.Cid())
+	}
+	return tc, blks
+}
+
+func tipSetCids(blks ...*types.Block) []cid.Cid {
+	var cids []cid.Cid
+	for _, blk := range blks {
+		cids = append(cids, blk.Cid())
+	}
+	return cids
+}
+
+func flatten(require *require.Assertions, tipsets [][]*types.Block) []*types.Block {
+	var blks []*types.Block
+	for _, ts := range tipsets {
+		require.Len(ts, 1)
+		blks = append(blks, ts...)
+	}
+	return blks
+}
+
+func TestFetchTipSets(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	setup := func(require *require.Assertions, tc testChain) *Handler {
+		mn, err := mocknet.WithNPeers(ctx, 2)
+		require.NoError(err)
+		require.NoError(mn.LinkAll())
+		require.NoError(mn.ConnectAllButSelf())
+
+		server, client := mn.Hosts()[0], mn.Hosts()[1]
+		New(server, tc)
+		handler := New(client, testChain{})
+		handler.AddPeer(server.ID(), 10)
+		return handler
+	}
+
+	t.Run("fetches a run of tipsets", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		tc, blks := newTestChain(5)
+		handler := setup(require, tc)
+
+		tipsets, err := handler.FetchTipSets(ctx, []cid.Cid{blks[4].Cid()}, 3)
+		require.NoError(err)
+		assert.Equal(tipSetCids(blks[4], blks[3], blks[2]), tipSetCids(flatten(require, tipsets)...))
+	})
+
+	t.Run("stops at the genesis block", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		tc, blks := newTestChain(3)
+		handler := setup(require, tc)
+
+		tipsets, err := handler.FetchTipSets(ctx, []cid.Cid{blks[2].Cid()}, 10)
+		require.NoError(err)
+		assert.Equal(tipSetCids(blks[2], blks[1], blks[0]), tipSetCids(flatten(require, tipsets)...))
+	})
+
+	t.Run("fails for unknown tipsets", func(t *testing.T) {
+		require := require.New(t)
+
+		tc, _ := newTestChain(3)
+		handler := setup(require, tc)
+
+		_, err := handler.FetchTipSets(ctx, []cid.Cid{types.SomeCid()}, 10)
+		require.Error(err)
+	})
+
+	t.Run("fails without peers", func(t *testing.T) {
+		require := require.New(t)
+
+		mn, err := mocknet.WithNPeers(ctx, 1)
+		require.NoError(err)
+
+		_, err = New(mn.Hosts()[0], testChain{}).FetchTipSets(ctx, []cid.Cid{types.SomeCid()}, 10)
+		require.Error(err)
+	})
+}
+
+func TestCheckRun(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	_, blks := newTestChain(3)
+
+	assert.NoError(checkRun([]cid.Cid{blks[2].Cid()}, [][]*types.Block{{blks[2]}, {blks[1]}}))
+	assert.Error(checkRun([]cid.Cid{blks[2].Cid()}, [][]*types.Block{{blks[1]}, {blks[0]}}))
+	assert.Error(checkRun([]cid.Cid{blks[2].Cid()}, [][]*types.Block{{blks[2]}, {blks[0]}}))
+	assert.Error(checkRun([]cid.Cid{blks[2].Cid()}, [][]*types.Block{{blks[2]}, {}}))
+}
+
+func TestPeersByHeight(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	h := &Handler{peers: make(map[peer.ID]uint64)}
+	h.AddPeer(peer.ID("a"), 5)
+	h.AddPeer(peer.ID("b"), 9)
+	h.AddPeer(peer.ID("c"), 7)
+	assert.Equal([]peer.ID{"b", "c", "a"}, h.peersByHeight())
+
+	h.removePeer(peer.ID("c"))
+	assert.Equal([]peer.ID{"b", "a"}, h.peersByHeight())
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	rl := newRateLimiter(2, time.Minute)
+	now := time.Now()
+
+	assert.True(rl.allow(peer.ID("a"), now))
+	assert.True(rl.allow(peer.ID("a"), now))
+	assert.False(rl.allow(peer.ID("a"), now))
+
+	// other peers have their own limit
+	assert.True(rl.allow(peer.ID("b"), now))
+
+	// the limit resets every period
+	assert.True(rl.allow(peer.ID("a"), now.Add(time.Minute)))
+}
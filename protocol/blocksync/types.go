@@ -0,0 +1,57 @@
+package blocksync
+
+import (
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func init() {
+	cbor.RegisterCborType(Request{})
+	cbor.RegisterCborType(Response{})
+	cbor.RegisterCborType(TipSetBundle{})
+}
+
+// Status communicates whether a peer serves a block sync request.
+type Status int
+
+const (
+	// Unset is the default status
+	Unset = Status(iota)
+
+	// Success means that the peer returns the requested tipsets
+	Success
+
+	// NotFound means that the peer does not have the start tipset
+	NotFound
+
+	// BadRequest means that the request is malformed or asks for too many tipsets
+	BadRequest
+
+	// RateLimited means that the peer made too many requests recently
+	RateLimited
+)
+
+// Request asks a peer for a run of Length tipsets, starting with the tipset
+// made of the blocks with cids Start and continuing with its ancestors.
+type Request struct {
+	Start  []cid.Cid
+	Length uint64
+}
+
+// Response is the first message a peer sends in reply to a Request. On
+// success it is followed by Count TipSetBundle messages, one per tipset in the
+// run, in order. Count may be less than the requested length if the run
+// reaches the genesis block or a tipset too big to send.
+type Response struct {
+	Status       Status
+	ErrorMessage string
+	Count        uint64
+}
+
+// TipSetBundle holds the blocks of a single tipset, including their messages
+// and message receipts.
+type TipSetBundle struct {
+	Blocks []*types.Block
+}
@@ -1,17 +1,21 @@
 package retrieval
 
 import (
-	"bytes"
 	"context"
+	"fmt"
 	"io"
-	"io/ioutil"
+	"math/big"
+	"sync"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	"gx/ipfs/QmTu65MVbemtUxJEWgsTtzv9Zv9P8rvmqNA4eG9TrTRGYc/go-libp2p-peer"
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	host "gx/ipfs/Qmd52WKRSwrBK5gUaJKawryZQ5by6UbNB8KVW2Zy6JtbyW/go-libp2p-host"
 
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
 	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 // RetrievePieceChunkSize defines the size of piece-chunks to be sent from miner to client. The maximum size of readable
@@ -19,67 +23,325 @@ import (
 // succeed.
 const RetrievePieceChunkSize = 256 << 8
 
+const (
+	// ChannelExpiryInterval defines how long a payment channel opened for retrieval remains open
+	ChannelExpiryInterval = 1000
+
+	// CreateChannelGasPrice is the gas price of the message used to create the payment channel
+	CreateChannelGasPrice = 0
+
+	// CreateChannelGasLimit is the gas limit of the message used to create the payment channel
+	CreateChannelGasLimit = 300
+)
+
 // TODO: better name
 type clientNode interface {
 	Host() host.Host
 }
 
+// clientPorcelainAPI is the subset of the porcelain API that retrieval.Client needs.
+type clientPorcelainAPI interface {
+	ChainBlockHeight(ctx context.Context) (*types.BlockHeight, error)
+	GetAndMaybeSetDefaultSenderAddress() (address.Address, error)
+	MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
+	MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error
+	SignBytes(data []byte, addr address.Address) (types.Signature, error)
+}
+
+// clientChannel is a payment channel the client has opened to pay a retrieval miner.
+type clientChannel struct {
+	info   PaymentInfo
+	target address.Address
+	amount *types.AttoFIL
+	eol    *types.BlockHeight
+
+	// paid is the amount of the most valuable voucher the miner has acknowledged.
+	paid *types.AttoFIL
+
+	// inUse is set while a retrieval is paying with the channel.
+	inUse bool
+}
+
 // Client is a client interface to the retrieval market protocols.
 type Client struct {
 	node clientNode
+	api  clientPorcelainAPI
+
+	// channels are the payment channels opened by this client, indexed by target address.
+	channels   map[address.Address][]*clientChannel
+	channelsLk sync.Mutex
 }
 
 // NewClient produces a new Client.
-func NewClient(nd clientNode) *Client {
+func NewClient(nd clientNode, api clientPorcelainAPI) *Client {
 	return &Client{
-		node: nd,
+		node:     nd,
+		api:      api,
+		channels: make(map[address.Address][]*clientChannel),
 	}
 }
 
-// RetrievePiece connects to a miner and transfers a piece of content.
-func (sc *Client) RetrievePiece(ctx context.Context, minerPeerID peer.ID, pieceCID cid.Cid) (io.ReadCloser, error) {
-	s, err := sc.node.Host().NewStream(ctx, minerPeerID, retrievalFreeProtocol)
+// RetrievePiece connects to a miner and streams length bytes of a piece starting at offset; a length of zero
+// retrieves the rest of the piece. If maxPrice is positive the piece is retrieved over the paid protocol, paying
+// the miner no more than maxPrice in total. Otherwise the miner is asked for the piece for free. If the transfer
+// is interrupted the returned reader resumes it from the last chunk received.
+func (sc *Client) RetrievePiece(ctx context.Context, minerPeerID peer.ID, pieceCID cid.Cid, offset, length uint64, maxPrice *types.AttoFIL) (io.ReadCloser, error) {
+	if maxPrice == nil || !maxPrice.IsPositive() {
+		return sc.retrievePieceForFree(ctx, minerPeerID, pieceCID, offset, length)
+	}
+
+	return sc.retrievePaidPiece(ctx, minerPeerID, pieceCID, offset, length, maxPrice)
+}
+
+func (sc *Client) retrievePieceForFree(ctx context.Context, minerPeerID peer.ID, pieceCID cid.Cid, offset, length uint64) (io.ReadCloser, error) {
+	open := func(ctx context.Context, offset, length uint64) (chunkSource, error) {
+		s, err := sc.node.Host().NewStream(ctx, minerPeerID, retrievalFreeProtocol)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create stream to retrieval miner")
+		}
+
+		stream := newPieceStream(s)
+
+		req := RetrievePieceRequest{
+			PieceRef: pieceCID,
+			Offset:   offset,
+			Length:   length,
+		}
+
+		if err := stream.start(&req); err != nil {
+			stream.Close() // nolint: errcheck
+			return nil, err
+		}
+
+		return stream, nil
+	}
+
+	return newPieceReader(ctx, open, offset, length, nil)
+}
+
+// QueryPiece asks a miner for its price to retrieve the given piece.
+func (sc *Client) QueryPiece(ctx context.Context, minerPeerID peer.ID, pieceCID cid.Cid) (*RetrievePieceQueryResponse, error) {
+	s, err := sc.node.Host().NewStream(ctx, minerPeerID, retrievalQueryProtocol)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create stream to retrieval miner")
 	}
 
 	defer s.Close() // nolint: errcheck
 
-	streamReader := cbu.NewMsgReader(s)
-
-	req := RetrievePieceRequest{
+	query := RetrievePieceQuery{
 		PieceRef: pieceCID,
 	}
 
-	if err := cbu.NewMsgWriter(s).WriteMsg(&req); err != nil {
-		return nil, errors.Wrap(err, "failed to write request message to stream")
+	if err := cbu.NewMsgWriter(s).WriteMsg(&query); err != nil {
+		return nil, errors.Wrap(err, "failed to write query message to stream")
 	}
 
-	var res RetrievePieceResponse
-	if err := streamReader.ReadMsg(&res); err != nil {
-		return nil, errors.Wrap(err, "failed to read response message from stream")
+	var res RetrievePieceQueryResponse
+	if err := cbu.NewMsgReader(s).ReadMsg(&res); err != nil {
+		return nil, errors.Wrap(err, "failed to read query response from stream")
 	}
 
 	if res.Status != Success {
-		return nil, errors.Errorf("could not retrieve piece - error from miner: %s", res.ErrorMessage)
+		return nil, errors.Errorf("could not query piece - error from miner: %s", res.ErrorMessage)
+	}
+
+	return &res, nil
+}
+
+func (sc *Client) retrievePaidPiece(ctx context.Context, minerPeerID peer.ID, pieceCID cid.Cid, offset, length uint64, maxPrice *types.AttoFIL) (io.ReadCloser, error) {
+	quote, err := sc.QueryPiece(ctx, minerPeerID, pieceCID)
+	if err != nil {
+		return nil, err
+	}
+
+	if quote.PricePerByte == nil || quote.PricePerByte.IsZero() {
+		return sc.retrievePieceForFree(ctx, minerPeerID, pieceCID, offset, length)
+	}
+
+	channel, err := sc.acquireChannel(ctx, quote.PaymentAddress, maxPrice)
+	if err != nil {
+		return nil, err
 	}
 
-	var buf []byte
-	for {
-		var chunk RetrievePieceChunk
-		if err := streamReader.ReadMsg(&chunk); err != nil {
-			if err == io.EOF {
-				break
+	// received counts the bytes paid for across every stream of this retrieval
+	var received uint64
+
+	open := func(ctx context.Context, offset, length uint64) (chunkSource, error) {
+		s, err := sc.node.Host().NewStream(ctx, minerPeerID, retrievalPaidProtocol)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create stream to retrieval miner")
+		}
+
+		stream := newPieceStream(s)
+
+		// vouchers sent over this stream are on top of what the channel has already paid
+		paidBefore := channel.paid
+		var streamReceived uint64
+
+		stream.pay = func(n uint64) error {
+			newCost := quote.PricePerByte.CalculatePrice(types.NewBytesAmount(received + n))
+			if newCost.GreaterThan(maxPrice) {
+				return &retrievalError{fmt.Errorf("retrieval cost (%s) exceeds max price (%s)", newCost.String(), maxPrice.String())}
+			}
+
+			voucher, err := sc.createVoucher(ctx, channel, paidBefore.Add(quote.PricePerByte.CalculatePrice(types.NewBytesAmount(streamReceived+n))))
+			if err != nil {
+				return &retrievalError{err}
+			}
+
+			if err := stream.writer.WriteMsg(&RetrievePiecePayment{Voucher: voucher}); err != nil {
+				return errors.Wrap(err, "failed to write payment to stream")
 			}
 
-			return nil, errors.Errorf("could not read chunk from stream: %s", err.Error())
+			var ack RetrievePieceResponse
+			if err := stream.reader.ReadMsg(&ack); err != nil {
+				return errors.Wrap(err, "failed to read payment acknowledgement from stream")
+			}
+
+			if ack.Status != Success {
+				return &retrievalError{errors.Errorf("miner rejected payment: %s", ack.ErrorMessage)}
+			}
+			channel.paid = &voucher.Amount
+
+			received += n
+			streamReceived += n
+			return nil
+		}
+
+		req := RetrievePaidPieceRequest{
+			PieceRef: pieceCID,
+			Offset:   offset,
+			Length:   length,
+			Payment:  channel.info,
+		}
+
+		if err := stream.start(&req); err != nil {
+			stream.Close() // nolint: errcheck
+			return nil, err
+		}
+
+		return stream, nil
+	}
+
+	reader, err := newPieceReader(ctx, open, offset, length, func() { sc.releaseChannel(channel) })
+	if err != nil {
+		sc.releaseChannel(channel)
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// createVoucher creates and signs a voucher for the given cumulative amount, valid immediately.
+func (sc *Client) createVoucher(ctx context.Context, channel *clientChannel, amount *types.AttoFIL) (*paymentbroker.PaymentVoucher, error) {
+	if amount.GreaterThan(channel.amount) {
+		return nil, fmt.Errorf("payment (%s) exceeds payment channel funds (%s)", amount.String(), channel.amount.String())
+	}
+
+	validAt, err := sc.api.ChainBlockHeight(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get current block height")
+	}
+
+	voucher := &paymentbroker.PaymentVoucher{
+		Channel: *channel.info.Channel,
+		Payer:   channel.info.Payer,
+		Target:  channel.target,
+		Amount:  *amount,
+		ValidAt: *validAt,
+	}
+
+	voucher.Signature, err = paymentbroker.SignVoucher(voucher, sc.api)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign voucher")
+	}
+
+	return voucher, nil
+}
+
+// acquireChannel returns a payment channel to target holding at least maxPrice of unspent funds, reusing
+// an idle channel if one exists and creating one otherwise. The channel must be released with releaseChannel.
+func (sc *Client) acquireChannel(ctx context.Context, target address.Address, maxPrice *types.AttoFIL) (*clientChannel, error) {
+	height, err := sc.api.ChainBlockHeight(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get current block height")
+	}
+	minEol := height.Add(types.NewBlockHeight(ChannelRedeemWindow))
+
+	sc.channelsLk.Lock()
+	for _, channel := range sc.channels[target] {
+		if channel.inUse || channel.eol.LessEqual(minEol) {
+			continue
+		}
+
+		if channel.amount.Sub(channel.paid).GreaterEqual(maxPrice) {
+			channel.inUse = true
+			sc.channelsLk.Unlock()
+			return channel, nil
 		}
+	}
+	sc.channelsLk.Unlock()
+
+	channel, err := sc.createChannel(ctx, target, maxPrice, height.Add(types.NewBlockHeight(ChannelExpiryInterval)))
+	if err != nil {
+		return nil, err
+	}
+
+	sc.channelsLk.Lock()
+	defer sc.channelsLk.Unlock()
+	sc.channels[target] = append(sc.channels[target], channel)
 
-		buf = append(buf, chunk.Data...)
+	return channel, nil
+}
+
+func (sc *Client) releaseChannel(channel *clientChannel) {
+	sc.channelsLk.Lock()
+	defer sc.channelsLk.Unlock()
+	channel.inUse = false
+}
+
+func (sc *Client) createChannel(ctx context.Context, target address.Address, amount *types.AttoFIL, eol *types.BlockHeight) (*clientChannel, error) {
+	payer, err := sc.api.GetAndMaybeSetDefaultSenderAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	msgCid, err := sc.api.MessageSend(ctx,
+		payer,
+		address.PaymentBrokerAddress,
+		amount,
+		*types.NewAttoFIL(big.NewInt(CreateChannelGasPrice)),
+		types.NewGasUnits(CreateChannelGasLimit),
+		"createChannel",
+		target,
+		eol)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create payment channel")
 	}
 
-	// TODO: Figure out how to stream piece-bytes w/out having to buffer.
-	buffered := ioutil.NopCloser(bytes.NewReader(buf))
+	var chid *types.ChannelID
+	err = sc.api.MessageWait(ctx, msgCid, func(block *types.Block, message *types.SignedMessage, receipt *types.MessageReceipt) error {
+		if receipt.ExitCode != 0 {
+			return fmt.Errorf("createChannel failed %d", receipt.ExitCode)
+		}
+
+		chid = types.NewChannelIDFromBytes(receipt.Return[0])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	return buffered, nil
+	return &clientChannel{
+		info: PaymentInfo{
+			Payer:         payer,
+			Channel:       chid,
+			ChannelMsgCid: &msgCid,
+		},
+		target: target,
+		amount: amount,
+		eol:    eol,
+		paid:   types.NewZeroAttoFIL(),
+		inUse:  true,
+	}, nil
 }
@@ -1,8 +1,28 @@
 // Package retrieval implements a very simple retrieval protocol that works on high level like this:
 //
-// 1. CLIENT opens /fil/retrieval/free/0.0.0 stream to MINER
+// 1. CLIENT opens /fil/retrieval/free/0.1.0 stream to MINER
 // 2. CLIENT sends MINER a RetrievePieceRequest
 // 3. MINER sends CLIENT a RetrievePieceResponse with Status set to Success if it has PieceRef in a sealed sector
-// 4. MINER sends CLIENT RetrievePieceChunks until all data associated with PieceRef has been sent
-// 5. CLIENT reads RetrievePieceChunk from stream until EOF and then closes stream
+// 4. MINER sends CLIENT RetrievePieceChunks until all requested data associated with PieceRef has been sent,
+//    followed by an empty RetrievePieceChunk marking the end of the data
+// 5. CLIENT reads RetrievePieceChunks from stream until the empty chunk and then closes stream
+//
+// The free protocol is only served by miners that do not charge for retrieval. Miners configured with a
+// mining.retrievalPrice are paid through a payment channel:
+//
+// 1. CLIENT opens /fil/retrieval/query/0.0.0 stream to MINER and sends a RetrievePieceQuery
+// 2. MINER replies with a RetrievePieceQueryResponse holding its price per byte and payment address
+// 3. CLIENT opens (or reuses) a payment channel to the payment address holding at least its max price
+// 4. CLIENT opens /fil/retrieval/paid/0.2.0 stream to MINER and sends a RetrievePaidPieceRequest
+// 5. MINER sends CLIENT a RetrievePieceResponse with Status set to Success if it accepts the channel and has the piece
+// 6. MINER sends CLIENT a RetrievePiecePaymentRequest announcing the size of the next RetrievePieceChunk
+// 7. CLIENT sends MINER a RetrievePiecePayment whose voucher covers every byte received so far and the announced chunk
+// 8. MINER replies with a RetrievePieceResponse, with Status set to Failure and the stream closed if the voucher is
+//    missing or underpays, and otherwise sends CLIENT the RetrievePieceChunk
+// 9. Steps 6-8 repeat until all requested data associated with PieceRef has been sent, and MINER sends a
+//    RetrievePiecePaymentRequest of size zero, an empty RetrievePieceChunk, and closes the stream
+//
+// Both requests carry an Offset and a Length so that a client can retrieve a byte range of a piece. If a stream
+// ends before the empty chunk is received the client opens a new stream requesting the data it has not yet
+// received, paying over the same channel from the most valuable voucher it has already issued.
 package retrieval
@@ -1,20 +1,53 @@
 package retrieval
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"sync"
+	"time"
 
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	inet "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	"gx/ipfs/QmZNkThpqfVXs9GNbexPrfBbXSLNYeKrE7jwFM2oqHbyqN/go-libp2p-protocol"
 	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 	host "gx/ipfs/Qmd52WKRSwrBK5gUaJKawryZQ5by6UbNB8KVW2Zy6JtbyW/go-libp2p-host"
 
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
 	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+	"github.com/filecoin-project/go-filecoin/exec"
 	"github.com/filecoin-project/go-filecoin/proofs/sectorbuilder"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 var log = logging.Logger("/fil/retrieval")
 
-const retrievalFreeProtocol = protocol.ID("/fil/retrieval/free/0.0.0")
+const retrievalFreeProtocol = protocol.ID("/fil/retrieval/free/0.1.0")
+const retrievalQueryProtocol = protocol.ID("/fil/retrieval/query/0.0.0")
+const retrievalPaidProtocol = protocol.ID("/fil/retrieval/paid/0.2.0")
+
+const waitForPaymentChannelDuration = 2 * time.Minute
+
+// redeemVouchersGasLimit is the gas limit of redeem messages if estimating their gas fails.
+const redeemVouchersGasLimit = 300
+
+// waitForRedeemDuration bounds how long the miner waits for a redeem message to be mined before it
+// may redeem the same payment channel again.
+const waitForRedeemDuration = 10 * time.Minute
+
+const retrievalVouchersDatastorePrefix = "retrievalVouchers"
+
+// ChannelRedeemWindow is the number of blocks a payment channel must remain open past the start of a paid
+// retrieval, so that the miner has time to redeem the vouchers it receives. The miner redeems them
+// mining.redeemBlocksBeforeEol blocks before the channel's eol, or once they are worth mining.redeemThreshold.
+const ChannelRedeemWindow = 100
 
 // TODO: better name
 type minerNode interface {
@@ -22,18 +55,53 @@ type minerNode interface {
 	SectorBuilder() sectorbuilder.SectorBuilder
 }
 
+// minerPorcelain is the subset of the porcelain API that retrieval.Miner needs.
+type minerPorcelain interface {
+	ChainBlockHeight(ctx context.Context) (*types.BlockHeight, error)
+	ConfigGet(dottedPath string) (interface{}, error)
+	GasPriceSuggest(ctx context.Context) (types.AttoFIL, error)
+	MessageEstimateGas(ctx context.Context, from, to address.Address, value *types.AttoFIL, method string, params ...interface{}) (types.GasUnits, error)
+	MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
+	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
+	MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error
+	MinerGetWorkerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error)
+}
+
 // Miner serves requests for pieces from RetrievalClients.
 type Miner struct {
-	node minerNode
+	node         minerNode
+	porcelainAPI minerPorcelain
+
+	// vouchersDs holds the most valuable voucher received for each payment channel.
+	vouchersDs repo.Datastore
+	vouchersLk sync.Mutex
+
+	// channelsInUse holds the keys of the payment channels paying for a retrieval. A channel pays for one
+	// retrieval at a time, so that every retrieval is priced against the vouchers of the previous one.
+	channelsInUse   map[datastore.Key]bool
+	channelsInUseLk sync.Mutex
+
+	// redeeming is set while the vouchers are scanned for redemption.
+	redeeming bool
+	// redeemsInProcess holds the keys of the payment channels with a redeem message waiting to be mined.
+	redeemsInProcess map[datastore.Key]bool
+	redeemLk         sync.Mutex
 }
 
 // NewMiner is used to create a Miner and bind a handling function to the piece retrieval protocol.
-func NewMiner(nd minerNode) *Miner {
+func NewMiner(nd minerNode, porcelainAPI minerPorcelain, vouchersDs repo.Datastore) *Miner {
 	rm := &Miner{
-		node: nd,
+		node:          nd,
+		porcelainAPI:  porcelainAPI,
+		vouchersDs:    vouchersDs,
+		channelsInUse: make(map[datastore.Key]bool),
+
+		redeemsInProcess: make(map[datastore.Key]bool),
 	}
 
 	nd.Host().SetStreamHandler(retrievalFreeProtocol, rm.handleRetrievePieceForFree)
+	nd.Host().SetStreamHandler(retrievalQueryProtocol, rm.handleQueryPiece)
+	nd.Host().SetStreamHandler(retrievalPaidProtocol, rm.handleRetrievePaidPiece)
 
 	return rm
 }
@@ -47,50 +115,660 @@ func (rm *Miner) handleRetrievePieceForFree(s inet.Stream) {
 		return
 	}
 
+	price, err := rm.getRetrievalPrice()
+	if err != nil {
+		writeFailure(s, req.PieceRef, err.Error())
+		return
+	}
+
+	if !price.IsZero() {
+		writeFailure(s, req.PieceRef, fmt.Sprintf("miner charges %s per byte, use paid retrieval", price.String()))
+		return
+	}
+
 	reader, err := rm.node.SectorBuilder().ReadPieceFromSealedSector(req.PieceRef)
 	if err != nil {
 		log.Warningf("failed to obtain a reader for piece with CID %s: %s", req.PieceRef.String(), err)
+		writeFailure(s, req.PieceRef, err.Error())
+		return
+	}
 
-		resp := RetrievePieceResponse{
-			Status:       Failure,
-			ErrorMessage: err.Error(),
-		}
+	reader, err = pieceRangeReader(reader, req.Offset, req.Length)
+	if err != nil {
+		writeFailure(s, req.PieceRef, err.Error())
+		return
+	}
 
-		if err := cbu.NewMsgWriter(s).WriteMsg(&resp); err != nil {
-			log.Warningf("failed to write response for piece with CID %s: %s", req.PieceRef.String(), err)
-		}
+	resp := RetrievePieceResponse{
+		Status: Success,
+	}
+
+	streamWriter := cbu.NewMsgWriter(s)
+	if err := streamWriter.WriteMsg(&resp); err != nil {
+		log.Warningf("failed to write response for piece with CID %s: %s", req.PieceRef.String(), err)
+		return
+	}
 
+	if err := sendPieceChunks(reader, streamWriter, nil); err != nil {
+		log.Warningf("failed to send piece with CID %s: %s", req.PieceRef.String(), err)
+	}
+}
+
+func (rm *Miner) handleQueryPiece(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	var query RetrievePieceQuery
+	if err := cbu.NewMsgReader(s).ReadMsg(&query); err != nil {
+		log.Errorf("failed to read piece retrieval query: %s", err)
+		return
+	}
+
+	ctx := context.Background()
+	resp := RetrievePieceQueryResponse{
+		Status: Failure,
+	}
+
+	price, err := rm.getRetrievalPrice()
+	if err != nil {
+		resp.ErrorMessage = err.Error()
+	} else if paymentAddr, err := rm.getPaymentAddress(ctx); err != nil {
+		resp.ErrorMessage = err.Error()
+	} else if err := rm.verifyPieceStored(ctx, query.PieceRef); err != nil {
+		resp.ErrorMessage = err.Error()
+	} else {
+		resp.Status = Success
+		resp.PricePerByte = price
+		resp.PaymentAddress = paymentAddr
+	}
+
+	if err := cbu.NewMsgWriter(s).WriteMsg(&resp); err != nil {
+		log.Warningf("failed to write query response for piece with CID %s: %s", query.PieceRef.String(), err)
+	}
+}
+
+func (rm *Miner) handleRetrievePaidPiece(s inet.Stream) {
+	defer s.Close() // nolint: errcheck
+
+	streamReader := cbu.NewMsgReader(s)
+	streamWriter := cbu.NewMsgWriter(s)
+
+	var req RetrievePaidPieceRequest
+	if err := streamReader.ReadMsg(&req); err != nil {
+		log.Errorf("failed to read paid piece retrieval request: %s", err)
+		return
+	}
+
+	ctx := context.Background()
+
+	price, err := rm.getRetrievalPrice()
+	if err != nil {
+		writeFailure(s, req.PieceRef, err.Error())
+		return
+	}
+
+	release, err := rm.acquireChannel(&req.Payment)
+	if err != nil {
+		writeFailure(s, req.PieceRef, err.Error())
+		return
+	}
+	defer release()
+
+	paid, err := rm.validateRetrievalPayment(ctx, &req.Payment)
+	if err != nil {
+		writeFailure(s, req.PieceRef, err.Error())
+		return
+	}
+
+	reader, err := rm.node.SectorBuilder().ReadPieceFromSealedSector(req.PieceRef)
+	if err != nil {
+		log.Warningf("failed to obtain a reader for piece with CID %s: %s", req.PieceRef.String(), err)
+		writeFailure(s, req.PieceRef, err.Error())
 		return
 	}
 
-	bs, err := ioutil.ReadAll(reader)
+	reader, err = pieceRangeReader(reader, req.Offset, req.Length)
 	if err != nil {
-		log.Errorf("failed to read all bytes: %s", err)
+		writeFailure(s, req.PieceRef, err.Error())
+		return
 	}
 
 	resp := RetrievePieceResponse{
 		Status: Success,
 	}
 
-	if err := cbu.NewMsgWriter(s).WriteMsg(&resp); err != nil {
+	if err := streamWriter.WriteMsg(&resp); err != nil {
 		log.Warningf("failed to write response for piece with CID %s: %s", req.PieceRef.String(), err)
 		return
 	}
 
-	for i := 0; i < len(bs); i += RetrievePieceChunkSize {
-		end := i + RetrievePieceChunkSize
+	// the client must pay for every chunk before it is sent
+	var sent uint64
+	err = sendPieceChunks(reader, streamWriter, func(n uint64) error {
+		if err := streamWriter.WriteMsg(&RetrievePiecePaymentRequest{Size: n}); err != nil {
+			return errors.Wrap(err, "failed to write payment request")
+		}
+		if n == 0 {
+			return nil
+		}
+
+		var payment RetrievePiecePayment
+		if err := streamReader.ReadMsg(&payment); err != nil {
+			return errors.Wrap(err, "failed to read payment")
+		}
+
+		owed := paid.Add(price.CalculatePrice(types.NewBytesAmount(sent + n)))
+		if err := rm.acceptVoucher(ctx, &req.Payment, payment.Voucher, owed); err != nil {
+			writeFailure(s, req.PieceRef, err.Error())
+			return err
+		}
+		sent += n
+
+		return streamWriter.WriteMsg(&resp)
+	})
+	if err != nil {
+		log.Warningf("stopping retrieval of CID %s: %s", req.PieceRef.String(), err)
+	}
+}
+
+// acquireChannel reserves the payment channel described by info for a retrieval, failing if it is paying
+// for another one. The returned function releases the channel.
+func (rm *Miner) acquireChannel(info *PaymentInfo) (func(), error) {
+	if info.Channel == nil {
+		return nil, errors.New("retrieval request contains no payment channel")
+	}
+	key := voucherKey(info.Payer, info.Channel)
+
+	rm.channelsInUseLk.Lock()
+	defer rm.channelsInUseLk.Unlock()
+
+	if rm.channelsInUse[key] {
+		return nil, errors.New("payment channel is paying for another retrieval")
+	}
+	rm.channelsInUse[key] = true
+
+	return func() {
+		rm.channelsInUseLk.Lock()
+		defer rm.channelsInUseLk.Unlock()
+		delete(rm.channelsInUse, key)
+	}, nil
+}
+
+// validateRetrievalPayment checks that the payment channel described by info may be used to pay this miner
+// and returns the amount the channel has already paid out, on chain or by vouchers held by the miner.
+func (rm *Miner) validateRetrievalPayment(ctx context.Context, info *PaymentInfo) (*types.AttoFIL, error) {
+	if info.Channel == nil || info.ChannelMsgCid == nil {
+		return nil, errors.New("retrieval request contains no payment channel")
+	}
+
+	paymentAddr, err := rm.getPaymentAddress(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	channel, err := rm.getPaymentChannel(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	// confirm we are target of channel
+	if channel.Target != paymentAddr {
+		return nil, fmt.Errorf("miner account (%s) is not target of payment channel (%s)", paymentAddr.String(), channel.Target.String())
+	}
+
+	blockHeight, err := rm.porcelainAPI.ChainBlockHeight(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get current block height")
+	}
+
+	// make sure we have time to redeem the vouchers
+	expectedEol := blockHeight.Add(types.NewBlockHeight(ChannelRedeemWindow))
+	if channel.Eol.LessThan(expectedEol) {
+		return nil, fmt.Errorf("payment channel eol (%s) less than required eol (%s)", channel.Eol, expectedEol)
+	}
+
+	paid := channel.AmountRedeemed
+	voucher, err := rm.LatestVoucher(info.Payer, info.Channel)
+	if err != nil {
+		return nil, err
+	}
+	if voucher != nil && voucher.Amount.GreaterThan(paid) {
+		paid = &voucher.Amount
+	}
+
+	if paid.GreaterEqual(channel.Amount) {
+		return nil, errors.New("payment channel has no funds remaining")
+	}
+
+	return paid, nil
+}
+
+// acceptVoucher verifies that voucher pays at least owed from the channel in info and records it.
+func (rm *Miner) acceptVoucher(ctx context.Context, info *PaymentInfo, voucher *paymentbroker.PaymentVoucher, owed *types.AttoFIL) error {
+	if voucher == nil {
+		return errors.New("missing payment voucher")
+	}
+
+	if !voucher.Channel.Equal(info.Channel) || voucher.Payer != info.Payer {
+		return errors.New("voucher is not for the agreed upon payment channel")
+	}
+
+	if voucher.Condition != nil {
+		return errors.New("retrieval vouchers may not be conditional")
+	}
+
+	if voucher.Lane != 0 || len(voucher.Merges) > 0 {
+		return errors.New("retrieval vouchers must pay on the first lane of the channel")
+	}
+
+	if voucher.Amount.LessThan(owed) {
+		return fmt.Errorf("voucher amount (%s) less than amount owed (%s)", voucher.Amount.String(), owed.String())
+	}
+
+	blockHeight, err := rm.porcelainAPI.ChainBlockHeight(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not get current block height")
+	}
+
+	if voucher.ValidAt.GreaterThan(blockHeight) {
+		return fmt.Errorf("voucher is not valid until %s", voucher.ValidAt.String())
+	}
+
+	if !paymentbroker.VerifyVoucherSignature(voucher) {
+		return errors.New("invalid signature in voucher")
+	}
+
+	return rm.saveVoucher(voucher)
+}
+
+// LatestVoucher returns the most valuable voucher received for the given payment channel, or nil if there
+// is none.
+func (rm *Miner) LatestVoucher(payer address.Address, chid *types.ChannelID) (*paymentbroker.PaymentVoucher, error) {
+	rm.vouchersLk.Lock()
+	defer rm.vouchersLk.Unlock()
+
+	return rm.loadVoucher(payer, chid)
+}
+
+func (rm *Miner) loadVoucher(payer address.Address, chid *types.ChannelID) (*paymentbroker.PaymentVoucher, error) {
+	datum, err := rm.vouchersDs.Get(voucherKey(payer, chid))
+	if err == datastore.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read voucher from datastore")
+	}
+
+	var voucher paymentbroker.PaymentVoucher
+	if err := cbor.DecodeInto(datum, &voucher); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal voucher from datastore")
+	}
+
+	return &voucher, nil
+}
+
+func (rm *Miner) saveVoucher(voucher *paymentbroker.PaymentVoucher) error {
+	rm.vouchersLk.Lock()
+	defer rm.vouchersLk.Unlock()
+
+	existing, err := rm.loadVoucher(voucher.Payer, &voucher.Channel)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Amount.GreaterThan(&voucher.Amount) {
+		return fmt.Errorf("voucher amount (%s) less than amount of voucher already received (%s)", voucher.Amount.String(), existing.Amount.String())
+	}
+
+	datum, err := cbor.DumpObject(voucher)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal voucher")
+	}
+
+	if err := rm.vouchersDs.Put(voucherKey(voucher.Payer, &voucher.Channel), datum); err != nil {
+		return errors.Wrap(err, "could not save voucher to disk")
+	}
+
+	return nil
+}
+
+// vouchers returns the most valuable voucher received for every payment channel.
+func (rm *Miner) vouchers() ([]*paymentbroker.PaymentVoucher, error) {
+	rm.vouchersLk.Lock()
+	defer rm.vouchersLk.Unlock()
+
+	res, err := rm.vouchersDs.Query(query.Query{Prefix: "/" + retrievalVouchersDatastorePrefix})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query vouchers from datastore")
+	}
+
+	var vouchers []*paymentbroker.PaymentVoucher
+	for entry := range res.Next() {
+		if entry.Error != nil {
+			return nil, errors.Wrap(entry.Error, "failed to read voucher from datastore")
+		}
+
+		var voucher paymentbroker.PaymentVoucher
+		if err := cbor.DecodeInto(entry.Value, &voucher); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal voucher from datastore")
+		}
+		vouchers = append(vouchers, &voucher)
+	}
+	return vouchers, nil
+}
+
+func voucherKey(payer address.Address, chid *types.ChannelID) datastore.Key {
+	return datastore.KeyWithNamespaces([]string{retrievalVouchersDatastorePrefix, payer.String(), chid.KeyString()})
+}
+
+func (rm *Miner) getRetrievalPrice() (*types.AttoFIL, error) {
+	retrievalPrice, err := rm.porcelainAPI.ConfigGet("mining.retrievalPrice")
+	if err != nil {
+		return nil, err
+	}
+	retrievalPriceAF, ok := retrievalPrice.(*types.AttoFIL)
+	if !ok {
+		return nil, errors.New("Could not retrieve retrievalPrice from config")
+	}
+	return retrievalPriceAF, nil
+}
+
+func (rm *Miner) getMinerAddress() (address.Address, error) {
+	minerAddr, err := rm.porcelainAPI.ConfigGet("mining.minerAddress")
+	if err != nil {
+		return address.Address{}, err
+	}
+	addr, ok := minerAddr.(address.Address)
+	if !ok || addr.Empty() {
+		return address.Address{}, errors.New("node is not configured with a miner address")
+	}
+	return addr, nil
+}
+
+// getPaymentAddress returns the address that must be the target of retrieval payment channels, which is
+// the worker of this node's miner, so that redeeming vouchers does not need the owner key.
+func (rm *Miner) getPaymentAddress(ctx context.Context) (address.Address, error) {
+	minerAddr, err := rm.getMinerAddress()
+	if err != nil {
+		return address.Address{}, err
+	}
+
+	return rm.porcelainAPI.MinerGetWorkerAddress(ctx, minerAddr)
+}
+
+// verifyPieceStored asks the storage market whether this node's miner is proving a sector with the
+// piece, which is cheaper than unsealing the piece to find out.
+func (rm *Miner) verifyPieceStored(ctx context.Context, pieceRef cid.Cid) error {
+	minerAddr, err := rm.getMinerAddress()
+	if err != nil {
+		return err
+	}
+
+	_, _, err = rm.porcelainAPI.MessageQuery(ctx, address.Address{}, address.StorageMarketAddress, "verifyPieceStored", minerAddr, pieceRef.Bytes())
+	if err != nil {
+		return errors.Wrapf(err, "piece %s is not stored by miner %s", pieceRef, minerAddr)
+	}
+	return nil
+}
+
+func (rm *Miner) getPaymentChannel(ctx context.Context, info *PaymentInfo) (*paymentbroker.PaymentChannel, error) {
+	// wait for create channel message
+	waitCtx, waitCancel := context.WithDeadline(ctx, time.Now().Add(waitForPaymentChannelDuration))
+	err := rm.porcelainAPI.MessageWait(waitCtx, *info.ChannelMsgCid, func(blk *types.Block, smsg *types.SignedMessage, receipt *types.MessageReceipt) error {
+		return nil
+	})
+	waitCancel()
+	if err != nil {
+		if err == context.DeadlineExceeded {
+			return nil, errors.Wrap(err, "Timeout waiting for payment channel")
+		}
+		return nil, err
+	}
+
+	return rm.getChannel(ctx, info.Payer, info.Channel)
+}
+
+func (rm *Miner) getChannel(ctx context.Context, payer address.Address, chid *types.ChannelID) (*paymentbroker.PaymentChannel, error) {
+	ret, _, err := rm.porcelainAPI.MessageQuery(ctx, address.Address{}, address.PaymentBrokerAddress, "ls", payer)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting payment channel for payer")
+	}
+
+	var channels map[string]*paymentbroker.PaymentChannel
+	if err := cbor.DecodeInto(ret[0], &channels); err != nil {
+		return nil, errors.Wrap(err, "Could not decode payment channels for payer")
+	}
+	channel, ok := channels[chid.KeyString()]
+	if !ok {
+		return nil, fmt.Errorf("could not find payment channel for payer %s and id %s", payer.String(), chid.KeyString())
+	}
+	return channel, nil
+}
+
+// OnNewHeaviestTipSet is called by the node every time the head is updated. It redeems the vouchers that
+// are due in the background, unless they are still being scanned since an earlier head.
+func (rm *Miner) OnNewHeaviestTipSet(ts types.TipSet) {
+	height, err := ts.Height()
+	if err != nil {
+		log.Errorf("failed to get block height: %s", err)
+		return
+	}
+
+	rm.redeemLk.Lock()
+	defer rm.redeemLk.Unlock()
+	if rm.redeeming {
+		return
+	}
+	rm.redeeming = true
+
+	go func() {
+		defer func() {
+			rm.redeemLk.Lock()
+			rm.redeeming = false
+			rm.redeemLk.Unlock()
+		}()
+
+		rm.redeemVouchers(context.Background(), types.NewBlockHeight(height))
+	}()
+}
+
+// redeemVouchers redeems the most valuable voucher of every payment channel that reaches its end of life
+// within mining.redeemBlocksBeforeEol blocks, or whose unredeemed amount is at least mining.redeemThreshold.
+func (rm *Miner) redeemVouchers(ctx context.Context, height *types.BlockHeight) {
+	blocksBeforeEol, threshold, err := rm.getRedeemConfig()
+	if err != nil {
+		log.Errorf("failed to get voucher redemption config: %s", err)
+		return
+	}
+
+	vouchers, err := rm.vouchers()
+	if err != nil {
+		log.Errorf("failed to load retrieval vouchers: %s", err)
+		return
+	}
+
+	for _, voucher := range vouchers {
+		key := voucherKey(voucher.Payer, &voucher.Channel)
+
+		rm.redeemLk.Lock()
+		inProcess := rm.redeemsInProcess[key]
+		rm.redeemLk.Unlock()
+		if inProcess {
+			continue
+		}
 
-		if end > len(bs) {
-			end = len(bs)
+		channel, err := rm.getChannel(ctx, voucher.Payer, &voucher.Channel)
+		if err != nil {
+			log.Errorf("failed to get payment channel %s of %s: %s", voucher.Channel.KeyString(), voucher.Payer, err)
+			continue
+		}
+		if height.GreaterEqual(channel.Eol) {
+			// vouchers of an expired channel can no longer be redeemed
+			continue
 		}
 
-		chunk := RetrievePieceChunk{
-			Data: bs[i:end],
+		redeemed := channel.LaneRedeemed(voucher.Lane)
+		if !voucher.Amount.GreaterThan(redeemed) {
+			continue
 		}
 
-		if err := cbu.NewMsgWriter(s).WriteMsg(&chunk); err != nil {
-			log.Warningf("failed to write chunk for CID %s: %s", req.PieceRef.String(), err)
-			return
+		nearEol := height.Add(types.NewBlockHeight(blocksBeforeEol)).GreaterEqual(channel.Eol)
+		overThreshold := threshold != nil && threshold.IsPositive() && voucher.Amount.Sub(redeemed).GreaterEqual(threshold)
+		if !nearEol && !overThreshold {
+			continue
+		}
+
+		if err := rm.redeem(ctx, key, voucher); err != nil {
+			log.Errorf("failed to redeem voucher of payment channel %s of %s: %s", voucher.Channel.KeyString(), voucher.Payer, err)
+		}
+	}
+}
+
+// redeem sends a message redeeming a voucher from the worker, the target of the payment channel, and waits
+// for it in the background so that the channel is not redeemed again in the meantime.
+func (rm *Miner) redeem(ctx context.Context, key datastore.Key, voucher *paymentbroker.PaymentVoucher) error {
+	params, err := paymentbroker.RedeemParams(voucher)
+	if err != nil {
+		return err
+	}
+
+	worker, err := rm.getPaymentAddress(ctx)
+	if err != nil {
+		return err
+	}
+
+	gasPrice, err := rm.porcelainAPI.GasPriceSuggest(ctx)
+	if err != nil {
+		log.Warningf("failed to suggest gas price for redeem message, using zero: %s", err)
+		gasPrice = types.NewGasPrice(0)
+	}
+	gasLimit, err := rm.porcelainAPI.MessageEstimateGas(ctx, worker, address.PaymentBrokerAddress, nil, "redeem", params...)
+	if err != nil {
+		log.Warningf("failed to estimate gas of redeem message, using %d: %s", redeemVouchersGasLimit, err)
+		gasLimit = types.NewGasUnits(redeemVouchersGasLimit)
+	}
+
+	msgCid, err := rm.porcelainAPI.MessageSend(ctx, worker, address.PaymentBrokerAddress, types.ZeroAttoFIL, gasPrice, gasLimit, "redeem", params...)
+	if err != nil {
+		return errors.Wrap(err, "failed to send redeem message")
+	}
+
+	rm.redeemLk.Lock()
+	rm.redeemsInProcess[key] = true
+	rm.redeemLk.Unlock()
+
+	go func() {
+		defer func() {
+			rm.redeemLk.Lock()
+			delete(rm.redeemsInProcess, key)
+			rm.redeemLk.Unlock()
+		}()
+
+		// give up waiting eventually, so that a message that is never mined does not keep the
+		// channel from being redeemed again
+		waitCtx, cancel := context.WithTimeout(ctx, waitForRedeemDuration)
+		defer cancel()
+
+		err := rm.porcelainAPI.MessageWait(waitCtx, msgCid, func(blk *types.Block, smsg *types.SignedMessage, receipt *types.MessageReceipt) error {
+			if receipt.ExitCode != uint8(0) {
+				return fmt.Errorf("redeem message failed with exit code %d", receipt.ExitCode)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Errorf("failed to redeem voucher of payment channel %s of %s: %s", voucher.Channel.KeyString(), voucher.Payer, err)
 		}
+	}()
+
+	return nil
+}
+
+func (rm *Miner) getRedeemConfig() (uint64, *types.AttoFIL, error) {
+	blocksBeforeEol, err := rm.porcelainAPI.ConfigGet("mining.redeemBlocksBeforeEol")
+	if err != nil {
+		return 0, nil, err
+	}
+	blocksBeforeEolUint, ok := blocksBeforeEol.(uint64)
+	if !ok {
+		return 0, nil, errors.New("Could not retrieve redeemBlocksBeforeEol from config")
+	}
+
+	threshold, err := rm.porcelainAPI.ConfigGet("mining.redeemThreshold")
+	if err != nil {
+		return 0, nil, err
+	}
+	thresholdAF, ok := threshold.(*types.AttoFIL)
+	if !ok {
+		return 0, nil, errors.New("Could not retrieve redeemThreshold from config")
+	}
+
+	return blocksBeforeEolUint, thresholdAF, nil
+}
+
+// pieceRangeReader returns a reader over length bytes of the piece read by r, starting at offset. A length
+// of zero reads to the end of the piece.
+func pieceRangeReader(r io.Reader, offset, length uint64) (io.Reader, error) {
+	if offset > 0 {
+		if seeker, ok := r.(io.Seeker); ok {
+			if _, err := seeker.Seek(int64(offset), io.SeekStart); err != nil {
+				return nil, errors.Wrap(err, "failed to seek to offset")
+			}
+		} else if _, err := io.CopyN(ioutil.Discard, r, int64(offset)); err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("offset %d is beyond the end of the piece", offset)
+			}
+			return nil, errors.Wrap(err, "failed to skip to offset")
+		}
+	}
+
+	if length > 0 {
+		return io.LimitReader(r, int64(length)), nil
+	}
+
+	return r, nil
+}
+
+// sendPieceChunks streams the bytes read from r as RetrievePieceChunks without buffering more than a single
+// chunk, followed by the empty chunk marking the end of the piece. If beforeChunk is not nil it is called with
+// the size of each chunk, including the empty one, before it is written; sending stops if it returns an error.
+func sendPieceChunks(r io.Reader, w *cbu.MsgWriter, beforeChunk func(uint64) error) error {
+	sendChunk := func(data []byte) error {
+		if beforeChunk != nil {
+			if err := beforeChunk(uint64(len(data))); err != nil {
+				return err
+			}
+		}
+
+		if err := w.WriteMsg(&RetrievePieceChunk{Data: data}); err != nil {
+			return errors.Wrap(err, "failed to write chunk")
+		}
+		return nil
+	}
+
+	buf := make([]byte, RetrievePieceChunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return errors.Wrap(readErr, "failed to read piece")
+		}
+
+		if err := sendChunk(buf[:n]); err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if readErr != nil {
+			return sendChunk(nil)
+		}
+	}
+}
+
+func writeFailure(s inet.Stream, pieceRef cid.Cid, message string) {
+	resp := RetrievePieceResponse{
+		Status:       Failure,
+		ErrorMessage: message,
+	}
+
+	if err := cbu.NewMsgWriter(s).WriteMsg(&resp); err != nil {
+		log.Warningf("failed to write response for piece with CID %s: %s", pieceRef.String(), err)
 	}
 }
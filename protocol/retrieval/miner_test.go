@@ -0,0 +1,361 @@
+package retrieval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/actor"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/exec"
+	"github.com/filecoin-project/go-filecoin/plumbing/cfg"
+	"github.com/filecoin-project/go-filecoin/repo"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestValidateRetrievalPayment(t *testing.T) {
+	t.Run("Accepts a channel targeting the miner worker", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner := newRetrievalMinerTestSetup()
+
+		paid, err := miner.validateRetrievalPayment(context.Background(), porcelainAPI.paymentInfo())
+		require.NoError(err)
+		assert.True(paid.IsZero())
+	})
+
+	t.Run("Rejects a channel with the wrong target", func(t *testing.T) {
+		assert := assert.New(t)
+
+		porcelainAPI, miner := newRetrievalMinerTestSetup()
+		porcelainAPI.channelTarget = address.TestAddress
+
+		_, err := miner.validateRetrievalPayment(context.Background(), porcelainAPI.paymentInfo())
+		assert.Contains(err.Error(), "not target of payment channel")
+	})
+
+	t.Run("Rejects a channel that expires too soon", func(t *testing.T) {
+		assert := assert.New(t)
+
+		porcelainAPI, miner := newRetrievalMinerTestSetup()
+		porcelainAPI.channelEol = porcelainAPI.blockHeight.Add(types.NewBlockHeight(ChannelRedeemWindow - 1))
+
+		_, err := miner.validateRetrievalPayment(context.Background(), porcelainAPI.paymentInfo())
+		assert.Contains(err.Error(), "less than required eol")
+	})
+
+	t.Run("Starts from the most valuable voucher already received", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner := newRetrievalMinerTestSetup()
+		voucher := porcelainAPI.voucher(types.NewAttoFILFromFIL(7))
+		require.NoError(miner.saveVoucher(voucher))
+
+		paid, err := miner.validateRetrievalPayment(context.Background(), porcelainAPI.paymentInfo())
+		require.NoError(err)
+		assert.True(types.NewAttoFILFromFIL(7).Equal(paid))
+	})
+}
+
+func TestAcceptVoucher(t *testing.T) {
+	t.Run("Accepts and records a sufficient voucher", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner := newRetrievalMinerTestSetup()
+		voucher := porcelainAPI.voucher(types.NewAttoFILFromFIL(10))
+
+		require.NoError(miner.acceptVoucher(context.Background(), porcelainAPI.paymentInfo(), voucher, types.NewAttoFILFromFIL(10)))
+
+		latest, err := miner.LatestVoucher(porcelainAPI.payerAddress, porcelainAPI.channelID)
+		require.NoError(err)
+		assert.True(voucher.Amount.Equal(&latest.Amount))
+	})
+
+	t.Run("Rejects a missing voucher", func(t *testing.T) {
+		assert := assert.New(t)
+
+		porcelainAPI, miner := newRetrievalMinerTestSetup()
+
+		err := miner.acceptVoucher(context.Background(), porcelainAPI.paymentInfo(), nil, types.NewAttoFILFromFIL(10))
+		assert.Contains(err.Error(), "missing payment voucher")
+	})
+
+	t.Run("Rejects an underpaying voucher", func(t *testing.T) {
+		assert := assert.New(t)
+
+		porcelainAPI, miner := newRetrievalMinerTestSetup()
+		voucher := porcelainAPI.voucher(types.NewAttoFILFromFIL(9))
+
+		err := miner.acceptVoucher(context.Background(), porcelainAPI.paymentInfo(), voucher, types.NewAttoFILFromFIL(10))
+		assert.Contains(err.Error(), "less than amount owed")
+	})
+
+	t.Run("Rejects a voucher with an invalid signature", func(t *testing.T) {
+		assert := assert.New(t)
+
+		porcelainAPI, miner := newRetrievalMinerTestSetup()
+		voucher := porcelainAPI.voucher(types.NewAttoFILFromFIL(10))
+		voucher.Signature = types.Signature([]byte{})
+
+		err := miner.acceptVoucher(context.Background(), porcelainAPI.paymentInfo(), voucher, types.NewAttoFILFromFIL(10))
+		assert.Contains(err.Error(), "invalid signature in voucher")
+	})
+
+	t.Run("Rejects a voucher worth less than one already received", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner := newRetrievalMinerTestSetup()
+		require.NoError(miner.acceptVoucher(context.Background(), porcelainAPI.paymentInfo(), porcelainAPI.voucher(types.NewAttoFILFromFIL(20)), types.NewAttoFILFromFIL(10)))
+
+		err := miner.acceptVoucher(context.Background(), porcelainAPI.paymentInfo(), porcelainAPI.voucher(types.NewAttoFILFromFIL(15)), types.NewAttoFILFromFIL(10))
+		assert.Contains(err.Error(), "less than amount of voucher already received")
+	})
+}
+
+func TestAcquireChannel(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	porcelainAPI, miner := newRetrievalMinerTestSetup()
+
+	release, err := miner.acquireChannel(porcelainAPI.paymentInfo())
+	require.NoError(err)
+
+	// a channel pays for one retrieval at a time
+	_, err = miner.acquireChannel(porcelainAPI.paymentInfo())
+	assert.Contains(err.Error(), "paying for another retrieval")
+
+	release()
+	release, err = miner.acquireChannel(porcelainAPI.paymentInfo())
+	require.NoError(err)
+	release()
+}
+
+func TestRedeemVouchers(t *testing.T) {
+	receivedVoucherSetup := func(t *testing.T) (*retrievalMinerTestPorcelain, *Miner, *paymentbroker.PaymentVoucher) {
+		porcelainAPI, miner := newRetrievalMinerTestSetup()
+		voucher := porcelainAPI.voucher(types.NewAttoFILFromFIL(10))
+		require.NoError(t, miner.acceptVoucher(context.Background(), porcelainAPI.paymentInfo(), voucher, types.NewAttoFILFromFIL(10)))
+		return porcelainAPI, miner, voucher
+	}
+
+	t.Run("Redeems the latest voucher near the channel's eol", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, voucher := receivedVoucherSetup(t)
+		miner.redeemVouchers(context.Background(), porcelainAPI.channelEol.Sub(types.NewBlockHeight(10)))
+
+		require.Equal(1, len(porcelainAPI.messagesSent))
+		msg := porcelainAPI.messagesSent[0]
+		assert.Equal(porcelainAPI.workerAddress, msg.from)
+		assert.Equal(address.PaymentBrokerAddress, msg.to)
+		assert.Equal("redeem", msg.method)
+
+		var vouchers []*paymentbroker.PaymentVoucher
+		require.NoError(cbor.DecodeInto(msg.params[2].([]byte), &vouchers))
+		require.Equal(1, len(vouchers))
+		assert.Equal(voucher.Amount, vouchers[0].Amount)
+
+		t.Log("the channel is not redeemed again while the message is pending")
+		miner.redeemsInProcess[voucherKey(voucher.Payer, &voucher.Channel)] = true
+		miner.redeemVouchers(context.Background(), porcelainAPI.channelEol.Sub(types.NewBlockHeight(10)))
+		assert.Equal(1, len(porcelainAPI.messagesSent))
+	})
+
+	t.Run("Redeems once the threshold is reached", func(t *testing.T) {
+		require := require.New(t)
+
+		porcelainAPI, miner, _ := receivedVoucherSetup(t)
+		require.NoError(porcelainAPI.config.Set("mining.redeemThreshold", `"10"`))
+
+		miner.redeemVouchers(context.Background(), porcelainAPI.blockHeight)
+		require.Equal(1, len(porcelainAPI.messagesSent))
+	})
+
+	t.Run("Does not redeem before the eol or threshold", func(t *testing.T) {
+		porcelainAPI, miner, _ := receivedVoucherSetup(t)
+		miner.redeemVouchers(context.Background(), porcelainAPI.blockHeight)
+
+		assert.Equal(t, 0, len(porcelainAPI.messagesSent))
+	})
+
+	t.Run("Does not redeem vouchers already redeemed", func(t *testing.T) {
+		porcelainAPI, miner, voucher := receivedVoucherSetup(t)
+		porcelainAPI.channelLanes = map[string]*paymentbroker.Lane{
+			"0": {AmountRedeemed: &voucher.Amount},
+		}
+		miner.redeemVouchers(context.Background(), porcelainAPI.channelEol.Sub(types.NewBlockHeight(10)))
+
+		assert.Equal(t, 0, len(porcelainAPI.messagesSent))
+	})
+}
+
+func TestVerifyPieceStored(t *testing.T) {
+	assert := assert.New(t)
+
+	porcelainAPI, miner := newRetrievalMinerTestSetup()
+	cidGetter := types.NewCidForTestGetter()
+	porcelainAPI.storedPiece = cidGetter()
+
+	assert.NoError(miner.verifyPieceStored(context.Background(), porcelainAPI.storedPiece))
+
+	err := miner.verifyPieceStored(context.Background(), cidGetter())
+	assert.Contains(err.Error(), "is not stored by miner")
+}
+
+type retrievalMinerTestPorcelain struct {
+	config        *cfg.Config
+	payerAddress  address.Address
+	workerAddress address.Address
+	channelTarget address.Address
+	channelID     *types.ChannelID
+	messageCid    *cid.Cid
+	storedPiece   cid.Cid
+	signer        types.MockSigner
+	blockHeight   *types.BlockHeight
+	channelEol    *types.BlockHeight
+	channelLanes  map[string]*paymentbroker.Lane
+	messagesSent  []redeemMessage
+}
+
+type redeemMessage struct {
+	from, to address.Address
+	method   string
+	params   []interface{}
+}
+
+func newRetrievalMinerTestSetup() (*retrievalMinerTestPorcelain, *Miner) {
+	ki := types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed())
+	payerAddr, err := ki[0].Address()
+	if err != nil {
+		panic("Could not create payer address")
+	}
+
+	addressGetter := address.NewForTestGetter()
+	messageCid := types.NewCidForTestGetter()()
+
+	config := cfg.NewConfig(repo.NewInMemoryRepo())
+	if err := config.Set("mining.minerAddress", addressGetter().String()); err != nil {
+		panic(err)
+	}
+	if err := config.Set("mining.retrievalPrice", `".001"`); err != nil {
+		panic(err)
+	}
+
+	workerAddr := addressGetter()
+	blockHeight := types.NewBlockHeight(773)
+	porcelainAPI := &retrievalMinerTestPorcelain{
+		config:        config,
+		payerAddress:  payerAddr,
+		workerAddress: workerAddr,
+		channelTarget: workerAddr,
+		channelID:     types.NewChannelID(73),
+		messageCid:    &messageCid,
+		signer:        types.NewMockSigner(ki),
+		blockHeight:   blockHeight,
+		channelEol:    blockHeight.Add(types.NewBlockHeight(1000)),
+	}
+
+	miner := &Miner{
+		porcelainAPI:  porcelainAPI,
+		vouchersDs:    repo.NewInMemoryRepo().DealsDatastore(),
+		channelsInUse: make(map[datastore.Key]bool),
+
+		redeemsInProcess: make(map[datastore.Key]bool),
+	}
+
+	return porcelainAPI, miner
+}
+
+func (mtp *retrievalMinerTestPorcelain) paymentInfo() *PaymentInfo {
+	return &PaymentInfo{
+		Payer:         mtp.payerAddress,
+		Channel:       mtp.channelID,
+		ChannelMsgCid: mtp.messageCid,
+	}
+}
+
+func (mtp *retrievalMinerTestPorcelain) voucher(amount *types.AttoFIL) *paymentbroker.PaymentVoucher {
+	voucher := &paymentbroker.PaymentVoucher{
+		Channel: *mtp.channelID,
+		Payer:   mtp.payerAddress,
+		Target:  mtp.workerAddress,
+		Amount:  *amount,
+		ValidAt: *mtp.blockHeight,
+	}
+
+	signature, err := paymentbroker.SignVoucher(voucher, mtp.signer)
+	if err != nil {
+		panic("Could not sign voucher")
+	}
+	voucher.Signature = signature
+
+	return voucher
+}
+
+func (mtp *retrievalMinerTestPorcelain) ChainBlockHeight(ctx context.Context) (*types.BlockHeight, error) {
+	return mtp.blockHeight, nil
+}
+
+func (mtp *retrievalMinerTestPorcelain) ConfigGet(dottedPath string) (interface{}, error) {
+	return mtp.config.Get(dottedPath)
+}
+
+func (mtp *retrievalMinerTestPorcelain) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
+	if method == "verifyPieceStored" {
+		if !mtp.storedPiece.Defined() || !bytes.Equal(params[1].([]byte), mtp.storedPiece.Bytes()) {
+			return nil, nil, errors.New("piece not stored")
+		}
+		return nil, nil, nil
+	}
+
+	channels := map[string]*paymentbroker.PaymentChannel{
+		mtp.channelID.KeyString(): {
+			Target:         mtp.channelTarget,
+			Amount:         types.NewAttoFILFromFIL(100),
+			AmountRedeemed: types.NewAttoFILFromFIL(0),
+			Eol:            mtp.channelEol,
+			Lanes:          mtp.channelLanes,
+		},
+	}
+
+	channelsBytes, err := actor.MarshalStorage(channels)
+	if err != nil {
+		panic(err)
+	}
+	return [][]byte{channelsBytes}, nil, nil
+}
+
+func (mtp *retrievalMinerTestPorcelain) GasPriceSuggest(ctx context.Context) (types.AttoFIL, error) {
+	return types.NewGasPrice(7), nil
+}
+
+func (mtp *retrievalMinerTestPorcelain) MessageEstimateGas(ctx context.Context, from, to address.Address, value *types.AttoFIL, method string, params ...interface{}) (types.GasUnits, error) {
+	return types.NewGasUnits(123), nil
+}
+
+func (mtp *retrievalMinerTestPorcelain) MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error) {
+	mtp.messagesSent = append(mtp.messagesSent, redeemMessage{from: from, to: to, method: method, params: params})
+	return types.SomeCid(), nil
+}
+
+func (mtp *retrievalMinerTestPorcelain) MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error {
+	return nil
+}
+
+func (mtp *retrievalMinerTestPorcelain) MinerGetWorkerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error) {
+	return mtp.workerAddress, nil
+}
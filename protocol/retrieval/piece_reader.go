@@ -0,0 +1,280 @@
+package retrieval
+
+import (
+	"context"
+	"io"
+	"time"
+
+	inet "gx/ipfs/QmTGxDz2CjBucFzPNTiWwzQmTWdrBnzqbqrMucDYMsjuPb/go-libp2p-net"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+)
+
+// MaxRetrievalAttempts is the number of times in a row a client will try to resume an interrupted retrieval
+// before giving up.
+const MaxRetrievalAttempts = 5
+
+// resumeDelay is how long a client waits before resuming an interrupted retrieval.
+var resumeDelay = time.Second
+
+// retrievalError marks errors that end a retrieval rather than cause it to be resumed.
+type retrievalError struct {
+	error
+}
+
+// chunkSource produces the chunks of a requested range of a piece.
+type chunkSource interface {
+	// next returns the data of the next chunk, or io.EOF when the whole range has been received.
+	next() ([]byte, error)
+	Close() error
+}
+
+// openChunkSourceFunc requests length bytes of a piece starting at offset. A length of zero requests the
+// rest of the piece.
+type openChunkSourceFunc func(ctx context.Context, offset, length uint64) (chunkSource, error)
+
+// pieceStream is a chunkSource reading from a single stream to a retrieval miner.
+type pieceStream struct {
+	s      inet.Stream
+	reader *cbu.MsgReader
+	writer *cbu.MsgWriter
+
+	// pay, if set, is called with the size of every chunk the miner announces and must pay the miner for it
+	// before the chunk is sent.
+	pay func(uint64) error
+}
+
+var _ chunkSource = (*pieceStream)(nil)
+
+func newPieceStream(s inet.Stream) *pieceStream {
+	return &pieceStream{
+		s:      s,
+		reader: cbu.NewMsgReader(s),
+		writer: cbu.NewMsgWriter(s),
+	}
+}
+
+// start sends the retrieval request and reads the miner's response to it.
+func (ps *pieceStream) start(req interface{}) error {
+	if err := ps.writer.WriteMsg(req); err != nil {
+		return errors.Wrap(err, "failed to write request message to stream")
+	}
+
+	var res RetrievePieceResponse
+	if err := ps.reader.ReadMsg(&res); err != nil {
+		return errors.Wrap(err, "failed to read response message from stream")
+	}
+
+	if res.Status != Success {
+		return &retrievalError{errors.Errorf("could not retrieve piece - error from miner: %s", res.ErrorMessage)}
+	}
+
+	return nil
+}
+
+func (ps *pieceStream) next() ([]byte, error) {
+	var announced uint64
+	if ps.pay != nil {
+		var req RetrievePiecePaymentRequest
+		if err := ps.reader.ReadMsg(&req); err != nil {
+			return nil, readError(err, "could not read payment request from stream")
+		}
+
+		if req.Size > RetrievePieceChunkSize {
+			return nil, &retrievalError{errors.Errorf("miner requested payment for %d bytes, more than a chunk", req.Size)}
+		}
+
+		if req.Size > 0 {
+			if err := ps.pay(req.Size); err != nil {
+				return nil, err
+			}
+		}
+		announced = req.Size
+	}
+
+	var chunk RetrievePieceChunk
+	if err := ps.reader.ReadMsg(&chunk); err != nil {
+		return nil, readError(err, "could not read chunk from stream")
+	}
+
+	if ps.pay != nil && uint64(len(chunk.Data)) != announced {
+		return nil, &retrievalError{errors.Errorf("miner sent %d bytes after requesting payment for %d", len(chunk.Data), announced)}
+	}
+
+	if len(chunk.Data) == 0 {
+		return nil, io.EOF
+	}
+
+	return chunk.Data, nil
+}
+
+// readError reports a stream that ended before the miner marked the end of the piece as io.ErrUnexpectedEOF,
+// so that the retrieval is resumed.
+func readError(err error, message string) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return errors.Wrap(err, message)
+}
+
+func (ps *pieceStream) Close() error {
+	return ps.s.Close()
+}
+
+// pieceReader streams the bytes of a piece from a retrieval miner. If the transfer is interrupted it reopens
+// the retrieval at the first byte it has not yet received.
+type pieceReader struct {
+	ctx     context.Context
+	open    openChunkSourceFunc
+	onClose func()
+
+	source chunkSource
+	buf    []byte
+	done   bool
+
+	// offset is the position in the piece of the next byte to be received.
+	offset uint64
+
+	// remaining is the number of bytes left to receive if the request was for a bounded range.
+	bounded   bool
+	remaining uint64
+
+	attempts int
+	lastErr  error
+}
+
+var _ io.ReadCloser = (*pieceReader)(nil)
+
+// newPieceReader opens the first chunk source so that request errors are returned immediately. onClose, if
+// not nil, is called once when the reader is closed.
+func newPieceReader(ctx context.Context, open openChunkSourceFunc, offset, length uint64, onClose func()) (*pieceReader, error) {
+	source, err := open(ctx, offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pieceReader{
+		ctx:       ctx,
+		open:      open,
+		onClose:   onClose,
+		source:    source,
+		offset:    offset,
+		bounded:   length > 0,
+		remaining: length,
+	}, nil
+}
+
+// Read implements io.Reader.
+func (pr *pieceReader) Read(p []byte) (int, error) {
+	for len(pr.buf) == 0 {
+		if pr.done {
+			return 0, io.EOF
+		}
+
+		if err := pr.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, pr.buf)
+	pr.buf = pr.buf[n:]
+	return n, nil
+}
+
+// Close implements io.Closer.
+func (pr *pieceReader) Close() error {
+	pr.done = true
+	err := pr.closeSource()
+
+	if pr.onClose != nil {
+		pr.onClose()
+		pr.onClose = nil
+	}
+
+	return err
+}
+
+func (pr *pieceReader) nextChunk() error {
+	for {
+		if pr.source == nil {
+			if err := pr.resume(); err != nil {
+				return err
+			}
+
+			if pr.done {
+				return nil
+			}
+		}
+
+		data, err := pr.source.next()
+		if err == io.EOF {
+			pr.done = true
+			return pr.closeSource()
+		}
+		if err != nil {
+			if _, ok := err.(*retrievalError); ok {
+				return err
+			}
+
+			log.Warningf("retrieval interrupted at offset %d: %s", pr.offset, err)
+			pr.lastErr = err
+			pr.closeSource() // nolint: errcheck
+			continue
+		}
+
+		if pr.bounded && uint64(len(data)) > pr.remaining {
+			data = data[:pr.remaining]
+		}
+
+		pr.attempts = 0
+		pr.buf = data
+		pr.offset += uint64(len(data))
+		if pr.bounded {
+			pr.remaining -= uint64(len(data))
+		}
+
+		return nil
+	}
+}
+
+// resume reopens the retrieval at the current offset.
+func (pr *pieceReader) resume() error {
+	if pr.bounded && pr.remaining == 0 {
+		pr.done = true
+		return nil
+	}
+
+	for {
+		if pr.attempts >= MaxRetrievalAttempts {
+			return errors.Wrapf(pr.lastErr, "failed to resume retrieval at offset %d after %d attempts", pr.offset, pr.attempts)
+		}
+		pr.attempts++
+
+		select {
+		case <-pr.ctx.Done():
+			return pr.ctx.Err()
+		case <-time.After(resumeDelay):
+		}
+
+		source, err := pr.open(pr.ctx, pr.offset, pr.remaining)
+		if err != nil {
+			log.Warningf("failed to resume retrieval at offset %d: %s", pr.offset, err)
+			pr.lastErr = err
+			continue
+		}
+
+		pr.source = source
+		return nil
+	}
+}
+
+func (pr *pieceReader) closeSource() error {
+	if pr.source == nil {
+		return nil
+	}
+
+	err := pr.source.Close()
+	pr.source = nil
+	return err
+}
@@ -0,0 +1,230 @@
+package retrieval
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	cbu "github.com/filecoin-project/go-filecoin/cborutil"
+)
+
+func init() {
+	resumeDelay = 0
+}
+
+func TestPieceRangeReader(t *testing.T) {
+	piece := []byte("0123456789")
+
+	t.Run("Reads the rest of the piece from an offset", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		r, err := pieceRangeReader(bytes.NewReader(piece), 4, 0)
+		require.NoError(err)
+
+		data, err := ioutil.ReadAll(r)
+		require.NoError(err)
+		assert.Equal([]byte("456789"), data)
+	})
+
+	t.Run("Reads a bounded range without seeking", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		r, err := pieceRangeReader(bytes.NewBuffer(piece), 2, 3)
+		require.NoError(err)
+
+		data, err := ioutil.ReadAll(r)
+		require.NoError(err)
+		assert.Equal([]byte("234"), data)
+	})
+
+	t.Run("Rejects an offset beyond the end of the piece", func(t *testing.T) {
+		assert := assert.New(t)
+
+		_, err := pieceRangeReader(bytes.NewBuffer(piece), 11, 0)
+		assert.Contains(err.Error(), "beyond the end of the piece")
+	})
+}
+
+func TestSendPieceChunks(t *testing.T) {
+	piece := bytes.Repeat([]byte{1}, RetrievePieceChunkSize+10)
+
+	t.Run("Announces every chunk before sending it", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		var out bytes.Buffer
+		var announced []uint64
+		require.NoError(sendPieceChunks(bytes.NewReader(piece), cbu.NewMsgWriter(&out), func(n uint64) error {
+			announced = append(announced, n)
+			return nil
+		}))
+		assert.Equal([]uint64{RetrievePieceChunkSize, 10, 0}, announced)
+
+		reader := cbu.NewMsgReader(&out)
+		for _, n := range announced {
+			var chunk RetrievePieceChunk
+			require.NoError(reader.ReadMsg(&chunk))
+			assert.Equal(int(n), len(chunk.Data))
+		}
+	})
+
+	t.Run("Sends nothing that has not been paid for", func(t *testing.T) {
+		assert := assert.New(t)
+
+		var out bytes.Buffer
+		err := sendPieceChunks(bytes.NewReader(piece), cbu.NewMsgWriter(&out), func(n uint64) error {
+			return fmt.Errorf("no payment")
+		})
+		assert.EqualError(err, "no payment")
+		assert.Equal(0, out.Len())
+	})
+}
+
+func TestPieceReader(t *testing.T) {
+	piece := []byte("0123456789")
+
+	t.Run("Resumes an interrupted retrieval where it stopped", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		opener := &testChunkSourceOpener{piece: piece, chunkSize: 2, failAfter: []int{2, 1}}
+		r, err := newPieceReader(context.Background(), opener.open, 0, 0, nil)
+		require.NoError(err)
+
+		data, err := ioutil.ReadAll(r)
+		require.NoError(err)
+		assert.Equal(piece, data)
+		assert.Equal([]uint64{0, 4, 6}, opener.offsets)
+	})
+
+	t.Run("Resumes a bounded range with the remaining length", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		opener := &testChunkSourceOpener{piece: piece, chunkSize: 2, failAfter: []int{1}}
+		r, err := newPieceReader(context.Background(), opener.open, 3, 5, nil)
+		require.NoError(err)
+
+		data, err := ioutil.ReadAll(r)
+		require.NoError(err)
+		assert.Equal([]byte("34567"), data)
+		assert.Equal([]uint64{3, 5}, opener.offsets)
+		assert.Equal([]uint64{5, 3}, opener.lengths)
+	})
+
+	t.Run("Gives up after too many failed attempts", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		failAfter := make([]int, MaxRetrievalAttempts+1)
+		opener := &testChunkSourceOpener{piece: piece, chunkSize: 2, failAfter: failAfter}
+		r, err := newPieceReader(context.Background(), opener.open, 0, 0, nil)
+		require.NoError(err)
+
+		_, err = ioutil.ReadAll(r)
+		assert.Contains(err.Error(), "failed to resume retrieval")
+	})
+
+	t.Run("Does not resume after a retrieval error", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		opener := &testChunkSourceOpener{piece: piece, chunkSize: 2, fatal: true, failAfter: []int{1}}
+		r, err := newPieceReader(context.Background(), opener.open, 0, 0, nil)
+		require.NoError(err)
+
+		_, err = ioutil.ReadAll(r)
+		assert.Contains(err.Error(), "fatal")
+		assert.Equal(1, len(opener.offsets))
+	})
+
+	t.Run("Calls onClose once", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		closed := 0
+		opener := &testChunkSourceOpener{piece: piece, chunkSize: 2}
+		r, err := newPieceReader(context.Background(), opener.open, 0, 0, func() { closed++ })
+		require.NoError(err)
+
+		require.NoError(r.Close())
+		require.NoError(r.Close())
+		assert.Equal(1, closed)
+	})
+}
+
+// testChunkSourceOpener opens chunk sources over piece. The nth source opened fails after sending
+// failAfter[n] chunks; sources opened beyond the end of failAfter send the whole range.
+type testChunkSourceOpener struct {
+	piece     []byte
+	chunkSize int
+	failAfter []int
+	fatal     bool
+
+	offsets []uint64
+	lengths []uint64
+}
+
+func (tco *testChunkSourceOpener) open(ctx context.Context, offset, length uint64) (chunkSource, error) {
+	end := uint64(len(tco.piece))
+	if length > 0 {
+		end = offset + length
+	}
+
+	failAfter := -1
+	if n := len(tco.offsets); n < len(tco.failAfter) {
+		failAfter = tco.failAfter[n]
+	}
+
+	tco.offsets = append(tco.offsets, offset)
+	tco.lengths = append(tco.lengths, length)
+
+	return &testChunkSource{
+		data:      tco.piece[offset:end],
+		chunkSize: tco.chunkSize,
+		failAfter: failAfter,
+		fatal:     tco.fatal,
+	}, nil
+}
+
+type testChunkSource struct {
+	data      []byte
+	chunkSize int
+	failAfter int
+	fatal     bool
+}
+
+func (tcs *testChunkSource) next() ([]byte, error) {
+	if tcs.failAfter == 0 {
+		if tcs.fatal {
+			return nil, &retrievalError{fmt.Errorf("fatal error")}
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	tcs.failAfter--
+
+	if len(tcs.data) == 0 {
+		return nil, io.EOF
+	}
+
+	n := tcs.chunkSize
+	if n > len(tcs.data) {
+		n = len(tcs.data)
+	}
+
+	chunk := tcs.data[:n]
+	tcs.data = tcs.data[n:]
+	return chunk, nil
+}
+
+func (tcs *testChunkSource) Close() error {
+	return nil
+}
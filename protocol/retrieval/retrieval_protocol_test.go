@@ -36,7 +36,7 @@ func TestRetrievalProtocolPieceNotFound(t *testing.T) {
 }
 
 func retrievePieceBytes(ctx context.Context, retrievalClient api.RetrievalClient, data cid.Cid, addr address.Address) ([]byte, error) {
-	r, err := retrievalClient.RetrievePiece(ctx, data, addr)
+	r, err := retrievalClient.RetrievePiece(ctx, data, addr, 0, 0, nil)
 	if err != nil {
 		return nil, err
 	}
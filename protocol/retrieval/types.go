@@ -3,12 +3,22 @@ package retrieval
 import (
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
+
+	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
 )
 
 func init() {
 	cbor.RegisterCborType(RetrievePieceRequest{})
 	cbor.RegisterCborType(RetrievePieceResponse{})
 	cbor.RegisterCborType(RetrievePieceChunk{})
+	cbor.RegisterCborType(RetrievePieceQuery{})
+	cbor.RegisterCborType(RetrievePieceQueryResponse{})
+	cbor.RegisterCborType(PaymentInfo{})
+	cbor.RegisterCborType(RetrievePaidPieceRequest{})
+	cbor.RegisterCborType(RetrievePiecePaymentRequest{})
+	cbor.RegisterCborType(RetrievePiecePayment{})
 }
 
 // RetrievePieceStatus communicates a successful (or failed) piece retrieval
@@ -28,6 +38,12 @@ const (
 // RetrievePieceRequest represents a retrieval miner's request for content.
 type RetrievePieceRequest struct {
 	PieceRef cid.Cid
+
+	// Offset is the number of bytes at the start of the piece to skip
+	Offset uint64
+
+	// Length is the number of bytes to retrieve from Offset. Zero retrieves the rest of the piece.
+	Length uint64
 }
 
 // RetrievePieceResponse contains the requested content.
@@ -36,7 +52,58 @@ type RetrievePieceResponse struct {
 	ErrorMessage string
 }
 
-// RetrievePieceChunk is a subset of bytes for a piece being retrieved.
+// RetrievePieceChunk is a subset of bytes for a piece being retrieved. The miner marks the end of the
+// requested range with an empty chunk.
 type RetrievePieceChunk struct {
 	Data []byte
 }
+
+// RetrievePieceQuery asks a miner for the terms under which it will serve a piece.
+type RetrievePieceQuery struct {
+	PieceRef cid.Cid
+}
+
+// RetrievePieceQueryResponse is a miner's price quote for retrieving a piece.
+type RetrievePieceQueryResponse struct {
+	Status       RetrievePieceStatus
+	ErrorMessage string
+
+	// PricePerByte is the amount the miner charges for each byte it sends
+	PricePerByte *types.AttoFIL
+
+	// PaymentAddress is the address that must be the target of the payment channel
+	PaymentAddress address.Address
+}
+
+// PaymentInfo identifies the payment channel a client will use to pay for a retrieval.
+type PaymentInfo struct {
+	// Payer is the address of the owner of the payment channel
+	Payer address.Address
+
+	// Channel is the ID of the channel the client will use to pay the miner
+	Channel *types.ChannelID
+
+	// ChannelMsgCid is the CID of the message used to create the channel (so the miner can wait for it).
+	ChannelMsgCid *cid.Cid
+}
+
+// RetrievePaidPieceRequest asks a miner to send a piece in exchange for payment vouchers.
+type RetrievePaidPieceRequest struct {
+	PieceRef cid.Cid
+	Offset   uint64
+	Length   uint64
+	Payment  PaymentInfo
+}
+
+// RetrievePiecePaymentRequest is sent by the miner before every RetrievePieceChunk of a paid retrieval,
+// announcing the size of the chunk. The chunk is only sent once the client has paid for it, except for the
+// empty chunk marking the end of the requested range, which is announced with a Size of zero.
+type RetrievePiecePaymentRequest struct {
+	Size uint64
+}
+
+// RetrievePiecePayment is sent by the client in response to a RetrievePiecePaymentRequest. The voucher must
+// cover all bytes received so far in this retrieval and the bytes of the announced chunk.
+type RetrievePiecePayment struct {
+	Voucher *paymentbroker.PaymentVoucher
+}
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"math/big"
 	"sync"
@@ -66,14 +68,19 @@ type clientPorcelainAPI interface {
 	CreatePayments(ctx context.Context, config porcelain.CreatePaymentsParams) (*porcelain.CreatePaymentsReturn, error)
 	GetAndMaybeSetDefaultSenderAddress() (address.Address, error)
 	MinerGetAsk(ctx context.Context, minerAddr address.Address, askID uint64) (miner.Ask, error)
-	MinerGetOwnerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error)
 	MinerGetPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error)
+	MinerGetWorkerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error)
+	SignBytes(data []byte, addr address.Address) (types.Signature, error)
 }
 
 type clientDeal struct {
 	Miner    address.Address
 	Proposal *DealProposal
 	Response *DealResponse
+	// Worker is the worker of the miner that signed the response to the
+	// proposal. The miner's later responses may be signed by it even after
+	// the miner changed its worker.
+	Worker address.Address
 }
 
 // Client is used to make deals directly with storage miners.
@@ -105,7 +112,9 @@ func NewClient(nd clientNode, api clientPorcelainAPI, dealsDs repo.Datastore) (*
 }
 
 // ProposeDeal is
-func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data cid.Cid, askID uint64, duration uint64, allowDuplicates bool) (*DealResponse, error) {
+// If channel is set, the deal is paid on lane of that existing payment channel
+// from the default address instead of a new channel.
+func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data cid.Cid, askID uint64, duration uint64, allowDuplicates bool, channel *types.ChannelID, lane uint64) (*DealResponse, error) {
 	ctx, cancel := context.WithTimeout(ctx, 4*smc.node.GetBlockTime())
 	defer cancel()
 	size, err := smc.node.GetFileSize(ctx, data)
@@ -129,35 +138,51 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 		return nil, err
 	}
 
-	minerOwner, err := smc.api.MinerGetOwnerAddress(ctx, miner)
+	// the miner's worker redeems the vouchers, so it is the target of the channel
+	minerWorker, err := smc.api.MinerGetWorkerAddress(ctx, miner)
 	if err != nil {
 		return nil, err
 	}
 
 	totalPrice := price.MulBigInt(big.NewInt(int64(size * duration)))
 
+	nonce, err := newProposalNonce()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate proposal nonce")
+	}
+
 	proposal := &DealProposal{
 		PieceRef:     data,
 		Size:         types.NewBytesAmount(size),
 		TotalPrice:   totalPrice,
 		Duration:     duration,
 		MinerAddress: miner,
-		// TODO: Sign this proposal
+		Nonce:        nonce,
 	}
 
 	if smc.isMaybeDupDeal(proposal) && !allowDuplicates {
 		return nil, Errors[ErrDupicateDeal]
 	}
+
+	// vouchers may only be redeemed while the miner proves it stores the piece
+	condition, err := PieceStoredCondition(miner, data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create payment condition")
+	}
+
 	// create payment information
 	cpResp, err := smc.api.CreatePayments(ctx, porcelain.CreatePaymentsParams{
 		From:            fromAddress,
-		To:              minerOwner,
+		To:              minerWorker,
 		Value:           *price.MulBigInt(big.NewInt(int64(size * duration))),
 		Duration:        duration,
 		PaymentInterval: VoucherInterval,
 		ChannelExpiry:   *chainHeight.Add(types.NewBlockHeight(duration + ChannelExpiryInterval)),
 		GasPrice:        *types.NewAttoFIL(big.NewInt(CreateChannelGasPrice)),
 		GasLimit:        types.NewGasUnits(CreateChannelGasLimit),
+		Condition:       condition,
+		Channel:         channel,
+		Lane:            lane,
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating payment")
@@ -167,8 +192,13 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 	proposal.Payment.PayChActor = address.PaymentBrokerAddress
 	proposal.Payment.Payer = fromAddress
 	proposal.Payment.ChannelMsgCid = &cpResp.ChannelMsgCid
+	proposal.Payment.Lane = cpResp.Lane
 	proposal.Payment.Vouchers = cpResp.Vouchers
 
+	if err := proposal.Sign(smc.api); err != nil {
+		return nil, errors.Wrap(err, "failed to sign proposal")
+	}
+
 	// send proposal
 	pid, err := smc.api.MinerGetPeerID(ctx, miner)
 	if err != nil {
@@ -181,6 +211,10 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 		return nil, errors.Wrap(err, "error sending proposal")
 	}
 
+	if err := smc.checkResponseSignature(ctx, miner, address.Address{}, &response); err != nil {
+		return nil, err
+	}
+
 	if err := smc.checkDealResponse(ctx, &response); err != nil {
 		return nil, errors.Wrap(err, "response check failed")
 	}
@@ -194,6 +228,16 @@ func (smc *Client) ProposeDeal(ctx context.Context, miner address.Address, data
 	return &response, nil
 }
 
+// newProposalNonce returns a random nonce, which keeps the terms of a proposal
+// distinct from those of earlier proposals for the same piece.
+func newProposalNonce() (uint64, error) {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
 func (smc *Client) recordResponse(resp *DealResponse, miner address.Address, p *DealProposal) error {
 	proposalCid, err := convert.ToCid(p)
 	if err != nil {
@@ -213,6 +257,7 @@ func (smc *Client) recordResponse(resp *DealResponse, miner address.Address, p *
 		Miner:    miner,
 		Proposal: p,
 		Response: resp,
+		Worker:   resp.Signer,
 	}
 	return smc.saveDeal(proposalCid)
 }
@@ -230,20 +275,42 @@ func (smc *Client) checkDealResponse(ctx context.Context, resp *DealResponse) er
 	}
 }
 
-func (smc *Client) minerForProposal(c cid.Cid) (address.Address, error) {
+// checkResponseSignature checks the response is signed by the miner's worker, either the one
+// that signed the response to the proposal, if known, or its current one.
+func (smc *Client) checkResponseSignature(ctx context.Context, miner address.Address, dealWorker address.Address, resp *DealResponse) error {
+	if !resp.VerifySignature() {
+		return fmt.Errorf("response is not signed by miner %s", miner)
+	}
+	if !dealWorker.Empty() && resp.Signer == dealWorker {
+		return nil
+	}
+
+	worker, err := smc.api.MinerGetWorkerAddress(ctx, miner)
+	if err != nil {
+		return errors.Wrap(err, "failed to get worker of miner")
+	}
+	if resp.Signer != worker {
+		return fmt.Errorf("response is not signed by miner %s", miner)
+	}
+
+	return nil
+}
+
+// minerForProposal returns the miner of a proposal and the worker that signed the response to it.
+func (smc *Client) minerForProposal(c cid.Cid) (address.Address, address.Address, error) {
 	smc.dealsLk.Lock()
 	defer smc.dealsLk.Unlock()
 	st, ok := smc.deals[c]
 	if !ok {
-		return address.Address{}, fmt.Errorf("no such proposal by cid: %s", c)
+		return address.Address{}, address.Address{}, fmt.Errorf("no such proposal by cid: %s", c)
 	}
 
-	return st.Miner, nil
+	return st.Miner, st.Worker, nil
 }
 
 // QueryDeal queries an in-progress proposal.
 func (smc *Client) QueryDeal(ctx context.Context, proposalCid cid.Cid) (*DealResponse, error) {
-	mineraddr, err := smc.minerForProposal(proposalCid)
+	mineraddr, worker, err := smc.minerForProposal(proposalCid)
 	if err != nil {
 		return nil, err
 	}
@@ -260,6 +327,10 @@ func (smc *Client) QueryDeal(ctx context.Context, proposalCid cid.Cid) (*DealRes
 		return nil, errors.Wrap(err, "error querying deal")
 	}
 
+	if err := smc.checkResponseSignature(ctx, mineraddr, worker, &resp); err != nil {
+		return nil, err
+	}
+
 	return &resp, nil
 }
 
@@ -32,6 +32,8 @@ func TestProposeDeal(t *testing.T) {
 
 	var proposal *DealProposal
 
+	testAPI := newTestClientAPI()
+
 	testNode := newTestClientNode(func(request interface{}) (interface{}, error) {
 		p, ok := request.(*DealProposal)
 		require.True(ok)
@@ -39,14 +41,15 @@ func TestProposeDeal(t *testing.T) {
 
 		pcid, err := convert.ToCid(p)
 		require.NoError(err)
-		return &DealResponse{
+		resp := &DealResponse{
 			State:       Accepted,
 			Message:     "OK",
 			ProposalCid: pcid,
-		}, nil
+		}
+		require.NoError(resp.Sign(testAPI.signer, testAPI.worker))
+		return resp, nil
 	})
 
-	testAPI := newTestClientAPI()
 	testRepo := repo.NewInMemoryRepo()
 
 	client, err := NewClient(testNode, testAPI, testRepo.DealsDs)
@@ -57,7 +60,7 @@ func TestProposeDeal(t *testing.T) {
 	ctx := context.Background()
 	askID := uint64(67)
 	duration := uint64(10000)
-	dealResponse, err := client.ProposeDeal(ctx, minerAddr, dataCid, askID, duration, false)
+	dealResponse, err := client.ProposeDeal(ctx, minerAddr, dataCid, askID, duration, false, nil, 0)
 	require.NoError(err)
 
 	t.Run("and creates proposal from parameters", func(t *testing.T) {
@@ -66,6 +69,11 @@ func TestProposeDeal(t *testing.T) {
 		assert.Equal(minerAddr, proposal.MinerAddress)
 	})
 
+	t.Run("and signs the proposal with the payer's key", func(t *testing.T) {
+		assert.Equal(testAPI.payer, proposal.Payment.Payer)
+		assert.True(proposal.VerifySignature())
+	})
+
 	t.Run("and creates proposal with file size", func(t *testing.T) {
 		expectedFileSize, err := testNode.GetFileSize(ctx, dataCid)
 		require.NoError(err)
@@ -94,7 +102,7 @@ func TestProposeDeal(t *testing.T) {
 		for i, voucher := range proposal.Payment.Vouchers {
 			assert.Equal(testAPI.channelID, &voucher.Channel)
 			assert.True(voucher.ValidAt.GreaterThan(lastValidAt))
-			assert.Equal(testAPI.target, voucher.Target)
+			assert.Equal(testAPI.worker, voucher.Target)
 			assert.Equal(testAPI.perPayment.MulBigInt(big.NewInt(int64(i+1))), &voucher.Amount)
 			assert.Equal(testAPI.payer, voucher.Payer)
 			lastValidAt = &voucher.ValidAt
@@ -123,27 +131,111 @@ func TestProposeDeal(t *testing.T) {
 		assert.NotNil(response)
 		assert.Equal(response, dealResponse)
 	})
+
+	t.Run("and pays on the given lane of an existing channel", func(t *testing.T) {
+		channel := types.NewChannelID(5)
+		_, err := client.ProposeDeal(ctx, minerAddr, dataCid, askID, duration, true, channel, 3)
+		require.NoError(err)
+
+		assert.Equal(channel, testAPI.paymentsParams.Channel)
+		assert.Equal(uint64(3), testAPI.paymentsParams.Lane)
+		assert.Equal(uint64(3), proposal.Payment.Lane)
+	})
+}
+
+func TestProposeDealRejectsUnsignedResponse(t *testing.T) {
+	require := require.New(t)
+
+	testNode := newTestClientNode(func(request interface{}) (interface{}, error) {
+		pcid, err := convert.ToCid(request.(*DealProposal))
+		require.NoError(err)
+		return &DealResponse{
+			State:       Accepted,
+			ProposalCid: pcid,
+		}, nil
+	})
+
+	client, err := NewClient(testNode, newTestClientAPI(), repo.NewInMemoryRepo().DealsDs)
+	require.NoError(err)
+
+	_, err = client.ProposeDeal(context.Background(), address.NewForTestGetter()(), types.SomeCid(), 67, 10000, false, nil, 0)
+	require.Error(err)
+	require.Contains(err.Error(), "response is not signed by miner")
+}
+
+func TestQueryDealChecksSignerAfterWorkerChange(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	testAPI := newTestClientAPI()
+	var stored *DealResponse
+	testNode := newTestClientNode(func(request interface{}) (interface{}, error) {
+		if p, ok := request.(*DealProposal); ok {
+			pcid, err := convert.ToCid(p)
+			require.NoError(err)
+			stored = &DealResponse{State: Accepted, ProposalCid: pcid}
+			require.NoError(stored.Sign(testAPI.signer, testAPI.worker))
+		}
+		return stored, nil
+	})
+
+	client, err := NewClient(testNode, testAPI, repo.NewInMemoryRepo().DealsDs)
+	require.NoError(err)
+
+	resp, err := client.ProposeDeal(ctx, address.NewForTestGetter()(), types.SomeCid(), 67, 10000, false, nil, 0)
+	require.NoError(err)
+	require.Equal(testAPI.worker, resp.Signer)
+
+	// the miner changes its worker, which did not sign the stored response
+	oldWorker := testAPI.worker
+	testAPI.worker = testAPI.payer
+
+	_, err = client.QueryDeal(ctx, resp.ProposalCid)
+	require.NoError(err)
+
+	// responses signed by the new worker are accepted as well
+	require.NoError(stored.Sign(testAPI.signer, testAPI.worker))
+	_, err = client.QueryDeal(ctx, resp.ProposalCid)
+	require.NoError(err)
+
+	// but not those signed by anyone else
+	other := types.NewMockSigner(types.MustGenerateKeyInfo(1, types.GenerateKeyInfoSeed()))
+	require.NoError(stored.Sign(other, other.Addresses[0]))
+	_, err = client.QueryDeal(ctx, resp.ProposalCid)
+	require.Error(err)
+	require.Contains(err.Error(), "response is not signed by miner")
+
+	// nor responses claiming a signer that did not sign them
+	require.NoError(stored.Sign(other, other.Addresses[0]))
+	stored.Signer = oldWorker
+	_, err = client.QueryDeal(ctx, resp.ProposalCid)
+	require.Error(err)
 }
 
 type clientTestAPI struct {
+	// paymentsParams are the params of the last CreatePayments call
+	paymentsParams porcelain.CreatePaymentsParams
+
 	blockHeight *types.BlockHeight
 	channelID   *types.ChannelID
 	msgCid      cid.Cid
 	payer       address.Address
-	target      address.Address
+	worker      address.Address
+	signer      types.MockSigner
 	perPayment  *types.AttoFIL
 }
 
 func newTestClientAPI() *clientTestAPI {
 	cidGetter := types.NewCidForTestGetter()
-	addressGetter := address.NewForTestGetter()
+	signer := types.NewMockSigner(types.MustGenerateKeyInfo(2, types.GenerateKeyInfoSeed()))
 
 	return &clientTestAPI{
 		blockHeight: types.NewBlockHeight(773),
 		msgCid:      cidGetter(),
 		channelID:   types.NewChannelID(23),
-		payer:       addressGetter(),
-		target:      addressGetter(),
+		payer:       signer.Addresses[0],
+		worker:      signer.Addresses[1],
+		signer:      signer,
 		perPayment:  types.NewAttoFILFromFIL(10),
 	}
 }
@@ -153,6 +245,7 @@ func (ctp *clientTestAPI) ChainBlockHeight(ctx context.Context) (*types.BlockHei
 }
 
 func (ctp *clientTestAPI) CreatePayments(ctx context.Context, config porcelain.CreatePaymentsParams) (*porcelain.CreatePaymentsReturn, error) {
+	ctp.paymentsParams = config
 	resp := &porcelain.CreatePaymentsReturn{
 		CreatePaymentsParams: config,
 		Channel:              ctp.channelID,
@@ -165,7 +258,7 @@ func (ctp *clientTestAPI) CreatePayments(ctx context.Context, config porcelain.C
 		resp.Vouchers[i] = &paymentbroker.PaymentVoucher{
 			Channel: *ctp.channelID,
 			Payer:   ctp.payer,
-			Target:  ctp.target,
+			Target:  config.To,
 			Amount:  *ctp.perPayment.MulBigInt(big.NewInt(int64(i + 1))),
 			ValidAt: *ctp.blockHeight.Add(types.NewBlockHeight(uint64(i+1) * VoucherInterval)),
 		}
@@ -181,10 +274,6 @@ func (ctp *clientTestAPI) MinerGetAsk(ctx context.Context, minerAddr address.Add
 	}, nil
 }
 
-func (ctp *clientTestAPI) MinerGetOwnerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error) {
-	return address.TestAddress, nil
-}
-
 func (ctp *clientTestAPI) MinerGetPeerID(ctx context.Context, minerAddr address.Address) (peer.ID, error) {
 	id, err := peer.IDB58Decode("QmWbMozPyW6Ecagtxq7SXBXXLY5BNdP1GwHB2WoZCKMvcb")
 	if err != nil {
@@ -193,6 +282,14 @@ func (ctp *clientTestAPI) MinerGetPeerID(ctx context.Context, minerAddr address.
 	return id, nil
 }
 
+func (ctp *clientTestAPI) MinerGetWorkerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error) {
+	return ctp.worker, nil
+}
+
+func (ctp *clientTestAPI) SignBytes(data []byte, addr address.Address) (types.Signature, error) {
+	return ctp.signer.SignBytes(data, addr)
+}
+
 func (ctp *clientTestAPI) GetAndMaybeSetDefaultSenderAddress() (address.Address, error) {
 	// always just default address
 	return ctp.payer, nil
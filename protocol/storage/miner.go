@@ -27,6 +27,7 @@ import (
 	"github.com/filecoin-project/go-filecoin/abi"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/miner"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
+	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
 	cbu "github.com/filecoin-project/go-filecoin/cborutil"
 	"github.com/filecoin-project/go-filecoin/exec"
@@ -42,12 +43,21 @@ var log = logging.Logger("/fil/storage")
 const makeDealProtocol = protocol.ID("/fil/storage/mk/1.0.0")
 const queryDealProtocol = protocol.ID("/fil/storage/qry/1.0.0")
 
-// TODO: replace this with a queries to pick reasonable gas price and limits.
-const submitPostGasPrice = 0
+// Gas limits for the messages the miner sends, used when a message's gas can not be estimated.
 const submitPostGasLimit = 300
+const publishDealsGasLimit = 300
+const redeemVouchersGasLimit = 300
+
+// DealPublishBatchSize is the number of staged deals at which the miner publishes them to the storage market,
+// without waiting for their sector to be committed.
+const DealPublishBatchSize = 10
 
 const waitForPaymentChannelDuration = 2 * time.Minute
 
+// waitForRedeemDuration bounds how long the miner waits for a redeem message to be mined before it
+// may redeem the same payment channel again.
+const waitForRedeemDuration = 10 * time.Minute
+
 const minerDatastorePrefix = "miner"
 const dealsAwatingSealDatastorePrefix = "dealsAwaitingSeal"
 
@@ -61,9 +71,21 @@ type Miner struct {
 	dealsDs repo.Datastore
 	dealsLk sync.Mutex
 
+	// responsesLk serializes updates of deal responses, which are signed without holding dealsLk.
+	responsesLk sync.Mutex
+
 	postInProcessLk sync.Mutex
 	postInProcess   *types.BlockHeight
 
+	// publishLk serializes the publication of deals to the storage market.
+	publishLk sync.Mutex
+
+	// redeeming is set while the vouchers are scanned for redemption.
+	redeeming bool
+	// redeemsInProcess holds the payment channels with a redeem message waiting to be mined.
+	redeemsInProcess map[paymentChannelKey]bool
+	redeemLk         sync.Mutex
+
 	dealsAwaitingSeal *dealsAwaitingSealStruct
 
 	porcelainAPI minerPorcelain
@@ -78,14 +100,25 @@ type storageDeal struct {
 	Response *DealResponse
 }
 
+// paymentChannelKey identifies a payment channel by its payer and id.
+type paymentChannelKey struct {
+	payer address.Address
+	chid  string
+}
+
 // minerPorcelain is the subset of the porcelain API that storage.Miner needs.
 type minerPorcelain interface {
 	ChainBlockHeight(ctx context.Context) (*types.BlockHeight, error)
 	ConfigGet(dottedPath string) (interface{}, error)
 
+	GasPriceSuggest(ctx context.Context) (types.AttoFIL, error)
+	MessageEstimateGas(ctx context.Context, from, to address.Address, value *types.AttoFIL, method string, params ...interface{}) (types.GasUnits, error)
 	MessageSend(ctx context.Context, from, to address.Address, value *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error)
 	MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error)
 	MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error
+
+	MinerGetWorkerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error)
+	SignBytes(data []byte, addr address.Address) (types.Signature, error)
 }
 
 // node is subset of node on which this protocol depends. These deps
@@ -165,7 +198,9 @@ func (sm *Miner) handleMakeDeal(s inet.Stream) {
 
 // receiveStorageProposal is the entry point for the miner storage protocol
 func (sm *Miner) receiveStorageProposal(ctx context.Context, p *DealProposal) (*DealResponse, error) {
-	// TODO: Check signature
+	if !p.VerifySignature() {
+		return sm.proposalRejector(ctx, sm, p, "invalid signature in proposal")
+	}
 
 	if err := sm.validateDealPayment(ctx, p); err != nil {
 		return sm.proposalRejector(ctx, sm, p, err.Error())
@@ -199,14 +234,24 @@ func (sm *Miner) validateDealPayment(ctx context.Context, p *DealProposal) error
 		return err
 	}
 
-	// confirm we are target of channel
-	if channel.Target != sm.minerOwnerAddr {
-		return fmt.Errorf("miner account (%s) is not target of payment channel (%s)", sm.minerOwnerAddr.String(), channel.Target.String())
+	// confirm we are target of channel, as the worker redeems the vouchers
+	worker, err := sm.porcelainAPI.MinerGetWorkerAddress(ctx, sm.minerAddr)
+	if err != nil {
+		return errors.Wrap(err, "failed to get miner worker address")
+	}
+	if channel.Target != worker {
+		return fmt.Errorf("miner worker (%s) is not target of payment channel (%s)", worker.String(), channel.Target.String())
 	}
 
-	// confirm channel contains enough funds
-	if channel.Amount.LessThan(expectedPrice) {
-		return fmt.Errorf("payment channel does not contain enough funds (%s < %s)", channel.Amount.String(), expectedPrice.String())
+	// confirm no other deal pays on the same lane and that the channel
+	// contains enough funds for this deal on top of the others it pays for
+	committed, laneInUse := sm.channelCommitment(p.Payment.Payer, p.Payment.Channel, p.Payment.Lane)
+	if laneInUse {
+		return fmt.Errorf("payment channel lane %d is already used by another deal", p.Payment.Lane)
+	}
+	available := channel.Amount.Sub(committed)
+	if available.LessThan(expectedPrice) {
+		return fmt.Errorf("payment channel does not contain enough funds (%s < %s)", available.String(), expectedPrice.String())
 	}
 
 	// start with current block height
@@ -227,13 +272,28 @@ func (sm *Miner) validateDealPayment(ctx context.Context, p *DealProposal) error
 		return errors.New("payments start after deal start interval")
 	}
 
+	condition, err := PieceStoredCondition(sm.minerAddr, p.PieceRef)
+	if err != nil {
+		return errors.Wrap(err, "failed to create payment condition")
+	}
+
 	lastValidAt := expectedFirstPayment
 	for _, v := range p.Payment.Vouchers {
-		// confirm signature is valid against expected actor and channel id
-		if !paymentbroker.VerifyVoucherSignature(p.Payment.Payer, p.Payment.Channel, &v.Amount, &v.ValidAt, v.Signature) {
+		// confirm the voucher pays on the deal's lane of the expected channel
+		if v.Payer != p.Payment.Payer || !v.Channel.Equal(p.Payment.Channel) || v.Lane != p.Payment.Lane || len(v.Merges) > 0 {
+			return errors.New("voucher is not for the deal's payment channel lane")
+		}
+
+		// confirm signature is valid against expected actor
+		if !paymentbroker.VerifyVoucherSignature(v) {
 			return errors.New("invalid signature in voucher")
 		}
 
+		// conditional vouchers must only depend on the piece being stored
+		if v.Condition != nil && !v.Condition.Equals(condition) {
+			return errors.New("voucher condition is not for the proposed piece")
+		}
+
 		// make sure voucher validAt is not spaced to far apart
 		expectedValidAt := lastValidAt.Add(types.NewBlockHeight(VoucherInterval))
 		if v.ValidAt.GreaterThan(expectedValidAt) {
@@ -279,25 +339,53 @@ func (sm *Miner) getStoragePrice() (*types.AttoFIL, error) {
 	return storagePriceAF, nil
 }
 
+// channelCommitment returns the total price of the deals that are paid
+// through the given payment channel and have not been rejected or failed, and
+// whether one of them pays on lane.
+func (sm *Miner) channelCommitment(payer address.Address, chid *types.ChannelID, lane uint64) (*types.AttoFIL, bool) {
+	sm.dealsLk.Lock()
+	defer sm.dealsLk.Unlock()
+
+	committed := types.NewZeroAttoFIL()
+	laneInUse := false
+	for _, deal := range sm.deals {
+		if deal.Response.State == Rejected || deal.Response.State == Failed {
+			continue
+		}
+
+		payment := deal.Proposal.Payment
+		if payment.Payer != payer || payment.Channel == nil || !payment.Channel.Equal(chid) {
+			continue
+		}
+
+		committed = committed.Add(deal.Proposal.TotalPrice)
+		laneInUse = laneInUse || payment.Lane == lane
+	}
+
+	return committed, laneInUse
+}
+
 // some parts of this should be porcelain
 func (sm *Miner) getPaymentChannel(ctx context.Context, p *DealProposal) (*paymentbroker.PaymentChannel, error) {
-	// wait for create channel message
-	messageCid := p.Payment.ChannelMsgCid
-
-	waitCtx, waitCancel := context.WithDeadline(ctx, time.Now().Add(waitForPaymentChannelDuration))
-	err := sm.porcelainAPI.MessageWait(waitCtx, *messageCid, func(blk *types.Block, smsg *types.SignedMessage, receipt *types.MessageReceipt) error {
-		return nil
-	})
-	waitCancel()
-	if err != nil {
-		if err == context.DeadlineExceeded {
-			return nil, errors.Wrap(err, "Timeout waiting for payment channel")
+	// wait for create channel message, unless the deal uses an existing channel
+	if messageCid := p.Payment.ChannelMsgCid; messageCid != nil {
+		waitCtx, waitCancel := context.WithDeadline(ctx, time.Now().Add(waitForPaymentChannelDuration))
+		err := sm.porcelainAPI.MessageWait(waitCtx, *messageCid, func(blk *types.Block, smsg *types.SignedMessage, receipt *types.MessageReceipt) error {
+			return nil
+		})
+		waitCancel()
+		if err != nil {
+			if err == context.DeadlineExceeded {
+				return nil, errors.Wrap(err, "Timeout waiting for payment channel")
+			}
+			return nil, err
 		}
-		return nil, err
 	}
 
-	payer := p.Payment.Payer
+	return sm.getChannel(ctx, p.Payment.Payer, p.Payment.Channel)
+}
 
+func (sm *Miner) getChannel(ctx context.Context, payer address.Address, chid *types.ChannelID) (*paymentbroker.PaymentChannel, error) {
 	ret, _, err := sm.porcelainAPI.MessageQuery(ctx, address.Address{}, address.PaymentBrokerAddress, "ls", payer)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error getting payment channel for payer")
@@ -307,9 +395,9 @@ func (sm *Miner) getPaymentChannel(ctx context.Context, p *DealProposal) (*payme
 	if err := cbor.DecodeInto(ret[0], &channels); err != nil {
 		return nil, errors.Wrap(err, "Could not decode payment channels for payer")
 	}
-	channel, ok := channels[p.Payment.Channel.KeyString()]
+	channel, ok := channels[chid.KeyString()]
 	if !ok {
-		return nil, fmt.Errorf("could not find payment channel for payer %s and id %s", payer.String(), p.Payment.Channel.KeyString())
+		return nil, fmt.Errorf("could not find payment channel for payer %s and id %s", payer.String(), chid.KeyString())
 	}
 	return channel, nil
 }
@@ -327,7 +415,9 @@ func acceptProposal(ctx context.Context, sm *Miner, p *DealProposal) (*DealRespo
 	resp := &DealResponse{
 		State:       Accepted,
 		ProposalCid: proposalCid,
-		Signature:   types.Signature("signaturrreee"),
+	}
+	if err := sm.signResponse(ctx, resp); err != nil {
+		return nil, err
 	}
 
 	sm.dealsLk.Lock()
@@ -359,7 +449,9 @@ func rejectProposal(ctx context.Context, sm *Miner, p *DealProposal, reason stri
 		State:       Rejected,
 		ProposalCid: proposalCid,
 		Message:     reason,
-		Signature:   types.Signature("signaturrreee"),
+	}
+	if err := sm.signResponse(ctx, resp); err != nil {
+		return nil, err
 	}
 
 	sm.dealsLk.Lock()
@@ -382,16 +474,41 @@ func (sm *Miner) getStorageDeal(c cid.Cid) *storageDeal {
 	return sm.deals[c]
 }
 
+// signResponse signs resp with the key of the miner's worker.
+func (sm *Miner) signResponse(ctx context.Context, resp *DealResponse) error {
+	worker, err := sm.porcelainAPI.MinerGetWorkerAddress(ctx, sm.minerAddr)
+	if err != nil {
+		return errors.Wrap(err, "failed to get worker of miner")
+	}
+
+	if err := resp.Sign(sm.porcelainAPI, worker); err != nil {
+		return errors.Wrap(err, "failed to sign deal response")
+	}
+
+	return nil
+}
+
+// updateDealResponse applies f to a copy of the response of a deal, signs it and replaces the response with it.
+// The response is signed without holding dealsLk, since the signer may be slow.
 func (sm *Miner) updateDealResponse(proposalCid cid.Cid, f func(*DealResponse)) error {
+	sm.responsesLk.Lock()
+	defer sm.responsesLk.Unlock()
+
+	resp := *sm.getStorageDeal(proposalCid).Response
+	f(&resp)
+	if err := sm.signResponse(context.Background(), &resp); err != nil {
+		return err
+	}
+
 	sm.dealsLk.Lock()
 	defer sm.dealsLk.Unlock()
-	f(sm.deals[proposalCid].Response)
+	sm.deals[proposalCid].Response = &resp
 	err := sm.saveDeal(proposalCid)
 	if err != nil {
 		return errors.Wrap(err, "failed to store updated deal response in datastore")
 	}
 
-	log.Debugf("Miner.updateDealResponse(%s) - %d", proposalCid.String(), sm.deals[proposalCid].Response)
+	log.Debugf("Miner.updateDealResponse(%s) - %d", proposalCid.String(), resp.State)
 	return nil
 }
 
@@ -468,6 +585,121 @@ func (sm *Miner) processStorageDeal(c cid.Cid) {
 	if err := sm.saveDealsAwaitingSeal(); err != nil {
 		log.Errorf("could not save deal awaiting seal: %s", err)
 	}
+
+	if len(sm.stagedDeals()) >= DealPublishBatchSize {
+		if err := sm.publishDeals(ctx); err != nil {
+			log.Errorf("failed to publish deals: %s", err)
+		}
+	}
+}
+
+// stagedDeals returns the cids of the deals whose data has been staged, but that have not been published yet.
+func (sm *Miner) stagedDeals() []cid.Cid {
+	sm.dealsLk.Lock()
+	defer sm.dealsLk.Unlock()
+
+	var staged []cid.Cid
+	for c, d := range sm.deals {
+		if d.Response.State == Staged {
+			staged = append(staged, c)
+		}
+	}
+	return staged
+}
+
+// publishDeals publishes all staged deals to the storage market in a single message, and waits for it to be
+// mined.
+func (sm *Miner) publishDeals(ctx context.Context) error {
+	sm.publishLk.Lock()
+	defer sm.publishLk.Unlock()
+
+	staged := sm.stagedDeals()
+	if len(staged) == 0 {
+		return nil
+	}
+
+	deals := make([]storagemarket.Deal, len(staged))
+	for i, c := range staged {
+		d := sm.getStorageDeal(c)
+		deals[i] = storagemarket.Deal{
+			Terms:           *d.Proposal.Terms(),
+			ClientSignature: d.Proposal.Signature,
+		}
+	}
+
+	dealsBytes, err := cbor.DumpObject(deals)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal deals")
+	}
+
+	worker, err := sm.porcelainAPI.MinerGetWorkerAddress(ctx, sm.minerAddr)
+	if err != nil {
+		return errors.Wrap(err, "failed to get worker of miner")
+	}
+
+	gasPrice, gasLimit := sm.messageGas(ctx, publishDealsGasLimit, worker, sm.minerAddr, "publishDeals", dealsBytes)
+
+	msgCid, err := sm.porcelainAPI.MessageSend(ctx, worker, sm.minerAddr, types.ZeroAttoFIL, gasPrice, gasLimit, "publishDeals", dealsBytes)
+	if err != nil {
+		return errors.Wrap(err, "failed to send publishDeals message")
+	}
+
+	var ids []uint64
+	err = sm.porcelainAPI.MessageWait(ctx, msgCid, func(blk *types.Block, smsg *types.SignedMessage, receipt *types.MessageReceipt) error {
+		if receipt.ExitCode != uint8(0) {
+			return fmt.Errorf("publishDeals message failed with exit code %d", receipt.ExitCode)
+		}
+
+		idsVal, err := abi.Deserialize(receipt.Return[0], abi.UintArray)
+		if err != nil {
+			return errors.Wrap(err, "could not deserialize deal ids")
+		}
+		ids = idsVal.Val.([]uint64)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(ids) != len(staged) {
+		return fmt.Errorf("storage market returned %d deal ids for %d deals", len(ids), len(staged))
+	}
+
+	for i, c := range staged {
+		id := ids[i]
+		err := sm.updateDealResponse(c, func(resp *DealResponse) {
+			resp.State = Published
+			resp.DealID = id
+		})
+		if err != nil {
+			log.Errorf("deal %s was published with id %d but could not update to 'Published' state: %s", c, id, err)
+		}
+	}
+
+	return nil
+}
+
+// PublishDealsForSector publishes all staged deals, and returns the ids of the published deals stored in the
+// sector with the given id. It must be called before the sector is committed so that the storage market can
+// record which sector the deals are stored in, and fails if any of the deals is not published.
+func (sm *Miner) PublishDealsForSector(ctx context.Context, sectorID uint64) ([]uint64, error) {
+	if err := sm.publishDeals(ctx); err != nil {
+		return nil, err
+	}
+
+	sm.dealsAwaitingSeal.l.Lock()
+	dealCids := append([]cid.Cid{}, sm.dealsAwaitingSeal.SectorsToDeals[sectorID]...)
+	sm.dealsAwaitingSeal.l.Unlock()
+
+	ids := []uint64{}
+	for _, c := range dealCids {
+		d := sm.getStorageDeal(c)
+		if d == nil || d.Response.State != Published {
+			return nil, fmt.Errorf("deal %s in sector %d has not been published", c, sectorID)
+		}
+		ids = append(ids, d.Response.DealID)
+	}
+
+	return ids, nil
 }
 
 // dealsAwaitingSealStruct is a container for keeping track of which sectors have
@@ -614,10 +846,17 @@ func (sm *Miner) onCommitFail(dealCid cid.Cid, message string) {
 }
 
 // OnNewHeaviestTipSet is a callback called by node, everytime the the latest head is updated.
-// It is used to check if we are in a new proving period and need to trigger PoSt submission.
+// It is used to redeem vouchers that are due in the background, and to check if we are in a new
+// proving period and need to trigger PoSt submission.
 func (sm *Miner) OnNewHeaviestTipSet(ts types.TipSet) {
 	ctx := context.Background()
 
+	if height, err := ts.Height(); err != nil {
+		log.Errorf("failed to get block height: %s", err)
+	} else {
+		sm.startRedeemingVouchers(types.NewBlockHeight(height))
+	}
+
 	rets, sig, err := sm.porcelainAPI.MessageQuery(
 		ctx,
 		address.Address{},
@@ -684,16 +923,21 @@ func (sm *Miner) OnNewHeaviestTipSet(ts types.TipSet) {
 
 	h := types.NewBlockHeight(height)
 	provingPeriodEnd := provingPeriodStart.Add(miner.ProvingPeriodBlocks)
+	gracePeriodEnd := provingPeriodEnd.Add(miner.GracePeriodBlocks)
 
 	if h.GreaterEqual(provingPeriodStart) {
-		if h.LessThan(provingPeriodEnd) {
+		if h.LessThan(gracePeriodEnd) {
+			if h.GreaterEqual(provingPeriodEnd) {
+				// we are late, but can still submit and pay a fee from our collateral
+				log.Warningf("submitting late PoSt start=%s end=%s current=%s", provingPeriodStart, provingPeriodEnd, h)
+			}
+
 			// we are in a new proving period, lets get this post going
 			sm.postInProcess = provingPeriodStart
-			go sm.submitPoSt(provingPeriodStart, provingPeriodEnd, inputs)
+			go sm.submitPoSt(provingPeriodStart, gracePeriodEnd, inputs)
 		} else {
-			// we are too late
-			// TODO: figure out faults and payments here
-			log.Errorf("too late start=%s  end=%s current=%s", provingPeriodStart, provingPeriodEnd, h)
+			// we are too late, and can be slashed by anyone
+			log.Errorf("too late start=%s grace period end=%s current=%s", provingPeriodStart, gracePeriodEnd, h)
 		}
 	}
 }
@@ -746,8 +990,8 @@ func (sm *Miner) submitPoSt(start, end *types.BlockHeight, inputs []generatePost
 		return
 	}
 	if len(faults) != 0 {
-		log.Warningf("some faults when generating PoSt: %v", faults)
-		// TODO: proper fault handling
+		// faulty sectors are declared along with the PoSt, and no longer count towards our power
+		log.Warningf("declaring faulty sectors in PoSt: %v", faults)
 	}
 
 	height, err := sm.node.BlockHeight()
@@ -763,7 +1007,7 @@ func (sm *Miner) submitPoSt(start, end *types.BlockHeight, inputs []generatePost
 	}
 
 	if height.GreaterEqual(end) {
-		// TODO: we are too late, figure out faults and decide if we want to still submit
+		// the grace period is over, the chain will no longer accept this PoSt
 		log.Errorf("PoSt generation was too slow height=%s end=%s", height, end)
 		return
 	}
@@ -772,11 +1016,16 @@ func (sm *Miner) submitPoSt(start, end *types.BlockHeight, inputs []generatePost
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer cancel()
 
-	// TODO: algorithmically determine appropriate values for these
-	gasPrice := types.NewGasPrice(submitPostGasPrice)
-	gasLimit := types.NewGasUnits(submitPostGasLimit)
+	// the worker may have been changed since the miner started, so look it up every time
+	workerAddr, err := sm.porcelainAPI.MinerGetWorkerAddress(ctx, sm.minerAddr)
+	if err != nil {
+		log.Errorf("failed to submit PoSt, as the miner's worker can not be determined: %s", err)
+		return
+	}
+
+	gasPrice, gasLimit := sm.messageGas(ctx, submitPostGasLimit, workerAddr, sm.minerAddr, "submitPoSt", proof[:], faults)
 
-	_, err = sm.porcelainAPI.MessageSend(ctx, sm.minerOwnerAddr, sm.minerAddr, types.ZeroAttoFIL, gasPrice, gasLimit, "submitPoSt", proof[:])
+	_, err = sm.porcelainAPI.MessageSend(ctx, workerAddr, sm.minerAddr, types.ZeroAttoFIL, gasPrice, gasLimit, "submitPoSt", proof[:], faults)
 	if err != nil {
 		log.Errorf("failed to submit PoSt: %s", err)
 		return
@@ -785,16 +1034,246 @@ func (sm *Miner) submitPoSt(start, end *types.BlockHeight, inputs []generatePost
 	log.Debug("submitted PoSt")
 }
 
-// Query responds to a query for the proposal referenced by the given cid
-func (sm *Miner) Query(ctx context.Context, c cid.Cid) *DealResponse {
+// startRedeemingVouchers redeems the vouchers that are due at height in the background, unless
+// they are still being scanned since an earlier head.
+func (sm *Miner) startRedeemingVouchers(height *types.BlockHeight) {
+	sm.redeemLk.Lock()
+	defer sm.redeemLk.Unlock()
+	if sm.redeeming {
+		return
+	}
+	sm.redeeming = true
+
+	go func() {
+		defer func() {
+			sm.redeemLk.Lock()
+			sm.redeeming = false
+			sm.redeemLk.Unlock()
+		}()
+
+		sm.redeemVouchers(context.Background(), height)
+	}()
+}
+
+// redeemVouchers redeems the best vouchers of the miner's committed deals for every payment
+// channel that reaches its end of life within mining.redeemBlocksBeforeEol blocks, or whose
+// unredeemed vouchers are worth at least mining.redeemThreshold.
+func (sm *Miner) redeemVouchers(ctx context.Context, height *types.BlockHeight) {
+	blocksBeforeEol, threshold, err := sm.getRedeemConfig()
+	if err != nil {
+		log.Errorf("failed to get voucher redemption config: %s", err)
+		return
+	}
+
+	for key, vouchers := range sm.bestVouchers(height) {
+		sm.redeemLk.Lock()
+		inProcess := sm.redeemsInProcess[key]
+		sm.redeemLk.Unlock()
+		if inProcess {
+			continue
+		}
+
+		channel, err := sm.getChannel(ctx, key.payer, &vouchers[0].Channel)
+		if err != nil {
+			log.Errorf("failed to get payment channel %s of %s: %s", key.chid, key.payer, err)
+			continue
+		}
+		if height.GreaterEqual(channel.Eol) {
+			// vouchers of an expired channel can no longer be redeemed
+			continue
+		}
+
+		var redeemable []*paymentbroker.PaymentVoucher
+		unredeemed := types.NewZeroAttoFIL()
+		for _, v := range vouchers {
+			redeemed := channel.LaneRedeemed(v.Lane)
+			if v.Amount.GreaterThan(redeemed) {
+				redeemable = append(redeemable, v)
+				unredeemed = unredeemed.Add(v.Amount.Sub(redeemed))
+			}
+		}
+		if len(redeemable) == 0 {
+			continue
+		}
+
+		nearEol := height.Add(types.NewBlockHeight(blocksBeforeEol)).GreaterEqual(channel.Eol)
+		overThreshold := threshold != nil && threshold.IsPositive() && unredeemed.GreaterEqual(threshold)
+		if !nearEol && !overThreshold {
+			continue
+		}
+
+		if err := sm.redeem(ctx, key, redeemable); err != nil {
+			log.Errorf("failed to redeem vouchers of payment channel %s of %s: %s", key.chid, key.payer, err)
+		}
+	}
+}
+
+// bestVouchers returns, grouped by payment channel, the voucher paying the most that is valid at
+// the given height for each deal whose sector has been committed. The vouchers are read from the
+// deals persisted by the miner.
+func (sm *Miner) bestVouchers(height *types.BlockHeight) map[paymentChannelKey][]*paymentbroker.PaymentVoucher {
+	best := make(map[paymentChannelKey][]*paymentbroker.PaymentVoucher)
+	for _, dealCid := range sm.committedDeals() {
+		vouchers, err := sm.LoadVouchersForDeal(dealCid)
+		if err != nil {
+			log.Errorf("failed to load vouchers of deal %s: %s", dealCid, err)
+			continue
+		}
+
+		var voucher *paymentbroker.PaymentVoucher
+		for _, v := range vouchers {
+			if v.ValidAt.LessEqual(height) && (voucher == nil || v.Amount.GreaterThan(&voucher.Amount)) {
+				voucher = v
+			}
+		}
+		if voucher == nil {
+			continue
+		}
+
+		key := paymentChannelKey{payer: voucher.Payer, chid: voucher.Channel.KeyString()}
+		best[key] = append(best[key], voucher)
+	}
+	return best
+}
+
+// committedDeals returns the proposal cids of the deals whose sector has been committed.
+func (sm *Miner) committedDeals() []cid.Cid {
 	sm.dealsLk.Lock()
 	defer sm.dealsLk.Unlock()
-	d, ok := sm.deals[c]
+
+	var committed []cid.Cid
+	for dealCid, deal := range sm.deals {
+		// vouchers are conditioned on the piece being proven, so earlier deals cannot be paid
+		if deal.Response.State == Posted || deal.Response.State == Complete {
+			committed = append(committed, dealCid)
+		}
+	}
+	return committed
+}
+
+// LoadVouchersForDeal loads the vouchers of a deal made with the miner from disk.
+func (sm *Miner) LoadVouchersForDeal(dealCid cid.Cid) ([]*paymentbroker.PaymentVoucher, error) {
+	key := datastore.KeyWithNamespaces([]string{minerDatastorePrefix, dealCid.String()})
+	raw, err := sm.dealsDs.Get(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get deal from datastore")
+	}
+
+	var deal storageDeal
+	if err := cbor.DecodeInto(raw, &deal); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal deal from datastore")
+	}
+	return deal.Proposal.Payment.Vouchers, nil
+}
+
+// messageGas returns the gas price and limit for a message the miner sends: the suggested gas price,
+// and the estimated gas of the message. It falls back to a zero gas price and to fallbackLimit when
+// these can not be determined.
+func (sm *Miner) messageGas(ctx context.Context, fallbackLimit uint64, from, to address.Address, method string, params ...interface{}) (types.AttoFIL, types.GasUnits) {
+	gasPrice, err := sm.porcelainAPI.GasPriceSuggest(ctx)
+	if err != nil {
+		log.Warningf("failed to suggest gas price for %s message, using zero: %s", method, err)
+		gasPrice = types.NewGasPrice(0)
+	}
+
+	gasLimit, err := sm.porcelainAPI.MessageEstimateGas(ctx, from, to, nil, method, params...)
+	if err != nil {
+		log.Warningf("failed to estimate gas of %s message, using %d: %s", method, fallbackLimit, err)
+		gasLimit = types.NewGasUnits(fallbackLimit)
+	}
+
+	return gasPrice, gasLimit
+}
+
+// redeem sends a message redeeming the vouchers of a payment channel, and waits for it in the
+// background so that the channel is not redeemed again in the meantime.
+func (sm *Miner) redeem(ctx context.Context, key paymentChannelKey, vouchers []*paymentbroker.PaymentVoucher) error {
+	params, err := paymentbroker.RedeemParams(vouchers...)
+	if err != nil {
+		return err
+	}
+
+	// the channel pays the sender of the message, which must be its target: the worker
+	worker, err := sm.porcelainAPI.MinerGetWorkerAddress(ctx, sm.minerAddr)
+	if err != nil {
+		return errors.Wrap(err, "failed to get miner worker address")
+	}
+
+	gasPrice, gasLimit := sm.messageGas(ctx, redeemVouchersGasLimit*uint64(len(vouchers)), worker, address.PaymentBrokerAddress, "redeem", params...)
+
+	msgCid, err := sm.porcelainAPI.MessageSend(ctx, worker, address.PaymentBrokerAddress, types.ZeroAttoFIL, gasPrice, gasLimit, "redeem", params...)
+	if err != nil {
+		return errors.Wrap(err, "failed to send redeem message")
+	}
+
+	sm.redeemLk.Lock()
+	if sm.redeemsInProcess == nil {
+		sm.redeemsInProcess = make(map[paymentChannelKey]bool)
+	}
+	sm.redeemsInProcess[key] = true
+	sm.redeemLk.Unlock()
+
+	go func() {
+		defer func() {
+			sm.redeemLk.Lock()
+			delete(sm.redeemsInProcess, key)
+			sm.redeemLk.Unlock()
+		}()
+
+		// give up waiting eventually, so that a message that is never mined does not keep the
+		// channel from being redeemed again
+		waitCtx, cancel := context.WithTimeout(ctx, waitForRedeemDuration)
+		defer cancel()
+
+		err := sm.porcelainAPI.MessageWait(waitCtx, msgCid, func(blk *types.Block, smsg *types.SignedMessage, receipt *types.MessageReceipt) error {
+			if receipt.ExitCode != uint8(0) {
+				return fmt.Errorf("redeem message failed with exit code %d", receipt.ExitCode)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Errorf("failed to redeem vouchers of payment channel %s of %s: %s", key.chid, key.payer, err)
+		}
+	}()
+
+	return nil
+}
+
+func (sm *Miner) getRedeemConfig() (uint64, *types.AttoFIL, error) {
+	blocksBeforeEol, err := sm.porcelainAPI.ConfigGet("mining.redeemBlocksBeforeEol")
+	if err != nil {
+		return 0, nil, err
+	}
+	blocksBeforeEolUint, ok := blocksBeforeEol.(uint64)
 	if !ok {
-		return &DealResponse{
-			State:   Unknown,
-			Message: "no such deal",
+		return 0, nil, errors.New("Could not retrieve redeemBlocksBeforeEol from config")
+	}
+
+	threshold, err := sm.porcelainAPI.ConfigGet("mining.redeemThreshold")
+	if err != nil {
+		return 0, nil, err
+	}
+	thresholdAF, ok := threshold.(*types.AttoFIL)
+	if !ok {
+		return 0, nil, errors.New("Could not retrieve redeemThreshold from config")
+	}
+
+	return blocksBeforeEolUint, thresholdAF, nil
+}
+
+// Query responds to a query for the proposal referenced by the given cid
+func (sm *Miner) Query(ctx context.Context, c cid.Cid) *DealResponse {
+	d := sm.getStorageDeal(c)
+	if d == nil {
+		resp := &DealResponse{
+			State:       Unknown,
+			Message:     "no such deal",
+			ProposalCid: c,
+		}
+		if err := sm.signResponse(ctx, resp); err != nil {
+			log.Errorf("failed to sign query response: %s", err)
 		}
+		return resp
 	}
 
 	return d.Response
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
+	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 
 	"github.com/filecoin-project/go-filecoin/actor"
 	"github.com/filecoin-project/go-filecoin/actor/builtin/paymentbroker"
@@ -30,6 +31,7 @@ func TestReceiveStorageProposal(t *testing.T) {
 		porcelainAPI := newMinerTestPorcelain()
 		miner := Miner{
 			porcelainAPI:   porcelainAPI,
+			minerAddr:      porcelainAPI.targetAddress,
 			minerOwnerAddr: porcelainAPI.targetAddress,
 			proposalAcceptor: func(ctx context.Context, m *Miner, p *DealProposal) (*DealResponse, error) {
 				accepted = true
@@ -52,6 +54,20 @@ func TestReceiveStorageProposal(t *testing.T) {
 		assert.Equal("", message)
 	})
 
+	t.Run("Rejects proposals not signed by the payer", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		_, miner, proposal := newMinerTestSetup()
+		proposal.Duration = 20000
+
+		res, err := miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+
+		assert.Equal(Rejected, res.State)
+		assert.Equal("invalid signature in proposal", res.Message)
+	})
+
 	t.Run("Rejects proposals with insufficient TotalPrice", func(t *testing.T) {
 		assert := assert.New(t)
 		require := require.New(t)
@@ -86,8 +102,8 @@ func TestReceiveStorageProposal(t *testing.T) {
 		assert := assert.New(t)
 		require := require.New(t)
 
-		_, miner, proposal := newMinerTestSetup()
-		miner.minerOwnerAddr = address.TestAddress
+		porcelainAPI, miner, proposal := newMinerTestSetup()
+		porcelainAPI.workerAddress = address.TestAddress
 
 		res, err := miner.receiveStorageProposal(context.Background(), proposal)
 		require.NoError(err)
@@ -138,6 +154,84 @@ func TestReceiveStorageProposal(t *testing.T) {
 		assert.Contains(res.Message, "invalid signature in voucher")
 	})
 
+	t.Run("Rejects proposals with vouchers conditioned on another piece", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := newMinerTestSetup()
+		proposal.PieceRef = types.NewCidForTestGetter()()
+		require.NoError(proposal.Sign(porcelainAPI.signer))
+
+		res, err := miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+
+		assert.Equal(Rejected, res.State)
+		assert.Contains(res.Message, "voucher condition is not for the proposed piece")
+	})
+
+	t.Run("Accepts proposals on a free lane of a channel paying for another deal", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := newMinerTestSetup()
+		miner.deals = map[cid.Cid]*storageDeal{
+			types.SomeCid(): {Proposal: proposal, Response: &DealResponse{State: Staged}},
+		}
+
+		res, err := miner.receiveStorageProposal(context.Background(), testDealProposalOnLane(porcelainAPI, VoucherInterval, 1773, porcelainAPI.targetAddress, 1))
+		require.NoError(err)
+
+		assert.Equal(Accepted, res.State)
+	})
+
+	t.Run("Rejects proposals on a lane used by another deal", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := newMinerTestSetup()
+		miner.deals = map[cid.Cid]*storageDeal{
+			types.SomeCid(): {Proposal: proposal, Response: &DealResponse{State: Staged}},
+		}
+
+		res, err := miner.receiveStorageProposal(context.Background(), testDealProposalOnLane(porcelainAPI, VoucherInterval, 1773, porcelainAPI.targetAddress, 0))
+		require.NoError(err)
+
+		assert.Equal(Rejected, res.State)
+		assert.Contains(res.Message, "lane 0 is already used by another deal")
+	})
+
+	t.Run("Rejects proposals when other deals use up the channel", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := newMinerTestSetup()
+		proposal.TotalPrice = types.NewAttoFILFromFIL(99000)
+		miner.deals = map[cid.Cid]*storageDeal{
+			types.SomeCid(): {Proposal: proposal, Response: &DealResponse{State: Staged}},
+		}
+
+		res, err := miner.receiveStorageProposal(context.Background(), testDealProposalOnLane(porcelainAPI, VoucherInterval, 1773, porcelainAPI.targetAddress, 1))
+		require.NoError(err)
+
+		assert.Equal(Rejected, res.State)
+		assert.Contains(res.Message, "does not contain enough funds")
+	})
+
+	t.Run("Rejects proposals with vouchers on another lane", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := newMinerTestSetup()
+		proposal.Payment.Lane = 1
+		require.NoError(proposal.Sign(porcelainAPI.signer))
+
+		res, err := miner.receiveStorageProposal(context.Background(), proposal)
+		require.NoError(err)
+
+		assert.Equal(Rejected, res.State)
+		assert.Contains(res.Message, "voucher is not for the deal's payment channel lane")
+	})
+
 	t.Run("Rejects proposals with when payments start too late", func(t *testing.T) {
 		assert := assert.New(t)
 		require := require.New(t)
@@ -183,6 +277,101 @@ func TestReceiveStorageProposal(t *testing.T) {
 	})
 }
 
+func TestMinerRedeemVouchers(t *testing.T) {
+	committedDealSetup := func() (*minerTestPorcelain, *Miner, *DealProposal) {
+		porcelainAPI, miner, proposal := newMinerTestSetup()
+		proposalCid := types.SomeCid()
+		miner.dealsDs = repo.NewInMemoryRepo().DealsDatastore()
+		miner.deals = map[cid.Cid]*storageDeal{
+			proposalCid: {Proposal: proposal, Response: &DealResponse{State: Posted, ProposalCid: proposalCid}},
+		}
+		if err := miner.saveDeal(proposalCid); err != nil {
+			panic(err)
+		}
+		return porcelainAPI, miner, proposal
+	}
+
+	t.Run("redeems the best voucher near the channel's eol", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := committedDealSetup()
+		miner.redeemVouchers(context.Background(), porcelainAPI.channelEol.Sub(types.NewBlockHeight(10)))
+
+		require.Equal(1, len(porcelainAPI.messagesSent))
+		msg := porcelainAPI.messagesSent[0]
+		assert.Equal(porcelainAPI.workerAddress, msg.from)
+		assert.Equal(address.PaymentBrokerAddress, msg.to)
+		assert.Equal("redeem", msg.method)
+		assert.Equal(types.NewGasPrice(7), msg.gasPrice)
+		assert.Equal(types.NewGasUnits(123), msg.gasLimit)
+		assert.Equal(porcelainAPI.payerAddress, msg.params[0])
+		assert.Equal(porcelainAPI.channelID, msg.params[1])
+
+		var vouchers []*paymentbroker.PaymentVoucher
+		require.NoError(cbor.DecodeInto(msg.params[2].([]byte), &vouchers))
+		require.Equal(1, len(vouchers))
+		assert.Equal(proposal.Payment.Vouchers[9].Amount, vouchers[0].Amount)
+	})
+
+	t.Run("redeems the best valid voucher once the threshold is reached", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		porcelainAPI, miner, proposal := committedDealSetup()
+		require.NoError(porcelainAPI.config.Set("mining.redeemThreshold", `"3000"`))
+
+		// only the first voucher is valid, which is below the threshold
+		height := &proposal.Payment.Vouchers[0].ValidAt
+		miner.redeemVouchers(context.Background(), height)
+		assert.Equal(0, len(porcelainAPI.messagesSent))
+
+		height = &proposal.Payment.Vouchers[1].ValidAt
+		miner.redeemVouchers(context.Background(), height)
+		require.Equal(1, len(porcelainAPI.messagesSent))
+
+		var vouchers []*paymentbroker.PaymentVoucher
+		require.NoError(cbor.DecodeInto(porcelainAPI.messagesSent[0].params[2].([]byte), &vouchers))
+		require.Equal(1, len(vouchers))
+		assert.Equal(proposal.Payment.Vouchers[1].Amount, vouchers[0].Amount)
+	})
+
+	t.Run("does not redeem before the eol or threshold", func(t *testing.T) {
+		porcelainAPI, miner, proposal := committedDealSetup()
+		miner.redeemVouchers(context.Background(), &proposal.Payment.Vouchers[9].ValidAt)
+
+		assert.Equal(t, 0, len(porcelainAPI.messagesSent))
+	})
+
+	t.Run("does not redeem deals whose sector is not committed", func(t *testing.T) {
+		porcelainAPI, miner, _ := committedDealSetup()
+		for _, deal := range miner.deals {
+			deal.Response.State = Staged
+		}
+		miner.redeemVouchers(context.Background(), porcelainAPI.channelEol.Sub(types.NewBlockHeight(10)))
+
+		assert.Equal(t, 0, len(porcelainAPI.messagesSent))
+	})
+
+	t.Run("does not redeem vouchers already redeemed", func(t *testing.T) {
+		porcelainAPI, miner, proposal := committedDealSetup()
+		porcelainAPI.channelLanes = map[string]*paymentbroker.Lane{
+			"0": {AmountRedeemed: &proposal.Payment.Vouchers[9].Amount},
+		}
+		miner.redeemVouchers(context.Background(), porcelainAPI.channelEol.Sub(types.NewBlockHeight(10)))
+
+		assert.Equal(t, 0, len(porcelainAPI.messagesSent))
+	})
+
+	t.Run("does not start redeeming while an earlier scan is running", func(t *testing.T) {
+		porcelainAPI, miner, _ := committedDealSetup()
+		miner.redeeming = true
+		miner.startRedeemingVouchers(porcelainAPI.channelEol.Sub(types.NewBlockHeight(10)))
+
+		assert.Equal(t, 0, len(porcelainAPI.messagesSent))
+	})
+}
+
 func TestDealsAwaitingSeal(t *testing.T) {
 	newCid := types.NewCidForTestGetter()
 	cid0 := newCid()
@@ -315,13 +504,25 @@ type minerTestPorcelain struct {
 	config        *cfg.Config
 	payerAddress  address.Address
 	targetAddress address.Address
+	workerAddress address.Address
 	channelID     *types.ChannelID
 	messageCid    *cid.Cid
 	signer        types.MockSigner
 	noChannels    bool
 	blockHeight   *types.BlockHeight
 	channelEol    *types.BlockHeight
+	channelLanes  map[string]*paymentbroker.Lane
 	paymentStart  *types.BlockHeight
+	messagesSent  []*minerTestMessage
+}
+
+type minerTestMessage struct {
+	from     address.Address
+	to       address.Address
+	gasPrice types.AttoFIL
+	gasLimit types.GasUnits
+	method   string
+	params   []interface{}
 }
 
 func newMinerTestPorcelain() *minerTestPorcelain {
@@ -340,11 +541,14 @@ func newMinerTestPorcelain() *minerTestPorcelain {
 	config := cfg.NewConfig(repo.NewInMemoryRepo())
 	config.Set("mining.storagePrice", `".00025"`)
 
+	targetAddr := addressGetter()
+
 	blockHeight := types.NewBlockHeight(773)
 	return &minerTestPorcelain{
 		config:        config,
 		payerAddress:  payerAddr,
-		targetAddress: addressGetter(),
+		targetAddress: targetAddr,
+		workerAddress: targetAddr,
 		channelID:     types.NewChannelID(73),
 		messageCid:    &cid,
 		signer:        mockSigner,
@@ -356,9 +560,18 @@ func newMinerTestPorcelain() *minerTestPorcelain {
 }
 
 func (mtp *minerTestPorcelain) MessageSend(ctx context.Context, from, to address.Address, val *types.AttoFIL, gasPrice types.AttoFIL, gasLimit types.GasUnits, method string, params ...interface{}) (cid.Cid, error) {
+	mtp.messagesSent = append(mtp.messagesSent, &minerTestMessage{from: from, to: to, gasPrice: gasPrice, gasLimit: gasLimit, method: method, params: params})
 	return cid.Cid{}, nil
 }
 
+func (mtp *minerTestPorcelain) GasPriceSuggest(ctx context.Context) (types.AttoFIL, error) {
+	return types.NewGasPrice(7), nil
+}
+
+func (mtp *minerTestPorcelain) MessageEstimateGas(ctx context.Context, from, to address.Address, value *types.AttoFIL, method string, params ...interface{}) (types.GasUnits, error) {
+	return types.NewGasUnits(123), nil
+}
+
 func (mtp *minerTestPorcelain) MessageQuery(ctx context.Context, optFrom, to address.Address, method string, params ...interface{}) ([][]byte, *exec.FunctionSignature, error) {
 	channels := map[string]*paymentbroker.PaymentChannel{}
 
@@ -369,6 +582,7 @@ func (mtp *minerTestPorcelain) MessageQuery(ctx context.Context, optFrom, to add
 			Amount:         types.NewAttoFILFromFIL(100000),
 			AmountRedeemed: types.NewAttoFILFromFIL(0),
 			Eol:            mtp.channelEol,
+			Lanes:          mtp.channelLanes,
 		}
 	}
 
@@ -387,6 +601,14 @@ func (mtp *minerTestPorcelain) ChainBlockHeight(ctx context.Context) (*types.Blo
 	return mtp.blockHeight, nil
 }
 
+func (mtp *minerTestPorcelain) MinerGetWorkerAddress(ctx context.Context, minerAddr address.Address) (address.Address, error) {
+	return mtp.workerAddress, nil
+}
+
+func (mtp *minerTestPorcelain) SignBytes(data []byte, addr address.Address) (types.Signature, error) {
+	return mtp.signer.SignBytes(data, addr)
+}
+
 func (mtp *minerTestPorcelain) MessageWait(ctx context.Context, msgCid cid.Cid, cb func(*types.Block, *types.SignedMessage, *types.MessageReceipt) error) error {
 	return nil
 }
@@ -394,6 +616,7 @@ func (mtp *minerTestPorcelain) MessageWait(ctx context.Context, msgCid cid.Cid,
 func newTestMiner(api *minerTestPorcelain) *Miner {
 	return &Miner{
 		porcelainAPI:   api,
+		minerAddr:      api.targetAddress,
 		minerOwnerAddr: api.targetAddress,
 		proposalAcceptor: func(ctx context.Context, m *Miner, p *DealProposal) (*DealResponse, error) {
 			return &DealResponse{State: Accepted}, nil
@@ -410,26 +633,39 @@ func newMinerTestSetup() (*minerTestPorcelain, *Miner, *DealProposal) {
 }
 
 func testDealProposal(porcelainAPI *minerTestPorcelain, voucherInterval int, amountInc uint64, addr address.Address) *DealProposal {
+	return testDealProposalOnLane(porcelainAPI, voucherInterval, amountInc, addr, 0)
+}
+
+func testDealProposalOnLane(porcelainAPI *minerTestPorcelain, voucherInterval int, amountInc uint64, addr address.Address, lane uint64) *DealProposal {
+	pieceRef := types.SomeCid()
+	condition, err := PieceStoredCondition(addr, pieceRef)
+	if err != nil {
+		panic("Could not create payment condition")
+	}
+
 	vouchers := make([]*paymentbroker.PaymentVoucher, 10)
 
 	for i := 0; i < 10; i++ {
 		validAt := porcelainAPI.paymentStart.Add(types.NewBlockHeight(uint64((i + 1) * voucherInterval)))
 		amount := types.NewAttoFILFromFIL(uint64(i+1) * amountInc)
-		signature, err := paymentbroker.SignVoucher(porcelainAPI.channelID, amount, validAt, porcelainAPI.payerAddress, porcelainAPI.signer)
-		if err != nil {
-			panic("Could not sign valid proposal")
-		}
 		vouchers[i] = &paymentbroker.PaymentVoucher{
 			Channel:   *porcelainAPI.channelID,
 			Payer:     porcelainAPI.payerAddress,
 			Target:    porcelainAPI.targetAddress,
 			Amount:    *amount,
 			ValidAt:   *validAt,
-			Signature: signature,
+			Lane:      lane,
+			Condition: condition,
 		}
+		signature, err := paymentbroker.SignVoucher(vouchers[i], porcelainAPI.signer)
+		if err != nil {
+			panic("Could not sign valid proposal")
+		}
+		vouchers[i].Signature = signature
 	}
 
-	return &DealProposal{
+	proposal := &DealProposal{
+		PieceRef:   pieceRef,
 		TotalPrice: types.NewAttoFILFromFIL(2500),
 		Size:       types.NewBytesAmount(1000),
 		Duration:   10000,
@@ -438,7 +674,13 @@ func testDealProposal(porcelainAPI *minerTestPorcelain, voucherInterval int, amo
 			PayChActor:    address.PaymentBrokerAddress,
 			Channel:       porcelainAPI.channelID,
 			ChannelMsgCid: porcelainAPI.messageCid,
+			Lane:          lane,
 			Vouchers:      vouchers,
 		},
 	}
+	if err := proposal.Sign(porcelainAPI.signer); err != nil {
+		panic("Could not sign proposal")
+	}
+
+	return proposal
 }
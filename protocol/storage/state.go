@@ -30,6 +30,9 @@ const (
 
 	// Staged means that the data in the deal has been staged into a sector
 	Staged
+
+	// Published means the deal has been published to the storage market
+	Published
 )
 
 func (s DealState) String() string {
@@ -50,6 +53,8 @@ func (s DealState) String() string {
 		return "complete"
 	case Staged:
 		return "staged"
+	case Published:
+		return "published"
 	default:
 		return fmt.Sprintf("<unrecognized %d>", s)
 	}
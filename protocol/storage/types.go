@@ -5,6 +5,7 @@ import (
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 
+	"github.com/filecoin-project/go-filecoin/actor/builtin/storagemarket"
 	"github.com/filecoin-project/go-filecoin/address"
 	"github.com/filecoin-project/go-filecoin/types"
 )
@@ -31,14 +32,27 @@ type PaymentInfo struct {
 	Channel *types.ChannelID
 
 	// ChannelMsgCid is the B58 encoded CID of the message used to create the channel (so the miner can wait for it).
+	// It is nil if the deal is paid through an existing channel.
 	ChannelMsgCid *cid.Cid
 
+	// Lane is the lane of Channel the vouchers pay on. Deals paid through the
+	// same channel use different lanes.
+	Lane uint64
+
 	// Vouchers is a set of payments from the client to the miner that can be
 	// cashed out contingent on the agreed upon data being provably within a
-	// live sector in the miners control on-chain
+	// live sector in the miners control on-chain, as checked by their
+	// PieceStoredCondition.
 	Vouchers []*paymentbroker.PaymentVoucher
 }
 
+// PieceStoredCondition returns the condition of the payment vouchers of a
+// storage deal. It only succeeds while the miner has the piece in a sector it
+// is proving.
+func PieceStoredCondition(miner address.Address, pieceRef cid.Cid) (*paymentbroker.Condition, error) {
+	return paymentbroker.NewCondition(address.StorageMarketAddress, "verifyPieceStored", miner, pieceRef.Bytes())
+}
+
 // DealProposal is the information sent over the wire, when a client proposes a deal to a miner.
 type DealProposal struct {
 	// PieceRef is the cid of the piece being stored
@@ -61,7 +75,40 @@ type DealProposal struct {
 	// miner using on-chain information.
 	Payment PaymentInfo
 
-	// Signature types.Signature
+	// Nonce distinguishes the terms of proposals that are otherwise identical,
+	// so each of them is published as a separate deal
+	Nonce uint64
+
+	// Signature is the signature of the payer over the terms of the deal
+	Signature types.Signature
+}
+
+// Terms returns the terms of the deal that the payer signs, and the miner publishes to the storage market.
+func (p *DealProposal) Terms() *storagemarket.DealTerms {
+	return &storagemarket.DealTerms{
+		PieceRef:   p.PieceRef,
+		Size:       p.Size,
+		TotalPrice: p.TotalPrice,
+		Duration:   p.Duration,
+		Miner:      p.MinerAddress,
+		Client:     p.Payment.Payer,
+		Nonce:      p.Nonce,
+	}
+}
+
+// Sign sets the signature of the payer over the terms of the deal.
+func (p *DealProposal) Sign(signer types.Signer) error {
+	sig, err := storagemarket.SignDealTerms(p.Terms(), signer)
+	if err != nil {
+		return err
+	}
+	p.Signature = sig
+	return nil
+}
+
+// VerifySignature returns whether the proposal is signed by its payer.
+func (p *DealProposal) VerifySignature() bool {
+	return storagemarket.VerifyDealSignature(p.Terms(), p.Signature)
 }
 
 // DealResponse is the information sent over the wire, when a miner responds to a client.
@@ -79,10 +126,49 @@ type DealResponse struct {
 	// the miner has sealed the data into a sector.
 	ProofInfo *ProofInfo
 
+	// DealID is the id of the deal in the storage market. It is set once the miner
+	// has published the deal.
+	DealID uint64
+
+	// Signer is the worker of the miner that signed the response. It is kept
+	// with the response, since the miner may change its worker later.
+	Signer address.Address
+
 	// Signature is a signature from the miner over the response
 	Signature types.Signature
 }
 
+// Sign sets the signature of the miner's worker over the response.
+func (r *DealResponse) Sign(signer types.Signer, worker address.Address) error {
+	r.Signer = worker
+	data, err := r.signatureData()
+	if err != nil {
+		return err
+	}
+
+	sig, err := signer.SignBytes(data, worker)
+	if err != nil {
+		return err
+	}
+	r.Signature = sig
+	return nil
+}
+
+// VerifySignature returns whether the response is signed by its Signer.
+func (r *DealResponse) VerifySignature() bool {
+	data, err := r.signatureData()
+	if err != nil {
+		return false
+	}
+	return types.IsValidSignature(data, r.Signer, r.Signature)
+}
+
+func (r *DealResponse) signatureData() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	return cbor.DumpObject(&unsigned)
+}
+
 // ProofInfo contains the details about a seal proof, that the client needs to know to verify that his deal was posted on chain.
 // TODO: finalize parameters
 type ProofInfo struct {
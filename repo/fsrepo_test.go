@@ -39,7 +39,9 @@ const (
 	},
 	"datastore": {
 		"type": "badgerds",
-		"path": "badger"
+		"path": "badger",
+		"gcPeriod": "",
+		"gcRetention": 1000
 	},
 	"swarm": {
 		"address": "/ip4/0.0.0.0/tcp/6000"
@@ -48,7 +50,16 @@ const (
 		"minerAddress": "",
 		"blockSignerAddress": "",
 		"autoSealIntervalSeconds": 120,
-		"storagePrice": "0"
+		"storagePrice": "0",
+		"retrievalPrice": "0",
+		"redeemBlocksBeforeEol": 50,
+		"redeemThreshold": "0"
+	},
+	"mpool": {
+		"maxPoolSize": 10000,
+		"maxSenderMessages": 100,
+		"replaceByFeeBumpPercent": 10,
+		"messageExpiration": 100
 	},
 	"wallet": {
 		"defaultAddress": ""
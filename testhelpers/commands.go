@@ -99,6 +99,7 @@ type TestDaemon struct {
 	swarmAddr        string
 	repoDir          string
 	genesisFile      string
+	importSnapshot   string
 	keyFiles         []string
 	withMiner        string
 	autoSealInterval string
@@ -723,6 +724,16 @@ func GenesisFile(a string) func(*TestDaemon) {
 	}
 }
 
+// ImportSnapshot allows setting the --import-snapshot flag on init. The
+// daemon then initializes its chain from the snapshot instead of the genesis
+// file.
+func ImportSnapshot(a string) func(*TestDaemon) {
+	return func(td *TestDaemon) {
+		td.importSnapshot = a
+		td.genesisFile = ""
+	}
+}
+
 // WithMiner allows setting the --with-miner flag on init.
 func WithMiner(m string) func(*TestDaemon) {
 	return func(td *TestDaemon) {
@@ -765,6 +776,10 @@ func NewDaemon(t *testing.T, options ...func(*TestDaemon)) *TestDaemon {
 		initopts = append(initopts, fmt.Sprintf("--genesisfile=%s", td.genesisFile))
 	}
 
+	if td.importSnapshot != "" {
+		initopts = append(initopts, fmt.Sprintf("--import-snapshot=%s", td.importSnapshot))
+	}
+
 	if td.withMiner != "" {
 		initopts = append(initopts, fmt.Sprintf("--with-miner=%s", td.withMiner))
 	}
@@ -27,7 +27,7 @@ func CreateMinerMessage(from address.Address, nonce uint64, pledge uint64, pid p
 
 // CommitSectorMessage creates a message to commit a sector.
 func CommitSectorMessage(miner, from address.Address, nonce, sectorID uint64, commD, commR, commRStar, proof []byte) (*types.Message, error) {
-	params, err := abi.ToEncodedValues(sectorID, commD, commR, commRStar, proof)
+	params, err := abi.ToEncodedValues(sectorID, commD, commR, commRStar, proof, []uint64{})
 	if err != nil {
 		return nil, err
 	}
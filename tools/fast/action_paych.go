@@ -66,6 +66,25 @@ func (f *Filecoin) PaychExtend(ctx context.Context,
 
 }
 
+// PaychAddFunds runs the `paych add-funds` command against the filecoin process.
+func (f *Filecoin) PaychAddFunds(ctx context.Context,
+	channel types.ChannelID, amount *types.AttoFIL,
+	options ...ActionOption) (cid.Cid, error) {
+
+	var out cid.Cid
+	args := []string{"go-filecoin", "paych", "add-funds", channel.String(), amount.String()}
+
+	for _, option := range options {
+		args = append(args, option()...)
+	}
+
+	if err := f.RunCmdJSONWithStdin(ctx, nil, &out, args...); err != nil {
+		return cid.Undef, err
+	}
+
+	return out, nil
+}
+
 // PaychLs runs the `paych ls` command against the filecoin process.
 func (f *Filecoin) PaychLs(ctx context.Context, options ...ActionOption) (map[string]*paymentbroker.PaymentChannel, error) {
 	var out map[string]*paymentbroker.PaymentChannel
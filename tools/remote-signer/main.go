@@ -0,0 +1,226 @@
+// The remote signer holds keys for a node configured with
+// wallet.remoteSigner, and signs with them only what their policies allow.
+// A policies file looks like:
+//
+//	{
+//	  "<owner address>": {
+//	    "maxValue": "100",
+//	    "maxGasPrice": "0.001",
+//	    "maxFee": "1",
+//	    "allowedMethods": ["", "addAsk"],
+//	    "allowedRecipients": ["<miner address>"]
+//	  }
+//	}
+//
+// When serving over http:// the signer requires the node to present the token
+// in the token file, which the node reads from wallet.remoteSignerToken. A
+// unix:// socket is only accessible to the user running the signer, and must
+// be in a directory nobody else can write to, such as
+// unix://$HOME/.filecoin-signer.sock.
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	logging "gx/ipfs/QmbkT7eMTyXfpeyB3ZMxxcxg7XH8t6uXp49jqzz4HB7BGF/go-log"
+
+	"github.com/filecoin-project/go-filecoin/tools/remote-signer/policy"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/wallet"
+)
+
+var log = logging.Logger("remote-signer")
+
+func init() {
+	// Info level
+	logging.SetAllLoggers(4)
+}
+
+func main() {
+	listen := flag.String("listen", "", "(required) http://host:port or unix:// socket path to serve on, e.g. unix://$HOME/.filecoin-signer.sock")
+	keysPath := flag.String("keys", "", "(required) file with the keys to sign with, as written by 'go-filecoin wallet export'")
+	policiesPath := flag.String("policies", "", "(required) JSON file mapping each address to its signing policy")
+	tokenPath := flag.String("token", "", "file with the token the node must present, required when serving over http://")
+	flag.Parse()
+
+	if *listen == "" || *keysPath == "" || *policiesPath == "" {
+		fmt.Println("ERROR: must provide listen, keys and policies")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if strings.HasPrefix(*listen, "http://") && *tokenPath == "" {
+		fmt.Println("ERROR: must provide a token when serving over http://")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	signer, err := loadKeys(*keysPath)
+	if err != nil {
+		log.Fatalf("failed to load keys: %s", err)
+	}
+	policies, err := policy.Load(*policiesPath)
+	if err != nil {
+		log.Fatalf("failed to load policies: %s", err)
+	}
+	var token string
+	if *tokenPath != "" {
+		if token, err = loadToken(*tokenPath); err != nil {
+			log.Fatalf("failed to load token: %s", err)
+		}
+	}
+
+	l, err := listener(*listen)
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %s", *listen, err)
+	}
+	log.Infof("Serving %d addresses on %s", len(signer.Addresses()), *listen)
+
+	panic(http.Serve(l, newHandler(signer, policies, token)))
+}
+
+// loadToken reads the token the node must present from path.
+func loadToken(path string) (string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(raw))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return token, nil
+}
+
+// loadKeys imports the keys exported to path into an in-memory backend.
+func loadKeys(path string) (*wallet.DSBackend, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// the output of 'wallet export'
+	var export struct {
+		KeyInfo []*types.KeyInfo
+	}
+	if err := json.Unmarshal(raw, &export); err != nil {
+		return nil, err
+	}
+
+	signer, err := wallet.NewDSBackend(datastore.NewMapDatastore())
+	if err != nil {
+		return nil, err
+	}
+	for _, ki := range export.KeyInfo {
+		if err := signer.ImportKey(ki); err != nil {
+			return nil, err
+		}
+	}
+	return signer, nil
+}
+
+func listener(endpoint string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(endpoint, "unix://"):
+		socket := strings.TrimPrefix(endpoint, "unix://")
+		// anyone who can write to the directory of the socket could replace
+		// it with their own and receive the node's requests
+		dir, err := os.Stat(filepath.Dir(socket))
+		if err != nil {
+			return nil, err
+		}
+		if dir.Mode().Perm()&0022 != 0 {
+			return nil, fmt.Errorf("directory of socket %s is writable by other users", socket)
+		}
+		// remove a socket left behind by a previous run
+		if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		// only the user running the signer and the node may connect, so the
+		// socket is created without permissions for anyone else
+		umask := syscall.Umask(0077)
+		defer syscall.Umask(umask)
+		return net.Listen("unix", socket)
+	case strings.HasPrefix(endpoint, "http://"):
+		return net.Listen("tcp", strings.TrimPrefix(endpoint, "http://"))
+	default:
+		return nil, fmt.Errorf("endpoint must start with http:// or unix://")
+	}
+}
+
+// newHandler serves the remote signer protocol of wallet.RemoteBackend,
+// signing with the keys of signer when policies allow it. Requests must
+// present token unless it is empty.
+func newHandler(signer *wallet.DSBackend, policies policy.Policies, token string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(wallet.RemoteAddressesPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, &wallet.RemoteAddressesResponse{Addresses: signer.Addresses()})
+	})
+
+	mux.HandleFunc(wallet.RemoteSignPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req wallet.RemoteSignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %s", err), http.StatusBadRequest)
+			return
+		}
+		if !signer.HasAddress(req.Address) {
+			http.Error(w, fmt.Sprintf("unknown address %s", req.Address), http.StatusNotFound)
+			return
+		}
+
+		if err := policies.Check(req.Address, req.Data); err != nil {
+			log.Warningf("refused to sign with %s: %s", req.Address, err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		sig, err := signer.SignBytes(req.Data, req.Address)
+		if err != nil {
+			log.Errorf("failed to sign with %s: %s", req.Address, err)
+			http.Error(w, "failed to sign", http.StatusInternalServerError)
+			return
+		}
+		log.Infof("signed with %s", req.Address)
+		writeJSON(w, &wallet.RemoteSignResponse{Signature: sig})
+	})
+
+	if token == "" {
+		return mux
+	}
+	expected := []byte(wallet.RemoteTokenScheme + " " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			log.Warningf("refused unauthorized request from %s", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("failed to write response: %s", err)
+	}
+}
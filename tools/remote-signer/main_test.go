@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/tools/remote-signer/policy"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/wallet"
+)
+
+func TestRemoteSigner(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	signer, err := wallet.NewDSBackend(datastore.NewMapDatastore())
+	require.NoError(err)
+	owner, err := signer.NewAddress()
+	require.NoError(err)
+	miner := address.NewForTestGetter()()
+
+	policies := policy.Policies{
+		owner: &policy.Policy{
+			MaxValue:          types.NewAttoFILFromFIL(10),
+			AllowedRecipients: []address.Address{miner},
+		},
+	}
+	server := httptest.NewServer(newHandler(signer, policies, "secret"))
+	defer server.Close()
+
+	t.Log("[failure] requests without the token are refused")
+	_, err = wallet.NewRemoteBackend(server.URL, "")
+	require.Error(err)
+	assert.Contains(err.Error(), "unauthorized")
+	_, err = wallet.NewRemoteBackend(server.URL, "guess")
+	require.Error(err)
+
+	remote, err := wallet.NewRemoteBackend(server.URL, "secret")
+	require.NoError(err)
+	w := wallet.New(remote)
+	assert.True(w.HasAddress(owner))
+
+	t.Log("[success] messages within the policy are signed")
+	msg := types.NewMessage(owner, miner, 0, types.NewAttoFILFromFIL(5), "", nil)
+	smsg, err := types.NewSignedMessage(*msg, w, *types.NewAttoFILFromFIL(1), types.NewGasUnits(100))
+	require.NoError(err)
+	assert.True(smsg.VerifySignature())
+
+	t.Log("[failure] messages outside the policy are refused")
+	msg = types.NewMessage(owner, miner, 0, types.NewAttoFILFromFIL(50), "", nil)
+	_, err = types.NewSignedMessage(*msg, w, *types.NewAttoFILFromFIL(1), types.NewGasUnits(100))
+	require.Error(err)
+	assert.Contains(err.Error(), "exceeds the maximum")
+}
+
+func TestListenerRefusesSharedSocketDirectories(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "remote-signer")
+	require.NoError(err)
+	defer os.RemoveAll(dir) // nolint: errcheck
+	endpoint := "unix://" + filepath.Join(dir, "signer.sock")
+
+	l, err := listener(endpoint)
+	require.NoError(err)
+	require.NoError(l.Close())
+
+	require.NoError(os.Chmod(dir, 0777))
+	_, err = listener(endpoint)
+	require.Error(err)
+	assert.Contains(t, err.Error(), "writable by other users")
+}
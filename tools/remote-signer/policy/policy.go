@@ -0,0 +1,118 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// Policy restricts what an address signs. The zero value allows signing
+// any message.
+type Policy struct {
+	// MaxValue is the maximum value of a message in FIL. Any value is
+	// allowed if it is nil.
+	MaxValue *types.AttoFIL `json:"maxValue,omitempty"`
+	// MaxGasPrice is the maximum gas price of a message in FIL. Any gas price
+	// is allowed if it is nil.
+	MaxGasPrice *types.AttoFIL `json:"maxGasPrice,omitempty"`
+	// MaxFee is the maximum fee a message may be charged in FIL, its gas
+	// price times its gas limit. Any fee is allowed if it is nil.
+	MaxFee *types.AttoFIL `json:"maxFee,omitempty"`
+	// AllowedMethods are the methods messages may call, where "" is a plain
+	// transfer. Any method is allowed if it is empty.
+	AllowedMethods []string `json:"allowedMethods,omitempty"`
+	// AllowedRecipients are the addresses messages may be sent to. Any
+	// recipient is allowed if it is empty.
+	AllowedRecipients []address.Address `json:"allowedRecipients,omitempty"`
+	// AllowNonMessages allows signing data that is not a message, such as
+	// payment channel vouchers and storage deal proposals.
+	AllowNonMessages bool `json:"allowNonMessages,omitempty"`
+}
+
+// Policies maps addresses to their policy. Addresses without a policy may not
+// sign anything.
+type Policies map[address.Address]*Policy
+
+// Load reads policies from a JSON file mapping addresses to policies.
+func Load(path string) (Policies, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies Policies
+	if err := json.Unmarshal(raw, &policies); err != nil {
+		return nil, fmt.Errorf("failed to parse policies: %s", err)
+	}
+	return policies, nil
+}
+
+// Check returns an error if the policy of addr does not allow it to sign
+// data.
+func (p Policies) Check(addr address.Address, data []byte) error {
+	policy, ok := p[addr]
+	if !ok {
+		return fmt.Errorf("no policy for %s", addr)
+	}
+
+	var msg types.MeteredMessage
+	if err := msg.Unmarshal(data); err != nil {
+		if policy.AllowNonMessages {
+			return nil
+		}
+		return fmt.Errorf("%s may only sign messages", addr)
+	}
+	return policy.checkMessage(addr, &msg)
+}
+
+func (policy *Policy) checkMessage(addr address.Address, msg *types.MeteredMessage) error {
+	if msg.From != addr {
+		return fmt.Errorf("message is from %s, not %s", msg.From, addr)
+	}
+
+	if policy.MaxValue != nil && msg.Value != nil && msg.Value.GreaterThan(policy.MaxValue) {
+		return fmt.Errorf("value %s exceeds the maximum of %s", msg.Value, policy.MaxValue)
+	}
+
+	if policy.MaxGasPrice != nil && msg.GasPrice.GreaterThan(policy.MaxGasPrice) {
+		return fmt.Errorf("gas price %s exceeds the maximum of %s", msg.GasPrice.String(), policy.MaxGasPrice)
+	}
+
+	if policy.MaxFee != nil {
+		fee := msg.GasPrice.MulBigInt(big.NewInt(int64(msg.GasLimit)))
+		if fee.GreaterThan(policy.MaxFee) {
+			return fmt.Errorf("fee %s exceeds the maximum of %s", fee, policy.MaxFee)
+		}
+	}
+
+	if len(policy.AllowedMethods) > 0 && !containsString(policy.AllowedMethods, msg.Method) {
+		return fmt.Errorf("method %q is not allowed", msg.Method)
+	}
+
+	if len(policy.AllowedRecipients) > 0 && !containsAddress(policy.AllowedRecipients, msg.To) {
+		return fmt.Errorf("recipient %s is not allowed", msg.To)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, el := range list {
+		if el == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAddress(list []address.Address, addr address.Address) bool {
+	for _, el := range list {
+		if el == addr {
+			return true
+		}
+	}
+	return false
+}
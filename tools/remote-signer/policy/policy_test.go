@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+func TestCheck(t *testing.T) {
+	addrGetter := address.NewForTestGetter()
+	owner, miner, other := addrGetter(), addrGetter(), addrGetter()
+
+	meteredMessage := func(from, to address.Address, value uint64, method string, gasPrice, gasLimit uint64) []byte {
+		msg := types.NewMeteredMessage(*types.NewMessage(from, to, 0, types.NewAttoFILFromFIL(value), method, nil), *types.NewAttoFILFromFIL(gasPrice), types.NewGasUnits(gasLimit))
+		data, err := msg.Marshal()
+		require.NoError(t, err)
+		return data
+	}
+	message := func(from, to address.Address, value uint64, method string) []byte {
+		return meteredMessage(from, to, value, method, 1, 100)
+	}
+
+	policies := Policies{
+		owner: &Policy{
+			MaxValue:          types.NewAttoFILFromFIL(10),
+			MaxGasPrice:       types.NewAttoFILFromFIL(2),
+			MaxFee:            types.NewAttoFILFromFIL(200),
+			AllowedMethods:    []string{"", "addAsk"},
+			AllowedRecipients: []address.Address{miner},
+		},
+		miner: &Policy{AllowNonMessages: true},
+	}
+
+	t.Run("allows messages within the policy", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.NoError(policies.Check(owner, message(owner, miner, 10, "")))
+		assert.NoError(policies.Check(owner, message(owner, miner, 0, "addAsk")))
+		assert.NoError(policies.Check(owner, meteredMessage(owner, miner, 0, "", 2, 100)))
+		assert.NoError(policies.Check(miner, message(miner, other, 1000, "commitSector")))
+	})
+
+	t.Run("refuses messages outside the policy", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Error(policies.Check(owner, message(owner, miner, 11, "")))
+		assert.Error(policies.Check(owner, message(owner, miner, 0, "changeWorker")))
+		assert.Error(policies.Check(owner, message(owner, other, 1, "")))
+
+		t.Log("the gas price and the fee it may be charged are bounded")
+		assert.Error(policies.Check(owner, meteredMessage(owner, miner, 0, "", 3, 10)))
+		assert.Error(policies.Check(owner, meteredMessage(owner, miner, 0, "", 1, 201)))
+
+		t.Log("the message must be from the signing address")
+		assert.Error(policies.Check(owner, message(miner, miner, 1, "")))
+
+		t.Log("addresses without a policy sign nothing")
+		assert.Error(policies.Check(other, message(other, miner, 1, "")))
+	})
+
+	t.Run("non-messages need to be allowed", func(t *testing.T) {
+		assert := assert.New(t)
+
+		assert.Error(policies.Check(owner, []byte("voucher")))
+		assert.NoError(policies.Check(miner, []byte("voucher")))
+	})
+}
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	addr := address.NewForTestGetter()()
+	f, err := ioutil.TempFile("", "policies")
+	require.NoError(err)
+	defer os.Remove(f.Name()) // nolint: errcheck
+
+	_, err = fmt.Fprintf(f, `{"%s": {"maxValue": "2.5", "maxGasPrice": "0.001", "maxFee": "1", "allowedMethods": [""], "allowedRecipients": ["%s"]}}`, addr, addr)
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	policies, err := Load(f.Name())
+	require.NoError(err)
+	require.Contains(policies, addr)
+	policy := policies[addr]
+	assert.Equal("2.5", policy.MaxValue.String())
+	assert.Equal("0.001", policy.MaxGasPrice.String())
+	assert.Equal("1", policy.MaxFee.String())
+	assert.Equal([]string{""}, policy.AllowedMethods)
+	assert.Equal([]address.Address{addr}, policy.AllowedRecipients)
+	assert.False(policy.AllowNonMessages)
+}
@@ -0,0 +1,86 @@
+package types
+
+import (
+	"github.com/filecoin-project/go-filecoin/address"
+	bls "github.com/filecoin-project/go-filecoin/bls-signatures"
+	wutil "github.com/filecoin-project/go-filecoin/wallet/util"
+)
+
+// IsAggregated returns true if this message is BLS-signed and its signature
+// was moved into the aggregate signature of a block, leaving only the public
+// key of the sender.
+func (smsg *SignedMessage) IsAggregated() bool {
+	return smsg.From.Protocol() == address.BLS && len(smsg.Signature) == bls.PublicKeyBytes
+}
+
+// withoutBLSSignature returns the message as it is stored in a block once its
+// signature is aggregated, or the message itself if it is not BLS-signed or
+// already aggregated.
+func (smsg *SignedMessage) withoutBLSSignature() *SignedMessage {
+	if smsg.From.Protocol() != address.BLS {
+		return smsg
+	}
+	pk, err := wutil.BLSPublicKey(smsg.Signature)
+	if err != nil {
+		return smsg
+	}
+
+	return &SignedMessage{
+		MeteredMessage: smsg.MeteredMessage,
+		Signature:      pk,
+	}
+}
+
+// AggregateBLSSignatures returns copies of msgs in which the signatures of
+// BLS-signed messages are replaced by the public keys of their senders,
+// together with the aggregate of the removed signatures. The aggregate is nil
+// if there are no BLS-signed messages.
+func AggregateBLSSignatures(msgs []*SignedMessage) ([]*SignedMessage, Signature, error) {
+	out := make([]*SignedMessage, len(msgs))
+	var sigs [][]byte
+	for i, msg := range msgs {
+		out[i] = msg.withoutBLSSignature()
+		if out[i] != msg {
+			sigs = append(sigs, msg.Signature)
+		}
+	}
+	if len(sigs) == 0 {
+		return out, nil, nil
+	}
+
+	aggregate, err := wutil.AggregateBLS(sigs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, aggregate, nil
+}
+
+// VerifyBLSAggregate returns true iff aggregate is the aggregate of the
+// signatures of the aggregated messages in msgs by their senders. If none of
+// the messages is aggregated the aggregate must be empty.
+func VerifyBLSAggregate(msgs []*SignedMessage, aggregate Signature) bool {
+	var pks, data [][]byte
+	for _, msg := range msgs {
+		if !msg.IsAggregated() {
+			continue
+		}
+
+		// the public key left in place of the signature must be the sender's
+		pk := []byte(msg.Signature)
+		if address.NewWithProtocol(address.Mainnet, address.BLS, address.Hash(pk)) != msg.From {
+			return false
+		}
+		bmsg, err := msg.MeteredMessage.Marshal()
+		if err != nil {
+			log.Infof("invalid aggregate signature: %s", err)
+			return false
+		}
+		pks = append(pks, pk)
+		data = append(data, bmsg)
+	}
+
+	if len(pks) == 0 {
+		return len(aggregate) == 0
+	}
+	return wutil.VerifyBLSAggregate(pks, data, aggregate)
+}
@@ -0,0 +1,70 @@
+package types
+
+import (
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+)
+
+func TestAggregateBLSSignatures(t *testing.T) {
+	blsSigner := NewMockSigner(MustGenerateBLSKeyInfo(2))
+	newBLSMessage := NewSignedMessageForTestGetter(blsSigner)
+
+	t.Run("strips BLS signatures and keeps message cids", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		msgs := []*SignedMessage{newBLSMessage(), newSignedMessage(), newBLSMessage()}
+		for _, msg := range msgs {
+			assert.False(msg.IsAggregated())
+		}
+
+		stripped, aggregate, err := AggregateBLSSignatures(msgs)
+		require.NoError(err)
+		require.Len(stripped, 3)
+		assert.NotEmpty(aggregate)
+
+		assert.True(stripped[0].IsAggregated())
+		assert.False(stripped[1].IsAggregated())
+		assert.True(stripped[2].IsAggregated())
+		assert.Equal(msgs[1], stripped[1])
+		for i := range msgs {
+			assert.True(SmsgCidsEqual(msgs[i], stripped[i]))
+		}
+
+		// the originals are untouched
+		assert.True(msgs[0].VerifySignature())
+		assert.False(stripped[0].VerifySignature())
+
+		assert.True(VerifyBLSAggregate(stripped, aggregate))
+		assert.False(VerifyBLSAggregate(stripped, nil))
+		assert.False(VerifyBLSAggregate(stripped[:2], aggregate))
+
+		corrupted := append(Signature{}, aggregate...)
+		corrupted[0] ^= 0xFF
+		assert.False(VerifyBLSAggregate(stripped, corrupted))
+
+		// the public key left in a message must belong to the sender
+		otherKey := blsSigner.AddrKeyInfo[blsSigner.Addresses[1]]
+		otherPk, err := otherKey.PublicKey()
+		require.NoError(err)
+		swapped := *stripped[0]
+		swapped.Signature = otherPk
+		assert.False(VerifyBLSAggregate([]*SignedMessage{&swapped, stripped[1], stripped[2]}, aggregate))
+	})
+
+	t.Run("needs no aggregate without BLS messages", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		msgs := []*SignedMessage{newSignedMessage(), newSignedMessage()}
+		stripped, aggregate, err := AggregateBLSSignatures(msgs)
+		require.NoError(err)
+		assert.Equal(msgs, stripped)
+		assert.Nil(aggregate)
+
+		assert.True(VerifyBLSAggregate(stripped, aggregate))
+		assert.False(VerifyBLSAggregate(stripped, Signature{1, 2, 3}))
+	})
+}
@@ -154,6 +154,13 @@ func (z *AttoFIL) MulBigInt(x *big.Int) *AttoFIL {
 	return &AttoFIL{val: newVal}
 }
 
+// DivBigInt divides attoFIL by a given big int, rounding towards zero
+func (z *AttoFIL) DivBigInt(x *big.Int) *AttoFIL {
+	newVal := big.NewInt(0)
+	newVal.Quo(z.val, x)
+	return &AttoFIL{val: newVal}
+}
+
 // DivCeil returns the minimum number of times this value can be divided into smaller amounts
 // such that none of the smaller amounts are greater than the given divisor.
 // Equal to ceil(z/y) if AttoFIL could be fractional.
@@ -174,6 +174,16 @@ func TestMulInt(t *testing.T) {
 	})
 }
 
+func TestDivBigInt(t *testing.T) {
+	attoFIL := AttoFIL{val: big.NewInt(25000)}
+
+	t.Run("divides the value and rounds towards zero", func(t *testing.T) {
+		assert := assert.New(t)
+		expected := AttoFIL{val: big.NewInt(3571)}
+		assert.Equal(attoFIL.DivBigInt(big.NewInt(7)), &expected)
+	})
+}
+
 func TestDivCeil(t *testing.T) {
 	x := AttoFIL{val: big.NewInt(200)}
 
@@ -44,6 +44,10 @@ type Block struct {
 	// TODO: should be a merkletree-ish thing
 	Messages []*SignedMessage `json:"messages"`
 
+	// BLSAggregateSig is the aggregate of the signatures of the BLS-signed
+	// messages in Messages, which only carry the public keys of their senders.
+	BLSAggregateSig Signature `json:"blsAggregateSig,omitempty" refmt:",omitempty"`
+
 	// StateRoot is a cid pointer to the state tree after application of the
 	// transactions state transitions.
 	StateRoot cid.Cid `json:"stateRoot,omitempty" refmt:",omitempty"`
@@ -5,12 +5,15 @@ import (
 	"io"
 	"math/rand"
 
+	bls "github.com/filecoin-project/go-filecoin/bls-signatures"
 	"github.com/filecoin-project/go-filecoin/crypto"
 )
 
 const (
 	// SECP256K1 is a curve used to compute private keys
 	SECP256K1 = "secp256k1"
+	// BLS is the curve of BLS private keys
+	BLS = "bls"
 )
 
 // MustGenerateKeyInfo generates a slice of KeyInfo size `n` with seed `seed`
@@ -31,6 +34,19 @@ func MustGenerateKeyInfo(n int, seed io.Reader) []KeyInfo {
 	return keyinfos
 }
 
+// MustGenerateBLSKeyInfo generates a slice of BLS KeyInfo of size `n`
+func MustGenerateBLSKeyInfo(n int) []KeyInfo {
+	var keyinfos []KeyInfo
+	for i := 0; i < n; i++ {
+		prv := bls.PrivateKeyGenerate()
+		keyinfos = append(keyinfos, KeyInfo{
+			PrivateKey: prv[:],
+			Curve:      BLS,
+		})
+	}
+	return keyinfos
+}
+
 // GenerateKeyInfoSeed returns a reader to be passed to MustGenerateKeyInfo
 func GenerateKeyInfoSeed() io.Reader {
 	token := make([]byte, 512)
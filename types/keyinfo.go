@@ -8,6 +8,7 @@ import (
 	cbor "gx/ipfs/QmcZLyosDwMKdB6NLRsiss9HXzDPhVhhRtPy67JFKTDQDX/go-ipld-cbor"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	bls "github.com/filecoin-project/go-filecoin/bls-signatures"
 	"github.com/filecoin-project/go-filecoin/crypto"
 	cu "github.com/filecoin-project/go-filecoin/crypto/util"
 )
@@ -68,12 +69,28 @@ func (ki *KeyInfo) Address() (address.Address, error) {
 
 	addrHash := address.Hash(pub)
 
+	protocol := address.SECP256K1
+	if ki.Curve == BLS {
+		protocol = address.BLS
+	}
+
 	// TODO: Use the address type we are running on from the config.
-	return address.NewMainnet(addrHash), nil
+	return address.NewWithProtocol(address.Mainnet, protocol, addrHash), nil
 }
 
-// PublicKey returns the public key part as uncompressed bytes.
+// PublicKey returns the public key part as uncompressed bytes for secp256k1
+// keys and as compressed bytes for BLS keys.
 func (ki *KeyInfo) PublicKey() ([]byte, error) {
+	if ki.Curve == BLS {
+		if len(ki.Key()) != bls.PrivateKeyBytes {
+			return nil, fmt.Errorf("invalid BLS private key length")
+		}
+		var prv bls.PrivateKey
+		copy(prv[:], ki.Key())
+		pub := bls.PrivateKeyPublicKey(prv)
+		return pub[:], nil
+	}
+
 	prv, err := crypto.BytesToECDSA(ki.Key())
 	if err != nil {
 		return nil, err
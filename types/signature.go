@@ -13,8 +13,13 @@ var log = logging.Logger("types")
 type Signature = Bytes
 
 // IsValidSignature cryptographically verifies that 'sig' is the signed hash of 'data' with
-// the public key belonging to `addr`.
+// the public key belonging to `addr`. The key type is taken from the protocol
+// of the address.
 func IsValidSignature(data []byte, addr address.Address, sig Signature) bool {
+	if addr.Protocol() == address.BLS {
+		return isValidBLSSignature(data, addr, sig)
+	}
+
 	maybePk, err := wutil.Ecrecover(data, sig)
 	if err != nil {
 		// Any error returned from Ecrecover means this signature is not valid.
@@ -25,3 +30,17 @@ func IsValidSignature(data []byte, addr address.Address, sig Signature) bool {
 
 	return address.NewMainnet(maybeAddrHash) == addr
 }
+
+func isValidBLSSignature(data []byte, addr address.Address, sig Signature) bool {
+	maybePk, err := wutil.BLSPublicKey(sig)
+	if err != nil {
+		log.Infof("error in signature validation: %s", err)
+		return false
+	}
+	maybeAddrHash := address.Hash(maybePk)
+	if address.NewWithProtocol(address.Mainnet, address.BLS, maybeAddrHash) != addr {
+		return false
+	}
+
+	return wutil.VerifyBLS(maybePk, data, sig)
+}
@@ -40,10 +40,12 @@ func (smsg *SignedMessage) Marshal() ([]byte, error) {
 	return cbor.DumpObject(smsg)
 }
 
-// Cid returns the canonical CID for the SignedMessage.
+// Cid returns the canonical CID for the SignedMessage. The CID of a BLS-signed
+// message covers the public key of the sender instead of the signature, so
+// that it does not change when the signature is aggregated into a block.
 // TODO: can we avoid returning an error?
 func (smsg *SignedMessage) Cid() (cid.Cid, error) {
-	obj, err := cbor.WrapObject(smsg, DefaultHashFunction, -1)
+	obj, err := cbor.WrapObject(smsg.withoutBLSSignature(), DefaultHashFunction, -1)
 	if err != nil {
 		return cid.Undef, errors.Wrap(err, "failed to marshal to cbor")
 	}
@@ -73,8 +75,9 @@ func (smsg *SignedMessage) RecoverAddress(r Recoverer) (address.Address, error)
 
 }
 
-// VerifySignature returns true iff the signature over the message as calculated
-// from EC recover matches the message sender address.
+// VerifySignature returns true iff the signature over the message was made
+// with the key of the message sender address, of the type given by the
+// protocol of the address.
 func (smsg *SignedMessage) VerifySignature() bool {
 	bmsg, err := smsg.MeteredMessage.Marshal()
 	if err != nil {
@@ -1,7 +1,6 @@
 package types
 
 import (
-	"crypto/ecdsa"
 	"fmt"
 
 	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
@@ -10,8 +9,8 @@ import (
 	"gx/ipfs/QmR8BauakNcBa3RbE4nbQu76PDiJgoQgz8AJdhJuiU4TAw/go-cid"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	bls "github.com/filecoin-project/go-filecoin/bls-signatures"
 	"github.com/filecoin-project/go-filecoin/crypto"
-	cu "github.com/filecoin-project/go-filecoin/crypto/util"
 	wutil "github.com/filecoin-project/go-filecoin/wallet/util"
 )
 
@@ -44,18 +43,10 @@ func NewMockSigner(kis []KeyInfo) MockSigner {
 	var ms MockSigner
 	ms.AddrKeyInfo = make(map[address.Address]KeyInfo)
 	for _, k := range kis {
-		// get the secret key
-		sk, err := crypto.BytesToECDSA(k.PrivateKey)
+		newAddr, err := k.Address()
 		if err != nil {
 			panic(err)
 		}
-		// extract public key
-		pub, ok := sk.Public().(*ecdsa.PublicKey)
-		if !ok {
-			panic("unknown public key type")
-		}
-		addrHash := address.Hash(cu.SerializeUncompressed(pub))
-		newAddr := address.NewMainnet(addrHash)
 		ms.Addresses = append(ms.Addresses, newAddr)
 		ms.AddrKeyInfo[newAddr] = k
 
@@ -70,6 +61,12 @@ func (ms MockSigner) SignBytes(data []byte, addr address.Address) (Signature, er
 		panic("unknown address")
 	}
 
+	if ki.Curve == BLS {
+		var sk bls.PrivateKey
+		copy(sk[:], ki.PrivateKey)
+		return wutil.SignBLS(sk, data), nil
+	}
+
 	sk, err := crypto.BytesToECDSA(ki.PrivateKey)
 	if err != nil {
 		return Signature{}, err
@@ -88,11 +85,12 @@ func NewSignedMessageForTestGetter(ms MockSigner) func() *SignedMessage {
 	i := 0
 	return func() *SignedMessage {
 		s := fmt.Sprintf("smsg%d", i)
+		nonce := uint64(i)
 		i++
 		msg := NewMessage(
 			ms.Addresses[0], // from needs to be an address from the signer
 			address.NewMainnet([]byte(s+"-to")),
-			0,
+			nonce,
 			NewAttoFILFromFIL(0),
 			s,
 			[]byte("params"))
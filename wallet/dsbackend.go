@@ -6,12 +6,14 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	ds "gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
 	dsq "gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore/query"
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 
 	"github.com/filecoin-project/go-filecoin/address"
+	bls "github.com/filecoin-project/go-filecoin/bls-signatures"
 	"github.com/filecoin-project/go-filecoin/crypto"
 	"github.com/filecoin-project/go-filecoin/repo"
 	"github.com/filecoin-project/go-filecoin/types"
@@ -21,6 +23,8 @@ import (
 const (
 	// SECP256K1 is a curve used to computer private keys
 	SECP256K1 = "secp256k1"
+	// BLS is the curve of BLS private keys
+	BLS = "bls"
 )
 
 // DSBackendType is the reflect type of the DSBackend.
@@ -30,11 +34,20 @@ var DSBackendType = reflect.TypeOf(&DSBackend{})
 type DSBackend struct {
 	lk sync.RWMutex
 
-	// TODO: use a better interface that supports time locks, encryption, etc.
 	ds repo.Datastore
 
 	// TODO: proper cache
 	cache map[address.Address]struct{}
+
+	// keystore is nil unless the keys are encrypted.
+	keystore *keystoreParams
+	// sealKey is the key derived from the passphrase while an encrypted
+	// backend is unlocked.
+	sealKey   []byte
+	lockTimer *time.Timer
+
+	// hd is nil unless new secp256k1 keys are derived from a seed.
+	hd *hdState
 }
 
 var _ Backend = (*DSBackend)(nil)
@@ -55,6 +68,9 @@ func NewDSBackend(ds repo.Datastore) (*DSBackend, error) {
 
 	cache := make(map[address.Address]struct{})
 	for _, el := range list {
+		if el.Key == keystoreKey.String() || el.Key == hdKey.String() {
+			continue
+		}
 		parsedAddr, err := address.NewFromString(strings.Trim(el.Key, "/"))
 		if err != nil {
 			return nil, errors.Wrapf(err, "trying to restore invalid address: %s", el.Key)
@@ -62,9 +78,20 @@ func NewDSBackend(ds repo.Datastore) (*DSBackend, error) {
 		cache[parsedAddr] = struct{}{}
 	}
 
+	keystore, err := loadKeystoreParams(ds)
+	if err != nil {
+		return nil, err
+	}
+	hd, err := loadHDState(ds)
+	if err != nil {
+		return nil, err
+	}
+
 	return &DSBackend{
-		ds:    ds,
-		cache: cache,
+		ds:       ds,
+		cache:    cache,
+		keystore: keystore,
+		hd:       hd,
 	}, nil
 }
 
@@ -98,15 +125,40 @@ func (backend *DSBackend) HasAddress(addr address.Address) bool {
 // NewAddress creates a new address and stores it.
 // Safe for concurrent access.
 func (backend *DSBackend) NewAddress() (address.Address, error) {
-	prv, err := crypto.GenerateKey()
-	if err != nil {
-		return address.Address{}, err
-	}
+	return backend.NewAddressWithCurve(SECP256K1)
+}
 
-	// TODO: maybe the above call should just return a keyinfo?
-	ki := &types.KeyInfo{
-		PrivateKey: crypto.ECDSAToBytes(prv),
-		Curve:      SECP256K1,
+// NewAddressWithCurve creates a new address of a key of the given curve and
+// stores it. secp256k1 keys are derived from the seed of the backend if it
+// has one.
+// Safe for concurrent access.
+func (backend *DSBackend) NewAddressWithCurve(curve string) (address.Address, error) {
+	var ki *types.KeyInfo
+	switch curve {
+	case SECP256K1:
+		// a seed is never removed once set
+		if backend.HasSeed() {
+			return backend.deriveAddress()
+		}
+
+		prv, err := crypto.GenerateKey()
+		if err != nil {
+			return address.Address{}, err
+		}
+
+		// TODO: maybe the above call should just return a keyinfo?
+		ki = &types.KeyInfo{
+			PrivateKey: crypto.ECDSAToBytes(prv),
+			Curve:      SECP256K1,
+		}
+	case BLS:
+		prv := bls.PrivateKeyGenerate()
+		ki = &types.KeyInfo{
+			PrivateKey: prv[:],
+			Curve:      BLS,
+		}
+	default:
+		return address.Address{}, fmt.Errorf("unknown key type %s", curve)
 	}
 
 	if err := backend.putKeyInfo(ki); err != nil {
@@ -130,6 +182,11 @@ func (backend *DSBackend) putKeyInfo(ki *types.KeyInfo) error {
 		return err
 	}
 
+	kib, err = backend.sealKeyInfo(a, kib)
+	if err != nil {
+		return err
+	}
+
 	if err := backend.ds.Put(ds.NewKey(a.String()), kib); err != nil {
 		return errors.Wrap(err, "failed to store new address")
 	}
@@ -145,12 +202,22 @@ func (backend *DSBackend) SignBytes(data []byte, addr address.Address) (types.Si
 		return nil, err
 	}
 
-	privateKey, _, err := keysFromInfo(ki)
-	if err != nil {
-		return nil, err
+	switch ki.Type() {
+	case SECP256K1:
+		privateKey, _, err := keysFromInfo(ki)
+		if err != nil {
+			return nil, err
+		}
+		return wutil.Sign(privateKey, data)
+	case BLS:
+		privateKey, err := blsKeyFromInfo(ki)
+		if err != nil {
+			return nil, err
+		}
+		return wutil.SignBLS(privateKey, data), nil
+	default:
+		return nil, fmt.Errorf("unknown key type %s", ki.Type())
 	}
-
-	return wutil.Sign(privateKey, data)
 }
 
 // Verify cryptographically verifies that 'sig' is the signed hash of 'data' with
@@ -160,16 +227,17 @@ func (backend *DSBackend) Verify(data []byte, pk []byte, sig types.Signature) (b
 }
 
 // GetKeyInfo will return the private & public keys associated with address `addr`
-// iff backend contains the addr.
+// iff backend contains the addr. It returns ErrLocked if the backend is
+// encrypted and locked.
 func (backend *DSBackend) GetKeyInfo(addr address.Address) (*types.KeyInfo, error) {
 	if !backend.HasAddress(addr) {
 		return nil, errors.New("backend does not contain address")
 	}
 
 	// kib is a cbor of types.KeyInfo
-	kib, err := backend.ds.Get(ds.NewKey(addr.String()))
+	kib, err := backend.readKeyInfo(addr)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to fetch private key from backend")
+		return nil, err
 	}
 
 	ki := &types.KeyInfo{}
@@ -193,3 +261,12 @@ func keysFromInfo(ki *types.KeyInfo) (*ecdsa.PrivateKey, *ecdsa.PublicKey, error
 
 	return prv, &prv.PublicKey, nil
 }
+
+func blsKeyFromInfo(ki *types.KeyInfo) (bls.PrivateKey, error) {
+	var prv bls.PrivateKey
+	if len(ki.Key()) != bls.PrivateKeyBytes {
+		return prv, errors.New("failed to unmarshal private key: invalid BLS private key length")
+	}
+	copy(prv[:], ki.Key())
+	return prv, nil
+}
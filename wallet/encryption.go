@@ -0,0 +1,395 @@
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"time"
+
+	ds "gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/crypto"
+)
+
+var (
+	// ErrLocked is returned when a private key of an encrypted backend is
+	// needed while the backend is locked.
+	ErrLocked = errors.New("wallet is locked")
+
+	// ErrNotEncrypted is returned when locking or unlocking a backend that
+	// stores its keys in the clear.
+	ErrNotEncrypted = errors.New("wallet is not encrypted")
+)
+
+// keystoreKey is the datastore key of the encryption parameters of an
+// encrypted backend. It is never a valid address.
+var keystoreKey = ds.NewKey("keystore")
+
+// checkData is the additional data of the value sealed into the encryption
+// parameters to check passphrases.
+var checkData = []byte("keystore")
+
+// scrypt parameters for new passphrases. They are stored with the keys so
+// they can be raised without breaking existing wallets.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	saltLen    = 32
+	sealKeyLen = 32
+)
+
+// keystoreParams are the parameters used to derive the sealing key from the
+// passphrase of an encrypted backend.
+type keystoreParams struct {
+	Salt []byte
+	N    int
+	R    int
+	P    int
+	// Check is an empty value sealed with the derived key; opening it
+	// verifies the passphrase.
+	Check []byte
+}
+
+// newKeystoreParams generates fresh parameters for passphrase and returns
+// them together with the derived sealing key.
+func newKeystoreParams(passphrase string) (*keystoreParams, []byte, error) {
+	if passphrase == "" {
+		return nil, nil, errors.New("passphrase must not be empty")
+	}
+
+	params := &keystoreParams{
+		Salt: make([]byte, saltLen),
+		N:    scryptN,
+		R:    scryptR,
+		P:    scryptP,
+	}
+	if _, err := rand.Read(params.Salt); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to generate salt")
+	}
+
+	key, err := crypto.Scrypt([]byte(passphrase), params.Salt, params.N, params.R, params.P, sealKeyLen)
+	if err != nil {
+		return nil, nil, err
+	}
+	params.Check, err = seal(key, checkData, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return params, key, nil
+}
+
+// deriveKey derives the sealing key from passphrase and checks it against the
+// parameters.
+func (params *keystoreParams) deriveKey(passphrase string) ([]byte, error) {
+	key, err := crypto.Scrypt([]byte(passphrase), params.Salt, params.N, params.R, params.P, sealKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := open(key, checkData, params.Check); err != nil {
+		return nil, errors.New("incorrect passphrase")
+	}
+	return key, nil
+}
+
+// seal encrypts and authenticates plaintext and authenticates data with
+// AES-256-GCM. The random nonce is prepended to the result.
+func seal(key, data, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to generate nonce")
+	}
+	return aead.Seal(nonce, nonce, plaintext, data), nil
+}
+
+// open reverses seal.
+func open(key, data, sealed []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed value is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, data)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsEncrypted returns true if the keys of this backend are encrypted.
+func (backend *DSBackend) IsEncrypted() bool {
+	backend.lk.RLock()
+	defer backend.lk.RUnlock()
+
+	return backend.keystore != nil
+}
+
+// IsLocked returns true if the keys of this backend are encrypted and can
+// not be used until it is unlocked.
+func (backend *DSBackend) IsLocked() bool {
+	backend.lk.RLock()
+	defer backend.lk.RUnlock()
+
+	return backend.keystore != nil && backend.sealKey == nil
+}
+
+// Encrypt encrypts all keys and the seed stored in the clear with a key
+// derived from passphrase, migrating the backend to the encrypted format. The
+// backend is locked afterwards.
+func (backend *DSBackend) Encrypt(passphrase string) error {
+	backend.lk.Lock()
+	defer backend.lk.Unlock()
+
+	if backend.keystore != nil {
+		return errors.New("wallet is already encrypted")
+	}
+
+	params, key, err := newKeystoreParams(passphrase)
+	if err != nil {
+		return err
+	}
+
+	batch, err := backend.ds.Batch()
+	if err != nil {
+		return err
+	}
+	for addr := range backend.cache {
+		kib, err := backend.ds.Get(ds.NewKey(addr.String()))
+		if err != nil {
+			return errors.Wrapf(err, "failed to fetch private key of %s", addr)
+		}
+		sealed, err := seal(key, addr.Bytes(), kib)
+		if err != nil {
+			return err
+		}
+		if err := batch.Put(ds.NewKey(addr.String()), sealed); err != nil {
+			return err
+		}
+	}
+	seedState, err := backend.resealSeed(batch, nil, key)
+	if err != nil {
+		return err
+	}
+	if err := putKeystoreParams(batch, params); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return errors.Wrap(err, "failed to store encrypted keys")
+	}
+
+	backend.keystore = params
+	if seedState != nil {
+		backend.hd = seedState
+	}
+	return nil
+}
+
+// Unlock makes the keys of an encrypted backend usable. The backend locks
+// itself again once timeout has passed. A zero timeout keeps it unlocked
+// until Lock is called.
+func (backend *DSBackend) Unlock(passphrase string, timeout time.Duration) error {
+	backend.lk.Lock()
+	defer backend.lk.Unlock()
+
+	if backend.keystore == nil {
+		return ErrNotEncrypted
+	}
+
+	key, err := backend.keystore.deriveKey(passphrase)
+	if err != nil {
+		return err
+	}
+
+	backend.lock()
+	backend.sealKey = key
+	if timeout > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(timeout, func() {
+			backend.lk.Lock()
+			defer backend.lk.Unlock()
+
+			// a later unlock replaced this timer
+			if backend.lockTimer == timer {
+				backend.lock()
+			}
+		})
+		backend.lockTimer = timer
+	}
+	return nil
+}
+
+// Lock forgets the sealing key of an encrypted backend so its keys can not
+// be used until it is unlocked again.
+func (backend *DSBackend) Lock() error {
+	backend.lk.Lock()
+	defer backend.lk.Unlock()
+
+	if backend.keystore == nil {
+		return ErrNotEncrypted
+	}
+	backend.lock()
+	return nil
+}
+
+// lock expects the lock to be held.
+func (backend *DSBackend) lock() {
+	if backend.lockTimer != nil {
+		backend.lockTimer.Stop()
+		backend.lockTimer = nil
+	}
+	zeroKey(backend.sealKey)
+	backend.sealKey = nil
+}
+
+// zeroKey overwrites a key so it does not linger in memory.
+func zeroKey(key []byte) {
+	for i := range key {
+		key[i] = 0
+	}
+}
+
+// ChangePassphrase re-encrypts all keys and the seed of an encrypted backend
+// with a key derived from newPassphrase. It does not change whether the
+// backend is locked.
+func (backend *DSBackend) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	backend.lk.Lock()
+	defer backend.lk.Unlock()
+
+	if backend.keystore == nil {
+		return ErrNotEncrypted
+	}
+
+	oldKey, err := backend.keystore.deriveKey(oldPassphrase)
+	if err != nil {
+		return err
+	}
+	defer zeroKey(oldKey)
+	params, newKey, err := newKeystoreParams(newPassphrase)
+	if err != nil {
+		return err
+	}
+
+	batch, err := backend.ds.Batch()
+	if err != nil {
+		return err
+	}
+	for addr := range backend.cache {
+		sealed, err := backend.ds.Get(ds.NewKey(addr.String()))
+		if err != nil {
+			return errors.Wrapf(err, "failed to fetch private key of %s", addr)
+		}
+		kib, err := open(oldKey, addr.Bytes(), sealed)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decrypt private key of %s", addr)
+		}
+		sealed, err = seal(newKey, addr.Bytes(), kib)
+		if err != nil {
+			return err
+		}
+		if err := batch.Put(ds.NewKey(addr.String()), sealed); err != nil {
+			return err
+		}
+	}
+	seedState, err := backend.resealSeed(batch, oldKey, newKey)
+	if err != nil {
+		return err
+	}
+	if err := putKeystoreParams(batch, params); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return errors.Wrap(err, "failed to store re-encrypted keys")
+	}
+
+	backend.keystore = params
+	if seedState != nil {
+		backend.hd = seedState
+	}
+	if backend.sealKey != nil {
+		zeroKey(backend.sealKey)
+		backend.sealKey = newKey
+	} else {
+		zeroKey(newKey)
+	}
+	return nil
+}
+
+func putKeystoreParams(batch ds.Batch, params *keystoreParams) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return batch.Put(keystoreKey, raw)
+}
+
+// loadKeystoreParams returns nil if the backend stores its keys in the
+// clear.
+func loadKeystoreParams(d ds.Datastore) (*keystoreParams, error) {
+	raw, err := d.Get(keystoreKey)
+	if err == ds.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read keystore parameters")
+	}
+
+	var params keystoreParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, errors.Wrap(err, "failed to decode keystore parameters")
+	}
+	return &params, nil
+}
+
+// sealKeyInfo encrypts the marshaled keyinfo of addr if the backend is
+// encrypted. It expects the lock to be held.
+func (backend *DSBackend) sealKeyInfo(addr address.Address, kib []byte) ([]byte, error) {
+	if backend.keystore == nil {
+		return kib, nil
+	}
+	if backend.sealKey == nil {
+		return nil, ErrLocked
+	}
+	return seal(backend.sealKey, addr.Bytes(), kib)
+}
+
+// readKeyInfo fetches the marshaled keyinfo of addr, decrypting it if the
+// backend is encrypted.
+func (backend *DSBackend) readKeyInfo(addr address.Address) ([]byte, error) {
+	backend.lk.RLock()
+	defer backend.lk.RUnlock()
+
+	if backend.keystore != nil && backend.sealKey == nil {
+		return nil, ErrLocked
+	}
+
+	raw, err := backend.ds.Get(ds.NewKey(addr.String()))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch private key from backend")
+	}
+	if backend.keystore == nil {
+		return raw, nil
+	}
+
+	kib, err := open(backend.sealKey, addr.Bytes(), raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt private key")
+	}
+	return kib, nil
+}
@@ -0,0 +1,135 @@
+package wallet
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+)
+
+func TestDSBackendEncryption(t *testing.T) {
+	t.Run("migrates plaintext keys and only uses them when unlocked", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		ds := datastore.NewMapDatastore()
+		defer ds.Close()
+
+		fs, err := NewDSBackend(ds)
+		require.NoError(err)
+		addr, err := fs.NewAddress()
+		require.NoError(err)
+		plain, err := ds.Get(datastore.NewKey(addr.String()))
+		require.NoError(err)
+		ki, err := fs.GetKeyInfo(addr)
+		require.NoError(err)
+		assert.False(fs.IsEncrypted())
+
+		require.NoError(fs.Encrypt("hunter2"))
+		assert.True(fs.IsEncrypted())
+		assert.True(fs.IsLocked())
+		assert.Error(fs.Encrypt("hunter2"))
+
+		t.Log("the private key is no longer stored in the clear")
+		sealed, err := ds.Get(datastore.NewKey(addr.String()))
+		require.NoError(err)
+		assert.False(bytes.Contains(sealed, ki.PrivateKey))
+		assert.NotEqual(plain, sealed)
+
+		t.Log("locked backends refuse to use keys")
+		_, err = fs.GetKeyInfo(addr)
+		assert.Equal(ErrLocked, err)
+		_, err = fs.SignBytes([]byte("data"), addr)
+		assert.Equal(ErrLocked, err)
+		_, err = fs.NewAddress()
+		assert.Equal(ErrLocked, err)
+
+		t.Log("the encryption persists and the backend loads locked")
+		fs2, err := NewDSBackend(ds)
+		require.NoError(err)
+		assert.Len(fs2.Addresses(), 1)
+		assert.True(fs2.IsLocked())
+
+		assert.Error(fs2.Unlock("hunter3", 0))
+		require.NoError(fs2.Unlock("hunter2", 0))
+		unlocked, err := fs2.GetKeyInfo(addr)
+		require.NoError(err)
+		assert.Equal(ki, unlocked)
+
+		t.Log("new keys are encrypted too")
+		addr2, err := fs2.NewAddress()
+		require.NoError(err)
+		_, err = fs2.SignBytes([]byte("data"), addr2)
+		assert.NoError(err)
+
+		require.NoError(fs2.Lock())
+		_, err = fs2.GetKeyInfo(addr2)
+		assert.Equal(ErrLocked, err)
+	})
+
+	t.Run("locks itself after the timeout", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		ds := datastore.NewMapDatastore()
+		defer ds.Close()
+
+		fs, err := NewDSBackend(ds)
+		require.NoError(err)
+		addr, err := fs.NewAddress()
+		require.NoError(err)
+		require.NoError(fs.Encrypt("hunter2"))
+
+		require.NoError(fs.Unlock("hunter2", 50*time.Millisecond))
+		_, err = fs.GetKeyInfo(addr)
+		assert.NoError(err)
+
+		time.Sleep(200 * time.Millisecond)
+		assert.True(fs.IsLocked())
+		_, err = fs.GetKeyInfo(addr)
+		assert.Equal(ErrLocked, err)
+	})
+
+	t.Run("changes the passphrase", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		ds := datastore.NewMapDatastore()
+		defer ds.Close()
+
+		fs, err := NewDSBackend(ds)
+		require.NoError(err)
+		addr, err := fs.NewAddress()
+		require.NoError(err)
+		require.NoError(fs.Encrypt("hunter2"))
+
+		assert.Error(fs.ChangePassphrase("hunter3", "correct horse"))
+		require.NoError(fs.ChangePassphrase("hunter2", "correct horse"))
+		assert.True(fs.IsLocked())
+
+		fs2, err := NewDSBackend(ds)
+		require.NoError(err)
+		assert.Error(fs2.Unlock("hunter2", 0))
+		require.NoError(fs2.Unlock("correct horse", 0))
+		_, err = fs2.GetKeyInfo(addr)
+		assert.NoError(err)
+	})
+
+	t.Run("rejects locking a plaintext backend", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		ds := datastore.NewMapDatastore()
+		defer ds.Close()
+
+		fs, err := NewDSBackend(ds)
+		require.NoError(err)
+		assert.Equal(ErrNotEncrypted, fs.Lock())
+		assert.Equal(ErrNotEncrypted, fs.Unlock("hunter2", 0))
+		assert.Error(fs.Encrypt(""))
+	})
+}
@@ -0,0 +1,294 @@
+package wallet
+
+import (
+	"encoding/json"
+
+	ds "gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+	"github.com/filecoin-project/go-filecoin/wallet/hd"
+)
+
+// ErrNoSeed is returned when deriving keys from a backend without a seed.
+var ErrNoSeed = errors.New("wallet has no seed")
+
+// hdKey is the datastore key of the seed of a backend. Like keystoreKey it is
+// never a valid address.
+var hdKey = ds.NewKey("hd")
+
+// seedData is the additional data of the sealed seed of an encrypted backend.
+var seedData = []byte("hd")
+
+// GapLimit is the number of consecutive unused addresses after which
+// RestoreSeed stops looking for used ones.
+const GapLimit = 20
+
+// hdState is the seed of a backend and the state of the derivation of its
+// keys.
+type hdState struct {
+	// Seed is sealed if the backend is encrypted.
+	Seed []byte
+	// Path is the derivation path of the parent of the derived keys.
+	Path string
+	// Next is the index of the next key to derive.
+	Next uint32
+}
+
+// HasSeed returns true if new secp256k1 keys of this backend are derived
+// from a seed.
+func (backend *DSBackend) HasSeed() bool {
+	backend.lk.RLock()
+	defer backend.lk.RUnlock()
+
+	return backend.hd != nil
+}
+
+// SetSeed makes the backend derive new secp256k1 keys from seed, starting
+// with the first child of hd.DefaultPath. Existing keys are kept, but are not
+// covered by backups of the seed, and neither are BLS keys.
+func (backend *DSBackend) SetSeed(seed []byte) error {
+	return backend.RestoreSeed(seed, func(address.Address) (bool, error) {
+		return false, nil
+	})
+}
+
+// RestoreSeed sets the seed of the backend like SetSeed and imports the keys
+// derived from it for which used returns true. Derivation stops once GapLimit
+// consecutive keys are unused, and new keys are derived after the last used
+// one.
+func (backend *DSBackend) RestoreSeed(seed []byte, used func(address.Address) (bool, error)) error {
+	if backend.HasSeed() {
+		return errors.New("wallet already has a seed")
+	}
+
+	parent, err := deriveParent(seed, hd.DefaultPath)
+	if err != nil {
+		return err
+	}
+
+	var found []*types.KeyInfo
+	var next, unused uint32
+	for index := uint32(0); unused < GapLimit; index++ {
+		ki, err := deriveKeyInfo(parent, index)
+		if err == hd.ErrInvalidKey {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		addr, err := ki.Address()
+		if err != nil {
+			return err
+		}
+
+		ok, err := used(addr)
+		if err != nil {
+			return errors.Wrapf(err, "failed to check whether %s is used", addr)
+		}
+		if !ok {
+			unused++
+			continue
+		}
+		found = append(found, ki)
+		next = index + 1
+		unused = 0
+	}
+
+	backend.lk.Lock()
+	defer backend.lk.Unlock()
+
+	if backend.hd != nil {
+		return errors.New("wallet already has a seed")
+	}
+
+	state := &hdState{
+		Seed: seed,
+		Path: hd.DefaultPath,
+		Next: next,
+	}
+	if backend.keystore != nil {
+		if backend.sealKey == nil {
+			return ErrLocked
+		}
+		if state.Seed, err = seal(backend.sealKey, seedData, seed); err != nil {
+			return err
+		}
+	}
+
+	batch, err := backend.ds.Batch()
+	if err != nil {
+		return err
+	}
+	var addrs []address.Address
+	for _, ki := range found {
+		addr, err := backend.putKeyInfoBatch(batch, ki)
+		if err != nil {
+			return err
+		}
+		addrs = append(addrs, addr)
+	}
+	if err := putHDState(batch, state); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return errors.Wrap(err, "failed to store seed")
+	}
+
+	for _, addr := range addrs {
+		backend.cache[addr] = struct{}{}
+	}
+	backend.hd = state
+	return nil
+}
+
+// deriveAddress derives the next key from the seed of the backend, stores it
+// and returns its address.
+func (backend *DSBackend) deriveAddress() (address.Address, error) {
+	backend.lk.Lock()
+	defer backend.lk.Unlock()
+
+	if backend.hd == nil {
+		return address.Address{}, ErrNoSeed
+	}
+
+	seed := backend.hd.Seed
+	if backend.keystore != nil {
+		if backend.sealKey == nil {
+			return address.Address{}, ErrLocked
+		}
+		var err error
+		if seed, err = open(backend.sealKey, seedData, seed); err != nil {
+			return address.Address{}, errors.Wrap(err, "failed to decrypt seed")
+		}
+	}
+
+	parent, err := deriveParent(seed, backend.hd.Path)
+	if err != nil {
+		return address.Address{}, err
+	}
+
+	index := backend.hd.Next
+	ki, err := deriveKeyInfo(parent, index)
+	for err == hd.ErrInvalidKey {
+		index++
+		ki, err = deriveKeyInfo(parent, index)
+	}
+	if err != nil {
+		return address.Address{}, err
+	}
+
+	state := *backend.hd
+	state.Next = index + 1
+
+	batch, err := backend.ds.Batch()
+	if err != nil {
+		return address.Address{}, err
+	}
+	addr, err := backend.putKeyInfoBatch(batch, ki)
+	if err != nil {
+		return address.Address{}, err
+	}
+	if err := putHDState(batch, &state); err != nil {
+		return address.Address{}, err
+	}
+	if err := batch.Commit(); err != nil {
+		return address.Address{}, errors.Wrap(err, "failed to store new address")
+	}
+
+	backend.cache[addr] = struct{}{}
+	backend.hd = &state
+	return addr, nil
+}
+
+// putKeyInfoBatch adds the sealed keyinfo to batch. It expects the lock to be
+// held.
+func (backend *DSBackend) putKeyInfoBatch(batch ds.Batch, ki *types.KeyInfo) (address.Address, error) {
+	addr, err := ki.Address()
+	if err != nil {
+		return address.Address{}, err
+	}
+	kib, err := ki.Marshal()
+	if err != nil {
+		return address.Address{}, err
+	}
+	kib, err = backend.sealKeyInfo(addr, kib)
+	if err != nil {
+		return address.Address{}, err
+	}
+	return addr, batch.Put(ds.NewKey(addr.String()), kib)
+}
+
+// resealSeed adds the seed sealed with newKey to batch and returns the new
+// state. oldKey is nil if the seed is stored in the clear. It returns nil if
+// the backend has no seed.
+func (backend *DSBackend) resealSeed(batch ds.Batch, oldKey, newKey []byte) (*hdState, error) {
+	if backend.hd == nil {
+		return nil, nil
+	}
+
+	seed := backend.hd.Seed
+	if oldKey != nil {
+		var err error
+		if seed, err = open(oldKey, seedData, seed); err != nil {
+			return nil, errors.Wrap(err, "failed to decrypt seed")
+		}
+	}
+
+	state := *backend.hd
+	sealed, err := seal(newKey, seedData, seed)
+	if err != nil {
+		return nil, err
+	}
+	state.Seed = sealed
+	return &state, putHDState(batch, &state)
+}
+
+func deriveParent(seed []byte, path string) (*hd.Key, error) {
+	indexes, err := hd.ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	master, err := hd.NewMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	return master.Derive(indexes)
+}
+
+func deriveKeyInfo(parent *hd.Key, index uint32) (*types.KeyInfo, error) {
+	child, err := parent.Child(index)
+	if err != nil {
+		return nil, err
+	}
+	return &types.KeyInfo{
+		PrivateKey: child.PrivateKey,
+		Curve:      SECP256K1,
+	}, nil
+}
+
+func putHDState(batch ds.Batch, state *hdState) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return batch.Put(hdKey, raw)
+}
+
+// loadHDState returns nil if the backend has no seed.
+func loadHDState(d ds.Datastore) (*hdState, error) {
+	raw, err := d.Get(hdKey)
+	if err == ds.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read seed")
+	}
+
+	var state hdState
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, errors.Wrap(err, "failed to decode seed")
+	}
+	return &state, nil
+}
@@ -0,0 +1,133 @@
+package hd
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/crypto"
+	cu "github.com/filecoin-project/go-filecoin/crypto/util"
+)
+
+// HardenedOffset is added to a child index to derive a hardened child, whose
+// key can not be derived from the public key of its parent.
+const HardenedOffset uint32 = 0x80000000
+
+// DefaultPath is the path of the parent of the keys derived for new
+// addresses. 461 is the SLIP-44 coin type of filecoin.
+const DefaultPath = "m/44'/461'/0'/0"
+
+// masterSecret is the HMAC key of the master key derivation of BIP-32.
+var masterSecret = []byte("Bitcoin seed")
+
+// ErrInvalidKey is returned in the unlikely event that a derivation step
+// produces an invalid secp256k1 key. BIP-32 says to proceed with the next
+// index.
+var ErrInvalidKey = errors.New("derived key is invalid")
+
+// Key is an extended secp256k1 private key from which child keys can be
+// derived as described in BIP-32.
+type Key struct {
+	// PrivateKey is the 32 byte big endian private key.
+	PrivateKey []byte
+	ChainCode  []byte
+}
+
+// NewMasterKey derives the master key of the tree of keys of seed.
+func NewMasterKey(seed []byte) (*Key, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, errors.New("seed must be between 16 and 64 bytes long")
+	}
+
+	mac := hmac.New(sha512.New, masterSecret)
+	mac.Write(seed) // nolint: errcheck
+	sum := mac.Sum(nil)
+
+	if _, err := crypto.BytesToECDSA(sum[:32]); err != nil {
+		return nil, ErrInvalidKey
+	}
+	return &Key{
+		PrivateKey: sum[:32],
+		ChainCode:  sum[32:],
+	}, nil
+}
+
+// Child derives the child key at index. Indexes from HardenedOffset on derive
+// hardened keys.
+func (k *Key) Child(index uint32) (*Key, error) {
+	prv, err := crypto.BytesToECDSA(k.PrivateKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid parent key")
+	}
+
+	mac := hmac.New(sha512.New, k.ChainCode)
+	if index >= HardenedOffset {
+		mac.Write([]byte{0})    // nolint: errcheck
+		mac.Write(k.PrivateKey) // nolint: errcheck
+	} else {
+		mac.Write(crypto.CompressPubkey(&prv.PublicKey)) // nolint: errcheck
+	}
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], index)
+	mac.Write(buf[:]) // nolint: errcheck
+	sum := mac.Sum(nil)
+
+	n := crypto.S256().Params().N
+	il := new(big.Int).SetBytes(sum[:32])
+	if il.Cmp(n) >= 0 {
+		return nil, ErrInvalidKey
+	}
+	d := il.Add(il, prv.D)
+	d.Mod(d, n)
+	if d.Sign() == 0 {
+		return nil, ErrInvalidKey
+	}
+
+	return &Key{
+		PrivateKey: cu.PaddedBigBytes(d, 32),
+		ChainCode:  sum[32:],
+	}, nil
+}
+
+// Derive derives the descendant of k at the given path of child indexes.
+func (k *Key) Derive(path []uint32) (*Key, error) {
+	key := k
+	for _, index := range path {
+		var err error
+		key, err = key.Child(index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// ParsePath parses a derivation path such as "m/44'/461'/0'/0" into child
+// indexes. A trailing ' or h marks a hardened index.
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("invalid derivation path %q: must start with m", path)
+	}
+
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		var offset uint32
+		if strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") {
+			offset = HardenedOffset
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(index) >= HardenedOffset {
+			return nil, fmt.Errorf("invalid derivation path %q: bad index %q", path, part)
+		}
+		indexes = append(indexes, uint32(index)+offset)
+	}
+	return indexes, nil
+}
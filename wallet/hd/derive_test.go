@@ -0,0 +1,58 @@
+package hd
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+)
+
+// Test vector 1 of BIP-32.
+func TestDeriveVector(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	seed, err := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	require.NoError(err)
+	master, err := NewMasterKey(seed)
+	require.NoError(err)
+	assert.Equal("e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35", hex.EncodeToString(master.PrivateKey))
+	assert.Equal("873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508", hex.EncodeToString(master.ChainCode))
+
+	cases := []struct {
+		path       string
+		privateKey string
+		chainCode  string
+	}{
+		{"m/0'", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea", "47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141"},
+		{"m/0'/1", "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368", "2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19"},
+		{"m/0h/1/2h", "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca", "04466b9cc8e161e966409ca52986c584f07e9dc81f735db683c3ff6ec7b1503f"},
+	}
+	for _, c := range cases {
+		path, err := ParsePath(c.path)
+		require.NoError(err)
+		key, err := master.Derive(path)
+		require.NoError(err)
+		assert.Equal(c.privateKey, hex.EncodeToString(key.PrivateKey), c.path)
+		assert.Equal(c.chainCode, hex.EncodeToString(key.ChainCode), c.path)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	path, err := ParsePath(DefaultPath)
+	require.NoError(err)
+	assert.Equal([]uint32{HardenedOffset + 44, HardenedOffset + 461, HardenedOffset, 0}, path)
+
+	path, err = ParsePath("m")
+	require.NoError(err)
+	assert.Empty(path)
+
+	for _, bad := range []string{"", "44'/0", "m/", "m/x", "m/-1", "m/2147483648"} {
+		_, err := ParsePath(bad)
+		assert.Error(err, bad)
+	}
+}
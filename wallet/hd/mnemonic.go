@@ -0,0 +1,111 @@
+package hd
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"math/big"
+	"strings"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/crypto"
+)
+
+// ErrInvalidMnemonic is returned for mnemonics that are not made of words of
+// the BIP-39 word list or whose checksum does not match.
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+// wordIndexes maps each word of the word list to its index.
+var wordIndexes = func() map[string]int {
+	indexes := make(map[string]int, len(wordlist))
+	for i, word := range wordlist {
+		indexes[word] = i
+	}
+	return indexes
+}()
+
+// NewMnemonic generates a BIP-39 mnemonic encoding entropyBits of random
+// entropy. entropyBits must be a multiple of 32 between 128 and 256; 256
+// bits give a 24 word mnemonic.
+func NewMnemonic(entropyBits int) (string, error) {
+	if entropyBits%32 != 0 || entropyBits < 128 || entropyBits > 256 {
+		return "", errors.New("entropy must be a multiple of 32 bits between 128 and 256")
+	}
+
+	entropy := make([]byte, entropyBits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", errors.Wrap(err, "failed to generate entropy")
+	}
+	return entropyToMnemonic(entropy), nil
+}
+
+// entropyToMnemonic appends the checksum to entropy and encodes every 11 bits
+// of the result as a word.
+func entropyToMnemonic(entropy []byte) string {
+	checksumBits := uint(len(entropy) * 8 / 32)
+	hash := sha256.Sum256(entropy)
+
+	data := new(big.Int).SetBytes(entropy)
+	data.Lsh(data, checksumBits)
+	data.Or(data, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	numWords := (len(entropy)*8 + int(checksumBits)) / 11
+	words := make([]string, numWords)
+	mask := big.NewInt(2047)
+	for i := numWords - 1; i >= 0; i-- {
+		words[i] = wordlist[new(big.Int).And(data, mask).Int64()]
+		data.Rsh(data, 11)
+	}
+	return strings.Join(words, " ")
+}
+
+// mnemonicToEntropy reverses entropyToMnemonic, checking the checksum.
+func mnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words)%3 != 0 || len(words) < 12 || len(words) > 24 {
+		return nil, ErrInvalidMnemonic
+	}
+
+	data := new(big.Int)
+	for _, word := range words {
+		index, ok := wordIndexes[word]
+		if !ok {
+			return nil, ErrInvalidMnemonic
+		}
+		data.Lsh(data, 11)
+		data.Or(data, big.NewInt(int64(index)))
+	}
+
+	checksumBits := uint(len(words) * 11 / 33)
+	checksum := new(big.Int).And(data, big.NewInt(int64(1)<<checksumBits-1))
+	data.Rsh(data, checksumBits)
+
+	entropy := make([]byte, len(words)*11*32/33/8)
+	raw := data.Bytes()
+	copy(entropy[len(entropy)-len(raw):], raw)
+
+	hash := sha256.Sum256(entropy)
+	if checksum.Int64() != int64(hash[0]>>(8-checksumBits)) {
+		return nil, ErrInvalidMnemonic
+	}
+	return entropy, nil
+}
+
+// ValidateMnemonic returns an error if mnemonic is not a valid BIP-39
+// mnemonic.
+func ValidateMnemonic(mnemonic string) error {
+	_, err := mnemonicToEntropy(mnemonic)
+	return err
+}
+
+// MnemonicToSeed checks mnemonic and returns the 64 byte BIP-39 seed derived
+// from it and the optional passphrase.
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+
+	normalized := strings.Join(strings.Fields(mnemonic), " ")
+	return crypto.PBKDF2([]byte(normalized), []byte("mnemonic"+passphrase), 2048, 64, sha512.New), nil
+}
@@ -0,0 +1,80 @@
+package hd
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+)
+
+// Test vectors from https://github.com/trezor/python-mnemonic/blob/master/vectors.json
+var mnemonicVectors = []struct {
+	entropy  string
+	mnemonic string
+	seed     string
+}{
+	{
+		"00000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+	},
+	{
+		"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		"legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth useful legal winner thank year wave sausage worth title",
+		"bc09fca1804f7e69da93c2f2028eb238c227f2e9dda30cd63699232578480a4021b146ad717fbb7e451ce9eb835f43620bf5c514db0f8add49f5d121449d3e87",
+	},
+}
+
+func TestMnemonicVectors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, v := range mnemonicVectors {
+		entropy, err := hex.DecodeString(v.entropy)
+		require.NoError(err)
+		assert.Equal(v.mnemonic, entropyToMnemonic(entropy))
+
+		decoded, err := mnemonicToEntropy(v.mnemonic)
+		require.NoError(err)
+		assert.Equal(entropy, decoded)
+
+		seed, err := MnemonicToSeed(v.mnemonic, "TREZOR")
+		require.NoError(err)
+		assert.Equal(v.seed, hex.EncodeToString(seed))
+	}
+}
+
+func TestNewMnemonic(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	mnemonic, err := NewMnemonic(256)
+	require.NoError(err)
+	assert.Len(strings.Fields(mnemonic), 24)
+	assert.NoError(ValidateMnemonic(mnemonic))
+
+	other, err := NewMnemonic(256)
+	require.NoError(err)
+	assert.NotEqual(mnemonic, other)
+
+	_, err = NewMnemonic(100)
+	assert.Error(err)
+}
+
+func TestValidateMnemonic(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Log("bad checksum")
+	assert.Equal(ErrInvalidMnemonic, ValidateMnemonic(strings.Repeat("abandon ", 12)))
+
+	t.Log("unknown word")
+	assert.Equal(ErrInvalidMnemonic, ValidateMnemonic(strings.Repeat("abandon ", 11)+"filecoin"))
+
+	t.Log("bad length")
+	assert.Equal(ErrInvalidMnemonic, ValidateMnemonic(strings.Repeat("abandon ", 10)+"about"))
+
+	t.Log("extra whitespace is ignored")
+	assert.NoError(ValidateMnemonic("  " + strings.Repeat("abandon  ", 11) + "about\n"))
+}
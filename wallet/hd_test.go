@@ -0,0 +1,140 @@
+package wallet
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+)
+
+var testSeed = bytes.Repeat([]byte{0x42}, 64)
+
+func TestDSBackendSeed(t *testing.T) {
+	t.Run("derives the same addresses from the same seed", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		ds := datastore.NewMapDatastore()
+		defer ds.Close()
+
+		fs, err := NewDSBackend(ds)
+		require.NoError(err)
+		assert.False(fs.HasSeed())
+		require.NoError(fs.SetSeed(testSeed))
+		assert.True(fs.HasSeed())
+		assert.Error(fs.SetSeed(testSeed))
+
+		a1, err := fs.NewAddress()
+		require.NoError(err)
+		a2, err := fs.NewAddress()
+		require.NoError(err)
+		assert.NotEqual(a1, a2)
+
+		t.Log("the next index survives a restart")
+		fs, err = NewDSBackend(ds)
+		require.NoError(err)
+		assert.True(fs.HasSeed())
+		assert.Len(fs.Addresses(), 2)
+		a3, err := fs.NewAddress()
+		require.NoError(err)
+
+		other, err := NewDSBackend(datastore.NewMapDatastore())
+		require.NoError(err)
+		require.NoError(other.SetSeed(testSeed))
+		for _, expected := range []address.Address{a1, a2, a3} {
+			addr, err := other.NewAddress()
+			require.NoError(err)
+			assert.Equal(expected, addr)
+		}
+
+		t.Log("BLS keys are not derived")
+		bls1, err := fs.NewAddressWithCurve(BLS)
+		require.NoError(err)
+		bls2, err := other.NewAddressWithCurve(BLS)
+		require.NoError(err)
+		assert.NotEqual(bls1, bls2)
+	})
+
+	t.Run("restores used addresses", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		source, err := NewDSBackend(datastore.NewMapDatastore())
+		require.NoError(err)
+		require.NoError(source.SetSeed(testSeed))
+		var derived []address.Address
+		for i := 0; i < 30; i++ {
+			addr, err := source.NewAddress()
+			require.NoError(err)
+			derived = append(derived, addr)
+		}
+
+		// the gap of GapLimit unused addresses after 3 hides 24
+		used := map[address.Address]bool{derived[0]: true, derived[3]: true, derived[4+GapLimit]: true}
+		var checked int
+		fs, err := NewDSBackend(datastore.NewMapDatastore())
+		require.NoError(err)
+		require.NoError(fs.RestoreSeed(testSeed, func(addr address.Address) (bool, error) {
+			checked++
+			return used[addr], nil
+		}))
+		assert.Equal(4+GapLimit, checked)
+		assert.Len(fs.Addresses(), 2)
+		assert.True(fs.HasAddress(derived[0]))
+		assert.True(fs.HasAddress(derived[3]))
+
+		next, err := fs.NewAddress()
+		require.NoError(err)
+		assert.Equal(derived[4], next)
+
+		ki, err := fs.GetKeyInfo(derived[3])
+		require.NoError(err)
+		expected, err := source.GetKeyInfo(derived[3])
+		require.NoError(err)
+		assert.Equal(expected, ki)
+	})
+
+	t.Run("encrypts the seed", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		ds := datastore.NewMapDatastore()
+		defer ds.Close()
+
+		fs, err := NewDSBackend(ds)
+		require.NoError(err)
+		require.NoError(fs.SetSeed(testSeed))
+		a1, err := fs.NewAddress()
+		require.NoError(err)
+
+		require.NoError(fs.Encrypt("hunter2"))
+		state, err := loadHDState(ds)
+		require.NoError(err)
+		assert.NotEqual(testSeed, state.Seed)
+
+		_, err = fs.NewAddress()
+		assert.Equal(ErrLocked, err)
+
+		require.NoError(fs.ChangePassphrase("hunter2", "correct horse"))
+		fs, err = NewDSBackend(ds)
+		require.NoError(err)
+		require.NoError(fs.Unlock("correct horse", time.Minute))
+		a2, err := fs.NewAddress()
+		require.NoError(err)
+
+		other, err := NewDSBackend(datastore.NewMapDatastore())
+		require.NoError(err)
+		require.NoError(other.SetSeed(testSeed))
+		for _, expected := range []address.Address{a1, a2} {
+			addr, err := other.NewAddress()
+			require.NoError(err)
+			assert.Equal(expected, addr)
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+	wutil "github.com/filecoin-project/go-filecoin/wallet/util"
+)
+
+// ErrRemoteKey is returned when asking a RemoteBackend for a private key,
+// which never leaves the remote signer.
+var ErrRemoteKey = errors.New("private key is held by the remote signer")
+
+// RemoteBackendType is the reflect type of the RemoteBackend.
+var RemoteBackendType = reflect.TypeOf(&RemoteBackend{})
+
+// Paths of the remote signer protocol. Requests and responses are JSON.
+const (
+	// RemoteAddressesPath lists the addresses of the signer in a
+	// RemoteAddressesResponse.
+	RemoteAddressesPath = "/addresses"
+	// RemoteSignPath signs the data of a RemoteSignRequest, responding with a
+	// RemoteSignResponse, or with 403 Forbidden if the signer refuses.
+	RemoteSignPath = "/sign"
+)
+
+// RemoteTokenScheme is the authorization scheme of the token a RemoteBackend
+// presents to the signer, which responds with 401 Unauthorized to requests
+// without it.
+const RemoteTokenScheme = "Bearer"
+
+// RemoteAddressesResponse is the response of a remote signer listing its
+// addresses.
+type RemoteAddressesResponse struct {
+	Addresses []address.Address `json:"addresses"`
+}
+
+// RemoteSignRequest asks a remote signer to sign Data with the key of
+// Address.
+type RemoteSignRequest struct {
+	Address address.Address `json:"address"`
+	Data    []byte          `json:"data"`
+}
+
+// RemoteSignResponse is the response of a remote signer to a
+// RemoteSignRequest.
+type RemoteSignResponse struct {
+	Signature types.Signature `json:"signature"`
+}
+
+// remoteTimeout bounds requests to the remote signer, which may involve an
+// operator approving them.
+const remoteTimeout = time.Minute
+
+// RemoteBackend is a wallet backend that forwards signing requests to a
+// separate signer process, so the private keys are never held by the node.
+type RemoteBackend struct {
+	lk sync.RWMutex
+
+	endpoint string
+	token    string
+	client   *http.Client
+
+	cache map[address.Address]struct{}
+}
+
+var _ Backend = (*RemoteBackend)(nil)
+
+// NewRemoteBackend constructs a backend for the signer at endpoint and
+// fetches its addresses. The endpoint is either an http:// URL or a
+// unix:// path of a socket. The token authenticates the node to the signer,
+// and is not sent if it is empty.
+func NewRemoteBackend(endpoint, token string) (*RemoteBackend, error) {
+	backend := &RemoteBackend{
+		token:  token,
+		client: &http.Client{Timeout: remoteTimeout},
+	}
+
+	switch {
+	case strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://"):
+		backend.endpoint = strings.TrimSuffix(endpoint, "/")
+	case strings.HasPrefix(endpoint, "unix://"):
+		socket := strings.TrimPrefix(endpoint, "unix://")
+		backend.endpoint = "http://unix"
+		backend.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+	default:
+		return nil, fmt.Errorf("invalid remote signer endpoint %q: must start with http:// or unix://", endpoint)
+	}
+
+	if err := backend.Refresh(); err != nil {
+		return nil, err
+	}
+	return backend, nil
+}
+
+// Refresh fetches the addresses of the remote signer again.
+func (backend *RemoteBackend) Refresh() error {
+	var res RemoteAddressesResponse
+	if err := backend.call(http.MethodGet, RemoteAddressesPath, nil, &res); err != nil {
+		return errors.Wrap(err, "failed to list addresses of remote signer")
+	}
+
+	cache := make(map[address.Address]struct{}, len(res.Addresses))
+	for _, addr := range res.Addresses {
+		cache[addr] = struct{}{}
+	}
+
+	backend.lk.Lock()
+	defer backend.lk.Unlock()
+	backend.cache = cache
+	return nil
+}
+
+// Addresses returns a list of all addresses of the remote signer.
+func (backend *RemoteBackend) Addresses() []address.Address {
+	backend.lk.RLock()
+	defer backend.lk.RUnlock()
+
+	var cpy []address.Address
+	for addr := range backend.cache {
+		cpy = append(cpy, addr)
+	}
+	return cpy
+}
+
+// HasAddress checks if the remote signer holds the key of the passed in
+// address.
+// Safe for concurrent access.
+func (backend *RemoteBackend) HasAddress(addr address.Address) bool {
+	backend.lk.RLock()
+	defer backend.lk.RUnlock()
+
+	_, ok := backend.cache[addr]
+	return ok
+}
+
+// SignBytes asks the remote signer to sign `data` with the private key of
+// `addr`. The signer may refuse according to its policy.
+func (backend *RemoteBackend) SignBytes(data []byte, addr address.Address) (types.Signature, error) {
+	if !backend.HasAddress(addr) {
+		return nil, errors.New("backend does not contain address")
+	}
+
+	var res RemoteSignResponse
+	if err := backend.call(http.MethodPost, RemoteSignPath, &RemoteSignRequest{Address: addr, Data: data}, &res); err != nil {
+		return nil, errors.Wrapf(err, "remote signer failed to sign with %s", addr)
+	}
+	return res.Signature, nil
+}
+
+// Verify cryptographically verifies that 'sig' is the signed hash of 'data' with
+// the public key `pk`.
+func (backend *RemoteBackend) Verify(data []byte, pk []byte, sig types.Signature) (bool, error) {
+	return wutil.Verify(pk, data, sig)
+}
+
+// GetKeyInfo always returns ErrRemoteKey.
+func (backend *RemoteBackend) GetKeyInfo(addr address.Address) (*types.KeyInfo, error) {
+	return nil, ErrRemoteKey
+}
+
+func (backend *RemoteBackend) call(method, path string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, backend.endpoint+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if backend.token != "" {
+		req.Header.Set("Authorization", RemoteTokenScheme+" "+backend.token)
+	}
+
+	res, err := backend.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close() // nolint: errcheck
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,148 @@
+package wallet
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gx/ipfs/QmUadX5EcvrBmxAV9sE7wUWtWSqxns5K84qKJBixmcT1w9/go-datastore"
+
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/assert"
+	"gx/ipfs/QmPVkJMTeRC6iBByPWdrRkD3BE5UXsj5HPzb4kPqL186mS/testify/require"
+
+	"github.com/filecoin-project/go-filecoin/address"
+	"github.com/filecoin-project/go-filecoin/types"
+)
+
+// signerHandler serves the remote signer protocol for the keys of signer,
+// refusing to sign data equal to refuse.
+func signerHandler(signer *DSBackend, refuse string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(RemoteAddressesPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&RemoteAddressesResponse{Addresses: signer.Addresses()}) // nolint: errcheck
+	})
+	mux.HandleFunc(RemoteSignPath, func(w http.ResponseWriter, r *http.Request) {
+		var req RemoteSignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if string(req.Data) == refuse {
+			http.Error(w, "not allowed", http.StatusForbidden)
+			return
+		}
+		sig, err := signer.SignBytes(req.Data, req.Address)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(&RemoteSignResponse{Signature: sig}) // nolint: errcheck
+	})
+	return mux
+}
+
+func TestRemoteBackend(t *testing.T) {
+	signer, err := NewDSBackend(datastore.NewMapDatastore())
+	require.NoError(t, err)
+	addr, err := signer.NewAddress()
+	require.NoError(t, err)
+	ki, err := signer.GetKeyInfo(addr)
+	require.NoError(t, err)
+	pk, err := ki.PublicKey()
+	require.NoError(t, err)
+
+	t.Run("signs over http", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		server := httptest.NewServer(signerHandler(signer, "forbidden"))
+		defer server.Close()
+
+		remote, err := NewRemoteBackend(server.URL, "")
+		require.NoError(err)
+		assert.Equal([]address.Address{addr}, remote.Addresses())
+
+		local, err := NewDSBackend(datastore.NewMapDatastore())
+		require.NoError(err)
+		w := New(local, remote)
+		assert.True(w.HasAddress(addr))
+
+		data := []byte("data")
+		sig, err := w.SignBytes(data, addr)
+		require.NoError(err)
+		assert.True(types.IsValidSignature(data, addr, sig))
+		valid, err := remote.Verify(data, pk, sig)
+		require.NoError(err)
+		assert.True(valid)
+
+		t.Log("refusals are reported")
+		_, err = w.SignBytes([]byte("forbidden"), addr)
+		require.Error(err)
+		assert.Contains(err.Error(), "not allowed")
+
+		t.Log("unknown addresses are not forwarded")
+		_, err = remote.SignBytes(data, address.NewForTestGetter()())
+		assert.Error(err)
+
+		t.Log("private keys are not available")
+		_, err = remote.GetKeyInfo(addr)
+		assert.Equal(ErrRemoteKey, err)
+	})
+
+	t.Run("signs over a unix socket", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		dir, err := ioutil.TempDir("", "remote-signer")
+		require.NoError(err)
+		defer os.RemoveAll(dir) // nolint: errcheck
+
+		socket := filepath.Join(dir, "signer.sock")
+		l, err := net.Listen("unix", socket)
+		require.NoError(err)
+		server := &http.Server{Handler: signerHandler(signer, "")}
+		go server.Serve(l)   // nolint: errcheck
+		defer server.Close() // nolint: errcheck
+
+		remote, err := NewRemoteBackend("unix://"+socket, "")
+		require.NoError(err)
+		assert.True(remote.HasAddress(addr))
+
+		data := []byte("data")
+		sig, err := remote.SignBytes(data, addr)
+		require.NoError(err)
+		assert.True(types.IsValidSignature(data, addr, sig))
+	})
+
+	t.Run("presents its token", func(t *testing.T) {
+		assert := assert.New(t)
+		require := require.New(t)
+
+		handler := signerHandler(signer, "")
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != RemoteTokenScheme+" secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			handler.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+
+		_, err := NewRemoteBackend(server.URL, "")
+		assert.Error(err)
+
+		remote, err := NewRemoteBackend(server.URL, "secret")
+		require.NoError(err)
+		assert.True(remote.HasAddress(addr))
+	})
+
+	t.Run("rejects invalid endpoints", func(t *testing.T) {
+		_, err := NewRemoteBackend("tcp://localhost:1234", "")
+		assert.Error(t, err)
+	})
+}
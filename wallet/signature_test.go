@@ -174,3 +174,80 @@ func TestSignedMessageCorrupted(t *testing.T) {
 	smsg.Message.Nonce = types.Uint64(uint64(42))
 	assert.False(smsg.VerifySignature())
 }
+
+/* Test BLS signatures */
+
+func requireBLSSignerAddr(require *require.Assertions) (*DSBackend, address.Address) {
+	fs, err := NewDSBackend(datastore.NewMapDatastore())
+	require.NoError(err)
+
+	addr, err := fs.NewAddressWithCurve(BLS)
+	require.NoError(err)
+	return fs, addr
+}
+
+// BLS keys have addresses of their own protocol and sign verifiably.
+func TestBLSSignatureOk(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, addr := requireBLSSignerAddr(require)
+	assert.Equal(address.BLS, addr.Protocol())
+
+	data := []byte("THESE BYTES WILL BE SIGNED")
+	sig, err := fs.SignBytes(data, addr)
+	require.NoError(err)
+	assert.True(types.IsValidSignature(data, addr, sig))
+
+	ki, err := fs.GetKeyInfo(addr)
+	require.NoError(err)
+	pk, err := ki.PublicKey()
+	require.NoError(err)
+	valid, err := fs.Verify(data, pk, sig)
+	require.NoError(err)
+	assert.True(valid)
+}
+
+// BLS signatures fail for other data, other addresses and corruption.
+func TestBLSSignatureInvalid(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, addr := requireBLSSignerAddr(require)
+
+	data := []byte("THESE BYTES ARE SIGNED")
+	sig, err := fs.SignBytes(data, addr)
+	require.NoError(err)
+
+	assert.False(types.IsValidSignature([]byte("THESE BYTEZ ARE SIGNED"), addr, sig))
+	assert.False(types.IsValidSignature(data, addr, nil))
+
+	otherAddr, err := fs.NewAddressWithCurve(BLS)
+	require.NoError(err)
+	assert.False(types.IsValidSignature(data, otherAddr, sig))
+
+	// a secp256k1 address with the same hash is a different account
+	secpAddr := address.NewMainnet(addr.Hash())
+	assert.False(types.IsValidSignature(data, secpAddr, sig))
+
+	corrupted := append([]byte{}, sig...)
+	corrupted[len(corrupted)-1] ^= 0xFF
+	assert.False(types.IsValidSignature(data, addr, corrupted))
+}
+
+// Messages from BLS addresses verify through SignedMessage.
+func TestBLSSignMessageOk(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	fs, addr := requireBLSSignerAddr(require)
+
+	msg := types.NewMessage(addr, addr, 1, nil, "", nil)
+	smsg, err := types.NewSignedMessage(*msg, fs, types.NewGasPrice(0), types.NewGasUnits(0))
+	require.NoError(err)
+
+	assert.True(smsg.VerifySignature())
+
+	smsg.Message.Nonce = 2
+	assert.False(smsg.VerifySignature())
+}
@@ -1,11 +1,13 @@
 package walletutil
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 
 	"gx/ipfs/QmVmDhyTTUcQXFD1rRQ64fGLMSAoaQvNH3hwuaCFAPq2hy/errors"
 	"gx/ipfs/QmZp3eKdYQHHAneECmeK6HhiMwTPufmjC8DuuaGKv3unvx/blake2b-simd"
 
+	bls "github.com/filecoin-project/go-filecoin/bls-signatures"
 	"github.com/filecoin-project/go-filecoin/crypto"
 )
 
@@ -22,8 +24,13 @@ func Sign(priv *ecdsa.PrivateKey, data []byte) ([]byte, error) {
 }
 
 // Verify cryptographically verifies that 'sig' is the signed hash of 'data' with
-// the public key `pk`.
+// the public key `pk`. BLS public keys are told apart from secp256k1 ones by
+// their length.
 func Verify(pk, data, signature []byte) (bool, error) {
+	if len(pk) == bls.PublicKeyBytes {
+		return VerifyBLS(pk, data, signature), nil
+	}
+
 	hash := blake2b.Sum256(data)
 	// remove recovery id
 	sig := signature[:len(signature)-1]
@@ -38,3 +45,75 @@ func Ecrecover(data, signature []byte) ([]byte, error) {
 	hash := blake2b.Sum256(data)
 	return crypto.Ecrecover(hash[:], signature)
 }
+
+// BLSSignatureBytes is the length of the signatures made by SignBLS.
+const BLSSignatureBytes = bls.PublicKeyBytes + bls.SignatureBytes
+
+// SignBLS cryptographically signs `data` using the BLS private key `priv`.
+// BLS public keys can not be recovered from signatures, so the public key is
+// prepended to the signature for verifiers that only know the address.
+func SignBLS(priv bls.PrivateKey, data []byte) []byte {
+	pub := bls.PrivateKeyPublicKey(priv)
+	sig := bls.PrivateKeySign(priv, data)
+	return append(pub[:], sig[:]...)
+}
+
+// BLSPublicKey returns the public key carried by a signature made by SignBLS.
+func BLSPublicKey(signature []byte) ([]byte, error) {
+	if len(signature) != BLSSignatureBytes {
+		return nil, errors.New("invalid BLS signature length")
+	}
+	return signature[:bls.PublicKeyBytes], nil
+}
+
+// VerifyBLS cryptographically verifies that 'signature' was made by SignBLS
+// over 'data' with the private key of the BLS public key `pk`.
+func VerifyBLS(pk, data, signature []byte) bool {
+	sigPk, err := BLSPublicKey(signature)
+	if err != nil || len(pk) != bls.PublicKeyBytes || !bytes.Equal(pk, sigPk) {
+		return false
+	}
+
+	var pub bls.PublicKey
+	copy(pub[:], pk)
+	var sig bls.Signature
+	copy(sig[:], signature[bls.PublicKeyBytes:])
+	return bls.Verify(sig, []bls.Digest{bls.Hash(data)}, []bls.PublicKey{pub})
+}
+
+// AggregateBLS aggregates signatures made by SignBLS into a single signature
+// that no longer carries the public keys.
+func AggregateBLS(signatures [][]byte) ([]byte, error) {
+	sigs := make([]bls.Signature, len(signatures))
+	for i, signature := range signatures {
+		if len(signature) != BLSSignatureBytes {
+			return nil, errors.New("invalid BLS signature length")
+		}
+		copy(sigs[i][:], signature[bls.PublicKeyBytes:])
+	}
+	aggregate := bls.Aggregate(sigs)
+	return aggregate[:], nil
+}
+
+// VerifyBLSAggregate cryptographically verifies that 'aggregate' is the
+// aggregate of the signatures of each of 'data' with the private key of the
+// BLS public key in `pks` at the same index.
+func VerifyBLSAggregate(pks, data [][]byte, aggregate []byte) bool {
+	if len(pks) != len(data) || len(aggregate) != bls.SignatureBytes {
+		return false
+	}
+
+	pubs := make([]bls.PublicKey, len(pks))
+	digests := make([]bls.Digest, len(data))
+	for i := range pks {
+		if len(pks[i]) != bls.PublicKeyBytes {
+			return false
+		}
+		copy(pubs[i][:], pks[i])
+		digests[i] = bls.Hash(data[i])
+	}
+
+	var sig bls.Signature
+	copy(sig[:], aggregate)
+	return bls.Verify(sig, digests, pubs)
+}
@@ -120,17 +120,36 @@ func (w *Wallet) Ecrecover(data []byte, sig types.Signature) ([]byte, error) {
 	return wutil.Ecrecover(data, sig)
 }
 
-// NewAddress creates a new account address on the default wallet backend.
-func NewAddress(w *Wallet) (address.Address, error) {
+// DefaultBackend returns the default wallet backend, which stores its keys in
+// the repo.
+func DefaultBackend(w *Wallet) (*DSBackend, error) {
 	backends := w.Backends(DSBackendType)
 	if len(backends) == 0 {
-		return address.Address{}, fmt.Errorf("missing default ds backend")
+		return nil, fmt.Errorf("missing default ds backend")
 	}
 
-	backend := (backends[0]).(*DSBackend)
+	return (backends[0]).(*DSBackend), nil
+}
+
+// NewAddress creates a new account address on the default wallet backend.
+func NewAddress(w *Wallet) (address.Address, error) {
+	backend, err := DefaultBackend(w)
+	if err != nil {
+		return address.Address{}, err
+	}
 	return backend.NewAddress()
 }
 
+// NewAddressWithCurve creates a new account address of a key of the given
+// curve on the default wallet backend.
+func NewAddressWithCurve(w *Wallet, curve string) (address.Address, error) {
+	backend, err := DefaultBackend(w)
+	if err != nil {
+		return address.Address{}, err
+	}
+	return backend.NewAddressWithCurve(curve)
+}
+
 // GetPubKeyForAddress returns the public key in the keystore associated with
 // the given address.
 func (w *Wallet) GetPubKeyForAddress(addr address.Address) ([]byte, error) {